@@ -0,0 +1,51 @@
+/*
+Copyright 2023 Thomas Stadler <thomas@thomasst.xyz>.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+//+kubebuilder:object:root=true
+//+kubebuilder:subresource:status
+//+kubebuilder:resource:scope=Cluster
+
+// ClusterEnvironment is the Schema for the clusterenvironments API.
+// It is the cluster-scoped variant of Environment, which Promotions of
+// all namespaces can promote from. Promoting to it requires a ReferenceGrant
+// in the cluster resource namespace of the operator, where the Secret of
+// its SecretRef is looked up as well.
+type ClusterEnvironment struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   EnvironmentSpec   `json:"spec,omitempty"`
+	Status EnvironmentStatus `json:"status,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+
+// ClusterEnvironmentList contains a list of ClusterEnvironment
+type ClusterEnvironmentList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []ClusterEnvironment `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&ClusterEnvironment{}, &ClusterEnvironmentList{})
+}
@@ -0,0 +1,68 @@
+/*
+Copyright 2023 Thomas Stadler <thomas@thomasst.xyz>.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+)
+
+// SetupWebhookWithManager registers the webhooks of ClusterEnvironment with the manager.
+func (r *ClusterEnvironment) SetupWebhookWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewWebhookManagedBy(mgr).
+		For(r).
+		Complete()
+}
+
+//+kubebuilder:webhook:path=/mutate-api-release-promotion-operator-io-v1alpha1-clusterenvironment,mutating=true,failurePolicy=fail,sideEffects=None,groups=api.release-promotion-operator.io,resources=clusterenvironments,verbs=create;update,versions=v1alpha1,name=mclusterenvironment.kb.io,admissionReviewVersions=v1
+
+var _ webhook.Defaulter = &ClusterEnvironment{}
+
+// Default implements webhook.Defaulter so a webhook will be registered for the type
+func (r *ClusterEnvironment) Default() {
+	r.Spec.setDefaults()
+}
+
+//+kubebuilder:webhook:path=/validate-api-release-promotion-operator-io-v1alpha1-clusterenvironment,mutating=false,failurePolicy=fail,sideEffects=None,groups=api.release-promotion-operator.io,resources=clusterenvironments,verbs=create;update,versions=v1alpha1,name=vclusterenvironment.kb.io,admissionReviewVersions=v1
+
+var _ webhook.Validator = &ClusterEnvironment{}
+
+// ValidateCreate implements webhook.Validator so a webhook will be registered for the type
+func (r *ClusterEnvironment) ValidateCreate() error {
+	return r.validate()
+}
+
+// ValidateUpdate implements webhook.Validator so a webhook will be registered for the type
+func (r *ClusterEnvironment) ValidateUpdate(old runtime.Object) error {
+	return r.validate()
+}
+
+// ValidateDelete implements webhook.Validator so a webhook will be registered for the type
+func (r *ClusterEnvironment) ValidateDelete() error {
+	return nil
+}
+
+func (r *ClusterEnvironment) validate() error {
+	allErrs := r.Spec.validate(field.NewPath("spec"))
+	if len(allErrs) == 0 {
+		return nil
+	}
+	return apierrors.NewInvalid(GroupVersion.WithKind(ClusterEnvironmentKind).GroupKind(), r.Name, allErrs)
+}
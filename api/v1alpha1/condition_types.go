@@ -0,0 +1,75 @@
+/*
+Copyright 2023 Thomas Stadler <thomas@thomasst.xyz>.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+// Condition types of a Promotion.
+// Reconciling and Stalled follow the kstatus conventions, see
+// https://github.com/kubernetes-sigs/cli-utils/tree/master/pkg/kstatus
+const (
+	// ReadyCondition indicates the Promotion is up to date with its source environment.
+	ReadyCondition string = "Ready"
+
+	// ReconcilingCondition indicates the Promotion is waiting for or working towards its desired state,
+	// including the retries of transient errors, e.g. failures to clone or push.
+	ReconcilingCondition string = "Reconciling"
+
+	// StalledCondition indicates the Promotion failed with an error which retrying cannot resolve,
+	// e.g. a denied reference, an invalid spec or a policy violation, and requires a change to progress.
+	StalledCondition string = "Stalled"
+)
+
+// Condition reasons of a Promotion.
+const (
+	// ReadinessChecksFailedReason signals the dependent objects could not be checked for readiness.
+	ReadinessChecksFailedReason string = "ReadinessChecksFailed"
+
+	// DependencyNotReadyReason signals that at least one dependent object is not ready.
+	DependencyNotReadyReason string = "DependencyNotReady"
+
+	// ClusterUnreachableReason signals that the remote cluster of a readiness check cannot be reached.
+	ClusterUnreachableReason string = "ClusterUnreachable"
+
+	// ReferenceNotGrantedReason signals that a reference to an object in another
+	// namespace is not permitted by a ReferenceGrant in that namespace.
+	ReferenceNotGrantedReason string = "ReferenceNotGranted"
+
+	// SourceVerificationFailedReason signals that the signature of the
+	// source revision could not be verified with the trusted keys.
+	SourceVerificationFailedReason string = "SourceVerificationFailed"
+
+	// VersionPolicyViolatedReason signals that the version of the source
+	// revision violates the version policy of the destination environment.
+	VersionPolicyViolatedReason string = "VersionPolicyViolated"
+
+	// WaitingForTriggerReason signals that the Trigger of the Promotion is not due.
+	WaitingForTriggerReason string = "WaitingForTrigger"
+
+	// WaitingForApprovalReason signals that the source revision has not been approved yet.
+	WaitingForApprovalReason string = "WaitingForApproval"
+
+	// DryRunSucceededReason signals the dry run has been rendered.
+	DryRunSucceededReason string = "DryRunSucceeded"
+
+	// DryRunFailedReason signals the dry run could not be rendered.
+	DryRunFailedReason string = "DryRunFailed"
+
+	// PromotionSucceededReason signals the source revision has been promoted.
+	PromotionSucceededReason string = "PromotionSucceeded"
+
+	// PromotionFailedReason signals the promotion of the source revision failed.
+	PromotionFailedReason string = "PromotionFailed"
+)
@@ -17,19 +17,303 @@ limitations under the License.
 package v1alpha1
 
 import (
+	"fmt"
+	"net/url"
+	"strings"
+
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
 // EnvironmentSpec defines the desired state of Environment
 type EnvironmentSpec struct {
 	// Source specifies the source Git Repository.
-	// +required
-	Source *SourceSpec `json:"source"`
+	// Exactly one of Source, SourceRef, OCI and Image must be set.
+	// +optional
+	Source *SourceSpec `json:"source,omitempty"`
+
+	// SourceRef references a Flux source object whose artifact holds the
+	// files of the environment, instead of cloning a Git repository.
+	// Environments with a SourceRef can only be promoted from.
+	// +optional
+	SourceRef *ArtifactSourceReference `json:"sourceRef,omitempty"`
+
+	// OCI specifies the tag of an OCI repository holding the artifact of the
+	// environment. Environments with an OCI repository are promoted by copying
+	// the artifact from the tag of the source environment to their tag, and can
+	// only be promoted to and from other environments with an OCI repository.
+	// +optional
+	OCI *OCIRepositorySpec `json:"oci,omitempty"`
+
+	// Image specifies an image repository whose tags are promoted instead of
+	// files. The revision of the environment is the tag selected by the policy,
+	// which the image operations of the PromotionTemplate write into the
+	// destination environment. Environments with an image repository can
+	// only be promoted from.
+	// +optional
+	Image *ImageRepositorySpec `json:"image,omitempty"`
 
 	// Path to the directory which represents the environment.
-	// Defaults to 'None', which translates to the root path of the Source.
+	// Defaults to './', which translates to the root path of the Source.
 	// +optional
 	Path string `json:"path,omitempty"`
+
+	// SigningKey specifies the key the commits promoted
+	// to this environment are signed with.
+	// +optional
+	SigningKey *SigningKey `json:"signingKey,omitempty"`
+
+	// Verify specifies the keys the commits of this environment must be
+	// signed with to be promoted to other environments.
+	// +optional
+	Verify *VerificationPolicy `json:"verify,omitempty"`
+
+	// Decryption specifies the keys to decrypt the SOPS-encrypted files
+	// of this environment with, when they are re-encrypted for another environment.
+	// +optional
+	Decryption *Decryption `json:"decryption,omitempty"`
+
+	// Provider specifies the Git hosting service of the Source. If set,
+	// promotions of this environment's commits are reported to it as
+	// commit statuses and deployments. Promotions to this environment with
+	// the pull-request strategy require it to open the pull requests.
+	// +optional
+	Provider *GitProvider `json:"provider,omitempty"`
+
+	// Charts constrains the versions of the Helm charts promoted to this
+	// environment by the chart operations of PromotionTemplates.
+	// +optional
+	Charts []ChartConstraint `json:"charts,omitempty"`
+
+	// VersionPolicy constrains the versions promoted to this environment.
+	// Promotions of versions violating the policy are blocked.
+	// +optional
+	VersionPolicy *VersionPolicy `json:"versionPolicy,omitempty"`
+}
+
+// VersionPolicy constrains the versions promoted to an environment,
+// which are extracted from the source environment of a promotion.
+type VersionPolicy struct {
+	// Source specifies where the version is extracted from.
+	// +optional
+	Source VersionSource `json:"source,omitempty"`
+
+	// SemVer is a range of semantic versions, e.g. '>=1.0.0 <2.0.0',
+	// the promoted versions must be in.
+	// +optional
+	SemVer string `json:"semver,omitempty"`
+
+	// NoDowngrade rejects versions lower than the version
+	// last promoted to the environment by any Promotion.
+	// +optional
+	NoDowngrade bool `json:"noDowngrade,omitempty"`
+
+	// PreReleases allows promoting pre-release versions, e.g. '2.0.0-rc.1'.
+	// +optional
+	PreReleases bool `json:"preReleases,omitempty"`
+}
+
+// VersionSource specifies where the version of a source environment is extracted from.
+// Without a file, the version is the tag of the source revision: the tag selected from
+// an image repository, or the tag of an OCI artifact or Flux source artifact revision,
+// e.g. 'v1.2.0' of 'v1.2.0@sha1:3f786850'.
+type VersionSource struct {
+	// File is the file in the source environment holding the version.
+	// +optional
+	File string `json:"file,omitempty"`
+
+	// Chart is the name of the Helm chart whose version is read from File,
+	// which is a Flux HelmRelease, a Chart.yaml or an Argo CD Application.
+	// Without a chart, the content of the file is the version.
+	// +optional
+	Chart string `json:"chart,omitempty"`
+
+	// Pattern is a regular expression the version is extracted with,
+	// either its first capture group or the whole match.
+	// +optional
+	Pattern string `json:"pattern,omitempty"`
+}
+
+// ChartConstraint constrains the versions of a Helm chart.
+type ChartConstraint struct {
+	// Name of the chart.
+	// +required
+	Name string `json:"name"`
+
+	// Version is a range of semantic versions, e.g. '>=1.0.0 <2.0.0',
+	// the promoted versions of the chart must be in.
+	// +required
+	Version string `json:"version"`
+}
+
+// SigningKey references a Secret with the private key to sign commits with.
+type SigningKey struct {
+	// SecretRef specifies the Secret containing either an ASCII-armored
+	// OpenPGP private key in the 'git.asc' field, or an SSH private key
+	// in the 'identity' field. An encrypted private key is decrypted
+	// with the optional 'passphrase' field.
+	// +required
+	SecretRef LocalObjectReference `json:"secretRef"`
+}
+
+// VerificationPolicy references a Secret with the public keys trusted to sign commits.
+type VerificationPolicy struct {
+	// SecretRef specifies the Secret containing ASCII-armored OpenPGP public
+	// keys in the 'git.asc' field, an SSH allowed signers file in the
+	// 'allowed_signers' field, or both. For environments with an OCI repository,
+	// it contains PEM-encoded cosign public keys in fields with the '.pub' suffix.
+	// +required
+	SecretRef LocalObjectReference `json:"secretRef"`
+}
+
+// Decryption references a Secret with the keys of SOPS-encrypted files.
+type Decryption struct {
+	// SecretRef specifies the Secret containing age identities in fields
+	// with the '.agekey' suffix, and unencrypted ASCII-armored OpenPGP keys
+	// in fields with the '.asc' suffix. The OpenPGP keys are also used to
+	// encrypt files for the OpenPGP recipients of this environment.
+	// +required
+	SecretRef LocalObjectReference `json:"secretRef"`
+}
+
+// GitProviderType is a Git hosting service.
+// +kubebuilder:validation:Enum=github;gitlab
+type GitProviderType string
+
+const (
+	// GitHubProvider reports to the REST API of GitHub or GitHub Enterprise Server.
+	GitHubProvider GitProviderType = "github"
+	// GitLabProvider reports to the REST API of GitLab.
+	GitLabProvider GitProviderType = "gitlab"
+)
+
+// GitProvider specifies the Git hosting service promotions are reported to.
+type GitProvider struct {
+	// Type of the Git hosting service.
+	// +required
+	Type GitProviderType `json:"type"`
+
+	// APIURL is the base URL of the REST API, defaults to
+	// 'https://api.github.com' or 'https://gitlab.com/api/v4'.
+	// +kubebuilder:validation:Pattern="^https?://.*$"
+	// +optional
+	APIURL string `json:"apiURL,omitempty"`
+
+	// Repository is the 'owner/name' of the GitHub repository or the path of
+	// the GitLab project, defaults to the path of the Source URL.
+	// +optional
+	Repository string `json:"repository,omitempty"`
+
+	// SecretRef specifies the Secret containing an API token in the 'token' field.
+	// +required
+	SecretRef LocalObjectReference `json:"secretRef"`
+}
+
+// GetRepository returns the Repository, falling back to the path
+// of the source URL without the '.git' suffix.
+func (in *GitProvider) GetRepository(sourceURL string) (string, error) {
+	if in.Repository != "" {
+		return in.Repository, nil
+	}
+	u, err := url.Parse(sourceURL)
+	if err != nil {
+		return "", err
+	}
+	repository := strings.TrimSuffix(strings.Trim(u.Path, "/"), ".git")
+	if !strings.Contains(repository, "/") {
+		return "", fmt.Errorf("cannot determine the repository from the URL %q", sourceURL)
+	}
+	return repository, nil
+}
+
+// ArtifactSourceReference references a Flux source object in the namespace of the Environment.
+// The revision and the artifact tarball are read from the status of the source object.
+type ArtifactSourceReference struct {
+	// APIVersion of the source object, defaults to 'source.toolkit.fluxcd.io/v1beta2'.
+	// +optional
+	APIVersion string `json:"apiVersion,omitempty"`
+
+	// Kind of the source object.
+	// +kubebuilder:validation:Enum=GitRepository;OCIRepository;Bucket
+	// +required
+	Kind string `json:"kind"`
+
+	// Name of the source object.
+	// +required
+	Name string `json:"name"`
+}
+
+// SourceGroup is the API group of the Flux source objects.
+const SourceGroup = "source.toolkit.fluxcd.io"
+
+// DefaultSourceAPIVersion is the API version used if ArtifactSourceReference.APIVersion is empty.
+const DefaultSourceAPIVersion = "source.toolkit.fluxcd.io/v1beta2"
+
+// GetAPIVersion returns the API version of the source object, falling back to DefaultSourceAPIVersion.
+func (in *ArtifactSourceReference) GetAPIVersion() string {
+	if in.APIVersion == "" {
+		return DefaultSourceAPIVersion
+	}
+	return in.APIVersion
+}
+
+// OCIRepositorySpec specifies the tag of an OCI repository.
+type OCIRepositorySpec struct {
+	// URL specifies the OCI repository, e.g. 'oci://ghcr.io/org/manifests'.
+	// +kubebuilder:validation:Pattern="^oci://.*$"
+	// +required
+	URL string `json:"url"`
+
+	// Tag of the artifact, defaults to 'latest'.
+	// +optional
+	Tag string `json:"tag,omitempty"`
+
+	// SecretRef specifies the Secret containing the credentials for the
+	// registry in the '.dockerconfigjson' field.
+	// +optional
+	SecretRef *LocalObjectReference `json:"secretRef,omitempty"`
+
+	// Insecure allows connecting to the registry over plain HTTP.
+	// +optional
+	Insecure bool `json:"insecure,omitempty"`
+}
+
+// ImageRepositorySpec specifies an image repository and the policy selecting its latest tag.
+type ImageRepositorySpec struct {
+	// Repository is the image repository, e.g. 'ghcr.io/acme/podinfo'.
+	// +required
+	Repository string `json:"repository"`
+
+	// Policy selects the tag to promote from the tags of the repository.
+	// +optional
+	Policy ImagePolicy `json:"policy,omitempty"`
+
+	// SecretRef specifies the Secret containing the credentials for the
+	// registry in the '.dockerconfigjson' field.
+	// +optional
+	SecretRef *LocalObjectReference `json:"secretRef,omitempty"`
+
+	// Insecure allows connecting to the registry over plain HTTP.
+	// +optional
+	Insecure bool `json:"insecure,omitempty"`
+}
+
+// ImagePolicy selects the latest tag of an image repository.
+type ImagePolicy struct {
+	// Pattern is a regular expression the tags must match.
+	// +optional
+	Pattern string `json:"pattern,omitempty"`
+
+	// Extract is the value the tags are ordered by, expanded from the
+	// capture groups of Pattern, e.g. '$version'. Defaults to the whole tag.
+	// +optional
+	Extract string `json:"extract,omitempty"`
+
+	// SemVer is a range of semantic versions, e.g. '>=1.0.0 <2.0.0', of
+	// which the highest version is selected. Pre-releases are only selected
+	// if the range contains one. If unset, the last tag in alphabetical
+	// order is selected.
+	// +optional
+	SemVer string `json:"semver,omitempty"`
 }
 
 // SourceSpec includes the Git reference of the source Git Repository.
@@ -43,6 +327,15 @@ type SourceSpec struct {
 	// changes, defaults to the 'master' branch.
 	// +optional
 	Reference *GitRepositoryRef `json:"ref,omitempty"`
+
+	// SecretRef specifies the Secret containing authentication credentials for
+	// the Git repository.
+	// For HTTPS repositories the Secret must contain 'username' and 'password'
+	// fields.
+	// For SSH repositories the Secret must contain 'identity'
+	// and 'known_hosts' fields.
+	// +optional
+	SecretRef *LocalObjectReference `json:"secretRef,omitempty"`
 }
 
 // GitRepositoryRef specifies the Git reference to resolve and checkout.
@@ -52,14 +345,44 @@ type GitRepositoryRef struct {
 	Branch string `json:"branch,omitempty"`
 }
 
+// DefaultBranch is the branch used if SourceSpec.Reference does not specify one.
+const DefaultBranch = "master"
+
+// DefaultPath is the path used if EnvironmentSpec.Path is empty.
+const DefaultPath = "./"
+
+// DefaultTag is the tag used if OCIRepositorySpec.Tag is empty.
+const DefaultTag = "latest"
+
+// GetTag returns the tag of the artifact, falling back to DefaultTag.
+func (in *OCIRepositorySpec) GetTag() string {
+	if in.Tag == "" {
+		return DefaultTag
+	}
+	return in.Tag
+}
+
+// GetBranch returns the branch to check out, falling back to DefaultBranch.
+func (in *SourceSpec) GetBranch() string {
+	if in.Reference != nil && in.Reference.Branch != "" {
+		return in.Reference.Branch
+	}
+	return DefaultBranch
+}
+
 // EnvironmentStatus defines the observed state of Environment
 type EnvironmentStatus struct {
-	// INSERT ADDITIONAL STATUS FIELD - define observed state of cluster
-	// Important: Run "make" to regenerate code after modifying this file
+	// LastPromotedVersion is the version last promoted to the environment,
+	// if it has a version policy. With the pull-request strategy, it is
+	// recorded once the pull request has been merged. Promotions to the
+	// environment are checked against it if the policy rejects downgrades.
+	// +optional
+	LastPromotedVersion string `json:"lastPromotedVersion,omitempty"`
 }
 
 //+kubebuilder:object:root=true
 //+kubebuilder:subresource:status
+//+kubebuilder:storageversion
 
 // Environment is the Schema for the environments API
 type Environment struct {
@@ -0,0 +1,288 @@
+/*
+Copyright 2023 Thomas Stadler <thomas@thomasst.xyz>.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/blang/semver"
+	"github.com/google/go-containerregistry/pkg/name"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+)
+
+// SetupWebhookWithManager registers the webhooks of Environment with the manager.
+func (r *Environment) SetupWebhookWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewWebhookManagedBy(mgr).
+		For(r).
+		Complete()
+}
+
+//+kubebuilder:webhook:path=/mutate-api-release-promotion-operator-io-v1alpha1-environment,mutating=true,failurePolicy=fail,sideEffects=None,groups=api.release-promotion-operator.io,resources=environments,verbs=create;update,versions=v1alpha1,name=menvironment.kb.io,admissionReviewVersions=v1
+
+var _ webhook.Defaulter = &Environment{}
+
+// Default implements webhook.Defaulter so a webhook will be registered for the type
+func (r *Environment) Default() {
+	r.Spec.setDefaults()
+}
+
+//+kubebuilder:webhook:path=/validate-api-release-promotion-operator-io-v1alpha1-environment,mutating=false,failurePolicy=fail,sideEffects=None,groups=api.release-promotion-operator.io,resources=environments,verbs=create;update,versions=v1alpha1,name=venvironment.kb.io,admissionReviewVersions=v1
+
+var _ webhook.Validator = &Environment{}
+
+// ValidateCreate implements webhook.Validator so a webhook will be registered for the type
+func (r *Environment) ValidateCreate() error {
+	return r.validate()
+}
+
+// ValidateUpdate implements webhook.Validator so a webhook will be registered for the type
+func (r *Environment) ValidateUpdate(old runtime.Object) error {
+	return r.validate()
+}
+
+// ValidateDelete implements webhook.Validator so a webhook will be registered for the type
+func (r *Environment) ValidateDelete() error {
+	return nil
+}
+
+func (r *Environment) validate() error {
+	allErrs := r.Spec.validate(field.NewPath("spec"))
+	if len(allErrs) == 0 {
+		return nil
+	}
+	return apierrors.NewInvalid(GroupVersion.WithKind(EnvironmentKind).GroupKind(), r.Name, allErrs)
+}
+
+// setDefaults defaults the path and the branch of the EnvironmentSpec.
+func (in *EnvironmentSpec) setDefaults() {
+	if in.Path == "" {
+		in.Path = DefaultPath
+	}
+	if in.OCI != nil && in.OCI.Tag == "" {
+		in.OCI.Tag = DefaultTag
+	}
+	if in.Source == nil {
+		return
+	}
+	if in.Source.Reference == nil {
+		in.Source.Reference = &GitRepositoryRef{}
+	}
+	if in.Source.Reference.Branch == "" {
+		in.Source.Reference.Branch = DefaultBranch
+	}
+}
+
+func (in *EnvironmentSpec) validate(specPath *field.Path) field.ErrorList {
+	var allErrs field.ErrorList
+
+	sources := 0
+	for _, set := range []bool{in.Source != nil, in.SourceRef != nil, in.OCI != nil, in.Image != nil} {
+		if set {
+			sources++
+		}
+	}
+	switch {
+	case sources == 0:
+		allErrs = append(allErrs, field.Required(specPath.Child("source"), "one of source, sourceRef, oci or image must be set"))
+	case sources > 1:
+		allErrs = append(allErrs, field.Forbidden(specPath.Child("source"), "source, sourceRef, oci and image are mutually exclusive"))
+	}
+	if in.Source != nil && in.Source.SecretRef != nil {
+		allErrs = append(allErrs, validateName(specPath.Child("source", "secretRef", "name"), in.Source.SecretRef.Name)...)
+	}
+	if in.SourceRef != nil {
+		allErrs = append(allErrs, in.SourceRef.validate(specPath.Child("sourceRef"))...)
+		// The artifact of a Flux source is read only and holds no commits
+		if in.SigningKey != nil {
+			allErrs = append(allErrs, field.Forbidden(specPath.Child("signingKey"), "environments with a sourceRef cannot be promoted to"))
+		}
+		if in.Verify != nil {
+			allErrs = append(allErrs, field.Forbidden(specPath.Child("verify"), "verify the commits with the Flux source instead"))
+		}
+		if in.Provider != nil {
+			allErrs = append(allErrs, field.Forbidden(specPath.Child("provider"), "not supported with a sourceRef"))
+		}
+	}
+	if in.OCI != nil {
+		allErrs = append(allErrs, in.OCI.validate(specPath.Child("oci"))...)
+		// Artifacts are copied as a whole, without commits or files to operate on
+		if in.SigningKey != nil {
+			allErrs = append(allErrs, field.Forbidden(specPath.Child("signingKey"), "not supported with an OCI repository"))
+		}
+		if in.Decryption != nil {
+			allErrs = append(allErrs, field.Forbidden(specPath.Child("decryption"), "not supported with an OCI repository"))
+		}
+		if in.Provider != nil {
+			allErrs = append(allErrs, field.Forbidden(specPath.Child("provider"), "not supported with an OCI repository"))
+		}
+		if in.Charts != nil {
+			allErrs = append(allErrs, field.Forbidden(specPath.Child("charts"), "not supported with an OCI repository"))
+		}
+		if in.VersionPolicy != nil && in.VersionPolicy.Source.File != "" {
+			allErrs = append(allErrs, field.Forbidden(specPath.Child("versionPolicy", "source", "file"), "not supported with an OCI repository"))
+		}
+	}
+	if in.Image != nil {
+		allErrs = append(allErrs, in.Image.validate(specPath.Child("image"))...)
+		// Tags are promoted without commits or files
+		if in.SigningKey != nil {
+			allErrs = append(allErrs, field.Forbidden(specPath.Child("signingKey"), "environments with an image repository cannot be promoted to"))
+		}
+		if in.Verify != nil {
+			allErrs = append(allErrs, field.Forbidden(specPath.Child("verify"), "not supported with an image repository"))
+		}
+		if in.Decryption != nil {
+			allErrs = append(allErrs, field.Forbidden(specPath.Child("decryption"), "not supported with an image repository"))
+		}
+		if in.Provider != nil {
+			allErrs = append(allErrs, field.Forbidden(specPath.Child("provider"), "not supported with an image repository"))
+		}
+		if in.Charts != nil {
+			allErrs = append(allErrs, field.Forbidden(specPath.Child("charts"), "environments with an image repository cannot be promoted to"))
+		}
+		if in.VersionPolicy != nil {
+			allErrs = append(allErrs, field.Forbidden(specPath.Child("versionPolicy"), "environments with an image repository cannot be promoted to"))
+		}
+	}
+	allErrs = append(allErrs, validateRelativePath(specPath.Child("path"), in.Path)...)
+	charts := map[string]bool{}
+	for i, constraint := range in.Charts {
+		constraintPath := specPath.Child("charts").Index(i)
+		switch {
+		case constraint.Name == "":
+			allErrs = append(allErrs, field.Required(constraintPath.Child("name"), ""))
+		case charts[constraint.Name]:
+			allErrs = append(allErrs, field.Duplicate(constraintPath.Child("name"), constraint.Name))
+		}
+		charts[constraint.Name] = true
+		if _, err := semver.ParseRange(constraint.Version); err != nil {
+			allErrs = append(allErrs, field.Invalid(constraintPath.Child("version"), constraint.Version, err.Error()))
+		}
+	}
+	if in.VersionPolicy != nil {
+		allErrs = append(allErrs, in.VersionPolicy.validate(specPath.Child("versionPolicy"))...)
+	}
+	if in.SigningKey != nil {
+		allErrs = append(allErrs, validateName(specPath.Child("signingKey", "secretRef", "name"), in.SigningKey.SecretRef.Name)...)
+	}
+	if in.Verify != nil {
+		allErrs = append(allErrs, validateName(specPath.Child("verify", "secretRef", "name"), in.Verify.SecretRef.Name)...)
+	}
+	if in.Decryption != nil {
+		allErrs = append(allErrs, validateName(specPath.Child("decryption", "secretRef", "name"), in.Decryption.SecretRef.Name)...)
+	}
+	if in.Provider != nil {
+		allErrs = append(allErrs, validateName(specPath.Child("provider", "secretRef", "name"), in.Provider.SecretRef.Name)...)
+		if in.Source != nil {
+			if _, err := in.Provider.GetRepository(in.Source.URL); err != nil {
+				allErrs = append(allErrs, field.Required(specPath.Child("provider", "repository"), err.Error()))
+			}
+		}
+	}
+
+	return allErrs
+}
+
+func (in *OCIRepositorySpec) validate(ociPath *field.Path) field.ErrorList {
+	var allErrs field.ErrorList
+
+	if !strings.HasPrefix(in.URL, "oci://") {
+		allErrs = append(allErrs, field.Invalid(ociPath.Child("url"), in.URL, "must start with 'oci://'"))
+	} else if repo, err := name.NewRepository(strings.TrimPrefix(in.URL, "oci://"), name.StrictValidation); err != nil {
+		allErrs = append(allErrs, field.Invalid(ociPath.Child("url"), in.URL, err.Error()))
+	} else if _, err := name.NewTag(repo.Name()+":"+in.GetTag(), name.StrictValidation); err != nil {
+		allErrs = append(allErrs, field.Invalid(ociPath.Child("tag"), in.Tag, err.Error()))
+	}
+	if in.SecretRef != nil {
+		allErrs = append(allErrs, validateName(ociPath.Child("secretRef", "name"), in.SecretRef.Name)...)
+	}
+
+	return allErrs
+}
+
+func (in *VersionPolicy) validate(policyPath *field.Path) field.ErrorList {
+	var allErrs field.ErrorList
+
+	sourcePath := policyPath.Child("source")
+	allErrs = append(allErrs, validateRelativePath(sourcePath.Child("file"), in.Source.File)...)
+	if in.Source.Chart != "" && in.Source.File == "" {
+		allErrs = append(allErrs, field.Required(sourcePath.Child("file"), "chart requires a file"))
+	}
+	if _, err := regexp.Compile(in.Source.Pattern); err != nil {
+		allErrs = append(allErrs, field.Invalid(sourcePath.Child("pattern"), in.Source.Pattern, err.Error()))
+	}
+	if in.SemVer != "" {
+		if _, err := semver.ParseRange(in.SemVer); err != nil {
+			allErrs = append(allErrs, field.Invalid(policyPath.Child("semver"), in.SemVer, err.Error()))
+		}
+	}
+
+	return allErrs
+}
+
+func (in *ImageRepositorySpec) validate(imagePath *field.Path) field.ErrorList {
+	var allErrs field.ErrorList
+
+	if _, err := name.NewRepository(in.Repository, name.StrictValidation); err != nil {
+		allErrs = append(allErrs, field.Invalid(imagePath.Child("repository"), in.Repository, err.Error()))
+	}
+	if _, err := regexp.Compile(in.Policy.Pattern); err != nil {
+		allErrs = append(allErrs, field.Invalid(imagePath.Child("policy", "pattern"), in.Policy.Pattern, err.Error()))
+	}
+	if in.Policy.Extract != "" && in.Policy.Pattern == "" {
+		allErrs = append(allErrs, field.Required(imagePath.Child("policy", "pattern"), "extract requires a pattern"))
+	}
+	if in.Policy.SemVer != "" {
+		if _, err := semver.ParseRange(in.Policy.SemVer); err != nil {
+			allErrs = append(allErrs, field.Invalid(imagePath.Child("policy", "semver"), in.Policy.SemVer, err.Error()))
+		}
+	}
+	if in.SecretRef != nil {
+		allErrs = append(allErrs, validateName(imagePath.Child("secretRef", "name"), in.SecretRef.Name)...)
+	}
+
+	return allErrs
+}
+
+// sourceKinds are the kinds of Flux source objects an ArtifactSourceReference can reference.
+var sourceKinds = []string{"GitRepository", "OCIRepository", "Bucket"}
+
+func (in *ArtifactSourceReference) validate(refPath *field.Path) field.ErrorList {
+	var allErrs field.ErrorList
+
+	if gv, err := schema.ParseGroupVersion(in.GetAPIVersion()); err != nil {
+		allErrs = append(allErrs, field.Invalid(refPath.Child("apiVersion"), in.APIVersion, err.Error()))
+	} else if gv.Group != SourceGroup {
+		allErrs = append(allErrs, field.Invalid(refPath.Child("apiVersion"), in.APIVersion, "must be a version of "+SourceGroup))
+	}
+	supported := false
+	for _, kind := range sourceKinds {
+		supported = supported || in.Kind == kind
+	}
+	if !supported {
+		allErrs = append(allErrs, field.NotSupported(refPath.Child("kind"), in.Kind, sourceKinds))
+	}
+	allErrs = append(allErrs, validateName(refPath.Child("name"), in.Name)...)
+
+	return allErrs
+}
@@ -0,0 +1,261 @@
+/*
+Copyright 2023 Thomas Stadler <thomas@thomasst.xyz>.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+var _ = Describe("Environment webhook", func() {
+	It("defaults the path and branch", func() {
+		env := &Environment{
+			ObjectMeta: metav1.ObjectMeta{Name: "dev", Namespace: newNamespace()},
+			Spec: EnvironmentSpec{
+				Source: &SourceSpec{URL: "https://example.com/dev.git"},
+			},
+		}
+		Expect(k8sClient.Create(ctx, env)).To(Succeed())
+		Expect(env.Spec.Path).To(Equal(DefaultPath))
+		Expect(env.Spec.Source.Reference).NotTo(BeNil())
+		Expect(env.Spec.Source.Reference.Branch).To(Equal(DefaultBranch))
+	})
+
+	It("rejects paths escaping the repository", func() {
+		env := &Environment{
+			ObjectMeta: metav1.ObjectMeta{Name: "dev", Namespace: newNamespace()},
+			Spec: EnvironmentSpec{
+				Source: &SourceSpec{URL: "https://example.com/dev.git"},
+				Path:   "../other",
+			},
+		}
+		err := k8sClient.Create(ctx, env)
+		Expect(apierrors.IsInvalid(err)).To(BeTrue())
+		Expect(err.Error()).To(ContainSubstring("spec.path"))
+	})
+
+	It("rejects an invalid signing key secret name", func() {
+		env := &Environment{
+			ObjectMeta: metav1.ObjectMeta{Name: "dev", Namespace: newNamespace()},
+			Spec: EnvironmentSpec{
+				Source:     &SourceSpec{URL: "https://example.com/dev.git"},
+				SigningKey: &SigningKey{SecretRef: LocalObjectReference{Name: "Signing_Key"}},
+			},
+		}
+		err := k8sClient.Create(ctx, env)
+		Expect(apierrors.IsInvalid(err)).To(BeTrue())
+		Expect(err.Error()).To(ContainSubstring("spec.signingKey.secretRef.name"))
+	})
+
+	It("rejects a provider without a repository", func() {
+		env := &Environment{
+			ObjectMeta: metav1.ObjectMeta{Name: "dev", Namespace: newNamespace()},
+			Spec: EnvironmentSpec{
+				Source:   &SourceSpec{URL: "https://example.com/dev.git"},
+				Provider: &GitProvider{Type: GitHubProvider, SecretRef: LocalObjectReference{Name: "github-token"}},
+			},
+		}
+		err := k8sClient.Create(ctx, env)
+		Expect(apierrors.IsInvalid(err)).To(BeTrue())
+		Expect(err.Error()).To(ContainSubstring("spec.provider.repository"))
+	})
+
+	It("accepts a Flux source reference", func() {
+		env := &Environment{
+			ObjectMeta: metav1.ObjectMeta{Name: "dev", Namespace: newNamespace()},
+			Spec: EnvironmentSpec{
+				SourceRef: &ArtifactSourceReference{Kind: "GitRepository", Name: "dev"},
+			},
+		}
+		Expect(k8sClient.Create(ctx, env)).To(Succeed())
+		Expect(env.Spec.Path).To(Equal(DefaultPath))
+	})
+
+	It("rejects both a source and a Flux source reference", func() {
+		env := &Environment{
+			ObjectMeta: metav1.ObjectMeta{Name: "dev", Namespace: newNamespace()},
+			Spec: EnvironmentSpec{
+				Source:    &SourceSpec{URL: "https://example.com/dev.git"},
+				SourceRef: &ArtifactSourceReference{Kind: "GitRepository", Name: "dev"},
+			},
+		}
+		err := k8sClient.Create(ctx, env)
+		Expect(apierrors.IsInvalid(err)).To(BeTrue())
+		Expect(err.Error()).To(ContainSubstring("spec.sourceRef"))
+	})
+
+	It("rejects a Flux source reference outside of the source API group", func() {
+		env := &Environment{
+			ObjectMeta: metav1.ObjectMeta{Name: "dev", Namespace: newNamespace()},
+			Spec: EnvironmentSpec{
+				SourceRef: &ArtifactSourceReference{APIVersion: "v1", Kind: "GitRepository", Name: "dev"},
+			},
+		}
+		err := k8sClient.Create(ctx, env)
+		Expect(apierrors.IsInvalid(err)).To(BeTrue())
+		Expect(err.Error()).To(ContainSubstring("spec.sourceRef.apiVersion"))
+	})
+
+	It("rejects a signing key for a Flux source reference", func() {
+		env := &Environment{
+			ObjectMeta: metav1.ObjectMeta{Name: "dev", Namespace: newNamespace()},
+			Spec: EnvironmentSpec{
+				SourceRef:  &ArtifactSourceReference{Kind: "OCIRepository", Name: "dev"},
+				SigningKey: &SigningKey{SecretRef: LocalObjectReference{Name: "signing-key"}},
+			},
+		}
+		err := k8sClient.Create(ctx, env)
+		Expect(apierrors.IsInvalid(err)).To(BeTrue())
+		Expect(err.Error()).To(ContainSubstring("spec.signingKey"))
+	})
+
+	It("defaults the tag of an OCI repository", func() {
+		env := &Environment{
+			ObjectMeta: metav1.ObjectMeta{Name: "dev", Namespace: newNamespace()},
+			Spec: EnvironmentSpec{
+				OCI: &OCIRepositorySpec{URL: "oci://ghcr.io/acme/manifests"},
+			},
+		}
+		Expect(k8sClient.Create(ctx, env)).To(Succeed())
+		Expect(env.Spec.OCI.Tag).To(Equal(DefaultTag))
+	})
+
+	It("rejects invalid OCI repositories", func() {
+		env := &Environment{
+			ObjectMeta: metav1.ObjectMeta{Name: "dev", Namespace: newNamespace()},
+			Spec: EnvironmentSpec{
+				OCI:        &OCIRepositorySpec{URL: "oci://ghcr.io/acme/manifests", Tag: "v1.0.0+build"},
+				Decryption: &Decryption{SecretRef: LocalObjectReference{Name: "sops-keys"}},
+			},
+		}
+		err := k8sClient.Create(ctx, env)
+		Expect(apierrors.IsInvalid(err)).To(BeTrue())
+		Expect(err.Error()).To(ContainSubstring("spec.oci.tag"))
+		Expect(err.Error()).To(ContainSubstring("spec.decryption"))
+	})
+
+	It("accepts image repositories with a policy", func() {
+		env := &Environment{
+			ObjectMeta: metav1.ObjectMeta{Name: "dev", Namespace: newNamespace()},
+			Spec: EnvironmentSpec{
+				Image: &ImageRepositorySpec{Repository: "ghcr.io/acme/podinfo", Policy: ImagePolicy{SemVer: ">=6.0.0 <7.0.0"}},
+			},
+		}
+		Expect(k8sClient.Create(ctx, env)).To(Succeed())
+	})
+
+	It("rejects invalid image policies", func() {
+		env := &Environment{
+			ObjectMeta: metav1.ObjectMeta{Name: "dev", Namespace: newNamespace()},
+			Spec: EnvironmentSpec{
+				Image:  &ImageRepositorySpec{Repository: "ghcr.io/acme/podinfo", Policy: ImagePolicy{Extract: "$version", SemVer: "6.x"}},
+				Verify: &VerificationPolicy{SecretRef: LocalObjectReference{Name: "trusted-keys"}},
+			},
+		}
+		err := k8sClient.Create(ctx, env)
+		Expect(apierrors.IsInvalid(err)).To(BeTrue())
+		Expect(err.Error()).To(ContainSubstring("spec.image.policy.pattern"))
+		Expect(err.Error()).To(ContainSubstring("spec.image.policy.semver"))
+		Expect(err.Error()).To(ContainSubstring("spec.verify"))
+	})
+
+	It("rejects invalid chart constraints", func() {
+		env := &Environment{
+			ObjectMeta: metav1.ObjectMeta{Name: "prod", Namespace: newNamespace()},
+			Spec: EnvironmentSpec{
+				Source: &SourceSpec{URL: "https://example.com/prod.git"},
+				Charts: []ChartConstraint{{Name: "podinfo", Version: ">=6.0.0 <7.0.0"}, {Name: "podinfo", Version: "6.x"}},
+			},
+		}
+		err := k8sClient.Create(ctx, env)
+		Expect(apierrors.IsInvalid(err)).To(BeTrue())
+		Expect(err.Error()).To(ContainSubstring("spec.charts[1].name"))
+		Expect(err.Error()).To(ContainSubstring("spec.charts[1].version"))
+	})
+
+	It("rejects invalid version policies", func() {
+		env := &Environment{
+			ObjectMeta: metav1.ObjectMeta{Name: "prod", Namespace: newNamespace()},
+			Spec: EnvironmentSpec{
+				Source: &SourceSpec{URL: "https://example.com/prod.git"},
+				VersionPolicy: &VersionPolicy{
+					Source: VersionSource{Chart: "podinfo", Pattern: "("},
+					SemVer: ">=1.0.0 <2.0.0",
+				},
+			},
+		}
+		err := k8sClient.Create(ctx, env)
+		Expect(apierrors.IsInvalid(err)).To(BeTrue())
+		Expect(err.Error()).To(ContainSubstring("spec.versionPolicy.source.file"))
+		Expect(err.Error()).To(ContainSubstring("spec.versionPolicy.source.pattern"))
+	})
+})
+
+var _ = Describe("Environment validation", func() {
+	var env *Environment
+
+	BeforeEach(func() {
+		env = &Environment{
+			ObjectMeta: metav1.ObjectMeta{Name: "dev", Namespace: "apps"},
+			Spec:       EnvironmentSpec{Source: &SourceSpec{URL: "https://example.com/dev.git"}},
+		}
+	})
+
+	It("defaults the path and branch", func() {
+		env.Default()
+		Expect(env.Spec.Path).To(Equal(DefaultPath))
+		Expect(env.Spec.Source.Reference).To(Equal(&GitRepositoryRef{Branch: DefaultBranch}))
+	})
+
+	It("keeps the path and branch", func() {
+		env.Spec.Path = "apps"
+		env.Spec.Source.Reference = &GitRepositoryRef{Branch: "release"}
+		env.Default()
+		Expect(env.Spec.Path).To(Equal("apps"))
+		Expect(env.Spec.Source.Reference.Branch).To(Equal("release"))
+	})
+
+	It("accepts a defaulted Environment", func() {
+		env.Default()
+		Expect(env.ValidateCreate()).To(Succeed())
+		Expect(env.ValidateUpdate(env.DeepCopy())).To(Succeed())
+		Expect(env.ValidateDelete()).To(Succeed())
+	})
+
+	It("rejects paths escaping the repository on create and update", func() {
+		old := env.DeepCopy()
+		env.Spec.Path = "../other"
+
+		err := env.ValidateCreate()
+		Expect(apierrors.IsInvalid(err)).To(BeTrue())
+		Expect(err.Error()).To(ContainSubstring("spec.path"))
+
+		err = env.ValidateUpdate(old)
+		Expect(apierrors.IsInvalid(err)).To(BeTrue())
+		Expect(err.Error()).To(ContainSubstring("spec.path"))
+	})
+
+	It("rejects an Environment without a source", func() {
+		env.Spec.Source = nil
+		err := env.ValidateCreate()
+		Expect(apierrors.IsInvalid(err)).To(BeTrue())
+		Expect(err.Error()).To(ContainSubstring("spec.source"))
+	})
+})
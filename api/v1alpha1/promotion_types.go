@@ -17,7 +17,13 @@ limitations under the License.
 package v1alpha1
 
 import (
+	"encoding/hex"
+	"strings"
+	"time"
+
+	"github.com/robfig/cron/v3"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
 )
 
 // PromotionSpec defines the desired state of Promotion
@@ -41,6 +47,84 @@ type PromotionSpec struct {
 	// A list of resources to be included in the readiness check.
 	// +optional
 	ReadinessChecks ReadinessChecks `json:"readinessChecks,omitempty"`
+
+	// DryRun renders the changes the promotion would make to the destination
+	// environment into the status, without committing or pushing anything.
+	// +optional
+	DryRun bool `json:"dryRun,omitempty"`
+
+	// ServiceAccountName is the name of the ServiceAccount in the namespace of the
+	// Promotion, which is impersonated for the readiness checks and for reading
+	// the Secrets of Environments in the same namespace.
+	// +optional
+	ServiceAccountName string `json:"serviceAccountName,omitempty"`
+
+	// Trigger specifies when the source revision is promoted.
+	// Defaults to promoting new revisions of the source environment.
+	// +optional
+	Trigger *Trigger `json:"trigger,omitempty"`
+
+	// RequireApproval holds back the promotion of each new source revision
+	// until it has been approved by setting the ApprovedRevisionAnnotation
+	// to the revision.
+	// +optional
+	RequireApproval bool `json:"requireApproval,omitempty"`
+}
+
+// DryRunAnnotation enables dry-run mode when set to "true" on a Promotion,
+// without having to change its spec.
+const DryRunAnnotation = "promote.release-promotion-operator.io/dry-run"
+
+// DryRunRequestedAtAnnotation requests rendering the dry run again, even if
+// neither the Promotion nor its environments have changed since the last one.
+// Its value is usually the time of the request, as set by 'kubectl promote diff'.
+const DryRunRequestedAtAnnotation = "promote.release-promotion-operator.io/dryRunRequestedAt"
+
+// RequestedAtAnnotation requests a promotion of the current source revision
+// when set to a new value, e.g. the current time, regardless of the Trigger.
+const RequestedAtAnnotation = "promote.release-promotion-operator.io/requestedAt"
+
+// ApprovedRevisionAnnotation approves the promotion of the source revision
+// it is set to, if the Promotion requires approval.
+const ApprovedRevisionAnnotation = "promote.release-promotion-operator.io/approvedRevision"
+
+// TriggerType is the type of a Trigger.
+type TriggerType string
+
+const (
+	// RevisionTrigger promotes new revisions of the source environment.
+	RevisionTrigger TriggerType = "Revision"
+	// ScheduleTrigger promotes the current source revision on a cron schedule.
+	ScheduleTrigger TriggerType = "Schedule"
+	// ManualTrigger only promotes when requested by the RequestedAtAnnotation.
+	ManualTrigger TriggerType = "Manual"
+)
+
+// DefaultTriggerInterval is the interval at which the source environment
+// is checked for new revisions if Trigger.Interval is not set.
+const DefaultTriggerInterval = 5 * time.Minute
+
+// Trigger specifies when the source revision is promoted.
+// Promotions can be requested with the RequestedAtAnnotation for all types.
+type Trigger struct {
+	// Type of the trigger. 'Revision' promotes new revisions of the source
+	// environment, 'Schedule' promotes the current source revision at the
+	// times of the Schedule, and 'Manual' only promotes on request.
+	// Defaults to 'Revision'.
+	// +kubebuilder:validation:Enum=Revision;Schedule;Manual
+	// +optional
+	Type TriggerType `json:"type,omitempty"`
+
+	// Interval at which the source environment is checked for new revisions
+	// with the 'Revision' trigger. Defaults to 5m.
+	// +optional
+	Interval *metav1.Duration `json:"interval,omitempty"`
+
+	// Schedule of the 'Schedule' trigger in cron format, e.g. '0 2 * * *'
+	// for nightly promotions. The times are in UTC, unless the schedule is
+	// prefixed with a time zone, e.g. 'CRON_TZ=Europe/Vienna 0 2 * * *'.
+	// +optional
+	Schedule string `json:"schedule,omitempty"`
 }
 
 // TypedLocalObjectReference defines the readiness checks to be done before doing the promotion.
@@ -56,12 +140,138 @@ type LocalObjectsRef struct {
 
 	// +optional
 	Namespace string `json:"namespace,omitempty"`
+
+	// KubeConfig references a Secret with the kubeconfig of the cluster the object
+	// is fetched from. Defaults to the cluster the operator is running in.
+	// +optional
+	KubeConfig *KubeConfigReference `json:"kubeConfig,omitempty"`
+}
+
+// UnreadyObject is an object of the readiness checks which is not ready.
+type UnreadyObject struct {
+	LocalObjectsRef `json:",inline"`
+
+	// Status is the kstatus status of the object.
+	Status string `json:"status"`
+
+	// Message is the kstatus message of the object.
+	// +optional
+	Message string `json:"message,omitempty"`
 }
 
 func (in *Promotion) GetLocalObjectsRefsForReadinessChecks() []LocalObjectsRef {
 	return in.Spec.ReadinessChecks.LocalObjectsRef
 }
 
+// FromEnvironmentKind returns the kind of the source Environment.
+func (in *Promotion) FromEnvironmentKind() string {
+	return defaultKind(in.Spec.FromSpec.EnvironmentRef.Kind, EnvironmentKind)
+}
+
+// FromEnvironmentKey returns the namespaced name of the source Environment.
+// The namespace is empty for a ClusterEnvironment.
+func (in *Promotion) FromEnvironmentKey() types.NamespacedName {
+	return in.referenceKey(in.FromEnvironmentKind(), in.Spec.FromSpec.EnvironmentRef.Namespace, in.Spec.FromSpec.EnvironmentRef.Name)
+}
+
+// ToEnvironmentKind returns the kind of the destination Environment.
+func (in *Promotion) ToEnvironmentKind() string {
+	return defaultKind(in.Spec.ToSpec.EnvironmentRef.Kind, EnvironmentKind)
+}
+
+// ToEnvironmentKey returns the namespaced name of the destination Environment.
+// The namespace is empty for a ClusterEnvironment.
+func (in *Promotion) ToEnvironmentKey() types.NamespacedName {
+	return in.referenceKey(in.ToEnvironmentKind(), in.Spec.ToSpec.EnvironmentRef.Namespace, in.Spec.ToSpec.EnvironmentRef.Name)
+}
+
+// TemplateKind returns the kind of the PromotionTemplate.
+func (in *Promotion) TemplateKind() string {
+	return defaultKind(in.Spec.TemplateRef.Kind, PromotionTemplateKind)
+}
+
+// TemplateKey returns the namespaced name of the PromotionTemplate.
+// The namespace is empty for a ClusterPromotionTemplate.
+func (in *Promotion) TemplateKey() types.NamespacedName {
+	return in.referenceKey(in.TemplateKind(), in.Spec.TemplateRef.Namespace, in.Spec.TemplateRef.Name)
+}
+
+// referenceKey defaults the namespace of a reference to a namespaced kind
+// to the namespace of the Promotion.
+func (in *Promotion) referenceKey(kind, namespace, name string) types.NamespacedName {
+	if IsClusterScoped(kind) {
+		return types.NamespacedName{Name: name}
+	}
+	if namespace == "" {
+		namespace = in.Namespace
+	}
+	return types.NamespacedName{Namespace: namespace, Name: name}
+}
+
+// IsClusterScoped returns true if the kind referenced by a Promotion is cluster-scoped.
+func IsClusterScoped(kind string) bool {
+	return kind == ClusterEnvironmentKind || kind == ClusterPromotionTemplateKind
+}
+
+func defaultKind(kind, defaultKind string) string {
+	if kind == "" {
+		return defaultKind
+	}
+	return kind
+}
+
+// TriggerType returns the type of the Trigger, defaulting to RevisionTrigger.
+func (in *Promotion) TriggerType() TriggerType {
+	if in.Spec.Trigger == nil || in.Spec.Trigger.Type == "" {
+		return RevisionTrigger
+	}
+	return in.Spec.Trigger.Type
+}
+
+// TriggerInterval returns the interval of the Trigger, defaulting to DefaultTriggerInterval.
+func (in *Promotion) TriggerInterval() time.Duration {
+	if in.Spec.Trigger == nil || in.Spec.Trigger.Interval == nil {
+		return DefaultTriggerInterval
+	}
+	return in.Spec.Trigger.Interval.Duration
+}
+
+// TriggerSchedule parses the schedule of the Trigger.
+func (in *Promotion) TriggerSchedule() (cron.Schedule, error) {
+	var schedule string
+	if in.Spec.Trigger != nil {
+		schedule = in.Spec.Trigger.Schedule
+	}
+	if !strings.HasPrefix(schedule, "CRON_TZ=") && !strings.HasPrefix(schedule, "TZ=") {
+		schedule = "CRON_TZ=UTC " + schedule
+	}
+	return cron.ParseStandard(schedule)
+}
+
+// DryRunRequest returns the value of the DryRunRequestedAtAnnotation.
+func (in *Promotion) DryRunRequest() string {
+	return in.GetAnnotations()[DryRunRequestedAtAnnotation]
+}
+
+// PromotionRequest returns the value of the RequestedAtAnnotation
+// and whether it has not been handled yet.
+func (in *Promotion) PromotionRequest() (string, bool) {
+	requestedAt, ok := in.GetAnnotations()[RequestedAtAnnotation]
+	return requestedAt, ok && requestedAt != "" && requestedAt != in.Status.LastHandledRequestedAt
+}
+
+// Approved returns true if the Promotion does not require approval,
+// or if the ApprovedRevisionAnnotation approves the source revision.
+func (in *Promotion) Approved(revision string) bool {
+	return !in.Spec.RequireApproval || in.GetAnnotations()[ApprovedRevisionAnnotation] == revision
+}
+
+// IsDryRun returns true if either the spec or the DryRunAnnotation
+// requests a dry run of the Promotion.
+func (in *Promotion) IsDryRun() bool {
+	return in.Spec.DryRun || in.GetAnnotations()[DryRunAnnotation] == "true"
+}
+
 // FromSpec defines the source of the promotion.
 type FromSpec struct {
 	EnvironmentRef EnvironmentReference `json:"environmentRef"`
@@ -74,18 +284,34 @@ type ToSpec struct {
 
 // TemplateRef defines the reference to the PromotionTemplate.
 type TemplateRef struct {
+	// Kind of the template, either 'PromotionTemplate' or 'ClusterPromotionTemplate'.
+	// Defaults to 'PromotionTemplate'.
+	// +kubebuilder:validation:Enum=PromotionTemplate;ClusterPromotionTemplate
+	// +optional
+	Kind string `json:"kind,omitempty"`
+
 	Name string `json:"name"`
+
+	// Namespace of the PromotionTemplate, defaults to the namespace of the Promotion.
+	// Referencing a PromotionTemplate in another namespace requires
+	// a ReferenceGrant in that namespace. Must be empty for a ClusterPromotionTemplate.
+	// +optional
+	Namespace string `json:"namespace,omitempty"`
 }
 
 // Strategy defines the strategy for the promotion.
 type Strategy struct {
+	// PullRequest pushes the promotion to the 'promotion/<name>' branch and opens
+	// a pull request of it into the branch of the destination environment, with
+	// the provider of the destination Environment, instead of pushing to its branch.
 	PullRequest bool `json:"pull-request"`
 }
 
 // PromotionStatus defines the observed state of Promotion
 type PromotionStatus struct {
-	// INSERT ADDITIONAL STATUS FIELD - define observed state of cluster
-	// Important: Run "make" to regenerate code after modifying this file
+	// ObservedGeneration is the last observed generation of the Promotion.
+	// +optional
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
 
 	// Conditions holds the conditions for the Promotion.
 	// +optional
@@ -94,10 +320,234 @@ type PromotionStatus struct {
 	// DependentObjectsReady ...
 	// +optional
 	DependentObjectsReady bool `json:"dependentObjectsReady"`
+
+	// UnreadyObjects lists the objects of the readiness checks which are not ready.
+	// +optional
+	UnreadyObjects []UnreadyObject `json:"unreadyObjects,omitempty"`
+
+	// DryRun holds the result of the last dry run.
+	// +optional
+	DryRun *DryRunResult `json:"dryRun,omitempty"`
+
+	// LastAttemptedRevision is the commit SHA of the source environment
+	// the last promotion was attempted for.
+	// +optional
+	LastAttemptedRevision string `json:"lastAttemptedRevision,omitempty"`
+
+	// LastPromotedRevision is the commit SHA of the source environment
+	// which was last promoted successfully.
+	// +optional
+	LastPromotedRevision string `json:"lastPromotedRevision,omitempty"`
+
+	// LastTargetRevision is the commit SHA in the destination environment
+	// which resulted from the last successful promotion.
+	// +optional
+	LastTargetRevision string `json:"lastTargetRevision,omitempty"`
+
+	// LastPromotedVersion is the version of the source environment
+	// which was last promoted successfully by this Promotion, if the
+	// destination environment has a version policy. Downgrades are checked
+	// against the version recorded in the status of the destination instead.
+	// +optional
+	LastPromotedVersion string `json:"lastPromotedVersion,omitempty"`
+
+	// LastAttemptTime is the time the last promotion was attempted.
+	// +optional
+	LastAttemptTime *metav1.Time `json:"lastAttemptTime,omitempty"`
+
+	// LastPromotionTime is the time of the last successful promotion.
+	// +optional
+	LastPromotionTime *metav1.Time `json:"lastPromotionTime,omitempty"`
+
+	// LastHandledRequestedAt holds the value of the most recent
+	// RequestedAtAnnotation which has been handled.
+	// +optional
+	LastHandledRequestedAt string `json:"lastHandledRequestedAt,omitempty"`
+
+	// PendingApprovalRevision is the source revision waiting to be approved,
+	// if the Promotion requires approval.
+	// +optional
+	PendingApprovalRevision string `json:"pendingApprovalRevision,omitempty"`
+
+	// LastScheduleTime is the time of the last promotion of the 'Schedule' trigger.
+	// +optional
+	LastScheduleTime *metav1.Time `json:"lastScheduleTime,omitempty"`
+
+	// NextScheduleTime is the time of the next promotion of the 'Schedule' trigger.
+	// +optional
+	NextScheduleTime *metav1.Time `json:"nextScheduleTime,omitempty"`
+
+	// PullRequest is the pull request opened by the last promotion with the
+	// pull-request strategy, until it has been merged or closed.
+	// +optional
+	PullRequest *PullRequestStatus `json:"pullRequest,omitempty"`
+
+	// History of past promotions, most recent first.
+	// Holds at most MaxPromotionHistory entries.
+	// +optional
+	History []PromotionRecord `json:"history,omitempty"`
+}
+
+// PromotionOutcome is the result of a promotion attempt.
+type PromotionOutcome string
+
+const (
+	// PromotionSucceeded means the changes have been pushed to the destination environment.
+	PromotionSucceeded PromotionOutcome = "Succeeded"
+	// PromotionFailed means the promotion could not be completed.
+	PromotionFailed PromotionOutcome = "Failed"
+	// PromotionSuperseded means the promotion has been abandoned, as the source
+	// environment moved on to a revision waiting for approval in the meantime.
+	PromotionSuperseded PromotionOutcome = "Superseded"
+)
+
+// MaxPromotionHistory is the maximum number of entries kept in PromotionStatus.History.
+const MaxPromotionHistory = 10
+
+// PullRequestStatus describes an open pull request of the pull-request strategy.
+type PullRequestStatus struct {
+	// URL of the pull request.
+	URL string `json:"url"`
+
+	// Number of the pull request, or the IID of the GitLab merge request.
+	Number int `json:"number"`
+
+	// SourceRevision is the commit SHA of the source environment the pull request promotes.
+	SourceRevision string `json:"sourceRevision"`
+
+	// Version is the version of the source revision, which is recorded
+	// on the destination environment once the pull request has been merged.
+	// +optional
+	Version string `json:"version,omitempty"`
 }
 
+// PromotionRecord describes a past promotion attempt.
+type PromotionRecord struct {
+	// SourceRevision is the commit SHA of the source environment which was promoted.
+	SourceRevision string `json:"sourceRevision"`
+
+	// TargetRevision is the resulting commit SHA in the destination environment.
+	// +optional
+	TargetRevision string `json:"targetRevision,omitempty"`
+
+	// Version is the version of the source revision, if the destination
+	// environment has a version policy.
+	// +optional
+	Version string `json:"version,omitempty"`
+
+	// PullRequestURL is the URL of the pull request opened for the promotion,
+	// if the pull-request strategy is used.
+	// +optional
+	PullRequestURL string `json:"pullRequestURL,omitempty"`
+
+	// Outcome of the promotion.
+	Outcome PromotionOutcome `json:"outcome"`
+
+	// Message holds details about the outcome, e.g. the error of a failed promotion.
+	// +optional
+	Message string `json:"message,omitempty"`
+
+	// SigningKeyFingerprint is the fingerprint of the key
+	// the promotion commit has been signed with.
+	// +optional
+	SigningKeyFingerprint string `json:"signingKeyFingerprint,omitempty"`
+
+	// StartTime is the time the promotion was started.
+	StartTime metav1.Time `json:"startTime"`
+
+	// Duration of the promotion.
+	Duration metav1.Duration `json:"duration"`
+}
+
+// RecordPromotion prepends the record to the history, dropping the oldest
+// entries beyond MaxPromotionHistory. Repeated failures for the same source
+// revision replace each other instead of filling up the history.
+func (in *PromotionStatus) RecordPromotion(record PromotionRecord) {
+	if len(in.History) > 0 {
+		last := in.History[0]
+		if record.Outcome == PromotionFailed && last.Outcome == PromotionFailed && last.SourceRevision == record.SourceRevision {
+			in.History = in.History[1:]
+		}
+	}
+
+	in.History = append([]PromotionRecord{record}, in.History...)
+	if len(in.History) > MaxPromotionHistory {
+		in.History = in.History[:MaxPromotionHistory]
+	}
+}
+
+// ShortRevision abbreviates a commit SHA like 'git log --oneline'. Other
+// revisions, e.g. tags, OCI digests or Flux revisions, are returned unchanged.
+func ShortRevision(revision string) string {
+	if len(revision) != 40 {
+		return revision
+	}
+	if _, err := hex.DecodeString(revision); err != nil {
+		return revision
+	}
+	return revision[:7]
+}
+
+// DryRunResult summarizes the changes a promotion would make
+// to the destination environment.
+type DryRunResult struct {
+	// ObservedGeneration is the generation of the Promotion the dry run was rendered for.
+	ObservedGeneration int64 `json:"observedGeneration"`
+
+	// SourceRevision is the commit SHA of the source environment the dry run was rendered from.
+	SourceRevision string `json:"sourceRevision"`
+
+	// TargetRevision is the commit SHA of the destination environment the dry run was rendered against.
+	TargetRevision string `json:"targetRevision"`
+
+	// LastRunTime is the time the dry run was rendered.
+	LastRunTime metav1.Time `json:"lastRunTime"`
+
+	// RequestedAt holds the value of the DryRunRequestedAtAnnotation
+	// the dry run has been rendered for.
+	// +optional
+	RequestedAt string `json:"requestedAt,omitempty"`
+
+	// Added lists the files which would be added to the destination environment.
+	// +optional
+	Added []string `json:"added,omitempty"`
+
+	// Modified lists the files which would be modified in the destination environment.
+	// +optional
+	Modified []string `json:"modified,omitempty"`
+
+	// Deleted lists the files which would be deleted from the destination environment.
+	// +optional
+	Deleted []string `json:"deleted,omitempty"`
+
+	// LinesAdded is the total number of added lines.
+	LinesAdded int `json:"linesAdded"`
+
+	// LinesDeleted is the total number of deleted lines.
+	LinesDeleted int `json:"linesDeleted"`
+
+	// Patch is the unified diff of the changes, truncated to MaxDryRunPatchSize bytes.
+	// +optional
+	Patch string `json:"patch,omitempty"`
+
+	// PatchTruncated is true if Patch has been truncated.
+	// +optional
+	PatchTruncated bool `json:"patchTruncated,omitempty"`
+}
+
+// MaxDryRunPatchSize is the maximum size in bytes of DryRunResult.Patch.
+const MaxDryRunPatchSize = 4096
+
 //+kubebuilder:object:root=true
 //+kubebuilder:subresource:status
+//+kubebuilder:storageversion
+//+kubebuilder:printcolumn:name="Ready",type=string,JSONPath=`.status.conditions[?(@.type=="Ready")].status`
+//+kubebuilder:printcolumn:name="Status",type=string,JSONPath=`.status.conditions[?(@.type=="Ready")].message`,priority=1
+//+kubebuilder:printcolumn:name="From",type=string,JSONPath=`.spec.from.environmentRef.name`
+//+kubebuilder:printcolumn:name="To",type=string,JSONPath=`.spec.to.environmentRef.name`
+//+kubebuilder:printcolumn:name="Promoted Revision",type=string,JSONPath=`.status.lastPromotedRevision`
+//+kubebuilder:printcolumn:name="Target Revision",type=string,JSONPath=`.status.lastTargetRevision`
+//+kubebuilder:printcolumn:name="Last Promotion",type=date,JSONPath=`.status.lastPromotionTime`
 
 // Promotion is the Schema for the promotions API
 type Promotion struct {
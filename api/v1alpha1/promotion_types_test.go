@@ -0,0 +1,85 @@
+/*
+Copyright 2023 Thomas Stadler <thomas@thomasst.xyz>.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"fmt"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Promotion history", func() {
+	var status *PromotionStatus
+
+	BeforeEach(func() {
+		status = &PromotionStatus{}
+	})
+
+	// revisions returns the source revisions of the history.
+	revisions := func() []string {
+		var revisions []string
+		for _, record := range status.History {
+			revisions = append(revisions, record.SourceRevision)
+		}
+		return revisions
+	}
+
+	It("records the most recent promotion first", func() {
+		status.RecordPromotion(PromotionRecord{SourceRevision: "a", Outcome: PromotionSucceeded})
+		status.RecordPromotion(PromotionRecord{SourceRevision: "b", Outcome: PromotionFailed})
+		status.RecordPromotion(PromotionRecord{SourceRevision: "b", Outcome: PromotionSucceeded})
+		Expect(revisions()).To(Equal([]string{"b", "b", "a"}))
+	})
+
+	It("keeps at most MaxPromotionHistory records", func() {
+		for i := 0; i < MaxPromotionHistory+2; i++ {
+			status.RecordPromotion(PromotionRecord{SourceRevision: fmt.Sprint(i), Outcome: PromotionSucceeded})
+		}
+		Expect(status.History).To(HaveLen(MaxPromotionHistory))
+		Expect(status.History[0].SourceRevision).To(Equal(fmt.Sprint(MaxPromotionHistory + 1)))
+		Expect(status.History[MaxPromotionHistory-1].SourceRevision).To(Equal("2"))
+	})
+
+	It("replaces repeated failures of the same source revision", func() {
+		status.RecordPromotion(PromotionRecord{SourceRevision: "a", Outcome: PromotionSucceeded})
+		status.RecordPromotion(PromotionRecord{SourceRevision: "b", Outcome: PromotionFailed, Message: "first"})
+		status.RecordPromotion(PromotionRecord{SourceRevision: "b", Outcome: PromotionFailed, Message: "second"})
+		Expect(revisions()).To(Equal([]string{"b", "a"}))
+		Expect(status.History[0].Message).To(Equal("second"))
+
+		status.RecordPromotion(PromotionRecord{SourceRevision: "c", Outcome: PromotionFailed})
+		Expect(revisions()).To(Equal([]string{"c", "b", "a"}))
+	})
+})
+
+var _ = DescribeTable("Short revisions",
+	func(revision, short string) {
+		Expect(ShortRevision(revision)).To(Equal(short))
+	},
+	Entry("of commits", "4b825dc642cb6eb9a060e54bf8d69288fbee4904", "4b825dc"),
+	Entry("of tags", "v1.10.11", "v1.10.11"),
+	Entry("of image tags", "6.3.0-rc.1-amd64", "6.3.0-rc.1-amd64"),
+	Entry("of OCI artifacts",
+		"6.3.0@sha256:2b6bb4e5ec4a8ba9b8e0b5e1b2a4a8f0c1ac8d7d6e8f3d6c0c2b5f9a1e4d7c3b",
+		"6.3.0@sha256:2b6bb4e5ec4a8ba9b8e0b5e1b2a4a8f0c1ac8d7d6e8f3d6c0c2b5f9a1e4d7c3b"),
+	Entry("of Flux sources",
+		"main@sha1:4b825dc642cb6eb9a060e54bf8d69288fbee4904",
+		"main@sha1:4b825dc642cb6eb9a060e54bf8d69288fbee4904"),
+	Entry("of 40 characters which are not a commit", "release-2023-03-01-podinfo-6.3.0-hotfix1", "release-2023-03-01-podinfo-6.3.0-hotfix1"),
+	Entry("without a revision", "", ""),
+)
@@ -0,0 +1,240 @@
+/*
+Copyright 2023 Thomas Stadler <thomas@thomasst.xyz>.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	admissionv1 "k8s.io/api/admission/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+// SetupWebhookWithManager registers the webhooks of Promotion with the manager.
+//
+// Unlike the other kinds, the validating webhook is registered as an
+// admission.Handler, since webhook.Validator cannot return warnings.
+// The clusterResourceNamespace holds the ReferenceGrants which permit
+// promoting to ClusterEnvironments, like for the PromotionReconciler.
+func (r *Promotion) SetupWebhookWithManager(mgr ctrl.Manager, clusterResourceNamespace string) error {
+	// registers the conversion webhook
+	if err := ctrl.NewWebhookManagedBy(mgr).For(r).Complete(); err != nil {
+		return err
+	}
+
+	decoder, err := admission.NewDecoder(mgr.GetScheme())
+	if err != nil {
+		return err
+	}
+
+	mgr.GetWebhookServer().Register("/validate-api-release-promotion-operator-io-v1alpha1-promotion", &webhook.Admission{
+		Handler: &promotionValidator{
+			client:                   mgr.GetClient(),
+			decoder:                  decoder,
+			clusterResourceNamespace: clusterResourceNamespace,
+		},
+	})
+	return nil
+}
+
+//+kubebuilder:webhook:path=/validate-api-release-promotion-operator-io-v1alpha1-promotion,mutating=false,failurePolicy=fail,sideEffects=None,groups=api.release-promotion-operator.io,resources=promotions,verbs=create;update,versions=v1alpha1,name=vpromotion.kb.io,admissionReviewVersions=v1
+
+// promotionValidator validates Promotions and warns about
+// references to objects which do not exist (yet).
+type promotionValidator struct {
+	client  client.Reader
+	decoder *admission.Decoder
+	// clusterResourceNamespace is the namespace in which the
+	// ReferenceGrants for ClusterEnvironments are created.
+	clusterResourceNamespace string
+}
+
+// Handle implements admission.Handler.
+func (v *promotionValidator) Handle(ctx context.Context, req admission.Request) admission.Response {
+	promotion := &Promotion{}
+	if err := v.decoder.Decode(req, promotion); err != nil {
+		return admission.Errored(http.StatusBadRequest, err)
+	}
+
+	if errs := promotion.validate(); len(errs) > 0 {
+		err := apierrors.NewInvalid(GroupVersion.WithKind("Promotion").GroupKind(), promotion.Name, errs)
+		return admission.Response{AdmissionResponse: admissionv1.AdmissionResponse{
+			Allowed: false,
+			Result:  &err.ErrStatus,
+		}}
+	}
+
+	warnings, err := v.missingReferences(ctx, promotion)
+	if err != nil {
+		return admission.Errored(http.StatusInternalServerError, err)
+	}
+	return admission.Allowed("").WithWarnings(warnings...)
+}
+
+// missingReferences returns a warning for each object referenced by the Promotion
+// which does not exist, or which needs a ReferenceGrant but is not permitted by any.
+func (v *promotionValidator) missingReferences(ctx context.Context, promotion *Promotion) ([]string, error) {
+	refs := []struct {
+		kind string
+		key  types.NamespacedName
+		obj  client.Object
+		// destination is true for the Environment promoted to.
+		destination bool
+	}{
+		{promotion.FromEnvironmentKind(), promotion.FromEnvironmentKey(), &Environment{}, false},
+		{promotion.ToEnvironmentKind(), promotion.ToEnvironmentKey(), &Environment{}, true},
+		{promotion.TemplateKind(), promotion.TemplateKey(), &PromotionTemplate{}, false},
+	}
+
+	var warnings []string
+	for _, ref := range refs {
+		switch ref.kind {
+		case ClusterEnvironmentKind:
+			ref.obj = &ClusterEnvironment{}
+		case ClusterPromotionTemplateKind:
+			ref.obj = &ClusterPromotionTemplate{}
+		}
+
+		err := v.client.Get(ctx, ref.key, ref.obj)
+		if apierrors.IsNotFound(err) {
+			if IsClusterScoped(ref.kind) {
+				warnings = append(warnings, fmt.Sprintf("%s %q does not exist", ref.kind, ref.key.Name))
+			} else {
+				warnings = append(warnings, fmt.Sprintf("%s %q does not exist in namespace %q", ref.kind, ref.key.Name, ref.key.Namespace))
+			}
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		// Promoting to a ClusterEnvironment must be granted in the cluster resource
+		// namespace, while other cluster-scoped objects can be referenced from all namespaces.
+		var grantNamespace string
+		switch {
+		case ref.kind == ClusterEnvironmentKind && ref.destination:
+			grantNamespace = v.clusterResourceNamespace
+		case IsClusterScoped(ref.kind) || ref.key.Namespace == promotion.Namespace:
+			continue
+		default:
+			grantNamespace = ref.key.Namespace
+		}
+		grants := &ReferenceGrantList{}
+		if err := v.client.List(ctx, grants, client.InNamespace(grantNamespace)); err != nil {
+			return nil, err
+		}
+		if grants.Permits(promotion.Namespace, ref.kind, ref.key.Name) {
+			continue
+		}
+		if IsClusterScoped(ref.kind) {
+			warnings = append(warnings, fmt.Sprintf("promoting to %s %q is not granted to namespace %q by any ReferenceGrant in namespace %q",
+				ref.kind, ref.key.Name, promotion.Namespace, grantNamespace))
+		} else {
+			warnings = append(warnings, fmt.Sprintf("%s %q in namespace %q is not granted to namespace %q by any ReferenceGrant",
+				ref.kind, ref.key.Name, ref.key.Namespace, promotion.Namespace))
+		}
+	}
+	return warnings, nil
+}
+
+func (r *Promotion) validate() field.ErrorList {
+	var allErrs field.ErrorList
+	specPath := field.NewPath("spec")
+
+	fromPath := specPath.Child("from", "environmentRef")
+	toPath := specPath.Child("to", "environmentRef")
+	allErrs = append(allErrs, validateName(fromPath.Child("name"), r.Spec.FromSpec.EnvironmentRef.Name)...)
+	allErrs = append(allErrs, validateReferenceNamespace(fromPath.Child("namespace"), r.FromEnvironmentKind(), r.Spec.FromSpec.EnvironmentRef.Namespace)...)
+	allErrs = append(allErrs, validateName(toPath.Child("name"), r.Spec.ToSpec.EnvironmentRef.Name)...)
+	allErrs = append(allErrs, validateReferenceNamespace(toPath.Child("namespace"), r.ToEnvironmentKind(), r.Spec.ToSpec.EnvironmentRef.Namespace)...)
+	if r.Spec.FromSpec.EnvironmentRef.Name != "" &&
+		r.FromEnvironmentKind() == r.ToEnvironmentKind() && r.FromEnvironmentKey() == r.ToEnvironmentKey() {
+		allErrs = append(allErrs, field.Invalid(toPath.Child("name"), r.Spec.ToSpec.EnvironmentRef.Name, "must differ from the source environment"))
+	}
+
+	templatePath := specPath.Child("templateRef")
+	allErrs = append(allErrs, validateName(templatePath.Child("name"), r.Spec.TemplateRef.Name)...)
+	allErrs = append(allErrs, validateReferenceNamespace(templatePath.Child("namespace"), r.TemplateKind(), r.Spec.TemplateRef.Namespace)...)
+
+	if r.Spec.ServiceAccountName != "" {
+		allErrs = append(allErrs, validateName(specPath.Child("serviceAccountName"), r.Spec.ServiceAccountName)...)
+	}
+
+	if r.Spec.Trigger != nil {
+		allErrs = append(allErrs, r.validateTrigger(specPath.Child("trigger"))...)
+	}
+
+	for i, ref := range r.Spec.ReadinessChecks.LocalObjectsRef {
+		refPath := specPath.Child("readinessChecks", "localObjectsRef").Index(i)
+		gvrPath := refPath.Child("groupVersionResource")
+		if ref.GroupVersionResource.Version == "" {
+			allErrs = append(allErrs, field.Required(gvrPath.Child("version"), ""))
+		}
+		if ref.GroupVersionResource.Resource == "" {
+			allErrs = append(allErrs, field.Required(gvrPath.Child("resource"), ""))
+		}
+		allErrs = append(allErrs, validateName(refPath.Child("name"), ref.Name)...)
+		if ref.KubeConfig != nil {
+			allErrs = append(allErrs, validateName(refPath.Child("kubeConfig", "secretRef", "name"), ref.KubeConfig.SecretRef.Name)...)
+		}
+	}
+
+	return allErrs
+}
+
+// validateTrigger validates that only the members of the trigger's type are set.
+func (r *Promotion) validateTrigger(fldPath *field.Path) field.ErrorList {
+	var allErrs field.ErrorList
+	trigger := r.Spec.Trigger
+
+	if trigger.Interval != nil {
+		if r.TriggerType() != RevisionTrigger {
+			allErrs = append(allErrs, field.Forbidden(fldPath.Child("interval"), "may only be set for the Revision trigger"))
+		} else if trigger.Interval.Duration <= 0 {
+			allErrs = append(allErrs, field.Invalid(fldPath.Child("interval"), trigger.Interval.Duration.String(), "must be positive"))
+		}
+	}
+
+	switch {
+	case r.TriggerType() != ScheduleTrigger && trigger.Schedule != "":
+		allErrs = append(allErrs, field.Forbidden(fldPath.Child("schedule"), "may only be set for the Schedule trigger"))
+	case r.TriggerType() == ScheduleTrigger && trigger.Schedule == "":
+		allErrs = append(allErrs, field.Required(fldPath.Child("schedule"), "must be set for the Schedule trigger"))
+	case r.TriggerType() == ScheduleTrigger:
+		if _, err := r.TriggerSchedule(); err != nil {
+			allErrs = append(allErrs, field.Invalid(fldPath.Child("schedule"), trigger.Schedule, err.Error()))
+		}
+	}
+
+	return allErrs
+}
+
+// validateReferenceNamespace validates the namespace of a reference,
+// which must be empty for cluster-scoped kinds.
+func validateReferenceNamespace(fldPath *field.Path, kind, namespace string) field.ErrorList {
+	if IsClusterScoped(kind) && namespace != "" {
+		return field.ErrorList{field.Forbidden(fldPath, fmt.Sprintf("must be empty for a %s", kind))}
+	}
+	return validateNamespace(fldPath, namespace)
+}
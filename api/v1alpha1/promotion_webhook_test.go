@@ -0,0 +1,322 @@
+/*
+Copyright 2023 Thomas Stadler <thomas@thomasst.xyz>.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	admissionv1 "k8s.io/api/admission/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+var _ = Describe("Promotion webhook", func() {
+	var namespace string
+
+	newPromotion := func(from, to, template string) *Promotion {
+		return &Promotion{
+			ObjectMeta: metav1.ObjectMeta{GenerateName: "promotion-", Namespace: namespace},
+			Spec: PromotionSpec{
+				FromSpec:    FromSpec{EnvironmentRef: EnvironmentReference{Name: from}},
+				ToSpec:      ToSpec{EnvironmentRef: EnvironmentReference{Name: to}},
+				TemplateRef: TemplateRef{Name: template},
+			},
+		}
+	}
+
+	BeforeEach(func() {
+		namespace = newNamespace()
+		warnings.pop()
+	})
+
+	It("rejects identical source and destination environments", func() {
+		err := k8sClient.Create(ctx, newPromotion("dev", "dev", "template"))
+		Expect(apierrors.IsInvalid(err)).To(BeTrue())
+		Expect(err.Error()).To(ContainSubstring("spec.to.environmentRef.name"))
+	})
+
+	It("rejects invalid reference names", func() {
+		err := k8sClient.Create(ctx, newPromotion("dev", "Prod_", "template"))
+		Expect(apierrors.IsInvalid(err)).To(BeTrue())
+		Expect(err.Error()).To(ContainSubstring("spec.to.environmentRef.name"))
+	})
+
+	It("rejects readiness checks with empty resource fields", func() {
+		promotion := newPromotion("dev", "prod", "template")
+		promotion.Spec.ReadinessChecks.LocalObjectsRef = []LocalObjectsRef{{
+			GroupVersionResource: metav1.GroupVersionResource{Group: "apps"},
+			Name:                 "podinfo",
+		}}
+		err := k8sClient.Create(ctx, promotion)
+		Expect(apierrors.IsInvalid(err)).To(BeTrue())
+		Expect(err.Error()).To(ContainSubstring("groupVersionResource.version"))
+		Expect(err.Error()).To(ContainSubstring("groupVersionResource.resource"))
+	})
+
+	It("rejects a Schedule trigger without a valid schedule", func() {
+		promotion := newPromotion("dev", "prod", "template")
+		promotion.Spec.Trigger = &Trigger{Type: ScheduleTrigger}
+		err := k8sClient.Create(ctx, promotion)
+		Expect(apierrors.IsInvalid(err)).To(BeTrue())
+		Expect(err.Error()).To(ContainSubstring("spec.trigger.schedule"))
+
+		promotion.Spec.Trigger.Schedule = "every morning"
+		err = k8sClient.Create(ctx, promotion)
+		Expect(apierrors.IsInvalid(err)).To(BeTrue())
+		Expect(err.Error()).To(ContainSubstring("spec.trigger.schedule"))
+	})
+
+	It("rejects an interval on a Manual trigger", func() {
+		promotion := newPromotion("dev", "prod", "template")
+		promotion.Spec.Trigger = &Trigger{Type: ManualTrigger, Interval: &metav1.Duration{Duration: time.Minute}}
+		err := k8sClient.Create(ctx, promotion)
+		Expect(apierrors.IsInvalid(err)).To(BeTrue())
+		Expect(err.Error()).To(ContainSubstring("spec.trigger.interval"))
+	})
+
+	It("warns about references to objects which do not exist", func() {
+		env := &Environment{
+			ObjectMeta: metav1.ObjectMeta{Name: "dev", Namespace: namespace},
+			Spec:       EnvironmentSpec{Source: &SourceSpec{URL: "https://example.com/dev.git"}},
+		}
+		Expect(k8sClient.Create(ctx, env)).To(Succeed())
+
+		Expect(k8sClient.Create(ctx, newPromotion("dev", "prod", "template"))).To(Succeed())
+		Expect(warnings.pop()).To(ConsistOf(
+			ContainSubstring(`Environment "prod" does not exist`),
+			ContainSubstring(`PromotionTemplate "template" does not exist`),
+		))
+	})
+
+	It("warns about cross-namespace references which are not granted", func() {
+		platform := newNamespace()
+		env := &Environment{
+			ObjectMeta: metav1.ObjectMeta{Name: "prod", Namespace: platform},
+			Spec:       EnvironmentSpec{Source: &SourceSpec{URL: "https://example.com/prod.git"}},
+		}
+		Expect(k8sClient.Create(ctx, env)).To(Succeed())
+
+		promotion := newPromotion("dev", "prod", "template")
+		promotion.Spec.ToSpec.EnvironmentRef.Namespace = platform
+		Expect(k8sClient.Create(ctx, promotion)).To(Succeed())
+		Expect(warnings.pop()).To(ContainElement(
+			ContainSubstring(`Environment "prod" in namespace %q is not granted to namespace %q`, platform, namespace),
+		))
+
+		grant := &ReferenceGrant{
+			ObjectMeta: metav1.ObjectMeta{Name: "promotions", Namespace: platform},
+			Spec: ReferenceGrantSpec{
+				From: []ReferenceGrantFrom{{Namespace: namespace}},
+				To:   []ReferenceGrantTo{{Kind: EnvironmentKind, Name: "prod"}},
+			},
+		}
+		Expect(k8sClient.Create(ctx, grant)).To(Succeed())
+
+		Eventually(func() []string {
+			promotion := newPromotion("dev", "prod", "template")
+			promotion.Spec.ToSpec.EnvironmentRef.Namespace = platform
+			Expect(k8sClient.Create(ctx, promotion)).To(Succeed())
+			return warnings.pop()
+		}).ShouldNot(ContainElement(ContainSubstring("is not granted")))
+	})
+
+	It("warns about promoting to ClusterEnvironments which are not granted", func() {
+		env := &ClusterEnvironment{
+			ObjectMeta: metav1.ObjectMeta{GenerateName: "prod-"},
+			Spec:       EnvironmentSpec{Source: &SourceSpec{URL: "https://example.com/prod.git"}},
+		}
+		Expect(k8sClient.Create(ctx, env)).To(Succeed())
+
+		newClusterPromotion := func() *Promotion {
+			promotion := newPromotion("dev", env.Name, "template")
+			promotion.Spec.ToSpec.EnvironmentRef.Kind = ClusterEnvironmentKind
+			return promotion
+		}
+		Expect(k8sClient.Create(ctx, newClusterPromotion())).To(Succeed())
+		Expect(warnings.pop()).To(ContainElement(
+			ContainSubstring(`promoting to ClusterEnvironment %q is not granted to namespace %q by any ReferenceGrant in namespace %q`,
+				env.Name, namespace, clusterResourceNamespace),
+		))
+
+		grant := &ReferenceGrant{
+			ObjectMeta: metav1.ObjectMeta{GenerateName: "promotions-", Namespace: clusterResourceNamespace},
+			Spec: ReferenceGrantSpec{
+				From: []ReferenceGrantFrom{{Namespace: namespace}},
+				To:   []ReferenceGrantTo{{Kind: ClusterEnvironmentKind, Name: env.Name}},
+			},
+		}
+		Expect(k8sClient.Create(ctx, grant)).To(Succeed())
+
+		Eventually(func() []string {
+			Expect(k8sClient.Create(ctx, newClusterPromotion())).To(Succeed())
+			return warnings.pop()
+		}).ShouldNot(ContainElement(ContainSubstring("is not granted")))
+	})
+
+	It("rejects a namespace on references to cluster-scoped kinds", func() {
+		promotion := newPromotion("dev", "prod", "template")
+		promotion.Spec.TemplateRef.Kind = ClusterPromotionTemplateKind
+		promotion.Spec.TemplateRef.Namespace = namespace
+		err := k8sClient.Create(ctx, promotion)
+		Expect(apierrors.IsInvalid(err)).To(BeTrue())
+		Expect(err.Error()).To(ContainSubstring("spec.templateRef.namespace"))
+	})
+
+	It("resolves references to cluster-scoped kinds", func() {
+		template := &ClusterPromotionTemplate{
+			ObjectMeta: metav1.ObjectMeta{GenerateName: "template-"},
+			Spec:       PromotionTemplateSpec{CopySpec: []CopyOperation{{Source: "app", Destination: "app"}}},
+		}
+		Expect(k8sClient.Create(ctx, template)).To(Succeed())
+
+		promotion := newPromotion("dev", "prod", template.Name)
+		promotion.Spec.TemplateRef.Kind = ClusterPromotionTemplateKind
+		Expect(k8sClient.Create(ctx, promotion)).To(Succeed())
+		Expect(warnings.pop()).NotTo(ContainElement(ContainSubstring("PromotionTemplate")))
+	})
+})
+
+var _ = Describe("Promotion reference warnings", func() {
+	var (
+		objects   []client.Object
+		promotion *Promotion
+	)
+
+	missingReferences := func() []string {
+		scheme := runtime.NewScheme()
+		Expect(AddToScheme(scheme)).To(Succeed())
+		v := &promotionValidator{
+			client:                   fake.NewClientBuilder().WithScheme(scheme).WithObjects(objects...).Build(),
+			clusterResourceNamespace: "platform",
+		}
+		warnings, err := v.missingReferences(context.Background(), promotion)
+		Expect(err).NotTo(HaveOccurred())
+		return warnings
+	}
+
+	BeforeEach(func() {
+		objects = []client.Object{
+			&Environment{ObjectMeta: metav1.ObjectMeta{Name: "dev", Namespace: "apps"}},
+			&ClusterEnvironment{ObjectMeta: metav1.ObjectMeta{Name: "prod"}},
+			&PromotionTemplate{ObjectMeta: metav1.ObjectMeta{Name: "template", Namespace: "apps"}},
+		}
+		promotion = &Promotion{
+			ObjectMeta: metav1.ObjectMeta{Name: "dev-to-prod", Namespace: "apps"},
+			Spec: PromotionSpec{
+				FromSpec:    FromSpec{EnvironmentRef: EnvironmentReference{Name: "dev"}},
+				ToSpec:      ToSpec{EnvironmentRef: EnvironmentReference{Name: "prod", Kind: ClusterEnvironmentKind}},
+				TemplateRef: TemplateRef{Name: "template"},
+			},
+		}
+	})
+
+	It("warns about promoting to a ClusterEnvironment which is not granted", func() {
+		Expect(missingReferences()).To(ConsistOf(
+			`promoting to ClusterEnvironment "prod" is not granted to namespace "apps" by any ReferenceGrant in namespace "platform"`,
+		))
+	})
+
+	It("accepts promoting to a ClusterEnvironment granted in the cluster resource namespace", func() {
+		objects = append(objects, &ReferenceGrant{
+			ObjectMeta: metav1.ObjectMeta{Name: "promotions", Namespace: "platform"},
+			Spec: ReferenceGrantSpec{
+				From: []ReferenceGrantFrom{{Namespace: "apps"}},
+				To:   []ReferenceGrantTo{{Kind: ClusterEnvironmentKind, Name: "prod"}},
+			},
+		})
+		Expect(missingReferences()).To(BeEmpty())
+	})
+
+	It("accepts promoting from a ClusterEnvironment without a grant", func() {
+		promotion.Spec.FromSpec.EnvironmentRef = EnvironmentReference{Name: "prod", Kind: ClusterEnvironmentKind}
+		promotion.Spec.ToSpec.EnvironmentRef = EnvironmentReference{Name: "dev"}
+		Expect(missingReferences()).To(BeEmpty())
+	})
+})
+
+var _ = Describe("Promotion validation", func() {
+	var promotion *Promotion
+
+	handle := func(operation admissionv1.Operation) admission.Response {
+		scheme := runtime.NewScheme()
+		Expect(AddToScheme(scheme)).To(Succeed())
+		decoder, err := admission.NewDecoder(scheme)
+		Expect(err).NotTo(HaveOccurred())
+		v := &promotionValidator{
+			client:  fake.NewClientBuilder().WithScheme(scheme).Build(),
+			decoder: decoder,
+		}
+
+		raw, err := json.Marshal(promotion)
+		Expect(err).NotTo(HaveOccurred())
+		return v.Handle(context.Background(), admission.Request{AdmissionRequest: admissionv1.AdmissionRequest{
+			Operation: operation,
+			Object:    runtime.RawExtension{Raw: raw},
+		}})
+	}
+
+	BeforeEach(func() {
+		promotion = &Promotion{
+			TypeMeta:   metav1.TypeMeta{APIVersion: GroupVersion.String(), Kind: "Promotion"},
+			ObjectMeta: metav1.ObjectMeta{Name: "dev-to-prod", Namespace: "apps"},
+			Spec: PromotionSpec{
+				FromSpec:    FromSpec{EnvironmentRef: EnvironmentReference{Name: "dev"}},
+				ToSpec:      ToSpec{EnvironmentRef: EnvironmentReference{Name: "prod"}},
+				TemplateRef: TemplateRef{Name: "template"},
+			},
+		}
+	})
+
+	It("allows valid Promotions with warnings about missing references", func() {
+		for _, operation := range []admissionv1.Operation{admissionv1.Create, admissionv1.Update} {
+			response := handle(operation)
+			Expect(response.Allowed).To(BeTrue())
+			Expect(response.Warnings).To(ConsistOf(
+				`Environment "dev" does not exist in namespace "apps"`,
+				`Environment "prod" does not exist in namespace "apps"`,
+				`PromotionTemplate "template" does not exist in namespace "apps"`,
+			))
+		}
+	})
+
+	DescribeTable("denies invalid Promotions on create and update",
+		func(mutate func(), field string) {
+			mutate()
+			for _, operation := range []admissionv1.Operation{admissionv1.Create, admissionv1.Update} {
+				response := handle(operation)
+				Expect(response.Allowed).To(BeFalse())
+				Expect(response.Result.Reason).To(Equal(metav1.StatusReasonInvalid))
+				Expect(response.Result.Message).To(ContainSubstring(field))
+			}
+		},
+		Entry("identical environments", func() { promotion.Spec.ToSpec.EnvironmentRef.Name = "dev" }, "spec.to.environmentRef.name"),
+		Entry("invalid template name", func() { promotion.Spec.TemplateRef.Name = "Template_" }, "spec.templateRef.name"),
+		Entry("empty resource fields", func() {
+			promotion.Spec.ReadinessChecks.LocalObjectsRef = []LocalObjectsRef{{Name: "podinfo"}}
+		}, "groupVersionResource.resource"),
+		Entry("Schedule trigger without a schedule", func() { promotion.Spec.Trigger = &Trigger{Type: ScheduleTrigger} }, "spec.trigger.schedule"),
+	)
+})
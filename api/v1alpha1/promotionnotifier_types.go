@@ -0,0 +1,181 @@
+/*
+Copyright 2023 Thomas Stadler <thomas@thomasst.xyz>.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// NotificationProviderType is the kind of service notifications are sent to.
+// +kubebuilder:validation:Enum=slack;msteams;generic;cloudevents
+type NotificationProviderType string
+
+const (
+	// SlackProvider posts messages to Slack-compatible incoming webhooks.
+	SlackProvider NotificationProviderType = "slack"
+	// MSTeamsProvider posts message cards to Microsoft Teams incoming webhooks.
+	MSTeamsProvider NotificationProviderType = "msteams"
+	// GenericProvider posts the event as JSON, signed with HMAC-SHA256 if a key is configured.
+	GenericProvider NotificationProviderType = "generic"
+	// CloudEventsProvider posts the event as a CloudEvent in structured content mode.
+	CloudEventsProvider NotificationProviderType = "cloudevents"
+)
+
+// PromotionEventType is a stage in the lifecycle of a promotion.
+// +kubebuilder:validation:Enum=Started;Blocked;PullRequestOpened;Succeeded;Failed;Superseded;RolledBack
+type PromotionEventType string
+
+const (
+	// PromotionStartedEvent is sent when the promotion of a source revision starts.
+	PromotionStartedEvent PromotionEventType = "Started"
+	// PromotionBlockedEvent is sent when a Promotion becomes blocked, e.g. by its readiness checks.
+	PromotionBlockedEvent PromotionEventType = "Blocked"
+	// PullRequestOpenedEvent is sent when the pull-request strategy opened a pull request,
+	// with the URL of the pull request.
+	PullRequestOpenedEvent PromotionEventType = "PullRequestOpened"
+	// PromotionSucceededEvent is sent when a source revision has been promoted.
+	PromotionSucceededEvent PromotionEventType = "Succeeded"
+	// PromotionFailedEvent is sent when the promotion of a source revision failed.
+	PromotionFailedEvent PromotionEventType = "Failed"
+	// PromotionSupersededEvent is sent when a started promotion has been abandoned,
+	// as the source environment moved on to a revision waiting for approval.
+	PromotionSupersededEvent PromotionEventType = "Superseded"
+	// PromotionRolledBackEvent is sent when a source revision which had been
+	// superseded by later promotions has been promoted again.
+	PromotionRolledBackEvent PromotionEventType = "RolledBack"
+)
+
+// Keys of the Secret referenced by a PromotionNotifier.
+const (
+	// NotifierAddressKey holds the address, overriding spec.address.
+	NotifierAddressKey = "address"
+	// NotifierHMACKey holds the key the payloads of the generic provider are signed with.
+	NotifierHMACKey = "hmacKey"
+)
+
+// DefaultNotificationRetries is the number of retries if spec.retries is not set.
+const DefaultNotificationRetries = 3
+
+// PromotionNotifierSpec defines the desired state of PromotionNotifier
+type PromotionNotifierSpec struct {
+	// Type of the service the notifications are sent to.
+	// +required
+	Type NotificationProviderType `json:"type"`
+
+	// Address is the URL the notifications are posted to.
+	// Webhook URLs embedding credentials should be set in the Secret instead.
+	// +optional
+	Address string `json:"address,omitempty"`
+
+	// SecretRef references a Secret in the namespace of the PromotionNotifier,
+	// which may hold the 'address' and, for the generic provider, the 'hmacKey'.
+	// The Secret is read with the ServiceAccount of the Promotion an event is sent for.
+	// +optional
+	SecretRef *LocalObjectReference `json:"secretRef,omitempty"`
+
+	// PromotionSelector selects the Promotions in the namespace of the PromotionNotifier
+	// whose events are sent. If empty, the events of all Promotions are sent.
+	// +optional
+	PromotionSelector *metav1.LabelSelector `json:"promotionSelector,omitempty"`
+
+	// Events lists the types of events which are sent. If empty, all events are sent.
+	// +optional
+	Events []PromotionEventType `json:"events,omitempty"`
+
+	// Retries is the number of times the delivery of a notification is retried,
+	// with exponential backoff. Defaults to 3.
+	// +kubebuilder:validation:Minimum=0
+	// +kubebuilder:validation:Maximum=10
+	// +optional
+	Retries *int32 `json:"retries,omitempty"`
+
+	// RateLimit limits the number of notifications sent by the PromotionNotifier,
+	// notifications exceeding the limit are dropped.
+	// +optional
+	RateLimit *NotificationRateLimit `json:"rateLimit,omitempty"`
+}
+
+// NotificationRateLimit allows a number of notifications per period.
+type NotificationRateLimit struct {
+	// Events is the number of notifications allowed per period.
+	// +kubebuilder:validation:Minimum=1
+	// +required
+	Events int32 `json:"events"`
+
+	// Period in which Events notifications are allowed.
+	// +required
+	Period metav1.Duration `json:"period"`
+}
+
+//+kubebuilder:object:root=true
+//+kubebuilder:printcolumn:name="Type",type=string,JSONPath=`.spec.type`
+//+kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
+
+// PromotionNotifier sends the lifecycle events of Promotions
+// in its namespace to a chat or webhook service.
+type PromotionNotifier struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec PromotionNotifierSpec `json:"spec,omitempty"`
+}
+
+// Subscribes returns true if the PromotionNotifier sends events of the type.
+func (in *PromotionNotifier) Subscribes(eventType PromotionEventType) bool {
+	if len(in.Spec.Events) == 0 {
+		return true
+	}
+	for _, t := range in.Spec.Events {
+		if t == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+// GetRetries returns the number of retries, defaulting to DefaultNotificationRetries.
+func (in *PromotionNotifier) GetRetries() int {
+	if in.Spec.Retries == nil {
+		return DefaultNotificationRetries
+	}
+	return int(*in.Spec.Retries)
+}
+
+// GetRateLimit returns the minimum interval between notifications and the burst
+// of notifications allowed, or zero values if the PromotionNotifier is not rate limited.
+func (in *PromotionNotifier) GetRateLimit() (time.Duration, int) {
+	if in.Spec.RateLimit == nil || in.Spec.RateLimit.Events <= 0 {
+		return 0, 0
+	}
+	events := int(in.Spec.RateLimit.Events)
+	return in.Spec.RateLimit.Period.Duration / time.Duration(events), events
+}
+
+//+kubebuilder:object:root=true
+
+// PromotionNotifierList contains a list of PromotionNotifier
+type PromotionNotifierList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []PromotionNotifier `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&PromotionNotifier{}, &PromotionNotifierList{})
+}
@@ -0,0 +1,101 @@
+/*
+Copyright 2023 Thomas Stadler <thomas@thomasst.xyz>.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"github.com/google/go-containerregistry/pkg/name"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+)
+
+// SetupWebhookWithManager registers the webhooks of PromotionTemplate with the manager.
+func (r *PromotionTemplate) SetupWebhookWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewWebhookManagedBy(mgr).
+		For(r).
+		Complete()
+}
+
+//+kubebuilder:webhook:path=/validate-api-release-promotion-operator-io-v1alpha1-promotiontemplate,mutating=false,failurePolicy=fail,sideEffects=None,groups=api.release-promotion-operator.io,resources=promotiontemplates,verbs=create;update,versions=v1alpha1,name=vpromotiontemplate.kb.io,admissionReviewVersions=v1
+
+var _ webhook.Validator = &PromotionTemplate{}
+
+// ValidateCreate implements webhook.Validator so a webhook will be registered for the type
+func (r *PromotionTemplate) ValidateCreate() error {
+	return r.validate()
+}
+
+// ValidateUpdate implements webhook.Validator so a webhook will be registered for the type
+func (r *PromotionTemplate) ValidateUpdate(old runtime.Object) error {
+	return r.validate()
+}
+
+// ValidateDelete implements webhook.Validator so a webhook will be registered for the type
+func (r *PromotionTemplate) ValidateDelete() error {
+	return nil
+}
+
+func (r *PromotionTemplate) validate() error {
+	allErrs := r.Spec.validate(field.NewPath("spec"))
+	if len(allErrs) == 0 {
+		return nil
+	}
+	return apierrors.NewInvalid(GroupVersion.WithKind(PromotionTemplateKind).GroupKind(), r.Name, allErrs)
+}
+
+func (in *PromotionTemplateSpec) validate(specPath *field.Path) field.ErrorList {
+	var allErrs field.ErrorList
+
+	for i, op := range in.CopySpec {
+		opPath := specPath.Child("copy").Index(i)
+		allErrs = append(allErrs, validateCopyPath(opPath.Child("source"), op.Source)...)
+		allErrs = append(allErrs, validateCopyPath(opPath.Child("destination"), op.Destination)...)
+	}
+	for i, op := range in.Images {
+		opPath := specPath.Child("images").Index(i)
+		if op.Name != "" {
+			if _, err := name.NewRepository(op.Name, name.StrictValidation); err != nil {
+				allErrs = append(allErrs, field.Invalid(opPath.Child("name"), op.Name, err.Error()))
+			}
+		}
+		for j, p := range op.Paths {
+			allErrs = append(allErrs, validateCopyPath(opPath.Child("paths").Index(j), p)...)
+		}
+	}
+	for i, op := range in.Charts {
+		opPath := specPath.Child("charts").Index(i)
+		if op.Name == "" {
+			allErrs = append(allErrs, field.Required(opPath.Child("name"), ""))
+		}
+		allErrs = append(allErrs, validateCopyPath(opPath.Child("source"), op.Source)...)
+		allErrs = append(allErrs, validateCopyPath(opPath.Child("destination"), op.Destination)...)
+	}
+	if len(in.CopySpec) == 0 && len(in.Images) == 0 && len(in.Charts) == 0 {
+		allErrs = append(allErrs, field.Required(specPath.Child("copy"), "either copy, image or chart operations must be specified"))
+	}
+
+	return allErrs
+}
+
+func validateCopyPath(fldPath *field.Path, p string) field.ErrorList {
+	if p == "" {
+		return field.ErrorList{field.Required(fldPath, "")}
+	}
+	return validateRelativePath(fldPath, p)
+}
@@ -0,0 +1,113 @@
+/*
+Copyright 2023 Thomas Stadler <thomas@thomasst.xyz>.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+var _ = Describe("PromotionTemplate webhook", func() {
+	newTemplate := func(ops ...CopyOperation) *PromotionTemplate {
+		return &PromotionTemplate{
+			ObjectMeta: metav1.ObjectMeta{GenerateName: "template-", Namespace: newNamespace()},
+			Spec:       PromotionTemplateSpec{CopySpec: ops},
+		}
+	}
+
+	It("accepts relative paths", func() {
+		Expect(k8sClient.Create(ctx, newTemplate(CopyOperation{Source: "settings", Destination: "./apps/settings"}))).To(Succeed())
+	})
+
+	DescribeTable("rejects invalid paths",
+		func(op CopyOperation, field string) {
+			err := k8sClient.Create(ctx, newTemplate(op))
+			Expect(apierrors.IsInvalid(err)).To(BeTrue())
+			Expect(err.Error()).To(ContainSubstring(field))
+		},
+		Entry("absolute source", CopyOperation{Source: "/etc", Destination: "settings"}, "spec.copy[0].source"),
+		Entry("escaping destination", CopyOperation{Source: "settings", Destination: "apps/../../settings"}, "spec.copy[0].destination"),
+	)
+
+	It("accepts image operations without copy operations", func() {
+		template := newTemplate()
+		template.Spec.Images = []ImageOperation{{Name: "ghcr.io/acme/podinfo", Paths: []string{"apps/podinfo"}}}
+		Expect(k8sClient.Create(ctx, template)).To(Succeed())
+	})
+
+	It("rejects templates without operations", func() {
+		err := k8sClient.Create(ctx, newTemplate())
+		Expect(apierrors.IsInvalid(err)).To(BeTrue())
+		Expect(err.Error()).To(ContainSubstring("spec.copy"))
+	})
+
+	It("rejects invalid image operations", func() {
+		template := newTemplate()
+		template.Spec.Images = []ImageOperation{{Name: "ghcr.io/Acme/podinfo", Paths: []string{"../apps"}}}
+		err := k8sClient.Create(ctx, template)
+		Expect(apierrors.IsInvalid(err)).To(BeTrue())
+		Expect(err.Error()).To(ContainSubstring("spec.images[0].name"))
+		Expect(err.Error()).To(ContainSubstring("spec.images[0].paths[0]"))
+	})
+
+	It("rejects chart operations without a name or files", func() {
+		template := newTemplate()
+		template.Spec.Charts = []ChartOperation{{Source: "podinfo.yaml"}}
+		err := k8sClient.Create(ctx, template)
+		Expect(apierrors.IsInvalid(err)).To(BeTrue())
+		Expect(err.Error()).To(ContainSubstring("spec.charts[0].name"))
+		Expect(err.Error()).To(ContainSubstring("spec.charts[0].destination"))
+	})
+})
+
+var _ = Describe("PromotionTemplate validation", func() {
+	newTemplate := func(ops ...CopyOperation) *PromotionTemplate {
+		return &PromotionTemplate{
+			ObjectMeta: metav1.ObjectMeta{Name: "template", Namespace: "apps"},
+			Spec:       PromotionTemplateSpec{CopySpec: ops},
+		}
+	}
+
+	It("accepts relative paths", func() {
+		template := newTemplate(CopyOperation{Source: "settings", Destination: "./apps/settings"})
+		Expect(template.ValidateCreate()).To(Succeed())
+		Expect(template.ValidateUpdate(template.DeepCopy())).To(Succeed())
+		Expect(template.ValidateDelete()).To(Succeed())
+	})
+
+	DescribeTable("rejects invalid paths on create and update",
+		func(op CopyOperation, field string) {
+			template := newTemplate(op)
+			for _, err := range []error{template.ValidateCreate(), template.ValidateUpdate(newTemplate())} {
+				Expect(apierrors.IsInvalid(err)).To(BeTrue())
+				Expect(err.Error()).To(ContainSubstring(field))
+			}
+		},
+		Entry("absolute source", CopyOperation{Source: "/etc", Destination: "settings"}, "spec.copy[0].source"),
+		Entry("escaping destination", CopyOperation{Source: "settings", Destination: "apps/../../settings"}, "spec.copy[0].destination"),
+		Entry("empty destination", CopyOperation{Source: "settings"}, "spec.copy[0].destination"),
+	)
+
+	It("rejects templates without operations", func() {
+		err := newTemplate().ValidateCreate()
+		Expect(apierrors.IsInvalid(err)).To(BeTrue())
+		Expect(err.Error()).To(ContainSubstring("spec.copy"))
+	})
+})
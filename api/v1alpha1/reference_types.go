@@ -19,7 +19,37 @@ package v1alpha1
 // EnvironmentReference contains a reference to an
 // Environment resource object.
 type EnvironmentReference struct {
+	// Kind of the referent, either 'Environment' or 'ClusterEnvironment'.
+	// Defaults to 'Environment'.
+	// +kubebuilder:validation:Enum=Environment;ClusterEnvironment
+	// +optional
+	Kind string `json:"kind,omitempty"`
+
+	// Name of the referent.
+	// +required
+	Name string `json:"name"`
+
+	// Namespace of the referent, defaults to the namespace of the Promotion.
+	// Referencing an Environment in another namespace requires
+	// a ReferenceGrant in that namespace. Must be empty for a ClusterEnvironment.
+	// +optional
+	Namespace string `json:"namespace,omitempty"`
+}
+
+// LocalObjectReference contains a reference to an object
+// in the same namespace.
+type LocalObjectReference struct {
 	// Name of the referent.
 	// +required
 	Name string `json:"name"`
 }
+
+// KubeConfigReference contains a reference to a Secret holding a kubeconfig.
+type KubeConfigReference struct {
+	// SecretRef references a Secret in the namespace of the Promotion.
+	// The kubeconfig is read from the 'value' or the 'value.yaml' key.
+	// It must embed its credentials: exec credential plugins, auth providers
+	// and references to files are rejected.
+	// +required
+	SecretRef LocalObjectReference `json:"secretRef"`
+}
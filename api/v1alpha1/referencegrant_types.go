@@ -0,0 +1,122 @@
+/*
+Copyright 2023 Thomas Stadler <thomas@thomasst.xyz>.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// Kinds which can be referenced by a Promotion.
+const (
+	EnvironmentKind              = "Environment"
+	ClusterEnvironmentKind       = "ClusterEnvironment"
+	PromotionTemplateKind        = "PromotionTemplate"
+	ClusterPromotionTemplateKind = "ClusterPromotionTemplate"
+)
+
+// ReferenceGrantSpec defines the desired state of ReferenceGrant
+type ReferenceGrantSpec struct {
+	// From lists the namespaces whose Promotions may reference
+	// the objects listed in To.
+	// +kubebuilder:validation:MinItems=1
+	// +required
+	From []ReferenceGrantFrom `json:"from"`
+
+	// To lists the objects in the namespace of the ReferenceGrant
+	// which may be referenced.
+	// +kubebuilder:validation:MinItems=1
+	// +required
+	To []ReferenceGrantTo `json:"to"`
+}
+
+// ReferenceGrantFrom describes where references may originate from.
+type ReferenceGrantFrom struct {
+	// Namespace of the referencing Promotions.
+	// +required
+	Namespace string `json:"namespace"`
+}
+
+// ReferenceGrantTo describes which objects may be referenced.
+type ReferenceGrantTo struct {
+	// Kind of the referent. Promoting to a ClusterEnvironment
+	// is granted in the cluster resource namespace of the operator.
+	// +kubebuilder:validation:Enum=Environment;PromotionTemplate;ClusterEnvironment
+	// +required
+	Kind string `json:"kind"`
+
+	// Name of the referent. If empty, all objects of the kind may be referenced.
+	// +optional
+	Name string `json:"name,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+
+// ReferenceGrant permits Promotions in other namespaces to reference
+// Environments and PromotionTemplates in the namespace of the ReferenceGrant.
+// In the cluster resource namespace of the operator, it permits promoting to ClusterEnvironments.
+type ReferenceGrant struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec ReferenceGrantSpec `json:"spec,omitempty"`
+}
+
+// Permits returns true if the ReferenceGrant permits Promotions in the namespace
+// from to reference the object of the kind with the name.
+func (in *ReferenceGrant) Permits(from, kind, name string) bool {
+	fromPermitted := false
+	for _, f := range in.Spec.From {
+		if f.Namespace == from {
+			fromPermitted = true
+			break
+		}
+	}
+	if !fromPermitted {
+		return false
+	}
+
+	for _, t := range in.Spec.To {
+		if t.Kind == kind && (t.Name == "" || t.Name == name) {
+			return true
+		}
+	}
+	return false
+}
+
+//+kubebuilder:object:root=true
+
+// ReferenceGrantList contains a list of ReferenceGrant
+type ReferenceGrantList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []ReferenceGrant `json:"items"`
+}
+
+// Permits returns true if any ReferenceGrant of the list permits Promotions
+// in the namespace from to reference the object of the kind with the name.
+func (in *ReferenceGrantList) Permits(from, kind, name string) bool {
+	for i := range in.Items {
+		if in.Items[i].Permits(from, kind, name) {
+			return true
+		}
+	}
+	return false
+}
+
+func init() {
+	SchemeBuilder.Register(&ReferenceGrant{}, &ReferenceGrantList{})
+}
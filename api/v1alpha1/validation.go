@@ -0,0 +1,62 @@
+/*
+Copyright 2023 Thomas Stadler <thomas@thomasst.xyz>.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"path"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+)
+
+// validateName validates the name of a referenced object.
+func validateName(fldPath *field.Path, name string) field.ErrorList {
+	if name == "" {
+		return field.ErrorList{field.Required(fldPath, "")}
+	}
+
+	var allErrs field.ErrorList
+	for _, msg := range validation.IsDNS1123Subdomain(name) {
+		allErrs = append(allErrs, field.Invalid(fldPath, name, msg))
+	}
+	return allErrs
+}
+
+// validateNamespace validates the optional namespace of a reference.
+func validateNamespace(fldPath *field.Path, namespace string) field.ErrorList {
+	var allErrs field.ErrorList
+	if namespace == "" {
+		return allErrs
+	}
+	for _, msg := range validation.IsDNS1123Label(namespace) {
+		allErrs = append(allErrs, field.Invalid(fldPath, namespace, msg))
+	}
+	return allErrs
+}
+
+// validateRelativePath validates that p is a path relative to,
+// and not escaping, the directory it is resolved in.
+func validateRelativePath(fldPath *field.Path, p string) field.ErrorList {
+	if strings.HasPrefix(p, "/") {
+		return field.ErrorList{field.Invalid(fldPath, p, "must be a relative path")}
+	}
+	if cleaned := path.Clean(p); cleaned == ".." || strings.HasPrefix(cleaned, "../") {
+		return field.ErrorList{field.Invalid(fldPath, p, "must not escape the environment directory")}
+	}
+	return nil
+}
@@ -0,0 +1,87 @@
+/*
+Copyright 2023 Thomas Stadler <thomas@thomasst.xyz>.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	"encoding/json"
+	"reflect"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// HubDataAnnotation preserves the fields of the hub version v1alpha1 which
+// cannot be represented in v1beta1, so that they survive a round trip
+// through v1beta1. It is only set if a round trip would lose data.
+const HubDataAnnotation = "api.release-promotion-operator.io/v1alpha1-data"
+
+// hubFields holds the spec and status of a hub object.
+type hubFields struct {
+	Spec   interface{} `json:"spec"`
+	Status interface{} `json:"status"`
+}
+
+// preserveHubData stores the hub fields in the HubDataAnnotation of the spoke,
+// unless they equal the fields of the hub converted back from the spoke.
+func preserveHubData(spoke metav1.Object, hub, roundTrip hubFields) error {
+	want, err := json.Marshal(hub)
+	if err != nil {
+		return err
+	}
+	got, err := json.Marshal(roundTrip)
+	if err != nil {
+		return err
+	}
+
+	var wantData, gotData interface{}
+	if err := json.Unmarshal(want, &wantData); err != nil {
+		return err
+	}
+	if err := json.Unmarshal(got, &gotData); err != nil {
+		return err
+	}
+	if reflect.DeepEqual(wantData, gotData) {
+		return nil
+	}
+
+	annotations := spoke.GetAnnotations()
+	if annotations == nil {
+		annotations = map[string]string{}
+	}
+	annotations[HubDataAnnotation] = string(want)
+	spoke.SetAnnotations(annotations)
+	return nil
+}
+
+// restoreHubData restores the hub fields preserved in the HubDataAnnotation of the
+// spoke into hub, which must hold pointers to the spec and status of the hub object.
+// The conversion then overwrites all fields which the spoke can represent.
+func restoreHubData(spoke metav1.Object, hub hubFields) error {
+	data, ok := spoke.GetAnnotations()[HubDataAnnotation]
+	if !ok {
+		return nil
+	}
+	return json.Unmarshal([]byte(data), &hub)
+}
+
+// convertObjectMetaToHub copies the ObjectMeta of the spoke without the HubDataAnnotation.
+func convertObjectMetaToHub(src *metav1.ObjectMeta, dst *metav1.ObjectMeta) {
+	src.DeepCopyInto(dst)
+	delete(dst.Annotations, HubDataAnnotation)
+	if len(dst.Annotations) == 0 {
+		dst.Annotations = nil
+	}
+}
@@ -0,0 +1,144 @@
+/*
+Copyright 2023 Thomas Stadler <thomas@thomasst.xyz>.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	fuzz "github.com/google/gofuzz"
+	apiequality "k8s.io/apimachinery/pkg/api/equality"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/conversion"
+
+	"github.com/thomasstxyz/release-promotion-operator/api/v1alpha1"
+)
+
+const fuzzIterations = 1000
+
+// fuzzFuncs leave the TypeMeta empty, which is set by the
+// conversion webhook rather than the conversion functions.
+var fuzzFuncs = []interface{}{
+	func(*metav1.TypeMeta, fuzz.Continue) {},
+}
+
+// spokeFuzzFuncs restrict the unions of v1beta1 to their valid states.
+var spokeFuzzFuncs = []interface{}{
+	func(s *PromotionStrategy, c fuzz.Continue) {
+		*s = PromotionStrategy{Type: DirectStrategy}
+		if c.RandBool() {
+			*s = PromotionStrategy{Type: PullRequestStrategy, PullRequest: &PullRequestOptions{}}
+		}
+	},
+	func(r *ReadinessCheck, c fuzz.Continue) {
+		r.Type = ObjectReadinessCheck
+		r.Object = &ObjectReference{}
+		c.Fuzz(r.Object)
+	},
+}
+
+func TestFuzzyConversion(t *testing.T) {
+	tests := []struct {
+		name  string
+		spoke func() conversion.Convertible
+		hub   func() conversion.Hub
+	}{
+		{
+			name:  "Environment",
+			spoke: func() conversion.Convertible { return &Environment{} },
+			hub:   func() conversion.Hub { return &v1alpha1.Environment{} },
+		},
+		{
+			name:  "PromotionTemplate",
+			spoke: func() conversion.Convertible { return &PromotionTemplate{} },
+			hub:   func() conversion.Hub { return &v1alpha1.PromotionTemplate{} },
+		},
+		{
+			name:  "Promotion",
+			spoke: func() conversion.Convertible { return &Promotion{} },
+			hub:   func() conversion.Hub { return &v1alpha1.Promotion{} },
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name+" spoke-hub-spoke", func(t *testing.T) {
+			f := fuzz.New().NilChance(0.3).Funcs(append(fuzzFuncs, spokeFuzzFuncs...)...)
+			for i := 0; i < fuzzIterations; i++ {
+				spoke := tt.spoke()
+				f.Fuzz(spoke)
+
+				hub := tt.hub()
+				if err := spoke.ConvertTo(hub); err != nil {
+					t.Fatalf("ConvertTo: %v", err)
+				}
+				got := tt.spoke()
+				if err := got.ConvertFrom(hub); err != nil {
+					t.Fatalf("ConvertFrom: %v", err)
+				}
+
+				if !apiequality.Semantic.DeepEqual(spoke, got) {
+					t.Fatalf("round trip changed the object (-want +got):\n%s", cmp.Diff(spoke, got))
+				}
+			}
+		})
+
+		t.Run(tt.name+" hub-spoke-hub", func(t *testing.T) {
+			f := fuzz.New().NilChance(0.3).Funcs(fuzzFuncs...)
+			for i := 0; i < fuzzIterations; i++ {
+				hub := tt.hub()
+				f.Fuzz(hub)
+
+				spoke := tt.spoke()
+				if err := spoke.ConvertFrom(hub); err != nil {
+					t.Fatalf("ConvertFrom: %v", err)
+				}
+				got := tt.hub()
+				if err := spoke.ConvertTo(got); err != nil {
+					t.Fatalf("ConvertTo: %v", err)
+				}
+
+				if !apiequality.Semantic.DeepEqual(hub, got) {
+					t.Fatalf("round trip changed the object (-want +got):\n%s", cmp.Diff(hub, got))
+				}
+			}
+		})
+	}
+}
+
+func TestConvertFromPreservesHubData(t *testing.T) {
+	hub := &v1alpha1.Promotion{}
+	hub.Annotations = map[string]string{"foo": "bar"}
+	hub.Spec.ReadinessChecks.LocalObjectsRef = []v1alpha1.LocalObjectsRef{{Name: "app"}}
+
+	spoke := &Promotion{}
+	if err := spoke.ConvertFrom(hub); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := spoke.Annotations[HubDataAnnotation]; ok {
+		t.Fatalf("unexpected %s annotation for a lossless conversion", HubDataAnnotation)
+	}
+
+	// Simulate a hub-only field by preserving data that differs from the spoke.
+	spoke.Annotations[HubDataAnnotation] = `{"spec":{"readinessChecks":{"localObjectsRef":[{"groupVersionResource":{"group":"","version":"","resource":""},"name":"stale"}]}},"status":{}}`
+	got := &v1alpha1.Promotion{}
+	if err := spoke.ConvertTo(got); err != nil {
+		t.Fatal(err)
+	}
+	if !apiequality.Semantic.DeepEqual(hub, got) {
+		t.Fatalf("spoke fields must take precedence over preserved hub data (-want +got):\n%s", cmp.Diff(hub, got))
+	}
+}
@@ -0,0 +1,200 @@
+/*
+Copyright 2023 Thomas Stadler <thomas@thomasst.xyz>.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	"sigs.k8s.io/controller-runtime/pkg/conversion"
+
+	"github.com/thomasstxyz/release-promotion-operator/api/v1alpha1"
+)
+
+// ConvertTo converts this Environment to the Hub version (v1alpha1).
+func (src *Environment) ConvertTo(dstRaw conversion.Hub) error {
+	dst := dstRaw.(*v1alpha1.Environment)
+	if err := restoreHubData(src, hubFields{&dst.Spec, &dst.Status}); err != nil {
+		return err
+	}
+	convertObjectMetaToHub(&src.ObjectMeta, &dst.ObjectMeta)
+
+	dst.Spec.Path = src.Spec.Path
+	dst.Status.LastPromotedVersion = src.Status.LastPromotedVersion
+	dst.Spec.SigningKey = nil
+	if src.Spec.SigningKey != nil {
+		dst.Spec.SigningKey = &v1alpha1.SigningKey{SecretRef: v1alpha1.LocalObjectReference(src.Spec.SigningKey.SecretRef)}
+	}
+	dst.Spec.Verify = nil
+	if src.Spec.Verify != nil {
+		dst.Spec.Verify = &v1alpha1.VerificationPolicy{SecretRef: v1alpha1.LocalObjectReference(src.Spec.Verify.SecretRef)}
+	}
+	dst.Spec.Decryption = nil
+	if src.Spec.Decryption != nil {
+		dst.Spec.Decryption = &v1alpha1.Decryption{SecretRef: v1alpha1.LocalObjectReference(src.Spec.Decryption.SecretRef)}
+	}
+	dst.Spec.Provider = nil
+	if src.Spec.Provider != nil {
+		dst.Spec.Provider = &v1alpha1.GitProvider{
+			Type:       v1alpha1.GitProviderType(src.Spec.Provider.Type),
+			APIURL:     src.Spec.Provider.APIURL,
+			Repository: src.Spec.Provider.Repository,
+			SecretRef:  v1alpha1.LocalObjectReference(src.Spec.Provider.SecretRef),
+		}
+	}
+	dst.Spec.SourceRef = nil
+	if src.Spec.SourceRef != nil {
+		sourceRef := v1alpha1.ArtifactSourceReference(*src.Spec.SourceRef)
+		dst.Spec.SourceRef = &sourceRef
+	}
+	dst.Spec.OCI = nil
+	if src.Spec.OCI != nil {
+		dst.Spec.OCI = &v1alpha1.OCIRepositorySpec{URL: src.Spec.OCI.URL, Tag: src.Spec.OCI.Tag, Insecure: src.Spec.OCI.Insecure}
+		if src.Spec.OCI.SecretRef != nil {
+			dst.Spec.OCI.SecretRef = &v1alpha1.LocalObjectReference{Name: src.Spec.OCI.SecretRef.Name}
+		}
+	}
+	dst.Spec.Image = nil
+	if src.Spec.Image != nil {
+		dst.Spec.Image = &v1alpha1.ImageRepositorySpec{
+			Repository: src.Spec.Image.Repository,
+			Policy:     v1alpha1.ImagePolicy(src.Spec.Image.Policy),
+			Insecure:   src.Spec.Image.Insecure,
+		}
+		if src.Spec.Image.SecretRef != nil {
+			dst.Spec.Image.SecretRef = &v1alpha1.LocalObjectReference{Name: src.Spec.Image.SecretRef.Name}
+		}
+	}
+	dst.Spec.Charts = nil
+	if src.Spec.Charts != nil {
+		dst.Spec.Charts = make([]v1alpha1.ChartConstraint, len(src.Spec.Charts))
+	}
+	for i, constraint := range src.Spec.Charts {
+		dst.Spec.Charts[i] = v1alpha1.ChartConstraint(constraint)
+	}
+	dst.Spec.VersionPolicy = nil
+	if src.Spec.VersionPolicy != nil {
+		versionPolicy := v1alpha1.VersionPolicy{
+			Source:      v1alpha1.VersionSource(src.Spec.VersionPolicy.Source),
+			SemVer:      src.Spec.VersionPolicy.SemVer,
+			NoDowngrade: src.Spec.VersionPolicy.NoDowngrade,
+			PreReleases: src.Spec.VersionPolicy.PreReleases,
+		}
+		dst.Spec.VersionPolicy = &versionPolicy
+	}
+	if src.Spec.Source == nil {
+		dst.Spec.Source = nil
+		return nil
+	}
+	if dst.Spec.Source == nil {
+		dst.Spec.Source = &v1alpha1.SourceSpec{}
+	}
+	dst.Spec.Source.URL = src.Spec.Source.URL
+	dst.Spec.Source.Reference = nil
+	if src.Spec.Source.Reference != nil {
+		dst.Spec.Source.Reference = &v1alpha1.GitRepositoryRef{Branch: src.Spec.Source.Reference.Branch}
+	}
+	dst.Spec.Source.SecretRef = nil
+	if src.Spec.Source.SecretRef != nil {
+		dst.Spec.Source.SecretRef = &v1alpha1.LocalObjectReference{Name: src.Spec.Source.SecretRef.Name}
+	}
+
+	return nil
+}
+
+// ConvertFrom converts from the Hub version (v1alpha1) to this version.
+func (dst *Environment) ConvertFrom(srcRaw conversion.Hub) error {
+	src := srcRaw.(*v1alpha1.Environment)
+	src.ObjectMeta.DeepCopyInto(&dst.ObjectMeta)
+
+	dst.Spec.Path = src.Spec.Path
+	dst.Status.LastPromotedVersion = src.Status.LastPromotedVersion
+	dst.Spec.SigningKey = nil
+	if src.Spec.SigningKey != nil {
+		dst.Spec.SigningKey = &SigningKey{SecretRef: LocalObjectReference(src.Spec.SigningKey.SecretRef)}
+	}
+	dst.Spec.Verify = nil
+	if src.Spec.Verify != nil {
+		dst.Spec.Verify = &VerificationPolicy{SecretRef: LocalObjectReference(src.Spec.Verify.SecretRef)}
+	}
+	dst.Spec.Decryption = nil
+	if src.Spec.Decryption != nil {
+		dst.Spec.Decryption = &Decryption{SecretRef: LocalObjectReference(src.Spec.Decryption.SecretRef)}
+	}
+	dst.Spec.Provider = nil
+	if src.Spec.Provider != nil {
+		dst.Spec.Provider = &GitProvider{
+			Type:       GitProviderType(src.Spec.Provider.Type),
+			APIURL:     src.Spec.Provider.APIURL,
+			Repository: src.Spec.Provider.Repository,
+			SecretRef:  LocalObjectReference(src.Spec.Provider.SecretRef),
+		}
+	}
+	dst.Spec.SourceRef = nil
+	if src.Spec.SourceRef != nil {
+		sourceRef := ArtifactSourceReference(*src.Spec.SourceRef)
+		dst.Spec.SourceRef = &sourceRef
+	}
+	dst.Spec.OCI = nil
+	if src.Spec.OCI != nil {
+		dst.Spec.OCI = &OCIRepositorySpec{URL: src.Spec.OCI.URL, Tag: src.Spec.OCI.Tag, Insecure: src.Spec.OCI.Insecure}
+		if src.Spec.OCI.SecretRef != nil {
+			dst.Spec.OCI.SecretRef = &LocalObjectReference{Name: src.Spec.OCI.SecretRef.Name}
+		}
+	}
+	dst.Spec.Image = nil
+	if src.Spec.Image != nil {
+		dst.Spec.Image = &ImageRepositorySpec{
+			Repository: src.Spec.Image.Repository,
+			Policy:     ImagePolicy(src.Spec.Image.Policy),
+			Insecure:   src.Spec.Image.Insecure,
+		}
+		if src.Spec.Image.SecretRef != nil {
+			dst.Spec.Image.SecretRef = &LocalObjectReference{Name: src.Spec.Image.SecretRef.Name}
+		}
+	}
+	dst.Spec.Charts = nil
+	if src.Spec.Charts != nil {
+		dst.Spec.Charts = make([]ChartConstraint, len(src.Spec.Charts))
+	}
+	for i, constraint := range src.Spec.Charts {
+		dst.Spec.Charts[i] = ChartConstraint(constraint)
+	}
+	dst.Spec.VersionPolicy = nil
+	if src.Spec.VersionPolicy != nil {
+		versionPolicy := VersionPolicy{
+			Source:      VersionSource(src.Spec.VersionPolicy.Source),
+			SemVer:      src.Spec.VersionPolicy.SemVer,
+			NoDowngrade: src.Spec.VersionPolicy.NoDowngrade,
+			PreReleases: src.Spec.VersionPolicy.PreReleases,
+		}
+		dst.Spec.VersionPolicy = &versionPolicy
+	}
+	dst.Spec.Source = nil
+	if src.Spec.Source != nil {
+		dst.Spec.Source = &SourceSpec{URL: src.Spec.Source.URL}
+		if src.Spec.Source.Reference != nil {
+			dst.Spec.Source.Reference = &GitRepositoryRef{Branch: src.Spec.Source.Reference.Branch}
+		}
+		if src.Spec.Source.SecretRef != nil {
+			dst.Spec.Source.SecretRef = &LocalObjectReference{Name: src.Spec.Source.SecretRef.Name}
+		}
+	}
+
+	roundTrip := &v1alpha1.Environment{}
+	if err := dst.ConvertTo(roundTrip); err != nil {
+		return err
+	}
+	return preserveHubData(dst, hubFields{src.Spec, src.Status}, hubFields{roundTrip.Spec, roundTrip.Status})
+}
@@ -0,0 +1,345 @@
+/*
+Copyright 2023 Thomas Stadler <thomas@thomasst.xyz>.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// EnvironmentSpec defines the desired state of Environment
+type EnvironmentSpec struct {
+	// Source specifies the source Git Repository.
+	// Exactly one of Source, SourceRef, OCI and Image must be set.
+	// +optional
+	Source *SourceSpec `json:"source,omitempty"`
+
+	// SourceRef references a Flux source object whose artifact holds the
+	// files of the environment, instead of cloning a Git repository.
+	// Environments with a SourceRef can only be promoted from.
+	// +optional
+	SourceRef *ArtifactSourceReference `json:"sourceRef,omitempty"`
+
+	// OCI specifies the tag of an OCI repository holding the artifact of the
+	// environment. Environments with an OCI repository are promoted by copying
+	// the artifact from the tag of the source environment to their tag, and can
+	// only be promoted to and from other environments with an OCI repository.
+	// +optional
+	OCI *OCIRepositorySpec `json:"oci,omitempty"`
+
+	// Image specifies an image repository whose tags are promoted instead of
+	// files. The revision of the environment is the tag selected by the policy,
+	// which the image operations of the PromotionTemplate write into the
+	// destination environment. Environments with an image repository can
+	// only be promoted from.
+	// +optional
+	Image *ImageRepositorySpec `json:"image,omitempty"`
+
+	// Path to the directory which represents the environment,
+	// relative to the root of the Source. Defaults to './'.
+	// +optional
+	Path string `json:"path,omitempty"`
+
+	// SigningKey specifies the key the commits promoted
+	// to this environment are signed with.
+	// +optional
+	SigningKey *SigningKey `json:"signingKey,omitempty"`
+
+	// Verify specifies the keys the commits of this environment must be
+	// signed with to be promoted to other environments.
+	// +optional
+	Verify *VerificationPolicy `json:"verify,omitempty"`
+
+	// Decryption specifies the keys to decrypt the SOPS-encrypted files
+	// of this environment with, when they are re-encrypted for another environment.
+	// +optional
+	Decryption *Decryption `json:"decryption,omitempty"`
+
+	// Provider specifies the Git hosting service of the Source. If set,
+	// promotions of this environment's commits are reported to it as
+	// commit statuses and deployments. Promotions to this environment with
+	// the pull-request strategy require it to open the pull requests.
+	// +optional
+	Provider *GitProvider `json:"provider,omitempty"`
+
+	// Charts constrains the versions of the Helm charts promoted to this
+	// environment by the chart operations of PromotionTemplates.
+	// +optional
+	Charts []ChartConstraint `json:"charts,omitempty"`
+
+	// VersionPolicy constrains the versions promoted to this environment.
+	// Promotions of versions violating the policy are blocked.
+	// +optional
+	VersionPolicy *VersionPolicy `json:"versionPolicy,omitempty"`
+}
+
+// VersionPolicy constrains the versions promoted to an environment,
+// which are extracted from the source environment of a promotion.
+type VersionPolicy struct {
+	// Source specifies where the version is extracted from.
+	// +optional
+	Source VersionSource `json:"source,omitempty"`
+
+	// SemVer is a range of semantic versions, e.g. '>=1.0.0 <2.0.0',
+	// the promoted versions must be in.
+	// +optional
+	SemVer string `json:"semver,omitempty"`
+
+	// NoDowngrade rejects versions lower than the version
+	// last promoted to the environment by any Promotion.
+	// +optional
+	NoDowngrade bool `json:"noDowngrade,omitempty"`
+
+	// PreReleases allows promoting pre-release versions, e.g. '2.0.0-rc.1'.
+	// +optional
+	PreReleases bool `json:"preReleases,omitempty"`
+}
+
+// VersionSource specifies where the version of a source environment is extracted from.
+// Without a file, the version is the tag of the source revision: the tag selected from
+// an image repository, or the tag of an OCI artifact or Flux source artifact revision,
+// e.g. 'v1.2.0' of 'v1.2.0@sha1:3f786850'.
+type VersionSource struct {
+	// File is the file in the source environment holding the version.
+	// +optional
+	File string `json:"file,omitempty"`
+
+	// Chart is the name of the Helm chart whose version is read from File,
+	// which is a Flux HelmRelease, a Chart.yaml or an Argo CD Application.
+	// Without a chart, the content of the file is the version.
+	// +optional
+	Chart string `json:"chart,omitempty"`
+
+	// Pattern is a regular expression the version is extracted with,
+	// either its first capture group or the whole match.
+	// +optional
+	Pattern string `json:"pattern,omitempty"`
+}
+
+// ChartConstraint constrains the versions of a Helm chart.
+type ChartConstraint struct {
+	// Name of the chart.
+	// +required
+	Name string `json:"name"`
+
+	// Version is a range of semantic versions, e.g. '>=1.0.0 <2.0.0',
+	// the promoted versions of the chart must be in.
+	// +required
+	Version string `json:"version"`
+}
+
+// SigningKey references a Secret with the private key to sign commits with.
+type SigningKey struct {
+	// SecretRef specifies the Secret containing either an ASCII-armored
+	// OpenPGP private key in the 'git.asc' field, or an SSH private key
+	// in the 'identity' field. An encrypted private key is decrypted
+	// with the optional 'passphrase' field.
+	// +required
+	SecretRef LocalObjectReference `json:"secretRef"`
+}
+
+// VerificationPolicy references a Secret with the public keys trusted to sign commits.
+type VerificationPolicy struct {
+	// SecretRef specifies the Secret containing ASCII-armored OpenPGP public
+	// keys in the 'git.asc' field, an SSH allowed signers file in the
+	// 'allowed_signers' field, or both. For environments with an OCI repository,
+	// it contains PEM-encoded cosign public keys in fields with the '.pub' suffix.
+	// +required
+	SecretRef LocalObjectReference `json:"secretRef"`
+}
+
+// Decryption references a Secret with the keys of SOPS-encrypted files.
+type Decryption struct {
+	// SecretRef specifies the Secret containing age identities in fields
+	// with the '.agekey' suffix, and unencrypted ASCII-armored OpenPGP keys
+	// in fields with the '.asc' suffix. The OpenPGP keys are also used to
+	// encrypt files for the OpenPGP recipients of this environment.
+	// +required
+	SecretRef LocalObjectReference `json:"secretRef"`
+}
+
+// GitProviderType is a Git hosting service.
+// +kubebuilder:validation:Enum=github;gitlab
+type GitProviderType string
+
+const (
+	// GitHubProvider reports to the REST API of GitHub or GitHub Enterprise Server.
+	GitHubProvider GitProviderType = "github"
+	// GitLabProvider reports to the REST API of GitLab.
+	GitLabProvider GitProviderType = "gitlab"
+)
+
+// GitProvider specifies the Git hosting service promotions are reported to.
+type GitProvider struct {
+	// Type of the Git hosting service.
+	// +required
+	Type GitProviderType `json:"type"`
+
+	// APIURL is the base URL of the REST API, defaults to
+	// 'https://api.github.com' or 'https://gitlab.com/api/v4'.
+	// +kubebuilder:validation:Pattern="^https?://.*$"
+	// +optional
+	APIURL string `json:"apiURL,omitempty"`
+
+	// Repository is the 'owner/name' of the GitHub repository or the path of
+	// the GitLab project, defaults to the path of the Source URL.
+	// +optional
+	Repository string `json:"repository,omitempty"`
+
+	// SecretRef specifies the Secret containing an API token in the 'token' field.
+	// +required
+	SecretRef LocalObjectReference `json:"secretRef"`
+}
+
+// ArtifactSourceReference references a Flux source object in the namespace of the Environment.
+type ArtifactSourceReference struct {
+	// APIVersion of the source object, defaults to 'source.toolkit.fluxcd.io/v1beta2'.
+	// +optional
+	APIVersion string `json:"apiVersion,omitempty"`
+
+	// Kind of the source object.
+	// +kubebuilder:validation:Enum=GitRepository;OCIRepository;Bucket
+	// +required
+	Kind string `json:"kind"`
+
+	// Name of the source object.
+	// +required
+	Name string `json:"name"`
+}
+
+// OCIRepositorySpec specifies the tag of an OCI repository.
+type OCIRepositorySpec struct {
+	// URL specifies the OCI repository, e.g. 'oci://ghcr.io/org/manifests'.
+	// +kubebuilder:validation:Pattern="^oci://.*$"
+	// +required
+	URL string `json:"url"`
+
+	// Tag of the artifact, defaults to 'latest'.
+	// +optional
+	Tag string `json:"tag,omitempty"`
+
+	// SecretRef specifies the Secret containing the credentials for the
+	// registry in the '.dockerconfigjson' field.
+	// +optional
+	SecretRef *LocalObjectReference `json:"secretRef,omitempty"`
+
+	// Insecure allows connecting to the registry over plain HTTP.
+	// +optional
+	Insecure bool `json:"insecure,omitempty"`
+}
+
+// ImageRepositorySpec specifies an image repository and the policy selecting its latest tag.
+type ImageRepositorySpec struct {
+	// Repository is the image repository, e.g. 'ghcr.io/acme/podinfo'.
+	// +required
+	Repository string `json:"repository"`
+
+	// Policy selects the tag to promote from the tags of the repository.
+	// +optional
+	Policy ImagePolicy `json:"policy,omitempty"`
+
+	// SecretRef specifies the Secret containing the credentials for the
+	// registry in the '.dockerconfigjson' field.
+	// +optional
+	SecretRef *LocalObjectReference `json:"secretRef,omitempty"`
+
+	// Insecure allows connecting to the registry over plain HTTP.
+	// +optional
+	Insecure bool `json:"insecure,omitempty"`
+}
+
+// ImagePolicy selects the latest tag of an image repository.
+type ImagePolicy struct {
+	// Pattern is a regular expression the tags must match.
+	// +optional
+	Pattern string `json:"pattern,omitempty"`
+
+	// Extract is the value the tags are ordered by, expanded from the
+	// capture groups of Pattern, e.g. '$version'. Defaults to the whole tag.
+	// +optional
+	Extract string `json:"extract,omitempty"`
+
+	// SemVer is a range of semantic versions, e.g. '>=1.0.0 <2.0.0', of
+	// which the highest version is selected. Pre-releases are only selected
+	// if the range contains one. If unset, the last tag in alphabetical
+	// order is selected.
+	// +optional
+	SemVer string `json:"semver,omitempty"`
+}
+
+// SourceSpec includes the Git reference of the source Git Repository.
+type SourceSpec struct {
+	// URL specifies the Git repository URL, it can be an HTTP/S or SSH address.
+	// +kubebuilder:validation:Pattern="^(http|https|ssh)://.*$"
+	// +required
+	URL string `json:"url"`
+
+	// Reference specifies the Git reference to resolve and monitor for
+	// changes, defaults to the 'master' branch.
+	// +optional
+	Reference *GitRepositoryRef `json:"ref,omitempty"`
+
+	// SecretRef specifies the Secret containing authentication credentials for
+	// the Git repository.
+	// For HTTPS repositories the Secret must contain 'username' and 'password'
+	// fields.
+	// For SSH repositories the Secret must contain 'identity'
+	// and 'known_hosts' fields.
+	// +optional
+	SecretRef *LocalObjectReference `json:"secretRef,omitempty"`
+}
+
+// GitRepositoryRef specifies the Git reference to resolve and checkout.
+type GitRepositoryRef struct {
+	// Branch to check out, defaults to 'master'.
+	// +optional
+	Branch string `json:"branch,omitempty"`
+}
+
+// EnvironmentStatus defines the observed state of Environment
+type EnvironmentStatus struct {
+	// LastPromotedVersion is the version last promoted to the environment,
+	// if it has a version policy. With the pull-request strategy, it is
+	// recorded once the pull request has been merged. Promotions to the
+	// environment are checked against it if the policy rejects downgrades.
+	// +optional
+	LastPromotedVersion string `json:"lastPromotedVersion,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+//+kubebuilder:subresource:status
+
+// Environment is the Schema for the environments API
+type Environment struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   EnvironmentSpec   `json:"spec,omitempty"`
+	Status EnvironmentStatus `json:"status,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+
+// EnvironmentList contains a list of Environment
+type EnvironmentList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []Environment `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&Environment{}, &EnvironmentList{})
+}
@@ -0,0 +1,236 @@
+/*
+Copyright 2023 Thomas Stadler <thomas@thomasst.xyz>.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/conversion"
+
+	"github.com/thomasstxyz/release-promotion-operator/api/v1alpha1"
+)
+
+// ConvertTo converts this Promotion to the Hub version (v1alpha1).
+func (src *Promotion) ConvertTo(dstRaw conversion.Hub) error {
+	dst := dstRaw.(*v1alpha1.Promotion)
+	if err := restoreHubData(src, hubFields{&dst.Spec, &dst.Status}); err != nil {
+		return err
+	}
+	convertObjectMetaToHub(&src.ObjectMeta, &dst.ObjectMeta)
+
+	dst.Spec.FromSpec.EnvironmentRef = v1alpha1.EnvironmentReference(src.Spec.From)
+	dst.Spec.ToSpec.EnvironmentRef = v1alpha1.EnvironmentReference(src.Spec.To)
+	dst.Spec.TemplateRef = v1alpha1.TemplateRef(src.Spec.TemplateRef)
+	dst.Spec.Strategy.PullRequest = src.Spec.Strategy.Type == PullRequestStrategy
+	dst.Spec.DryRun = src.Spec.DryRun
+	dst.Spec.ServiceAccountName = src.Spec.ServiceAccountName
+	dst.Spec.RequireApproval = src.Spec.RequireApproval
+	dst.Spec.Trigger = nil
+	if src.Spec.Trigger != nil {
+		dst.Spec.Trigger = &v1alpha1.Trigger{
+			Type:     v1alpha1.TriggerType(src.Spec.Trigger.Type),
+			Interval: src.Spec.Trigger.Interval,
+			Schedule: src.Spec.Trigger.Schedule,
+		}
+	}
+
+	base := dst.Spec.ReadinessChecks.LocalObjectsRef
+	dst.Spec.ReadinessChecks.LocalObjectsRef = nil
+	for _, check := range src.Spec.ReadinessChecks {
+		if check.Type != ObjectReadinessCheck || check.Object == nil {
+			continue
+		}
+		var ref v1alpha1.LocalObjectsRef
+		if i := len(dst.Spec.ReadinessChecks.LocalObjectsRef); i < len(base) {
+			ref = base[i]
+		}
+		convertObjectReferenceToHub(check.Object, &ref)
+		ref.KubeConfig = convertKubeConfigReferenceToHub(check.KubeConfig)
+		dst.Spec.ReadinessChecks.LocalObjectsRef = append(dst.Spec.ReadinessChecks.LocalObjectsRef, ref)
+	}
+
+	dst.Status.ObservedGeneration = src.Status.ObservedGeneration
+	dst.Status.Conditions = src.Status.Conditions
+	dst.Status.DependentObjectsReady = src.Status.DependentObjectsReady
+	dst.Status.UnreadyObjects = nil
+	for _, obj := range src.Status.UnreadyObjects {
+		var ref v1alpha1.LocalObjectsRef
+		convertObjectReferenceToHub(&obj.Object, &ref)
+		ref.KubeConfig = convertKubeConfigReferenceToHub(obj.KubeConfig)
+		dst.Status.UnreadyObjects = append(dst.Status.UnreadyObjects, v1alpha1.UnreadyObject{
+			LocalObjectsRef: ref,
+			Status:          obj.Status,
+			Message:         obj.Message,
+		})
+	}
+	dst.Status.DryRun = nil
+	if src.Status.DryRun != nil {
+		dryRun := v1alpha1.DryRunResult(*src.Status.DryRun)
+		dst.Status.DryRun = &dryRun
+	}
+	dst.Status.LastAttemptedRevision = src.Status.LastAttemptedRevision
+	dst.Status.LastPromotedRevision = src.Status.LastPromotedRevision
+	dst.Status.LastTargetRevision = src.Status.LastTargetRevision
+	dst.Status.LastPromotedVersion = src.Status.LastPromotedVersion
+	dst.Status.LastAttemptTime = src.Status.LastAttemptTime
+	dst.Status.LastPromotionTime = src.Status.LastPromotionTime
+	dst.Status.LastHandledRequestedAt = src.Status.LastHandledRequestedAt
+	dst.Status.PendingApprovalRevision = src.Status.PendingApprovalRevision
+	dst.Status.LastScheduleTime = src.Status.LastScheduleTime
+	dst.Status.NextScheduleTime = src.Status.NextScheduleTime
+	dst.Status.PullRequest = nil
+	if src.Status.PullRequest != nil {
+		pullRequest := v1alpha1.PullRequestStatus(*src.Status.PullRequest)
+		dst.Status.PullRequest = &pullRequest
+	}
+	dst.Status.History = nil
+	for _, record := range src.Status.History {
+		dst.Status.History = append(dst.Status.History, v1alpha1.PromotionRecord{
+			SourceRevision:        record.SourceRevision,
+			TargetRevision:        record.TargetRevision,
+			Version:               record.Version,
+			PullRequestURL:        record.PullRequestURL,
+			Outcome:               v1alpha1.PromotionOutcome(record.Outcome),
+			Message:               record.Message,
+			SigningKeyFingerprint: record.SigningKeyFingerprint,
+			StartTime:             record.StartTime,
+			Duration:              record.Duration,
+		})
+	}
+
+	return nil
+}
+
+// ConvertFrom converts from the Hub version (v1alpha1) to this version.
+func (dst *Promotion) ConvertFrom(srcRaw conversion.Hub) error {
+	src := srcRaw.(*v1alpha1.Promotion)
+	src.ObjectMeta.DeepCopyInto(&dst.ObjectMeta)
+
+	dst.Spec.From = EnvironmentReference(src.Spec.FromSpec.EnvironmentRef)
+	dst.Spec.To = EnvironmentReference(src.Spec.ToSpec.EnvironmentRef)
+	dst.Spec.TemplateRef = TemplateReference(src.Spec.TemplateRef)
+	dst.Spec.Strategy = PromotionStrategy{Type: DirectStrategy}
+	if src.Spec.Strategy.PullRequest {
+		dst.Spec.Strategy = PromotionStrategy{Type: PullRequestStrategy, PullRequest: &PullRequestOptions{}}
+	}
+	dst.Spec.DryRun = src.Spec.DryRun
+	dst.Spec.ServiceAccountName = src.Spec.ServiceAccountName
+	dst.Spec.RequireApproval = src.Spec.RequireApproval
+	dst.Spec.Trigger = nil
+	if src.Spec.Trigger != nil {
+		dst.Spec.Trigger = &Trigger{
+			Type:     TriggerType(src.Spec.Trigger.Type),
+			Interval: src.Spec.Trigger.Interval,
+			Schedule: src.Spec.Trigger.Schedule,
+		}
+	}
+
+	dst.Spec.ReadinessChecks = nil
+	for _, ref := range src.Spec.ReadinessChecks.LocalObjectsRef {
+		dst.Spec.ReadinessChecks = append(dst.Spec.ReadinessChecks, ReadinessCheck{
+			Type:       ObjectReadinessCheck,
+			Object:     convertObjectReferenceFromHub(ref),
+			KubeConfig: convertKubeConfigReferenceFromHub(ref.KubeConfig),
+		})
+	}
+
+	dst.Status.ObservedGeneration = src.Status.ObservedGeneration
+	dst.Status.Conditions = src.Status.Conditions
+	dst.Status.DependentObjectsReady = src.Status.DependentObjectsReady
+	dst.Status.UnreadyObjects = nil
+	for _, obj := range src.Status.UnreadyObjects {
+		dst.Status.UnreadyObjects = append(dst.Status.UnreadyObjects, UnreadyObject{
+			Object:     *convertObjectReferenceFromHub(obj.LocalObjectsRef),
+			KubeConfig: convertKubeConfigReferenceFromHub(obj.KubeConfig),
+			Status:     obj.Status,
+			Message:    obj.Message,
+		})
+	}
+	dst.Status.DryRun = nil
+	if src.Status.DryRun != nil {
+		dryRun := DryRunResult(*src.Status.DryRun)
+		dst.Status.DryRun = &dryRun
+	}
+	dst.Status.LastAttemptedRevision = src.Status.LastAttemptedRevision
+	dst.Status.LastPromotedRevision = src.Status.LastPromotedRevision
+	dst.Status.LastTargetRevision = src.Status.LastTargetRevision
+	dst.Status.LastPromotedVersion = src.Status.LastPromotedVersion
+	dst.Status.LastAttemptTime = src.Status.LastAttemptTime
+	dst.Status.LastPromotionTime = src.Status.LastPromotionTime
+	dst.Status.LastHandledRequestedAt = src.Status.LastHandledRequestedAt
+	dst.Status.PendingApprovalRevision = src.Status.PendingApprovalRevision
+	dst.Status.LastScheduleTime = src.Status.LastScheduleTime
+	dst.Status.NextScheduleTime = src.Status.NextScheduleTime
+	dst.Status.PullRequest = nil
+	if src.Status.PullRequest != nil {
+		pullRequest := PullRequestStatus(*src.Status.PullRequest)
+		dst.Status.PullRequest = &pullRequest
+	}
+	dst.Status.History = nil
+	for _, record := range src.Status.History {
+		dst.Status.History = append(dst.Status.History, PromotionRecord{
+			SourceRevision:        record.SourceRevision,
+			TargetRevision:        record.TargetRevision,
+			Version:               record.Version,
+			PullRequestURL:        record.PullRequestURL,
+			Outcome:               string(record.Outcome),
+			Message:               record.Message,
+			SigningKeyFingerprint: record.SigningKeyFingerprint,
+			StartTime:             record.StartTime,
+			Duration:              record.Duration,
+		})
+	}
+
+	roundTrip := &v1alpha1.Promotion{}
+	if err := dst.ConvertTo(roundTrip); err != nil {
+		return err
+	}
+	return preserveHubData(dst, hubFields{src.Spec, src.Status}, hubFields{roundTrip.Spec, roundTrip.Status})
+}
+
+func convertObjectReferenceToHub(src *ObjectReference, dst *v1alpha1.LocalObjectsRef) {
+	dst.GroupVersionResource = metav1.GroupVersionResource{
+		Group:    src.Group,
+		Version:  src.Version,
+		Resource: src.Resource,
+	}
+	dst.Name = src.Name
+	dst.Namespace = src.Namespace
+}
+
+func convertObjectReferenceFromHub(src v1alpha1.LocalObjectsRef) *ObjectReference {
+	return &ObjectReference{
+		Group:     src.GroupVersionResource.Group,
+		Version:   src.GroupVersionResource.Version,
+		Resource:  src.GroupVersionResource.Resource,
+		Name:      src.Name,
+		Namespace: src.Namespace,
+	}
+}
+
+func convertKubeConfigReferenceToHub(src *KubeConfigReference) *v1alpha1.KubeConfigReference {
+	if src == nil {
+		return nil
+	}
+	return &v1alpha1.KubeConfigReference{SecretRef: v1alpha1.LocalObjectReference(src.SecretRef)}
+}
+
+func convertKubeConfigReferenceFromHub(src *v1alpha1.KubeConfigReference) *KubeConfigReference {
+	if src == nil {
+		return nil
+	}
+	return &KubeConfigReference{SecretRef: LocalObjectReference(src.SecretRef)}
+}
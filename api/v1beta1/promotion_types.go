@@ -0,0 +1,387 @@
+/*
+Copyright 2023 Thomas Stadler <thomas@thomasst.xyz>.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// PromotionSpec defines the desired state of Promotion
+type PromotionSpec struct {
+	// From references the Environment to promote from.
+	// +required
+	From EnvironmentReference `json:"from"`
+
+	// To references the Environment to promote to.
+	// +required
+	To EnvironmentReference `json:"to"`
+
+	// TemplateRef references the PromotionTemplate.
+	// +required
+	TemplateRef TemplateReference `json:"templateRef"`
+
+	// Strategy specifies how to promote.
+	// +required
+	Strategy PromotionStrategy `json:"strategy"`
+
+	// ReadinessChecks which must succeed before promoting.
+	// +optional
+	ReadinessChecks []ReadinessCheck `json:"readinessChecks,omitempty"`
+
+	// DryRun renders the changes the promotion would make to the destination
+	// environment into the status, without committing or pushing anything.
+	// +optional
+	DryRun bool `json:"dryRun,omitempty"`
+
+	// ServiceAccountName is the name of the ServiceAccount in the namespace of the
+	// Promotion, which is impersonated for the readiness checks and for reading
+	// the Secrets of Environments in the same namespace.
+	// +optional
+	ServiceAccountName string `json:"serviceAccountName,omitempty"`
+
+	// Trigger specifies when the source revision is promoted.
+	// Defaults to promoting new revisions of the source environment.
+	// +optional
+	Trigger *Trigger `json:"trigger,omitempty"`
+
+	// RequireApproval holds back the promotion of each new source revision
+	// until it has been approved by setting the 'promote.release-promotion-operator.io/approvedRevision' annotation
+	// to the revision.
+	// +optional
+	RequireApproval bool `json:"requireApproval,omitempty"`
+}
+
+// TriggerType is the type of a Trigger.
+// +kubebuilder:validation:Enum=Revision;Schedule;Manual
+type TriggerType string
+
+const (
+	// RevisionTrigger promotes new revisions of the source environment.
+	RevisionTrigger TriggerType = "Revision"
+	// ScheduleTrigger promotes the current source revision on a cron schedule.
+	ScheduleTrigger TriggerType = "Schedule"
+	// ManualTrigger only promotes when requested by the
+	// 'promote.release-promotion-operator.io/requestedAt' annotation.
+	ManualTrigger TriggerType = "Manual"
+)
+
+// Trigger specifies when the source revision is promoted. Promotions can be
+// requested for all types by setting the 'promote.release-promotion-operator.io/requestedAt'
+// annotation to a new value.
+type Trigger struct {
+	// Type of the trigger, defaults to 'Revision'.
+	// +optional
+	Type TriggerType `json:"type,omitempty"`
+
+	// Interval at which the source environment is checked for new revisions
+	// with the 'Revision' trigger. Defaults to 5m.
+	// +optional
+	Interval *metav1.Duration `json:"interval,omitempty"`
+
+	// Schedule of the 'Schedule' trigger in cron format, e.g. '0 2 * * *'.
+	// The times are in UTC, unless the schedule is prefixed with a time zone,
+	// e.g. 'CRON_TZ=Europe/Vienna 0 2 * * *'.
+	// +optional
+	Schedule string `json:"schedule,omitempty"`
+}
+
+// StrategyType is the type of a PromotionStrategy.
+// +kubebuilder:validation:Enum=Direct;PullRequest
+type StrategyType string
+
+const (
+	// DirectStrategy pushes the promotion to the branch of the destination environment.
+	DirectStrategy StrategyType = "Direct"
+	// PullRequestStrategy pushes the promotion to a separate branch and opens a pull
+	// request of it with the provider of the destination Environment.
+	PullRequestStrategy StrategyType = "PullRequest"
+)
+
+// PromotionStrategy defines how to promote.
+// Only the member matching Type may be set.
+// +kubebuilder:validation:XValidation:rule="self.type == 'PullRequest' || !has(self.pullRequest)",message="pullRequest may only be set for the PullRequest strategy"
+type PromotionStrategy struct {
+	// Type of the strategy.
+	// +required
+	Type StrategyType `json:"type"`
+
+	// PullRequest holds the options of the PullRequest strategy.
+	// +optional
+	PullRequest *PullRequestOptions `json:"pullRequest,omitempty"`
+}
+
+// PullRequestOptions holds the options of the PullRequest strategy.
+type PullRequestOptions struct {
+}
+
+// ReadinessCheckType is the type of a ReadinessCheck.
+// +kubebuilder:validation:Enum=Object
+type ReadinessCheckType string
+
+const (
+	// ObjectReadinessCheck checks the kstatus of a Kubernetes object.
+	ObjectReadinessCheck ReadinessCheckType = "Object"
+)
+
+// ReadinessCheck defines a check which must succeed before promoting.
+// Only the member matching Type may be set.
+type ReadinessCheck struct {
+	// Type of the readiness check.
+	// +required
+	Type ReadinessCheckType `json:"type"`
+
+	// Object references the object whose kstatus must be 'Current'.
+	// +optional
+	Object *ObjectReference `json:"object,omitempty"`
+
+	// KubeConfig references a Secret with the kubeconfig of the cluster the object
+	// is fetched from. Defaults to the cluster the operator is running in.
+	// +optional
+	KubeConfig *KubeConfigReference `json:"kubeConfig,omitempty"`
+}
+
+// PromotionStatus defines the observed state of Promotion
+type PromotionStatus struct {
+	// ObservedGeneration is the last observed generation of the Promotion.
+	// +optional
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+
+	// Conditions holds the conditions for the Promotion.
+	// +optional
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+
+	// DependentObjectsReady is true if all readiness checks succeeded.
+	// +optional
+	DependentObjectsReady bool `json:"dependentObjectsReady"`
+
+	// UnreadyObjects lists the objects of the readiness checks which are not ready.
+	// +optional
+	UnreadyObjects []UnreadyObject `json:"unreadyObjects,omitempty"`
+
+	// DryRun holds the result of the last dry run.
+	// +optional
+	DryRun *DryRunResult `json:"dryRun,omitempty"`
+
+	// LastAttemptedRevision is the commit SHA of the source environment
+	// the last promotion was attempted for.
+	// +optional
+	LastAttemptedRevision string `json:"lastAttemptedRevision,omitempty"`
+
+	// LastPromotedRevision is the commit SHA of the source environment
+	// which was last promoted successfully.
+	// +optional
+	LastPromotedRevision string `json:"lastPromotedRevision,omitempty"`
+
+	// LastTargetRevision is the commit SHA in the destination environment
+	// which resulted from the last successful promotion.
+	// +optional
+	LastTargetRevision string `json:"lastTargetRevision,omitempty"`
+
+	// LastPromotedVersion is the version of the source environment
+	// which was last promoted successfully by this Promotion, if the
+	// destination environment has a version policy. Downgrades are checked
+	// against the version recorded in the status of the destination instead.
+	// +optional
+	LastPromotedVersion string `json:"lastPromotedVersion,omitempty"`
+
+	// LastAttemptTime is the time the last promotion was attempted.
+	// +optional
+	LastAttemptTime *metav1.Time `json:"lastAttemptTime,omitempty"`
+
+	// LastPromotionTime is the time of the last successful promotion.
+	// +optional
+	LastPromotionTime *metav1.Time `json:"lastPromotionTime,omitempty"`
+
+	// LastHandledRequestedAt holds the value of the most recent
+	// 'promote.release-promotion-operator.io/requestedAt' annotation which has been handled.
+	// +optional
+	LastHandledRequestedAt string `json:"lastHandledRequestedAt,omitempty"`
+
+	// PendingApprovalRevision is the source revision waiting to be approved,
+	// if the Promotion requires approval.
+	// +optional
+	PendingApprovalRevision string `json:"pendingApprovalRevision,omitempty"`
+
+	// LastScheduleTime is the time of the last promotion of the 'Schedule' trigger.
+	// +optional
+	LastScheduleTime *metav1.Time `json:"lastScheduleTime,omitempty"`
+
+	// NextScheduleTime is the time of the next promotion of the 'Schedule' trigger.
+	// +optional
+	NextScheduleTime *metav1.Time `json:"nextScheduleTime,omitempty"`
+
+	// PullRequest is the pull request opened by the last promotion with the
+	// pull-request strategy, until it has been merged or closed.
+	// +optional
+	PullRequest *PullRequestStatus `json:"pullRequest,omitempty"`
+
+	// History of past promotions, most recent first.
+	// +optional
+	History []PromotionRecord `json:"history,omitempty"`
+}
+
+// UnreadyObject is an object of the readiness checks which is not ready.
+type UnreadyObject struct {
+	// Object references the unready object.
+	Object ObjectReference `json:"object"`
+
+	// KubeConfig references the Secret with the kubeconfig of the cluster
+	// of the unready object, if it is not the cluster the operator is running in.
+	// +optional
+	KubeConfig *KubeConfigReference `json:"kubeConfig,omitempty"`
+
+	// Status is the kstatus status of the object.
+	Status string `json:"status"`
+
+	// Message is the kstatus message of the object.
+	// +optional
+	Message string `json:"message,omitempty"`
+}
+
+// DryRunResult summarizes the changes a promotion would make
+// to the destination environment.
+type DryRunResult struct {
+	// ObservedGeneration is the generation of the Promotion the dry run was rendered for.
+	ObservedGeneration int64 `json:"observedGeneration"`
+
+	// SourceRevision is the commit SHA of the source environment the dry run was rendered from.
+	SourceRevision string `json:"sourceRevision"`
+
+	// TargetRevision is the commit SHA of the destination environment the dry run was rendered against.
+	TargetRevision string `json:"targetRevision"`
+
+	// LastRunTime is the time the dry run was rendered.
+	LastRunTime metav1.Time `json:"lastRunTime"`
+
+	// RequestedAt holds the value of the DryRunRequestedAtAnnotation
+	// the dry run has been rendered for.
+	// +optional
+	RequestedAt string `json:"requestedAt,omitempty"`
+
+	// Added lists the files which would be added to the destination environment.
+	// +optional
+	Added []string `json:"added,omitempty"`
+
+	// Modified lists the files which would be modified in the destination environment.
+	// +optional
+	Modified []string `json:"modified,omitempty"`
+
+	// Deleted lists the files which would be deleted from the destination environment.
+	// +optional
+	Deleted []string `json:"deleted,omitempty"`
+
+	// LinesAdded is the total number of added lines.
+	LinesAdded int `json:"linesAdded"`
+
+	// LinesDeleted is the total number of deleted lines.
+	LinesDeleted int `json:"linesDeleted"`
+
+	// Patch is the unified diff of the changes, truncated to 4096 bytes.
+	// +optional
+	Patch string `json:"patch,omitempty"`
+
+	// PatchTruncated is true if Patch has been truncated.
+	// +optional
+	PatchTruncated bool `json:"patchTruncated,omitempty"`
+}
+
+// PullRequestStatus describes an open pull request of the pull-request strategy.
+type PullRequestStatus struct {
+	// URL of the pull request.
+	URL string `json:"url"`
+
+	// Number of the pull request, or the IID of the GitLab merge request.
+	Number int `json:"number"`
+
+	// SourceRevision is the commit SHA of the source environment the pull request promotes.
+	SourceRevision string `json:"sourceRevision"`
+
+	// Version is the version of the source revision, which is recorded
+	// on the destination environment once the pull request has been merged.
+	// +optional
+	Version string `json:"version,omitempty"`
+}
+
+// PromotionRecord describes a past promotion attempt.
+type PromotionRecord struct {
+	// SourceRevision is the commit SHA of the source environment which was promoted.
+	SourceRevision string `json:"sourceRevision"`
+
+	// TargetRevision is the resulting commit SHA in the destination environment.
+	// +optional
+	TargetRevision string `json:"targetRevision,omitempty"`
+
+	// Version is the version of the source revision, if the destination
+	// environment has a version policy.
+	// +optional
+	Version string `json:"version,omitempty"`
+
+	// PullRequestURL is the URL of the pull request opened for the promotion,
+	// if the PullRequest strategy is used.
+	// +optional
+	PullRequestURL string `json:"pullRequestURL,omitempty"`
+
+	// Outcome of the promotion, either 'Succeeded', 'Failed' or 'Superseded'.
+	Outcome string `json:"outcome"`
+
+	// Message holds details about the outcome, e.g. the error of a failed promotion.
+	// +optional
+	Message string `json:"message,omitempty"`
+
+	// SigningKeyFingerprint is the fingerprint of the key
+	// the promotion commit has been signed with.
+	// +optional
+	SigningKeyFingerprint string `json:"signingKeyFingerprint,omitempty"`
+
+	// StartTime is the time the promotion was started.
+	StartTime metav1.Time `json:"startTime"`
+
+	// Duration of the promotion.
+	Duration metav1.Duration `json:"duration"`
+}
+
+//+kubebuilder:object:root=true
+//+kubebuilder:subresource:status
+//+kubebuilder:printcolumn:name="Ready",type=string,JSONPath=`.status.conditions[?(@.type=="Ready")].status`
+//+kubebuilder:printcolumn:name="Status",type=string,JSONPath=`.status.conditions[?(@.type=="Ready")].message`,priority=1
+//+kubebuilder:printcolumn:name="From",type=string,JSONPath=`.spec.from.name`
+//+kubebuilder:printcolumn:name="To",type=string,JSONPath=`.spec.to.name`
+//+kubebuilder:printcolumn:name="Promoted Revision",type=string,JSONPath=`.status.lastPromotedRevision`
+//+kubebuilder:printcolumn:name="Target Revision",type=string,JSONPath=`.status.lastTargetRevision`
+//+kubebuilder:printcolumn:name="Last Promotion",type=date,JSONPath=`.status.lastPromotionTime`
+
+// Promotion is the Schema for the promotions API
+type Promotion struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   PromotionSpec   `json:"spec,omitempty"`
+	Status PromotionStatus `json:"status,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+
+// PromotionList contains a list of Promotion
+type PromotionList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []Promotion `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&Promotion{}, &PromotionList{})
+}
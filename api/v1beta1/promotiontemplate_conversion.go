@@ -0,0 +1,96 @@
+/*
+Copyright 2023 Thomas Stadler <thomas@thomasst.xyz>.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	"sigs.k8s.io/controller-runtime/pkg/conversion"
+
+	"github.com/thomasstxyz/release-promotion-operator/api/v1alpha1"
+)
+
+// ConvertTo converts this PromotionTemplate to the Hub version (v1alpha1).
+func (src *PromotionTemplate) ConvertTo(dstRaw conversion.Hub) error {
+	dst := dstRaw.(*v1alpha1.PromotionTemplate)
+	if err := restoreHubData(src, hubFields{&dst.Spec, &dst.Status}); err != nil {
+		return err
+	}
+	convertObjectMetaToHub(&src.ObjectMeta, &dst.ObjectMeta)
+
+	base := dst.Spec.CopySpec
+	dst.Spec.CopySpec = nil
+	if src.Spec.Copy != nil {
+		dst.Spec.CopySpec = make([]v1alpha1.CopyOperation, len(src.Spec.Copy))
+	}
+	for i, op := range src.Spec.Copy {
+		if i < len(base) {
+			dst.Spec.CopySpec[i] = base[i]
+		}
+		dst.Spec.CopySpec[i].Source = op.Source
+		dst.Spec.CopySpec[i].Destination = op.Destination
+		dst.Spec.CopySpec[i].SOPS = v1alpha1.SOPSMode(op.SOPS)
+	}
+	dst.Spec.Images = nil
+	if src.Spec.Images != nil {
+		dst.Spec.Images = make([]v1alpha1.ImageOperation, len(src.Spec.Images))
+	}
+	for i, op := range src.Spec.Images {
+		dst.Spec.Images[i] = v1alpha1.ImageOperation{Name: op.Name, Paths: op.Paths}
+	}
+	dst.Spec.Charts = nil
+	if src.Spec.Charts != nil {
+		dst.Spec.Charts = make([]v1alpha1.ChartOperation, len(src.Spec.Charts))
+	}
+	for i, op := range src.Spec.Charts {
+		dst.Spec.Charts[i] = v1alpha1.ChartOperation(op)
+	}
+
+	return nil
+}
+
+// ConvertFrom converts from the Hub version (v1alpha1) to this version.
+func (dst *PromotionTemplate) ConvertFrom(srcRaw conversion.Hub) error {
+	src := srcRaw.(*v1alpha1.PromotionTemplate)
+	src.ObjectMeta.DeepCopyInto(&dst.ObjectMeta)
+
+	dst.Spec.Copy = nil
+	if src.Spec.CopySpec != nil {
+		dst.Spec.Copy = make([]CopyOperation, len(src.Spec.CopySpec))
+	}
+	for i, op := range src.Spec.CopySpec {
+		dst.Spec.Copy[i] = CopyOperation{Source: op.Source, Destination: op.Destination, SOPS: SOPSMode(op.SOPS)}
+	}
+	dst.Spec.Images = nil
+	if src.Spec.Images != nil {
+		dst.Spec.Images = make([]ImageOperation, len(src.Spec.Images))
+	}
+	for i, op := range src.Spec.Images {
+		dst.Spec.Images[i] = ImageOperation{Name: op.Name, Paths: op.Paths}
+	}
+	dst.Spec.Charts = nil
+	if src.Spec.Charts != nil {
+		dst.Spec.Charts = make([]ChartOperation, len(src.Spec.Charts))
+	}
+	for i, op := range src.Spec.Charts {
+		dst.Spec.Charts[i] = ChartOperation(op)
+	}
+
+	roundTrip := &v1alpha1.PromotionTemplate{}
+	if err := dst.ConvertTo(roundTrip); err != nil {
+		return err
+	}
+	return preserveHubData(dst, hubFields{src.Spec, src.Status}, hubFields{roundTrip.Spec, roundTrip.Status})
+}
@@ -0,0 +1,142 @@
+/*
+Copyright 2023 Thomas Stadler <thomas@thomasst.xyz>.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// PromotionTemplateSpec defines the desired state of PromotionTemplate
+type PromotionTemplateSpec struct {
+	// Copy contains a list of source/destination pairs,
+	// which represent file copy operations
+	// between the source and destination environment.
+	// +optional
+	Copy []CopyOperation `json:"copy,omitempty"`
+
+	// Images contains a list of operations setting the tag of images in the
+	// destination environment to the tag selected by the image repository
+	// of the source environment.
+	// +optional
+	Images []ImageOperation `json:"images,omitempty"`
+
+	// Charts contains a list of operations promoting the version of a Helm
+	// chart from a file of the source environment to a file of the
+	// destination environment.
+	// +optional
+	Charts []ChartOperation `json:"charts,omitempty"`
+}
+
+// CopyOperation copies a file or directory from the source to the destination environment.
+type CopyOperation struct {
+	// Source is the path in the source environment.
+	// Can be either a file or a directory.
+	// +required
+	Source string `json:"source"`
+
+	// Destination is the path in the destination environment.
+	// Can be either a file or a directory.
+	// +required
+	Destination string `json:"destination"`
+
+	// SOPS specifies how files encrypted with SOPS are copied. 'Copy' copies
+	// them unchanged, 'Verify' refuses to copy files which are not encrypted
+	// for the recipients of the destination environment, and 'Reencrypt'
+	// decrypts them with the keys of the source environment and encrypts
+	// them for the recipients of the destination environment.
+	// The recipients are those of the matching creation rule in the
+	// '.sops.yaml' file closest to the destination file.
+	// Defaults to 'Copy'.
+	// +kubebuilder:validation:Enum=Copy;Verify;Reencrypt
+	// +optional
+	SOPS SOPSMode `json:"sops,omitempty"`
+}
+
+// ImageOperation sets the tag of the references to an image
+// in the YAML files of the destination environment.
+type ImageOperation struct {
+	// Name of the image whose references are updated, e.g. 'ghcr.io/acme/podinfo'.
+	// Defaults to the image repository of the source environment.
+	// +optional
+	Name string `json:"name,omitempty"`
+
+	// Paths are the files or directories in the destination environment
+	// whose YAML files are updated. Defaults to the whole environment.
+	// +optional
+	Paths []string `json:"paths,omitempty"`
+}
+
+// ChartOperation promotes the version of a Helm chart as referenced by a Flux
+// HelmRelease, the dependencies of a Chart.yaml or an Argo CD Application.
+type ChartOperation struct {
+	// Name of the chart.
+	// +required
+	Name string `json:"name"`
+
+	// Source is the file in the source environment the version is read from.
+	// +required
+	Source string `json:"source"`
+
+	// Destination is the file in the destination environment the version is written to.
+	// +required
+	Destination string `json:"destination"`
+
+	// AppVersion promotes the appVersion of Chart.yaml files as well.
+	// +optional
+	AppVersion bool `json:"appVersion,omitempty"`
+}
+
+// SOPSMode specifies how files encrypted with SOPS are copied.
+type SOPSMode string
+
+const (
+	// SOPSCopy copies encrypted files unchanged.
+	SOPSCopy SOPSMode = "Copy"
+	// SOPSVerify refuses to copy files encrypted for other than the destination's recipients.
+	SOPSVerify SOPSMode = "Verify"
+	// SOPSReencrypt encrypts files for the destination's recipients.
+	SOPSReencrypt SOPSMode = "Reencrypt"
+)
+
+// PromotionTemplateStatus defines the observed state of PromotionTemplate
+type PromotionTemplateStatus struct {
+}
+
+//+kubebuilder:object:root=true
+//+kubebuilder:subresource:status
+
+// PromotionTemplate is the Schema for the promotiontemplates API
+type PromotionTemplate struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   PromotionTemplateSpec   `json:"spec,omitempty"`
+	Status PromotionTemplateStatus `json:"status,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+
+// PromotionTemplateList contains a list of PromotionTemplate
+type PromotionTemplateList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []PromotionTemplate `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&PromotionTemplate{}, &PromotionTemplateList{})
+}
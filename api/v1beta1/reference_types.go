@@ -0,0 +1,98 @@
+/*
+Copyright 2023 Thomas Stadler <thomas@thomasst.xyz>.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+// EnvironmentReference contains a reference to an
+// Environment resource object.
+type EnvironmentReference struct {
+	// Kind of the referent, either 'Environment' or 'ClusterEnvironment'.
+	// Defaults to 'Environment'.
+	// +kubebuilder:validation:Enum=Environment;ClusterEnvironment
+	// +optional
+	Kind string `json:"kind,omitempty"`
+
+	// Name of the referent.
+	// +required
+	Name string `json:"name"`
+
+	// Namespace of the referent, defaults to the namespace of the Promotion.
+	// Referencing an Environment in another namespace requires
+	// a ReferenceGrant in that namespace. Must be empty for a ClusterEnvironment.
+	// +optional
+	Namespace string `json:"namespace,omitempty"`
+}
+
+// TemplateReference contains a reference to a
+// PromotionTemplate resource object.
+type TemplateReference struct {
+	// Kind of the referent, either 'PromotionTemplate' or 'ClusterPromotionTemplate'.
+	// Defaults to 'PromotionTemplate'.
+	// +kubebuilder:validation:Enum=PromotionTemplate;ClusterPromotionTemplate
+	// +optional
+	Kind string `json:"kind,omitempty"`
+
+	// Name of the referent.
+	// +required
+	Name string `json:"name"`
+
+	// Namespace of the referent, defaults to the namespace of the Promotion.
+	// Referencing a PromotionTemplate in another namespace requires
+	// a ReferenceGrant in that namespace. Must be empty for a ClusterPromotionTemplate.
+	// +optional
+	Namespace string `json:"namespace,omitempty"`
+}
+
+// LocalObjectReference contains a reference to an object
+// in the same namespace.
+type LocalObjectReference struct {
+	// Name of the referent.
+	// +required
+	Name string `json:"name"`
+}
+
+// ObjectReference contains a reference to an object of any resource.
+type ObjectReference struct {
+	// Group of the referent, empty for the core API group.
+	// +optional
+	Group string `json:"group,omitempty"`
+
+	// Version of the referent.
+	// +required
+	Version string `json:"version"`
+
+	// Resource of the referent, e.g. 'deployments'.
+	// +required
+	Resource string `json:"resource"`
+
+	// Name of the referent.
+	// +required
+	Name string `json:"name"`
+
+	// Namespace of the referent, defaults to the namespace of the Promotion.
+	// +optional
+	Namespace string `json:"namespace,omitempty"`
+}
+
+// KubeConfigReference contains a reference to a Secret holding a kubeconfig.
+type KubeConfigReference struct {
+	// SecretRef references a Secret in the namespace of the Promotion.
+	// The kubeconfig is read from the 'value' or the 'value.yaml' key.
+	// It must embed its credentials: exec credential plugins, auth providers
+	// and references to files are rejected.
+	// +required
+	SecretRef LocalObjectReference `json:"secretRef"`
+}
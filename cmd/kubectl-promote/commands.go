@@ -0,0 +1,294 @@
+/*
+Copyright 2023 Thomas Stadler <thomas@thomasst.xyz>.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	apiv1alpha1 "github.com/thomasstxyz/release-promotion-operator/api/v1alpha1"
+)
+
+// promoteCmd implements the commands of the plugin.
+type promoteCmd struct {
+	client    client.Client
+	namespace string
+	out       io.Writer
+	now       func() time.Time
+
+	// pollInterval is the interval in which the status is polled while waiting for a dry run.
+	pollInterval time.Duration
+}
+
+// list prints the Promotions of the namespace, or of all namespaces.
+func (c *promoteCmd) list(ctx context.Context, allNamespaces bool) error {
+	promotions := &apiv1alpha1.PromotionList{}
+	var opts []client.ListOption
+	if !allNamespaces {
+		opts = append(opts, client.InNamespace(c.namespace))
+	}
+	if err := c.client.List(ctx, promotions, opts...); err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(c.out, 0, 0, 3, ' ', 0)
+	if allNamespaces {
+		fmt.Fprint(w, "NAMESPACE\t")
+	}
+	fmt.Fprintln(w, "NAME\tFROM\tTO\tSOURCE REVISION\tTARGET REVISION\tGATE")
+	for i := range promotions.Items {
+		p := &promotions.Items[i]
+		if allNamespaces {
+			fmt.Fprintf(w, "%s\t", p.Namespace)
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", p.Name,
+			p.Spec.FromSpec.EnvironmentRef.Name, p.Spec.ToSpec.EnvironmentRef.Name,
+			shortRevision(p.Status.LastPromotedRevision), shortRevision(p.Status.LastTargetRevision), gateState(p))
+	}
+	return w.Flush()
+}
+
+// status prints the state of the Promotion.
+func (c *promoteCmd) status(ctx context.Context, name string) error {
+	p, err := c.get(ctx, name)
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(c.out, 0, 0, 3, ' ', 0)
+	fmt.Fprintf(w, "Name:\t%s/%s\n", p.Namespace, p.Name)
+	fmt.Fprintf(w, "From:\t%s\n", p.Spec.FromSpec.EnvironmentRef.Name)
+	fmt.Fprintf(w, "To:\t%s\n", p.Spec.ToSpec.EnvironmentRef.Name)
+	fmt.Fprintf(w, "Trigger:\t%s\n", p.TriggerType())
+	fmt.Fprintf(w, "Gate:\t%s\n", gateState(p))
+	fmt.Fprintf(w, "Promoted revision:\t%s\n", valueOrNone(p.Status.LastPromotedRevision))
+	fmt.Fprintf(w, "Target revision:\t%s\n", valueOrNone(p.Status.LastTargetRevision))
+	if p.Status.PendingApprovalRevision != "" {
+		fmt.Fprintf(w, "Pending approval:\t%s\n", p.Status.PendingApprovalRevision)
+	}
+	if p.Status.NextScheduleTime != nil {
+		fmt.Fprintf(w, "Next schedule:\t%s\n", p.Status.NextScheduleTime.UTC().Format(time.RFC3339))
+	}
+	if len(p.Status.History) > 0 && p.Status.History[0].PullRequestURL != "" {
+		fmt.Fprintf(w, "Pull request:\t%s\n", p.Status.History[0].PullRequestURL)
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	fmt.Fprintln(c.out, "\nConditions:")
+	w = tabwriter.NewWriter(c.out, 0, 0, 3, ' ', 0)
+	fmt.Fprintln(w, "  TYPE\tSTATUS\tREASON\tMESSAGE")
+	for _, cond := range p.Status.Conditions {
+		fmt.Fprintf(w, "  %s\t%s\t%s\t%s\n", cond.Type, cond.Status, cond.Reason, cond.Message)
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	if len(p.Status.UnreadyObjects) > 0 {
+		fmt.Fprintln(c.out, "\nUnready objects:")
+		w = tabwriter.NewWriter(c.out, 0, 0, 3, ' ', 0)
+		fmt.Fprintln(w, "  RESOURCE\tNAMESPACE\tNAME\tSTATUS\tMESSAGE")
+		for _, o := range p.Status.UnreadyObjects {
+			fmt.Fprintf(w, "  %s\t%s\t%s\t%s\t%s\n", o.GroupVersionResource.Resource, valueOrNone(o.Namespace), o.Name, o.Status, o.Message)
+		}
+		return w.Flush()
+	}
+	return nil
+}
+
+// diff requests a dry run of the Promotion with the DryRunRequestedAtAnnotation
+// and prints its patch once rendered. Unless the Promotion already is a dry run,
+// it is switched to dry-run mode with the DryRunAnnotation until then.
+func (c *promoteCmd) diff(ctx context.Context, name string, timeout time.Duration) error {
+	p, err := c.get(ctx, name)
+	if err != nil {
+		return err
+	}
+
+	// Request the dry run and switch to dry-run mode in a single patch,
+	// otherwise the controller could promote the requested revision for real.
+	requestedAt := c.now().UTC().Format(time.RFC3339Nano)
+	annotations := map[string]string{apiv1alpha1.DryRunRequestedAtAnnotation: requestedAt}
+	leaveDryRun := !p.IsDryRun()
+	if leaveDryRun {
+		annotations[apiv1alpha1.DryRunAnnotation] = "true"
+	}
+	if err := c.annotate(ctx, p, annotations); err != nil {
+		return err
+	}
+	if leaveDryRun {
+		defer func() {
+			// Leave dry-run mode even if the command has been interrupted
+			if err := c.annotate(context.Background(), p, map[string]string{apiv1alpha1.DryRunAnnotation: ""}); err != nil {
+				fmt.Fprintf(c.out, "Failed to remove the %s annotation: %s\n", apiv1alpha1.DryRunAnnotation, err)
+			}
+		}()
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	err = wait.PollImmediateUntilWithContext(ctx, c.pollInterval, func(ctx context.Context) (bool, error) {
+		if err := c.client.Get(ctx, client.ObjectKeyFromObject(p), p); err != nil {
+			return false, err
+		}
+		dryRun := p.Status.DryRun
+		return dryRun != nil && dryRun.RequestedAt == requestedAt, nil
+	})
+	if err != nil {
+		if ready := meta.FindStatusCondition(p.Status.Conditions, apiv1alpha1.ReadyCondition); ready != nil {
+			return fmt.Errorf("dry run has not been rendered: %s: %s", ready.Reason, ready.Message)
+		}
+		return fmt.Errorf("dry run has not been rendered: %w", err)
+	}
+
+	dryRun := p.Status.DryRun
+	fmt.Fprintf(c.out, "# %s (%s) -> %s (%s): %d added, %d modified, %d deleted files, +%d -%d lines\n",
+		p.Spec.FromSpec.EnvironmentRef.Name, shortRevision(dryRun.SourceRevision),
+		p.Spec.ToSpec.EnvironmentRef.Name, shortRevision(dryRun.TargetRevision),
+		len(dryRun.Added), len(dryRun.Modified), len(dryRun.Deleted), dryRun.LinesAdded, dryRun.LinesDeleted)
+	fmt.Fprint(c.out, dryRun.Patch)
+	if dryRun.PatchTruncated {
+		fmt.Fprintln(c.out, "# The diff has been truncated")
+	}
+	return nil
+}
+
+// approve approves the revision, or the source revision pending approval.
+func (c *promoteCmd) approve(ctx context.Context, name, revision string) error {
+	p, err := c.get(ctx, name)
+	if err != nil {
+		return err
+	}
+	if !p.Spec.RequireApproval {
+		return fmt.Errorf("Promotion %s does not require approval", name)
+	}
+	if revision == "" {
+		revision = p.Status.PendingApprovalRevision
+	}
+	if revision == "" {
+		return fmt.Errorf("Promotion %s has no source revision pending approval", name)
+	}
+
+	if err := c.annotate(ctx, p, map[string]string{apiv1alpha1.ApprovedRevisionAnnotation: revision}); err != nil {
+		return err
+	}
+	fmt.Fprintf(c.out, "Approved source revision %s of Promotion %s\n", revision, name)
+	return nil
+}
+
+// trigger requests a promotion of the current source revision.
+func (c *promoteCmd) trigger(ctx context.Context, name string) error {
+	p, err := c.get(ctx, name)
+	if err != nil {
+		return err
+	}
+
+	requestedAt := c.now().UTC().Format(time.RFC3339Nano)
+	if err := c.annotate(ctx, p, map[string]string{apiv1alpha1.RequestedAtAnnotation: requestedAt}); err != nil {
+		return err
+	}
+	fmt.Fprintf(c.out, "Requested promotion of Promotion %s at %s\n", name, requestedAt)
+	return nil
+}
+
+// history prints the past promotions of the Promotion.
+func (c *promoteCmd) history(ctx context.Context, name string) error {
+	p, err := c.get(ctx, name)
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(c.out, 0, 0, 3, ' ', 0)
+	fmt.Fprintln(w, "STARTED\tSOURCE REVISION\tTARGET REVISION\tOUTCOME\tDURATION\tMESSAGE")
+	for _, r := range p.Status.History {
+		message := r.Message
+		if r.PullRequestURL != "" {
+			message = strings.TrimSpace(r.PullRequestURL + " " + message)
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", r.StartTime.UTC().Format(time.RFC3339),
+			shortRevision(r.SourceRevision), shortRevision(r.TargetRevision), r.Outcome,
+			r.Duration.Duration.Round(time.Second), firstLine(message))
+	}
+	return w.Flush()
+}
+
+func (c *promoteCmd) get(ctx context.Context, name string) (*apiv1alpha1.Promotion, error) {
+	p := &apiv1alpha1.Promotion{}
+	if err := c.client.Get(ctx, types.NamespacedName{Namespace: c.namespace, Name: name}, p); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// annotate sets the annotations of the Promotion in a single patch,
+// removing those with an empty value.
+func (c *promoteCmd) annotate(ctx context.Context, p *apiv1alpha1.Promotion, annotations map[string]string) error {
+	patch := client.MergeFrom(p.DeepCopy())
+	merged := p.GetAnnotations()
+	if merged == nil {
+		merged = map[string]string{}
+	}
+	for key, value := range annotations {
+		if value == "" {
+			delete(merged, key)
+		} else {
+			merged[key] = value
+		}
+	}
+	p.SetAnnotations(merged)
+	return c.client.Patch(ctx, p, patch)
+}
+
+// gateState summarizes what the Promotion is waiting for, based on its conditions.
+func gateState(p *apiv1alpha1.Promotion) string {
+	ready := meta.FindStatusCondition(p.Status.Conditions, apiv1alpha1.ReadyCondition)
+	if ready == nil {
+		return "Unknown"
+	}
+	if meta.IsStatusConditionTrue(p.Status.Conditions, apiv1alpha1.StalledCondition) {
+		return "Stalled: " + ready.Reason
+	}
+	return ready.Reason
+}
+
+// shortRevision abbreviates a commit SHA like 'git log --oneline'.
+func shortRevision(revision string) string {
+	return valueOrNone(apiv1alpha1.ShortRevision(revision))
+}
+
+func valueOrNone(value string) string {
+	if value == "" {
+		return "<none>"
+	}
+	return value
+}
+
+func firstLine(s string) string {
+	line, _, _ := strings.Cut(s, "\n")
+	return line
+}
@@ -0,0 +1,241 @@
+/*
+Copyright 2023 Thomas Stadler <thomas@thomasst.xyz>.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"regexp"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	apiv1alpha1 "github.com/thomasstxyz/release-promotion-operator/api/v1alpha1"
+)
+
+var _ = Describe("kubectl-promote", func() {
+	const (
+		sourceRevision = "1f0c3e2d9b8a7f6e5d4c3b2a1f0e9d8c7b6a5f4e"
+		targetRevision = "9a8b7c6d5e4f3a2b1c0d9e8f7a6b5c4d3e2f1a0b"
+	)
+
+	var (
+		ctx       context.Context
+		now       time.Time
+		out       *bytes.Buffer
+		promotion *apiv1alpha1.Promotion
+		cmd       *promoteCmd
+	)
+
+	newCmd := func(objs ...client.Object) *promoteCmd {
+		scheme := runtime.NewScheme()
+		Expect(apiv1alpha1.AddToScheme(scheme)).To(Succeed())
+		return &promoteCmd{
+			client:       fake.NewClientBuilder().WithScheme(scheme).WithObjects(objs...).Build(),
+			namespace:    "apps",
+			out:          out,
+			now:          func() time.Time { return now },
+			pollInterval: time.Millisecond,
+		}
+	}
+
+	get := func() *apiv1alpha1.Promotion {
+		p := &apiv1alpha1.Promotion{}
+		Expect(cmd.client.Get(ctx, client.ObjectKeyFromObject(promotion), p)).To(Succeed())
+		return p
+	}
+
+	BeforeEach(func() {
+		ctx = context.Background()
+		now = time.Date(2023, 3, 1, 9, 0, 0, 0, time.UTC)
+		out = &bytes.Buffer{}
+		promotion = &apiv1alpha1.Promotion{
+			ObjectMeta: metav1.ObjectMeta{Name: "dev-to-prod", Namespace: "apps"},
+			Spec: apiv1alpha1.PromotionSpec{
+				FromSpec: apiv1alpha1.FromSpec{EnvironmentRef: apiv1alpha1.EnvironmentReference{Name: "dev"}},
+				ToSpec:   apiv1alpha1.ToSpec{EnvironmentRef: apiv1alpha1.EnvironmentReference{Name: "prod"}},
+			},
+			Status: apiv1alpha1.PromotionStatus{
+				LastPromotedRevision: sourceRevision,
+				LastTargetRevision:   targetRevision,
+				Conditions: []metav1.Condition{{
+					Type:    apiv1alpha1.ReadyCondition,
+					Status:  metav1.ConditionFalse,
+					Reason:  apiv1alpha1.DependencyNotReadyReason,
+					Message: "1 of 1 dependent objects are not ready: deployments/podinfo",
+				}},
+				UnreadyObjects: []apiv1alpha1.UnreadyObject{{
+					LocalObjectsRef: apiv1alpha1.LocalObjectsRef{
+						GroupVersionResource: metav1.GroupVersionResource{Group: "apps", Version: "v1", Resource: "deployments"},
+						Name:                 "podinfo",
+					},
+					Status: "InProgress",
+				}},
+				History: []apiv1alpha1.PromotionRecord{{
+					SourceRevision: sourceRevision,
+					TargetRevision: targetRevision,
+					PullRequestURL: "https://github.com/acme/fleet/pull/7",
+					Outcome:        apiv1alpha1.PromotionSucceeded,
+					StartTime:      metav1.NewTime(now.Add(-time.Hour)),
+					Duration:       metav1.Duration{Duration: 4 * time.Second},
+				}},
+			},
+		}
+		cmd = newCmd(promotion)
+	})
+
+	It("lists Promotions with their revisions and gate state", func() {
+		Expect(cmd.list(ctx, false)).To(Succeed())
+		Expect(out.String()).To(MatchRegexp(`NAME\s+FROM\s+TO\s+SOURCE REVISION\s+TARGET REVISION\s+GATE`))
+		Expect(out.String()).To(MatchRegexp(`dev-to-prod\s+dev\s+prod\s+1f0c3e2\s+9a8b7c6\s+DependencyNotReady`))
+	})
+
+	DescribeTable("lists the revisions",
+		func(source, target string) {
+			promotion.Status.LastPromotedRevision, promotion.Status.LastTargetRevision = source, target
+			cmd = newCmd(promotion)
+			Expect(cmd.list(ctx, false)).To(Succeed())
+			Expect(out.String()).To(MatchRegexp(`dev-to-prod\s+dev\s+prod\s+%s\s+%s\s+DependencyNotReady`,
+				regexp.QuoteMeta(source), regexp.QuoteMeta(target)))
+		},
+		Entry("of tags", "v1.10.11", "v1.10.10"),
+		Entry("of OCI artifacts",
+			"6.3.0@sha256:2b6bb4e5ec4a8ba9b8e0b5e1b2a4a8f0c1ac8d7d6e8f3d6c0c2b5f9a1e4d7c3b",
+			"6.2.0@sha256:9f2c7d1e0b3a4c5d6e7f8a9b0c1d2e3f4a5b6c7d8e9f0a1b2c3d4e5f6a7b8c9d"),
+		Entry("of Flux sources", "main@sha1:"+sourceRevision, "main@sha1:"+targetRevision),
+	)
+
+	It("shows the status of a Promotion", func() {
+		Expect(cmd.status(ctx, "dev-to-prod")).To(Succeed())
+		Expect(out.String()).To(MatchRegexp(`Pull request:\s+https://github.com/acme/fleet/pull/7`))
+		Expect(out.String()).To(MatchRegexp(`Ready\s+False\s+DependencyNotReady\s+1 of 1 dependent objects`))
+		Expect(out.String()).To(MatchRegexp(`deployments\s+<none>\s+podinfo\s+InProgress`))
+	})
+
+	It("shows the history of a Promotion", func() {
+		Expect(cmd.history(ctx, "dev-to-prod")).To(Succeed())
+		Expect(out.String()).To(MatchRegexp(`2023-03-01T08:00:00Z\s+1f0c3e2\s+9a8b7c6\s+Succeeded\s+4s\s+https://github.com/acme/fleet/pull/7`))
+	})
+
+	It("approves the source revision pending approval", func() {
+		Expect(cmd.approve(ctx, "dev-to-prod", "")).To(MatchError(ContainSubstring("does not require approval")))
+
+		promotion.Spec.RequireApproval = true
+		promotion.Status.PendingApprovalRevision = "7d4a9b1"
+		cmd = newCmd(promotion)
+		Expect(cmd.approve(ctx, "dev-to-prod", "")).To(Succeed())
+		Expect(get().Annotations).To(HaveKeyWithValue(apiv1alpha1.ApprovedRevisionAnnotation, "7d4a9b1"))
+	})
+
+	It("requests a promotion", func() {
+		Expect(cmd.trigger(ctx, "dev-to-prod")).To(Succeed())
+		Expect(get().Annotations).To(HaveKeyWithValue(apiv1alpha1.RequestedAtAnnotation, "2023-03-01T09:00:00Z"))
+	})
+
+	// renderDryRuns plays the controller, which renders a dry run
+	// for each new value of the DryRunRequestedAtAnnotation.
+	renderDryRuns := func(count int) {
+		go func() {
+			defer GinkgoRecover()
+			for i := 0; i < count; i++ {
+				var requestedAt string
+				Eventually(func() string {
+					p := get()
+					if !p.IsDryRun() || (p.Status.DryRun != nil && p.Status.DryRun.RequestedAt == p.DryRunRequest()) {
+						return ""
+					}
+					requestedAt = p.DryRunRequest()
+					return requestedAt
+				}).ShouldNot(BeEmpty())
+				p := get()
+				p.Status.DryRun = &apiv1alpha1.DryRunResult{
+					SourceRevision: sourceRevision,
+					TargetRevision: targetRevision,
+					LastRunTime:    metav1.NewTime(now),
+					RequestedAt:    requestedAt,
+					Modified:       []string{"apps/podinfo.yaml"},
+					LinesAdded:     1,
+					LinesDeleted:   1,
+					Patch:          "--- a/apps/podinfo.yaml\n+++ b/apps/podinfo.yaml\n",
+				}
+				Expect(cmd.client.Status().Update(ctx, p)).To(Succeed())
+			}
+		}()
+	}
+
+	It("renders a dry run and leaves dry-run mode again", func() {
+		renderDryRuns(1)
+
+		Expect(cmd.diff(ctx, "dev-to-prod", time.Minute)).To(Succeed())
+		Expect(out.String()).To(ContainSubstring("# dev (1f0c3e2) -> prod (9a8b7c6): 0 added, 1 modified, 0 deleted files, +1 -1 lines"))
+		Expect(out.String()).To(ContainSubstring("+++ b/apps/podinfo.yaml"))
+		Expect(get().Annotations).NotTo(HaveKey(apiv1alpha1.DryRunAnnotation))
+		Expect(get().Annotations).To(HaveKeyWithValue(apiv1alpha1.DryRunRequestedAtAnnotation, "2023-03-01T09:00:00Z"))
+	})
+
+	It("never requests a dry run without switching to dry-run mode", func() {
+		recorder := &patchRecorder{Client: cmd.client}
+		cmd.client = recorder
+		renderDryRuns(1)
+
+		Expect(cmd.diff(ctx, "dev-to-prod", time.Minute)).To(Succeed())
+		Expect(recorder.patched).To(HaveLen(2))
+		for _, p := range recorder.patched {
+			pending := p.Status.DryRun == nil || p.Status.DryRun.RequestedAt != p.DryRunRequest()
+			Expect(pending && !p.IsDryRun()).To(BeFalse(), "patched annotations: %v", p.Annotations)
+		}
+	})
+
+	It("requests a new dry run on every run", func() {
+		renderDryRuns(2)
+
+		Expect(cmd.diff(ctx, "dev-to-prod", time.Minute)).To(Succeed())
+		now = now.Add(time.Minute)
+		Expect(cmd.diff(ctx, "dev-to-prod", time.Minute)).To(Succeed())
+		Expect(get().Status.DryRun.RequestedAt).To(Equal("2023-03-01T09:01:00Z"))
+	})
+
+	It("times out if the dry run is not rendered", func() {
+		promotion.Status.DryRun = &apiv1alpha1.DryRunResult{SourceRevision: sourceRevision, LastRunTime: metav1.NewTime(now)}
+		cmd = newCmd(promotion)
+
+		Expect(cmd.diff(ctx, "dev-to-prod", 10*time.Millisecond)).To(MatchError(ContainSubstring("dry run has not been rendered")))
+		Expect(get().Annotations).NotTo(HaveKey(apiv1alpha1.DryRunAnnotation))
+	})
+})
+
+// patchRecorder records the Promotions as patched on the server.
+type patchRecorder struct {
+	client.Client
+	patched []*apiv1alpha1.Promotion
+}
+
+func (r *patchRecorder) Patch(ctx context.Context, obj client.Object, patch client.Patch, opts ...client.PatchOption) error {
+	if err := r.Client.Patch(ctx, obj, patch, opts...); err != nil {
+		return err
+	}
+	if p, ok := obj.(*apiv1alpha1.Promotion); ok {
+		r.patched = append(r.patched, p.DeepCopy())
+	}
+	return nil
+}
@@ -0,0 +1,123 @@
+/*
+Copyright 2023 Thomas Stadler <thomas@thomasst.xyz>.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// kubectl-promote is a kubectl plugin to inspect and drive Promotions.
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"time"
+
+	flag "github.com/spf13/pflag"
+	"k8s.io/apimachinery/pkg/runtime"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/client-go/tools/clientcmd"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	apiv1alpha1 "github.com/thomasstxyz/release-promotion-operator/api/v1alpha1"
+)
+
+const usage = `Usage: kubectl promote <command> [flags]
+
+Commands:
+  list                  List Promotions with their revisions and gate state
+  status <promotion>    Show the conditions, unready objects and pull request of a Promotion
+  diff <promotion>      Render a dry run of a Promotion and print the diff
+  approve <promotion>   Approve the source revision pending approval
+  trigger <promotion>   Request a promotion of the current source revision
+  history <promotion>   Show the past promotions of a Promotion
+
+Flags:
+`
+
+func main() {
+	if err := run(os.Args[1:]); err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		os.Exit(1)
+	}
+}
+
+func run(args []string) error {
+	flags := flag.NewFlagSet("kubectl-promote", flag.ContinueOnError)
+	flags.Usage = func() {
+		fmt.Fprint(os.Stderr, usage)
+		flags.PrintDefaults()
+	}
+
+	loadingRules := clientcmd.NewDefaultClientConfigLoadingRules()
+	overrides := &clientcmd.ConfigOverrides{}
+	flags.StringVar(&loadingRules.ExplicitPath, "kubeconfig", "", "Path to the kubeconfig file.")
+	flags.StringVar(&overrides.CurrentContext, "context", "", "The kubeconfig context to use.")
+	flags.StringVarP(&overrides.Context.Namespace, "namespace", "n", "", "The namespace of the Promotions.")
+	allNamespaces := flags.BoolP("all-namespaces", "A", false, "List the Promotions of all namespaces.")
+	revision := flags.String("revision", "", "The source revision to approve, defaults to the revision pending approval.")
+	timeout := flags.Duration("timeout", 2*time.Minute, "How long to wait for the dry run to be rendered.")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() == 0 {
+		flags.Usage()
+		return fmt.Errorf("missing command")
+	}
+
+	clientConfig := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(loadingRules, overrides)
+	namespace, _, err := clientConfig.Namespace()
+	if err != nil {
+		return err
+	}
+	restConfig, err := clientConfig.ClientConfig()
+	if err != nil {
+		return err
+	}
+	scheme := runtime.NewScheme()
+	utilruntime.Must(apiv1alpha1.AddToScheme(scheme))
+	c, err := client.New(restConfig, client.Options{Scheme: scheme})
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer cancel()
+
+	cmd := &promoteCmd{client: c, namespace: namespace, out: os.Stdout, now: time.Now, pollInterval: 2 * time.Second}
+	command, cmdArgs := flags.Arg(0), flags.Args()[1:]
+	if command == "list" {
+		return cmd.list(ctx, *allNamespaces)
+	}
+	if len(cmdArgs) != 1 {
+		return fmt.Errorf("%s requires the name of a Promotion", command)
+	}
+	name := cmdArgs[0]
+
+	switch command {
+	case "status":
+		return cmd.status(ctx, name)
+	case "diff":
+		return cmd.diff(ctx, name, *timeout)
+	case "approve":
+		return cmd.approve(ctx, name, *revision)
+	case "trigger":
+		return cmd.trigger(ctx, name)
+	case "history":
+		return cmd.history(ctx, name)
+	default:
+		flags.Usage()
+		return fmt.Errorf("unknown command %q", command)
+	}
+}
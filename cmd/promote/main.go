@@ -0,0 +1,109 @@
+/*
+Copyright 2023 Thomas Stadler <thomas@thomasst.xyz>.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// promote applies a PromotionTemplate between two checkouts of environments
+// without a cluster, exactly like the operator does.
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+
+	flag "github.com/spf13/pflag"
+
+	apiv1alpha1 "github.com/thomasstxyz/release-promotion-operator/api/v1alpha1"
+)
+
+const usage = `Usage: promote [flags] <template> <from> <to>
+
+Applies the copy and chart operations of the PromotionTemplate or ClusterPromotionTemplate
+in the file <template> from the source environment <from> to the destination
+environment <to>, and prints the diff. The environments are local directories
+or URLs of Git repositories. With --write, the destination directory is
+modified in place instead.
+
+Exits with 0 on success, with 1 if --exit-code is set and the promotion changes
+the destination environment, and with 2 on errors.
+
+Flags:
+`
+
+// errChanged is returned if --exit-code is set and the promotion changes the destination.
+var errChanged = errors.New("the promotion changes the destination environment")
+
+func main() {
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
+	err := run(ctx, os.Args[1:], os.Stdout)
+	cancel()
+	if errors.Is(err, errChanged) {
+		os.Exit(1)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		os.Exit(2)
+	}
+}
+
+func run(ctx context.Context, args []string, out io.Writer) error {
+	flags := flag.NewFlagSet("promote", flag.ContinueOnError)
+	flags.Usage = func() {
+		fmt.Fprint(os.Stderr, usage)
+		flags.PrintDefaults()
+	}
+
+	from, to := &environment{}, &environment{}
+	flags.StringVar(&from.path, "from-path", apiv1alpha1.DefaultPath, "The directory of the source environment in <from>.")
+	flags.StringVar(&to.path, "to-path", apiv1alpha1.DefaultPath, "The directory of the destination environment in <to>.")
+	flags.StringVar(&from.branch, "from-branch", apiv1alpha1.DefaultBranch, "The branch to clone if <from> is a Git URL.")
+	flags.StringVar(&to.branch, "to-branch", apiv1alpha1.DefaultBranch, "The branch to clone if <to> is a Git URL.")
+	flags.StringSliceVar(&from.keyFiles, "from-sops-key", nil, "Files with the age identities (.agekey) or OpenPGP keys (.asc) of the source environment.")
+	flags.StringSliceVar(&to.keyFiles, "to-sops-key", nil, "Files with the age identities (.agekey) or OpenPGP keys (.asc) of the destination environment.")
+	write := flags.Bool("write", false, "Write the result to the destination directory instead of printing the diff.")
+	exitCode := flags.Bool("exit-code", false, "Exit with 1 if the promotion changes the destination environment.")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 3 {
+		flags.Usage()
+		return fmt.Errorf("expected <template> <from> <to>, got %d arguments", flags.NArg())
+	}
+	from.location, to.location = flags.Arg(1), flags.Arg(2)
+
+	spec, err := loadTemplate(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.MkdirTemp("", "promote-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmp)
+
+	cmd := &promoteCmd{out: out, tmp: tmp}
+	if *write {
+		return cmd.write(ctx, spec, from, to)
+	}
+	changed, err := cmd.diff(ctx, spec, from, to)
+	if err == nil && changed && *exitCode {
+		return errChanged
+	}
+	return err
+}
@@ -0,0 +1,250 @@
+/*
+Copyright 2023 Thomas Stadler <thomas@thomasst.xyz>.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/serializer"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+
+	apiv1alpha1 "github.com/thomasstxyz/release-promotion-operator/api/v1alpha1"
+	apiv1beta1 "github.com/thomasstxyz/release-promotion-operator/api/v1beta1"
+	"github.com/thomasstxyz/release-promotion-operator/pkg/promotion"
+)
+
+// environment is a source or destination environment given on the command line.
+type environment struct {
+	// location is the local directory or the Git URL of the environment's repository.
+	location string
+	// path is the directory of the environment in the repository.
+	path string
+	// branch is the branch to clone if location is a Git URL.
+	branch string
+	// keyFiles are the files with the keys of the SOPS-encrypted files.
+	keyFiles []string
+}
+
+// isRemote returns true if the location is the URL of a Git repository.
+func (e *environment) isRemote() bool {
+	return strings.Contains(e.location, "://") || strings.HasPrefix(e.location, "git@")
+}
+
+// loadTemplate returns the spec of the PromotionTemplate
+// or ClusterPromotionTemplate in the file.
+func loadTemplate(file string) (*apiv1alpha1.PromotionTemplateSpec, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	scheme := runtime.NewScheme()
+	utilruntime.Must(apiv1alpha1.AddToScheme(scheme))
+	utilruntime.Must(apiv1beta1.AddToScheme(scheme))
+	obj, _, err := serializer.NewCodecFactory(scheme).UniversalDeserializer().Decode(data, nil, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode %s: %w", file, err)
+	}
+
+	var template apiv1alpha1.PromotionTemplate
+	switch t := obj.(type) {
+	case *apiv1alpha1.PromotionTemplate:
+		template = *t
+	case *apiv1beta1.PromotionTemplate:
+		if err := t.ConvertTo(&template); err != nil {
+			return nil, err
+		}
+	case *apiv1alpha1.ClusterPromotionTemplate:
+		template = *promotion.TemplateFromCluster(t)
+	default:
+		return nil, fmt.Errorf("%s is a %s, not a PromotionTemplate or ClusterPromotionTemplate", file, obj.GetObjectKind().GroupVersionKind().Kind)
+	}
+	if err := template.ValidateCreate(); err != nil {
+		return nil, err
+	}
+	// Image operations need an image repository to select the tag from
+	if len(template.Spec.Images) > 0 {
+		return nil, fmt.Errorf("%s has image operations, which are only supported by the operator", file)
+	}
+	return &template.Spec, nil
+}
+
+// promoteCmd promotes between environments given on the command line.
+type promoteCmd struct {
+	out io.Writer
+	// tmp is the directory of the clones and snapshots, removed when done.
+	tmp string
+}
+
+// write applies the copy and chart operations to the destination directory in place
+// and prints the changed files like 'git status --short'.
+func (c *promoteCmd) write(ctx context.Context, spec *apiv1alpha1.PromotionTemplateSpec, from, to *environment) error {
+	if to.isRemote() {
+		return fmt.Errorf("--write requires a local destination directory, not %s", to.location)
+	}
+	src, err := c.checkout(ctx, from)
+	if err != nil {
+		return err
+	}
+	dst, err := c.checkout(ctx, to)
+	if err != nil {
+		return err
+	}
+
+	changes, err := promotion.ApplyTemplate(src, dst, spec)
+	if err != nil {
+		return err
+	}
+	if changes.Empty() {
+		fmt.Fprintln(c.out, "No changes")
+	}
+	for _, name := range changes.Added {
+		fmt.Fprintf(c.out, "A %s\n", name)
+	}
+	for _, name := range changes.Modified {
+		fmt.Fprintf(c.out, "M %s\n", name)
+	}
+	for _, name := range changes.Deleted {
+		fmt.Fprintf(c.out, "D %s\n", name)
+	}
+	return nil
+}
+
+// diff applies the copy and chart operations to a copy of the destination environment
+// and prints the resulting patch. It returns true if the destination changes.
+func (c *promoteCmd) diff(ctx context.Context, spec *apiv1alpha1.PromotionTemplateSpec, from, to *environment) (bool, error) {
+	src, err := c.checkout(ctx, from)
+	if err != nil {
+		return false, err
+	}
+	dst, err := c.checkout(ctx, to)
+	if err != nil {
+		return false, err
+	}
+	if !to.isRemote() {
+		// Leave the local destination untouched
+		if dst, err = c.snapshot(dst); err != nil {
+			return false, err
+		}
+	}
+
+	if _, err := promotion.ApplyTemplate(src, dst, spec); err != nil {
+		return false, err
+	}
+	result, err := dst.Diff(ctx, 0)
+	if err != nil {
+		return false, err
+	}
+
+	sourceRevision, targetRevision := "working tree", "working tree"
+	if from.isRemote() {
+		if sourceRevision, err = src.Head(); err != nil {
+			return false, err
+		}
+	}
+	if to.isRemote() {
+		targetRevision = result.TargetRevision
+	}
+	fmt.Fprintf(c.out, "# %s (%s) -> %s (%s): %d added, %d modified, %d deleted files, +%d -%d lines\n",
+		from.location, apiv1alpha1.ShortRevision(sourceRevision), to.location, apiv1alpha1.ShortRevision(targetRevision),
+		len(result.Added), len(result.Modified), len(result.Deleted), result.LinesAdded, result.LinesDeleted)
+	fmt.Fprint(c.out, result.Patch)
+	return result.Patch != "", nil
+}
+
+// checkout returns the checkout of the environment, cloning it if it is remote.
+func (c *promoteCmd) checkout(ctx context.Context, env *environment) (*promotion.Checkout, error) {
+	keys := map[string][]byte{}
+	for _, file := range env.keyFiles {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		keys[filepath.Base(file)] = data
+	}
+	keyring, err := promotion.NewSOPSKeyring(keys)
+	if err != nil {
+		return nil, err
+	}
+	checkout := &promotion.Checkout{Name: env.location, Path: env.path, SOPSKeys: keyring}
+
+	if env.isRemote() {
+		if checkout.Dir, err = os.MkdirTemp(c.tmp, "clone-"); err != nil {
+			return nil, err
+		}
+		// Without credentials, go-git falls back to the SSH agent for SSH URLs
+		checkout.Repo, err = promotion.Clone(ctx, checkout.Dir, env.location, env.branch, nil)
+		return checkout, err
+	}
+
+	if checkout.Dir, err = filepath.Abs(env.location); err != nil {
+		return nil, err
+	}
+	if info, err := os.Stat(checkout.Dir); err != nil {
+		return nil, err
+	} else if !info.IsDir() {
+		return nil, fmt.Errorf("%s is not a directory", env.location)
+	}
+	checkout.Repo, err = git.PlainOpen(checkout.Dir)
+	if errors.Is(err, git.ErrRepositoryNotExists) {
+		return checkout, nil
+	}
+	return checkout, err
+}
+
+// snapshot commits a copy of the working tree of the checkout to a new repository,
+// so that the promotion can be applied and diffed without modifying the checkout.
+func (c *promoteCmd) snapshot(checkout *promotion.Checkout) (*promotion.Checkout, error) {
+	dir, err := os.MkdirTemp(c.tmp, "snapshot-")
+	if err != nil {
+		return nil, err
+	}
+	if err := promotion.CopyDir(checkout.Dir, dir); err != nil {
+		return nil, err
+	}
+	repo, err := git.PlainInit(dir, false)
+	if err != nil {
+		return nil, err
+	}
+
+	wt, err := repo.Worktree()
+	if err != nil {
+		return nil, err
+	}
+	if err := wt.AddWithOptions(&git.AddOptions{All: true}); err != nil {
+		return nil, err
+	}
+	// The destination may be empty, so the commit may be as well
+	author := promotion.CommitAuthor
+	author.When = time.Now()
+	if _, err := wt.Commit("snapshot", &git.CommitOptions{Author: &author}); err != nil {
+		return nil, err
+	}
+
+	snapshot := *checkout
+	snapshot.Dir, snapshot.Repo = dir, repo
+	return &snapshot, nil
+}
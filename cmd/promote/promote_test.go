@@ -0,0 +1,112 @@
+/*
+Copyright 2023 Thomas Stadler <thomas@thomasst.xyz>.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+
+	"github.com/go-git/go-git/v5"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/thomasstxyz/release-promotion-operator/pkg/promotion"
+)
+
+var _ = Describe("promote", func() {
+	const template = `apiVersion: api.release-promotion-operator.io/v1alpha1
+kind: PromotionTemplate
+metadata:
+  name: apps
+spec:
+  copy:
+    - source: apps
+      destination: apps
+`
+
+	var (
+		ctx            context.Context
+		out            *bytes.Buffer
+		templateFile   string
+		fromDir, toDir string
+	)
+
+	writeFile := func(name, content string) {
+		Expect(os.MkdirAll(filepath.Dir(name), 0o755)).To(Succeed())
+		Expect(os.WriteFile(name, []byte(content), 0o644)).To(Succeed())
+	}
+	readFile := func(name string) string {
+		data, err := os.ReadFile(name)
+		Expect(err).NotTo(HaveOccurred())
+		return string(data)
+	}
+
+	BeforeEach(func() {
+		ctx = context.Background()
+		out = &bytes.Buffer{}
+
+		templateFile = filepath.Join(GinkgoT().TempDir(), "template.yaml")
+		writeFile(templateFile, template)
+		fromDir, toDir = GinkgoT().TempDir(), GinkgoT().TempDir()
+		writeFile(filepath.Join(fromDir, "dev", "apps", "podinfo.yaml"), "image: podinfo:6.3.0\n")
+		writeFile(filepath.Join(toDir, "prod", "apps", "podinfo.yaml"), "image: podinfo:6.2.0\n")
+	})
+
+	It("prints the diff without modifying the destination", func() {
+		Expect(run(ctx, []string{"--from-path", "dev", "--to-path", "prod", templateFile, fromDir, toDir}, out)).To(Succeed())
+
+		Expect(out.String()).To(HavePrefix("# " + fromDir + " (working tree) -> " + toDir + " (working tree): 0 added, 1 modified, 0 deleted files, +1 -1 lines\n"))
+		Expect(out.String()).To(ContainSubstring("-image: podinfo:6.2.0\n+image: podinfo:6.3.0\n"))
+		Expect(readFile(filepath.Join(toDir, "prod", "apps", "podinfo.yaml"))).To(Equal("image: podinfo:6.2.0\n"))
+	})
+
+	It("writes the result to the destination", func() {
+		Expect(run(ctx, []string{"--write", "--from-path", "dev", "--to-path", "prod", templateFile, fromDir, toDir}, out)).To(Succeed())
+
+		Expect(out.String()).To(Equal("M prod/apps/podinfo.yaml\n"))
+		Expect(readFile(filepath.Join(toDir, "prod", "apps", "podinfo.yaml"))).To(Equal("image: podinfo:6.3.0\n"))
+	})
+
+	It("exits with changes only if the destination changes", func() {
+		args := []string{"--exit-code", "--from-path", "dev", "--to-path", "prod", templateFile, fromDir, toDir}
+		Expect(run(ctx, args, out)).To(MatchError(errChanged))
+
+		writeFile(filepath.Join(toDir, "prod", "apps", "podinfo.yaml"), "image: podinfo:6.3.0\n")
+		Expect(run(ctx, args, out)).To(Succeed())
+	})
+
+	It("clones Git repositories", func() {
+		repo, err := git.PlainInit(fromDir, false)
+		Expect(err).NotTo(HaveOccurred())
+		source := &promotion.Checkout{Dir: fromDir, Repo: repo}
+		head, _, err := source.Commit("Release podinfo 6.3.0")
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(run(ctx, []string{"--from-path", "dev", "--from-branch", "master", "--to-path", "prod", templateFile, "file://" + fromDir, toDir}, out)).To(Succeed())
+		Expect(out.String()).To(HavePrefix("# file://" + fromDir + " (" + head.String()[:7] + ") -> "))
+	})
+
+	It("rejects invalid templates", func() {
+		writeFile(templateFile, "apiVersion: api.release-promotion-operator.io/v1alpha1\nkind: PromotionTemplate\nspec:\n  copy:\n    - source: ../apps\n      destination: apps\n")
+		Expect(run(ctx, []string{templateFile, fromDir, toDir}, out)).To(MatchError(ContainSubstring("spec.copy[0].source")))
+
+		writeFile(templateFile, "apiVersion: api.release-promotion-operator.io/v1alpha1\nkind: Environment\n")
+		Expect(run(ctx, []string{templateFile, fromDir, toDir}, out)).To(MatchError(ContainSubstring("not a PromotionTemplate")))
+	})
+})
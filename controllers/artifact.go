@@ -0,0 +1,94 @@
+/*
+Copyright 2023 Thomas Stadler <thomas@thomasst.xyz>.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	apiv1alpha1 "github.com/thomasstxyz/release-promotion-operator/api/v1alpha1"
+	engine "github.com/thomasstxyz/release-promotion-operator/pkg/promotion"
+)
+
+//+kubebuilder:rbac:groups=source.toolkit.fluxcd.io,resources=gitrepositories;ocirepositories;buckets,verbs=get;list;watch
+
+// artifactClient downloads the artifacts of Flux source objects.
+var artifactClient = &http.Client{Timeout: 5 * time.Minute}
+
+// environmentArtifact returns the artifact of the Flux source object of the Environment's SourceRef.
+func (r *PromotionReconciler) environmentArtifact(ctx context.Context, c client.Reader, env *apiv1alpha1.Environment) (*engine.Artifact, error) {
+	gv, err := schema.ParseGroupVersion(env.Spec.SourceRef.GetAPIVersion())
+	if err != nil {
+		return nil, err
+	}
+	obj := &unstructured.Unstructured{}
+	obj.SetGroupVersionKind(gv.WithKind(env.Spec.SourceRef.Kind))
+	if err := c.Get(ctx, client.ObjectKey{Namespace: env.Namespace, Name: env.Spec.SourceRef.Name}, obj); err != nil {
+		return nil, err
+	}
+	return artifactFromSource(obj)
+}
+
+// artifactFromSource reads the artifact from the status of the Flux source object.
+// Digests of source-controller versions reporting only the SHA-256 checksum are converted.
+func artifactFromSource(obj *unstructured.Unstructured) (*engine.Artifact, error) {
+	artifact := &engine.Artifact{}
+	var checksum string
+	fields := map[string]*string{"url": &artifact.URL, "revision": &artifact.Revision, "digest": &artifact.Digest, "checksum": &checksum}
+	for name, value := range fields {
+		v, _, err := unstructured.NestedString(obj.Object, "status", "artifact", name)
+		if err != nil {
+			return nil, fmt.Errorf("invalid artifact of %s %s: %w", obj.GetKind(), obj.GetName(), err)
+		}
+		*value = v
+	}
+	if artifact.URL == "" || artifact.Revision == "" {
+		return nil, fmt.Errorf("%s %s has no artifact yet", obj.GetKind(), obj.GetName())
+	}
+	if artifact.Digest == "" && checksum != "" {
+		artifact.Digest = "sha256:" + checksum
+	}
+	return artifact, nil
+}
+
+// fetchEnvironmentArtifact downloads and extracts the artifact of the Environment's
+// Flux source into a temporary directory. The result has no Git repository
+// and cannot be committed to. The caller must call Close when done.
+func fetchEnvironmentArtifact(ctx context.Context, env *apiv1alpha1.Environment, artifact *engine.Artifact) (*gitCheckout, error) {
+	dir, err := os.MkdirTemp("", "promotion-"+env.Name+"-")
+	if err != nil {
+		return nil, err
+	}
+
+	if err := engine.FetchArtifact(ctx, artifactClient, artifact, dir); err != nil {
+		os.RemoveAll(dir)
+		return nil, fmt.Errorf("%s %s: %w", env.Spec.SourceRef.Kind, env.Spec.SourceRef.Name, err)
+	}
+
+	return &gitCheckout{
+		Checkout: &engine.Checkout{Name: env.Name, Dir: dir, Path: env.Spec.Path},
+		env:      env,
+		artifact: artifact,
+	}, nil
+}
@@ -0,0 +1,139 @@
+/*
+Copyright 2023 Thomas Stadler <thomas@thomasst.xyz>.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	apiv1alpha1 "github.com/thomasstxyz/release-promotion-operator/api/v1alpha1"
+	engine "github.com/thomasstxyz/release-promotion-operator/pkg/promotion"
+)
+
+var _ = Describe("Flux source artifacts", func() {
+	const revision = "main@sha1:3f786850e387550fdab836ed7e6dc881de23001b"
+
+	var (
+		ctx    context.Context
+		server *httptest.Server
+		digest string
+		env    *apiv1alpha1.Environment
+	)
+
+	newGitRepository := func(artifact map[string]any) *unstructured.Unstructured {
+		obj := &unstructured.Unstructured{Object: map[string]any{
+			"apiVersion": apiv1alpha1.DefaultSourceAPIVersion,
+			"kind":       "GitRepository",
+			"metadata":   map[string]any{"name": "podinfo", "namespace": "default"},
+		}}
+		if artifact != nil {
+			obj.Object["status"] = map[string]any{"artifact": artifact}
+		}
+		return obj
+	}
+
+	BeforeEach(func() {
+		ctx = context.Background()
+
+		var buf bytes.Buffer
+		gz := gzip.NewWriter(&buf)
+		tw := tar.NewWriter(gz)
+		data := []byte("image: podinfo:6.3.0\n")
+		Expect(tw.WriteHeader(&tar.Header{Name: "envs/dev/app/deployment.yaml", Mode: 0o644, Size: int64(len(data))})).To(Succeed())
+		_, err := tw.Write(data)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(tw.Close()).To(Succeed())
+		Expect(gz.Close()).To(Succeed())
+		tarball := buf.Bytes()
+		digest = fmt.Sprintf("sha256:%x", sha256.Sum256(tarball))
+
+		server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			_, _ = w.Write(tarball)
+		}))
+		DeferCleanup(server.Close)
+
+		env = &apiv1alpha1.Environment{
+			ObjectMeta: metav1.ObjectMeta{Name: "dev", Namespace: "default"},
+			Spec: apiv1alpha1.EnvironmentSpec{
+				SourceRef: &apiv1alpha1.ArtifactSourceReference{Kind: "GitRepository", Name: "podinfo"},
+				Path:      "envs/dev",
+			},
+		}
+	})
+
+	It("reads the artifact from the status of the source object", func() {
+		c := fake.NewClientBuilder().WithObjects(newGitRepository(map[string]any{
+			"url":      server.URL + "/gitrepository/default/podinfo/latest.tar.gz",
+			"revision": revision,
+			"digest":   digest,
+			"size":     int64(42),
+		})).Build()
+
+		artifact, err := (&PromotionReconciler{}).environmentArtifact(ctx, c, env)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(artifact.Revision).To(Equal(revision))
+		Expect(artifact.Digest).To(Equal(digest))
+
+		objs := &promotionObjects{from: env, fromArtifact: artifact}
+		Expect(objs.sourceRevision(ctx)).To(Equal(revision))
+		from, err := objs.checkoutSource(ctx)
+		Expect(err).NotTo(HaveOccurred())
+		defer from.Close()
+		Expect(from.revision()).To(Equal(revision))
+		Expect(os.ReadFile(filepath.Join(from.Dir, from.Path, "app/deployment.yaml"))).To(BeEquivalentTo("image: podinfo:6.3.0\n"))
+	})
+
+	It("falls back to the checksum of older source-controller versions", func() {
+		artifact, err := artifactFromSource(newGitRepository(map[string]any{
+			"url":      server.URL + "/gitrepository/default/podinfo/latest.tar.gz",
+			"revision": "main/3f786850e387550fdab836ed7e6dc881de23001b",
+			"checksum": "0123abcd",
+		}))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(artifact.Digest).To(Equal("sha256:0123abcd"))
+	})
+
+	It("fails for source objects without an artifact", func() {
+		_, err := artifactFromSource(newGitRepository(nil))
+		Expect(err).To(MatchError("GitRepository podinfo has no artifact yet"))
+	})
+
+	It("rejects artifacts not matching the digest", func() {
+		artifact := &engine.Artifact{
+			URL:      server.URL + "/gitrepository/default/podinfo/latest.tar.gz",
+			Revision: revision,
+			Digest:   fmt.Sprintf("sha256:%x", sha256.Sum256([]byte("other"))),
+		}
+		_, err := fetchEnvironmentArtifact(ctx, env, artifact)
+		Expect(err).To(MatchError(ContainSubstring("GitRepository podinfo: digest of artifact")))
+	})
+})
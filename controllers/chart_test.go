@@ -0,0 +1,71 @@
+/*
+Copyright 2023 Thomas Stadler <thomas@thomasst.xyz>.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	apiv1alpha1 "github.com/thomasstxyz/release-promotion-operator/api/v1alpha1"
+	engine "github.com/thomasstxyz/release-promotion-operator/pkg/promotion"
+)
+
+var _ = Describe("Chart version promotions", func() {
+	var (
+		from, to *gitCheckout
+		objs     *promotionObjects
+	)
+
+	writeHelmRelease := func(dir, version string) {
+		Expect(os.WriteFile(filepath.Join(dir, "podinfo.yaml"), []byte(
+			"apiVersion: helm.toolkit.fluxcd.io/v2beta1\nkind: HelmRelease\nspec:\n  chart:\n    spec:\n      chart: podinfo\n      version: "+version+"\n"), 0o644)).To(Succeed())
+	}
+
+	BeforeEach(func() {
+		from = &gitCheckout{Checkout: &engine.Checkout{Name: "dev", Dir: GinkgoT().TempDir()}}
+		to = &gitCheckout{Checkout: &engine.Checkout{Name: "prod", Dir: GinkgoT().TempDir()}}
+		writeHelmRelease(from.Dir, "7.0.0")
+		writeHelmRelease(to.Dir, "6.3.5")
+
+		objs = &promotionObjects{
+			to: &apiv1alpha1.Environment{ObjectMeta: metav1.ObjectMeta{Name: "prod"}},
+			template: &apiv1alpha1.PromotionTemplate{Spec: apiv1alpha1.PromotionTemplateSpec{
+				Charts: []apiv1alpha1.ChartOperation{{Name: "podinfo", Source: "podinfo.yaml", Destination: "podinfo.yaml"}},
+			}},
+		}
+	})
+
+	It("promotes the chart version", func() {
+		changes, err := objs.applyTemplate(from, to)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(changes.Modified).To(ConsistOf("podinfo.yaml"))
+	})
+
+	It("rejects versions outside of the chart constraints of the destination Environment", func() {
+		objs.to.Spec.Charts = []apiv1alpha1.ChartConstraint{{Name: "podinfo", Version: "<7.0.0"}}
+		_, err := objs.applyTemplate(from, to)
+		var versionErr *engine.ChartVersionError
+		Expect(errors.As(err, &versionErr)).To(BeTrue())
+		Expect(os.ReadFile(filepath.Join(to.Dir, "podinfo.yaml"))).To(ContainSubstring("version: 6.3.5"))
+	})
+})
@@ -0,0 +1,102 @@
+/*
+Copyright 2023 Thomas Stadler <thomas@thomasst.xyz>.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	apiv1alpha1 "github.com/thomasstxyz/release-promotion-operator/api/v1alpha1"
+)
+
+// markReady marks the Promotion as ready and
+// removes the Reconciling and Stalled conditions.
+func markReady(promotion *apiv1alpha1.Promotion, reason, message string) {
+	setCondition(promotion, apiv1alpha1.ReadyCondition, metav1.ConditionTrue, reason, message)
+	meta.RemoveStatusCondition(&promotion.Status.Conditions, apiv1alpha1.ReconcilingCondition)
+	meta.RemoveStatusCondition(&promotion.Status.Conditions, apiv1alpha1.StalledCondition)
+}
+
+// markWaiting marks the Promotion as ready while it waits for its Trigger.
+// The causes which stalled the Promotion before the Trigger is evaluated have
+// been resolved, so only the outcome of the last promotion is kept in the message.
+func markWaiting(promotion *apiv1alpha1.Promotion, message string) {
+	if len(promotion.Status.History) > 0 {
+		last := promotion.Status.History[0]
+		message = fmt.Sprintf("%s, the last promotion of source revision %s %s",
+			message, last.SourceRevision, strings.ToLower(string(last.Outcome)))
+	}
+	markReady(promotion, apiv1alpha1.WaitingForTriggerReason, message)
+}
+
+// markReconciling marks the Promotion as not ready,
+// but progressing towards its desired state.
+func markReconciling(promotion *apiv1alpha1.Promotion, reason, message string) {
+	setCondition(promotion, apiv1alpha1.ReadyCondition, metav1.ConditionFalse, reason, message)
+	setCondition(promotion, apiv1alpha1.ReconcilingCondition, metav1.ConditionTrue, reason, message)
+	meta.RemoveStatusCondition(&promotion.Status.Conditions, apiv1alpha1.StalledCondition)
+}
+
+// markStalled marks the Promotion as not ready,
+// because an error prevents it from progressing.
+func markStalled(promotion *apiv1alpha1.Promotion, reason, message string) {
+	setCondition(promotion, apiv1alpha1.ReadyCondition, metav1.ConditionFalse, reason, message)
+	setCondition(promotion, apiv1alpha1.StalledCondition, metav1.ConditionTrue, reason, message)
+	meta.RemoveStatusCondition(&promotion.Status.Conditions, apiv1alpha1.ReconcilingCondition)
+}
+
+// markFailed marks the Promotion as stalled if the error is a stalledError.
+// Other errors, like failures to clone or push, are transient and retried,
+// so the Promotion is marked as reconciling instead.
+func markFailed(promotion *apiv1alpha1.Promotion, reason string, err error) {
+	var stalledErr *stalledError
+	if errors.As(err, &stalledErr) {
+		markStalled(promotion, reason, err.Error())
+		return
+	}
+	markReconciling(promotion, reason, err.Error())
+}
+
+// stalledError is an error which retrying cannot resolve, as it requires
+// a change of the Promotion or of the objects it references, e.g. an invalid spec.
+type stalledError struct {
+	err error
+}
+
+func (e *stalledError) Error() string {
+	return e.err.Error()
+}
+
+func (e *stalledError) Unwrap() error {
+	return e.err
+}
+
+// setCondition sets the condition, only updating its
+// LastTransitionTime if the status of the condition changes.
+func setCondition(promotion *apiv1alpha1.Promotion, conditionType string, status metav1.ConditionStatus, reason, message string) {
+	meta.SetStatusCondition(&promotion.Status.Conditions, metav1.Condition{
+		Type:               conditionType,
+		Status:             status,
+		ObservedGeneration: promotion.Generation,
+		Reason:             reason,
+		Message:            message,
+	})
+}
@@ -0,0 +1,318 @@
+/*
+Copyright 2023 Thomas Stadler <thomas@thomasst.xyz>.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/plumbing/transport"
+	githttp "github.com/go-git/go-git/v5/plumbing/transport/http"
+	gitssh "github.com/go-git/go-git/v5/plumbing/transport/ssh"
+	"github.com/go-git/go-git/v5/storage/memory"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+	corev1 "k8s.io/api/core/v1"
+
+	apiv1alpha1 "github.com/thomasstxyz/release-promotion-operator/api/v1alpha1"
+	engine "github.com/thomasstxyz/release-promotion-operator/pkg/promotion"
+)
+
+// gitCheckout is a temporary local clone of the Git repository of an Environment,
+// the extracted artifact of its Flux source, or the latest tag of its image repository.
+type gitCheckout struct {
+	*engine.Checkout
+	env  *apiv1alpha1.Environment
+	auth transport.AuthMethod
+
+	// artifact is the Flux source artifact the checkout has been extracted from, if any.
+	artifact *engine.Artifact
+	// image is the image repository whose tag imageTag has been selected, if any.
+	// The checkout holds no files then.
+	image    *engine.ImageRepository
+	imageTag string
+
+	// signer signs the commits, if set.
+	signer commitSigner
+}
+
+// gitAuth returns the authentication method for the URL
+// from the data of the Environment's Secret.
+func gitAuth(url string, secret *corev1.Secret) (transport.AuthMethod, error) {
+	if secret == nil {
+		return nil, nil
+	}
+
+	if strings.HasPrefix(url, "ssh://") {
+		keys, err := gitssh.NewPublicKeys("git", secret.Data["identity"], string(secret.Data["password"]))
+		if err != nil {
+			return nil, fmt.Errorf("invalid identity in Secret %s: %w", secret.Name, err)
+		}
+		keys.HostKeyCallback, err = knownHostsCallback(secret.Data["known_hosts"])
+		if err != nil {
+			return nil, fmt.Errorf("invalid known_hosts in Secret %s: %w", secret.Name, err)
+		}
+		return keys, nil
+	}
+
+	return &githttp.BasicAuth{
+		Username: string(secret.Data["username"]),
+		Password: string(secret.Data["password"]),
+	}, nil
+}
+
+// knownHostsCallback returns a host key callback accepting only
+// the keys listed in the known_hosts data for the host connected to.
+func knownHostsCallback(knownHosts []byte) (ssh.HostKeyCallback, error) {
+	entries := 0
+	for rest := knownHosts; ; entries++ {
+		var err error
+		_, _, _, _, rest, err = ssh.ParseKnownHosts(rest)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	if entries == 0 {
+		return nil, fmt.Errorf("no host keys found")
+	}
+
+	// The known_hosts file is parsed when the callback is created
+	f, err := os.CreateTemp("", "known_hosts-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(f.Name())
+	_, err = f.Write(knownHosts)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return nil, err
+	}
+	callback, err := knownhosts.New(f.Name())
+	if err != nil {
+		return nil, err
+	}
+
+	return func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+		if err := callback(hostname, remote, key); err != nil {
+			return fmt.Errorf("host key of %s not found in known_hosts: %w", hostname, err)
+		}
+		return nil
+	}, nil
+}
+
+// cloneEnvironment clones the branch of the Environment's source
+// into a temporary directory. The caller must call Close when done.
+func cloneEnvironment(ctx context.Context, env *apiv1alpha1.Environment, auth transport.AuthMethod) (*gitCheckout, error) {
+	defer observeGitOperation("clone", time.Now())
+
+	dir, err := os.MkdirTemp("", "promotion-"+env.Name+"-")
+	if err != nil {
+		return nil, err
+	}
+
+	repo, err := engine.Clone(ctx, dir, env.Spec.Source.URL, env.Spec.Source.GetBranch(), auth)
+	if err != nil {
+		os.RemoveAll(dir)
+		return nil, err
+	}
+
+	return &gitCheckout{
+		Checkout: &engine.Checkout{Name: env.Name, Dir: dir, Path: env.Spec.Path, Repo: repo},
+		env:      env,
+		auth:     auth,
+	}, nil
+}
+
+// Close removes the temporary clone.
+func (c *gitCheckout) Close() error {
+	return os.RemoveAll(c.Dir)
+}
+
+// revision returns the checked out commit SHA, the revision of the artifact or the image tag.
+func (c *gitCheckout) revision() (string, error) {
+	if c.image != nil {
+		return c.imageTag, nil
+	}
+	if c.artifact != nil {
+		return c.artifact.Revision, nil
+	}
+	return c.Head()
+}
+
+// headTime returns the commit time of the checked out branch.
+func (c *gitCheckout) headTime() (time.Time, error) {
+	if c.Repo == nil {
+		return time.Time{}, fmt.Errorf("%s is not a Git repository", c.Dir)
+	}
+	ref, err := c.Repo.Head()
+	if err != nil {
+		return time.Time{}, err
+	}
+	commit, err := c.Repo.CommitObject(ref.Hash())
+	if err != nil {
+		return time.Time{}, err
+	}
+	return commit.Committer.When, nil
+}
+
+// remoteHead resolves the commit SHA of the Environment's branch
+// without cloning the repository.
+func remoteHead(ctx context.Context, env *apiv1alpha1.Environment, auth transport.AuthMethod) (string, error) {
+	defer observeGitOperation("ls-remote", time.Now())
+
+	remote := git.NewRemote(memory.NewStorage(), &config.RemoteConfig{
+		Name: git.DefaultRemoteName,
+		URLs: []string{env.Spec.Source.URL},
+	})
+	refs, err := remote.ListContext(ctx, &git.ListOptions{Auth: auth})
+	if err != nil {
+		return "", fmt.Errorf("failed to list references of %s: %w", env.Spec.Source.URL, err)
+	}
+
+	branch := plumbing.NewBranchReferenceName(env.Spec.Source.GetBranch())
+	for _, ref := range refs {
+		if ref.Name() == branch {
+			return ref.Hash().String(), nil
+		}
+	}
+	return "", fmt.Errorf("branch %s not found in %s", branch.Short(), env.Spec.Source.URL)
+}
+
+// commit commits all changes in the checkout, signed by the signer of the
+// checkout if set, and returns the commit SHA. If there are no changes,
+// the SHA of the current HEAD is returned and changed is false.
+func (c *gitCheckout) commit(message string) (hash string, changed bool, err error) {
+	h, changed, err := c.Commit(message)
+	if err != nil || !changed {
+		return h.String(), false, err
+	}
+	if c.signer != nil {
+		if h, err = c.sign(h); err != nil {
+			return "", false, fmt.Errorf("failed to sign commit: %w", err)
+		}
+	}
+	return h.String(), true, nil
+}
+
+// sign replaces the HEAD commit with hash by a commit signed by the signer of the checkout.
+func (c *gitCheckout) sign(hash plumbing.Hash) (plumbing.Hash, error) {
+	commit, err := c.Repo.CommitObject(hash)
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	data, err := encodeWithoutSignature(commit)
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+	if commit.PGPSignature, err = c.signer.sign(data); err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	signed := c.Repo.Storer.NewEncodedObject()
+	if err := commit.Encode(signed); err != nil {
+		return plumbing.ZeroHash, err
+	}
+	signedHash, err := c.Repo.Storer.SetEncodedObject(signed)
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	head, err := c.Repo.Head()
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+	if err := c.Repo.Storer.SetReference(plumbing.NewHashReference(head.Name(), signedHash)); err != nil {
+		return plumbing.ZeroHash, err
+	}
+	return signedHash, nil
+}
+
+// verifyHead verifies the signature of the HEAD commit with the verifier
+// and returns the fingerprint of the key it has been signed with.
+func (c *gitCheckout) verifyHead(verifier *commitVerifier) (string, error) {
+	if c.Repo == nil {
+		return "", fmt.Errorf("%s is not a Git repository", c.Dir)
+	}
+	head, err := c.Repo.Head()
+	if err != nil {
+		return "", err
+	}
+	commit, err := c.Repo.CommitObject(head.Hash())
+	if err != nil {
+		return "", err
+	}
+	if commit.PGPSignature == "" {
+		return "", fmt.Errorf("commit is not signed")
+	}
+
+	data, err := encodeWithoutSignature(commit)
+	if err != nil {
+		return "", err
+	}
+	return verifier.verify(data, commit.PGPSignature)
+}
+
+// encodeWithoutSignature returns the encoded commit the signature is computed for.
+func encodeWithoutSignature(commit *object.Commit) ([]byte, error) {
+	unsigned := &plumbing.MemoryObject{}
+	if err := commit.EncodeWithoutSignature(unsigned); err != nil {
+		return nil, err
+	}
+	r, err := unsigned.Reader()
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return io.ReadAll(r)
+}
+
+// push pushes the checked out branch to the branch of the remote repository.
+// Pushing to any other than the Environment's branch overwrites the remote branch.
+func (c *gitCheckout) push(ctx context.Context, branch string) error {
+	defer observeGitOperation("push", time.Now())
+
+	refSpec := config.RefSpec(fmt.Sprintf("%s:%s",
+		plumbing.NewBranchReferenceName(c.env.Spec.Source.GetBranch()), plumbing.NewBranchReferenceName(branch)))
+	if branch != c.env.Spec.Source.GetBranch() {
+		refSpec = "+" + refSpec
+	}
+
+	err := c.Repo.PushContext(ctx, &git.PushOptions{
+		RemoteName: git.DefaultRemoteName,
+		RefSpecs:   []config.RefSpec{refSpec},
+		Auth:       c.auth,
+	})
+	if err != nil && err != git.NoErrAlreadyUpToDate {
+		return fmt.Errorf("failed to push to %s: %w", c.env.Spec.Source.URL, err)
+	}
+	return nil
+}
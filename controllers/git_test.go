@@ -0,0 +1,209 @@
+/*
+Copyright 2023 Thomas Stadler <thomas@thomasst.xyz>.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	githttp "github.com/go-git/go-git/v5/plumbing/transport/http"
+	gitssh "github.com/go-git/go-git/v5/plumbing/transport/ssh"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// testRepository is a bare Git repository standing in for the remote of an Environment.
+type testRepository struct {
+	dir string
+}
+
+// newTestRepository creates a bare repository with a commit of the files on the master branch.
+func newTestRepository(files map[string]string) *testRepository {
+	r := &testRepository{dir: GinkgoT().TempDir()}
+	_, err := git.PlainInit(r.dir, true)
+	Expect(err).NotTo(HaveOccurred())
+	r.commit("Initial commit", files)
+	return r
+}
+
+// url returns the URL the repository is cloned from.
+func (r *testRepository) url() string {
+	return "file://" + r.dir
+}
+
+// commit pushes a commit of the files on top of the master branch and returns its SHA.
+func (r *testRepository) commit(message string, files map[string]string) string {
+	dir := GinkgoT().TempDir()
+	var repo *git.Repository
+	var err error
+	if r.head("master") == "" {
+		repo, err = git.PlainInit(dir, false)
+		Expect(err).NotTo(HaveOccurred())
+		_, err = repo.CreateRemote(&config.RemoteConfig{Name: git.DefaultRemoteName, URLs: []string{r.url()}})
+	} else {
+		repo, err = git.PlainClone(dir, false, &git.CloneOptions{URL: r.url()})
+	}
+	Expect(err).NotTo(HaveOccurred())
+
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		Expect(os.MkdirAll(filepath.Dir(path), 0o755)).To(Succeed())
+		Expect(os.WriteFile(path, []byte(content), 0o644)).To(Succeed())
+	}
+	wt, err := repo.Worktree()
+	Expect(err).NotTo(HaveOccurred())
+	Expect(wt.AddWithOptions(&git.AddOptions{All: true})).To(Succeed())
+	hash, err := wt.Commit(message, &git.CommitOptions{
+		Author: &object.Signature{Name: "Developer", Email: "developer@example.com", When: time.Now()},
+	})
+	Expect(err).NotTo(HaveOccurred())
+	Expect(repo.Push(&git.PushOptions{RefSpecs: []config.RefSpec{"refs/heads/master:refs/heads/master"}})).To(Succeed())
+	return hash.String()
+}
+
+// head returns the commit SHA of the branch, or an empty string if it does not exist.
+func (r *testRepository) head(branch string) string {
+	repo, err := git.PlainOpen(r.dir)
+	Expect(err).NotTo(HaveOccurred())
+	ref, err := repo.Reference(plumbing.NewBranchReferenceName(branch), true)
+	if err != nil {
+		return ""
+	}
+	return ref.Hash().String()
+}
+
+// setHead points the master branch at the commit, e.g. to stage a commit
+// which moveOnWhenCloned moves the branch to later.
+func (r *testRepository) setHead(sha string) {
+	repo, err := git.PlainOpen(r.dir)
+	Expect(err).NotTo(HaveOccurred())
+	Expect(repo.Storer.SetReference(plumbing.NewHashReference(plumbing.Master, plumbing.NewHash(sha)))).To(Succeed())
+}
+
+// moveOnWhenCloned moves the master branch to the commit once the references of
+// the repository have been listed, so that the next clone sees another revision
+// than the listing, as if the commit had been pushed in between.
+func (r *testRepository) moveOnWhenCloned(sha string) {
+	execPath, err := exec.Command("git", "--exec-path").Output()
+	Expect(err).NotTo(HaveOccurred())
+	bin := GinkgoT().TempDir()
+	listed := filepath.Join(bin, "listed")
+	script := fmt.Sprintf(`#!/bin/sh
+if [ "$1" = %q ]; then
+	if [ -e %q ]; then git --git-dir="$1" update-ref refs/heads/master %s; fi
+	touch %q
+fi
+exec %q "$@"
+`, r.dir, listed, sha, listed, filepath.Join(strings.TrimSpace(string(execPath)), "git-upload-pack"))
+	Expect(os.WriteFile(filepath.Join(bin, "git-upload-pack"), []byte(script), 0o755)).To(Succeed())
+	GinkgoT().Setenv("PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+}
+
+// commitObject returns the commit with the SHA.
+func (r *testRepository) commitObject(sha string) *object.Commit {
+	repo, err := git.PlainOpen(r.dir)
+	Expect(err).NotTo(HaveOccurred())
+	commit, err := repo.CommitObject(plumbing.NewHash(sha))
+	Expect(err).NotTo(HaveOccurred())
+	return commit
+}
+
+// newHostKey returns a new SSH host key.
+func newHostKey() ssh.PublicKey {
+	public, _, err := ed25519.GenerateKey(rand.Reader)
+	Expect(err).NotTo(HaveOccurred())
+	key, err := ssh.NewPublicKey(public)
+	Expect(err).NotTo(HaveOccurred())
+	return key
+}
+
+// newIdentity returns a new PEM encoded SSH private key.
+func newIdentity() []byte {
+	_, private, err := ed25519.GenerateKey(rand.Reader)
+	Expect(err).NotTo(HaveOccurred())
+	der, err := x509.MarshalPKCS8PrivateKey(private)
+	Expect(err).NotTo(HaveOccurred())
+	return pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+}
+
+var _ = Describe("Git credentials", func() {
+	var (
+		hostKey    ssh.PublicKey
+		knownHosts []byte
+	)
+
+	BeforeEach(func() {
+		hostKey = newHostKey()
+		knownHosts = []byte(knownhosts.Line([]string{"github.com"}, hostKey) + "\n")
+	})
+
+	It("authenticates HTTPS with basic auth", func() {
+		auth, err := gitAuth("https://github.com/acme/podinfo.git", &corev1.Secret{
+			Data: map[string][]byte{"username": []byte("flux"), "password": []byte("s3cr3t")},
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(auth).To(Equal(&githttp.BasicAuth{Username: "flux", Password: "s3cr3t"}))
+	})
+
+	It("authenticates SSH with the identity of the Secret", func() {
+		auth, err := gitAuth("ssh://git@github.com/acme/podinfo.git", &corev1.Secret{
+			Data: map[string][]byte{"identity": newIdentity(), "known_hosts": knownHosts},
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(auth).To(BeAssignableToTypeOf(&gitssh.PublicKeys{}))
+		Expect(auth.(*gitssh.PublicKeys).User).To(Equal("git"))
+	})
+
+	It("rejects invalid SSH credentials", func() {
+		secret := &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: "git-credentials"},
+			Data:       map[string][]byte{"identity": []byte("not a key"), "known_hosts": knownHosts},
+		}
+		_, err := gitAuth("ssh://git@github.com/acme/podinfo.git", secret)
+		Expect(err).To(MatchError(ContainSubstring("invalid identity in Secret git-credentials")))
+
+		secret.Data = map[string][]byte{"identity": newIdentity()}
+		_, err = gitAuth("ssh://git@github.com/acme/podinfo.git", secret)
+		Expect(err).To(MatchError("invalid known_hosts in Secret git-credentials: no host keys found"))
+	})
+
+	It("accepts only the known key of the host", func() {
+		callback, err := knownHostsCallback(knownHosts)
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(callback("github.com:22", &net.TCPAddr{}, hostKey)).To(Succeed())
+		Expect(callback("gitlab.com:22", &net.TCPAddr{}, hostKey)).To(MatchError(ContainSubstring("host key of gitlab.com:22 not found in known_hosts")))
+		Expect(callback("github.com:22", &net.TCPAddr{}, newHostKey())).To(MatchError(ContainSubstring("host key of github.com:22 not found in known_hosts")))
+	})
+})
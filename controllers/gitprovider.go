@@ -0,0 +1,359 @@
+/*
+Copyright 2023 Thomas Stadler <thomas@thomasst.xyz>.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+
+	apiv1alpha1 "github.com/thomasstxyz/release-promotion-operator/api/v1alpha1"
+)
+
+// gitProviderTokenKey is the field of the provider Secret holding the API token.
+const gitProviderTokenKey = "token"
+
+// Default API URLs of the Git hosting services.
+const (
+	defaultGitHubAPIURL = "https://api.github.com"
+	defaultGitLabAPIURL = "https://gitlab.com/api/v4"
+)
+
+// commitState is the state of a commit status.
+type commitState string
+
+const (
+	commitStatePending commitState = "pending"
+	commitStateSuccess commitState = "success"
+	commitStateFailure commitState = "failure"
+	// commitStateCanceled is reported for promotions which have been superseded,
+	// as "error" to GitHub, which has no canceled state.
+	commitStateCanceled commitState = "canceled"
+)
+
+// commitStatus is reported on a commit of the source environment.
+type commitStatus struct {
+	state       commitState
+	context     string
+	description string
+}
+
+// deployment is a record of a commit deployed to an environment.
+type deployment struct {
+	sha         string
+	ref         string
+	environment string
+	description string
+}
+
+// pullRequest is a pull request, or a merge request on GitLab,
+// of a branch into the branch of an environment.
+type pullRequest struct {
+	head        string
+	base        string
+	title       string
+	description string
+
+	// number and url are set once the pull request has been opened.
+	number int
+	url    string
+	// opened is true if the pull request has been created,
+	// rather than found open already.
+	opened bool
+}
+
+// pullRequestState is the state of a pull request.
+type pullRequestState string
+
+const (
+	pullRequestOpen   pullRequestState = "open"
+	pullRequestMerged pullRequestState = "merged"
+	pullRequestClosed pullRequestState = "closed"
+)
+
+// gitProvider reports promotions to a Git hosting service
+// and opens the pull requests of the pull-request strategy.
+type gitProvider interface {
+	// setCommitStatus creates a status on the commit, replacing previous statuses of the same context.
+	setCommitStatus(ctx context.Context, sha string, status commitStatus) error
+	// createDeployment records a successful deployment of the commit to the environment.
+	createDeployment(ctx context.Context, d deployment) error
+	// openPullRequest opens the pull request, unless a pull request of its head
+	// branch into its base branch is already open, and sets its number and URL.
+	// It sets opened if the pull request has been created.
+	openPullRequest(ctx context.Context, pr *pullRequest) error
+	// getPullRequestState returns whether the pull request with the number is open, merged or closed without merging.
+	getPullRequestState(ctx context.Context, number int) (pullRequestState, error)
+}
+
+// gitProviderFromSecret returns the provider of the Environment, authenticated with the token in the Secret.
+func gitProviderFromSecret(env *apiv1alpha1.Environment, secret *corev1.Secret) (gitProvider, error) {
+	token, ok := secret.Data[gitProviderTokenKey]
+	if !ok {
+		return nil, fmt.Errorf("Secret %s has no %s field", secret.Name, gitProviderTokenKey)
+	}
+	repository, err := env.Spec.Provider.GetRepository(env.Spec.Source.URL)
+	if err != nil {
+		return nil, err
+	}
+
+	api := &restAPI{
+		httpClient: &http.Client{Timeout: 30 * time.Second},
+		baseURL:    strings.TrimSuffix(env.Spec.Provider.APIURL, "/"),
+	}
+	switch env.Spec.Provider.Type {
+	case apiv1alpha1.GitHubProvider:
+		if api.baseURL == "" {
+			api.baseURL = defaultGitHubAPIURL
+		}
+		api.header = http.Header{
+			"Authorization": {"Bearer " + string(token)},
+			"Accept":        {"application/vnd.github+json"},
+		}
+		return &gitHubProvider{api: api, repository: repository}, nil
+	case apiv1alpha1.GitLabProvider:
+		if api.baseURL == "" {
+			api.baseURL = defaultGitLabAPIURL
+		}
+		api.header = http.Header{"Private-Token": {string(token)}}
+		return &gitLabProvider{api: api, project: url.PathEscape(repository)}, nil
+	default:
+		return nil, fmt.Errorf("unsupported Git provider type %q", env.Spec.Provider.Type)
+	}
+}
+
+// restAPI sends JSON requests to the REST API of a Git hosting service.
+type restAPI struct {
+	httpClient *http.Client
+	baseURL    string
+	header     http.Header
+}
+
+// post sends the body as JSON to the path and decodes the response into result, if not nil.
+func (a *restAPI) post(ctx context.Context, path string, body, result any) error {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	return a.do(ctx, http.MethodPost, path, bytes.NewReader(data), result)
+}
+
+// get decodes the response to a GET request of the path into result.
+func (a *restAPI) get(ctx context.Context, path string, result any) error {
+	return a.do(ctx, http.MethodGet, path, nil, result)
+}
+
+// do sends the request with the body, if not nil, and decodes the response into result, if not nil.
+func (a *restAPI) do(ctx context.Context, method, path string, body io.Reader, result any) error {
+	req, err := http.NewRequestWithContext(ctx, method, a.baseURL+path, body)
+	if err != nil {
+		return err
+	}
+	for name, values := range a.header {
+		req.Header[name] = values
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := a.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	respBody, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("%s %s responded with %s: %s", method, path, resp.Status, strings.TrimSpace(string(respBody)))
+	}
+	if result == nil {
+		return nil
+	}
+	return json.Unmarshal(respBody, result)
+}
+
+// gitHubProvider reports to the REST API of GitHub.
+type gitHubProvider struct {
+	api        *restAPI
+	repository string
+}
+
+func (p *gitHubProvider) setCommitStatus(ctx context.Context, sha string, status commitStatus) error {
+	state := string(status.state)
+	if status.state == commitStateCanceled {
+		state = "error"
+	}
+	return p.api.post(ctx, fmt.Sprintf("/repos/%s/statuses/%s", p.repository, sha), map[string]string{
+		"state":       state,
+		"context":     status.context,
+		"description": status.description,
+	}, nil)
+}
+
+// createDeployment creates a deployment of the commit and marks it as successful,
+// as the promotion has already landed when it is reported.
+func (p *gitHubProvider) createDeployment(ctx context.Context, d deployment) error {
+	var created struct {
+		ID int64 `json:"id"`
+	}
+	if err := p.api.post(ctx, fmt.Sprintf("/repos/%s/deployments", p.repository), map[string]any{
+		"ref":               d.sha,
+		"environment":       d.environment,
+		"description":       d.description,
+		"auto_merge":        false,
+		"required_contexts": []string{},
+	}, &created); err != nil {
+		return err
+	}
+	return p.api.post(ctx, fmt.Sprintf("/repos/%s/deployments/%d/statuses", p.repository, created.ID), map[string]string{
+		"state":       "success",
+		"description": d.description,
+	}, nil)
+}
+
+func (p *gitHubProvider) openPullRequest(ctx context.Context, pr *pullRequest) error {
+	type gitHubPullRequest struct {
+		Number  int    `json:"number"`
+		HTMLURL string `json:"html_url"`
+	}
+
+	// Pull requests from branches of the same repository are listed by '<owner>:<branch>'
+	owner, _, _ := strings.Cut(p.repository, "/")
+	var open []gitHubPullRequest
+	query := url.Values{"state": {"open"}, "head": {owner + ":" + pr.head}, "base": {pr.base}}
+	if err := p.api.get(ctx, fmt.Sprintf("/repos/%s/pulls?%s", p.repository, query.Encode()), &open); err != nil {
+		return err
+	}
+	if len(open) > 0 {
+		pr.number, pr.url = open[0].Number, open[0].HTMLURL
+		return nil
+	}
+
+	var created gitHubPullRequest
+	if err := p.api.post(ctx, fmt.Sprintf("/repos/%s/pulls", p.repository), map[string]string{
+		"head":  pr.head,
+		"base":  pr.base,
+		"title": pr.title,
+		"body":  pr.description,
+	}, &created); err != nil {
+		return err
+	}
+	pr.number, pr.url, pr.opened = created.Number, created.HTMLURL, true
+	return nil
+}
+
+func (p *gitHubProvider) getPullRequestState(ctx context.Context, number int) (pullRequestState, error) {
+	var pr struct {
+		State  string `json:"state"`
+		Merged bool   `json:"merged"`
+	}
+	if err := p.api.get(ctx, fmt.Sprintf("/repos/%s/pulls/%d", p.repository, number), &pr); err != nil {
+		return "", err
+	}
+	switch {
+	case pr.Merged:
+		return pullRequestMerged, nil
+	case pr.State == "closed":
+		return pullRequestClosed, nil
+	default:
+		return pullRequestOpen, nil
+	}
+}
+
+// gitLabProvider reports to the REST API of GitLab.
+type gitLabProvider struct {
+	api     *restAPI
+	project string
+}
+
+func (p *gitLabProvider) setCommitStatus(ctx context.Context, sha string, status commitStatus) error {
+	state := string(status.state)
+	if status.state == commitStateFailure {
+		state = "failed"
+	}
+	return p.api.post(ctx, fmt.Sprintf("/projects/%s/statuses/%s", p.project, sha), map[string]string{
+		"state":       state,
+		"name":        status.context,
+		"description": status.description,
+	}, nil)
+}
+
+func (p *gitLabProvider) createDeployment(ctx context.Context, d deployment) error {
+	return p.api.post(ctx, fmt.Sprintf("/projects/%s/deployments", p.project), map[string]any{
+		"environment": d.environment,
+		"sha":         d.sha,
+		"ref":         d.ref,
+		"tag":         false,
+		"status":      "success",
+	}, nil)
+}
+
+func (p *gitLabProvider) openPullRequest(ctx context.Context, pr *pullRequest) error {
+	type gitLabMergeRequest struct {
+		IID    int    `json:"iid"`
+		WebURL string `json:"web_url"`
+	}
+
+	var open []gitLabMergeRequest
+	query := url.Values{"state": {"opened"}, "source_branch": {pr.head}, "target_branch": {pr.base}}
+	if err := p.api.get(ctx, fmt.Sprintf("/projects/%s/merge_requests?%s", p.project, query.Encode()), &open); err != nil {
+		return err
+	}
+	if len(open) > 0 {
+		pr.number, pr.url = open[0].IID, open[0].WebURL
+		return nil
+	}
+
+	var created gitLabMergeRequest
+	if err := p.api.post(ctx, fmt.Sprintf("/projects/%s/merge_requests", p.project), map[string]string{
+		"source_branch": pr.head,
+		"target_branch": pr.base,
+		"title":         pr.title,
+		"description":   pr.description,
+	}, &created); err != nil {
+		return err
+	}
+	pr.number, pr.url, pr.opened = created.IID, created.WebURL, true
+	return nil
+}
+
+func (p *gitLabProvider) getPullRequestState(ctx context.Context, number int) (pullRequestState, error) {
+	var mr struct {
+		State string `json:"state"`
+	}
+	if err := p.api.get(ctx, fmt.Sprintf("/projects/%s/merge_requests/%d", p.project, number), &mr); err != nil {
+		return "", err
+	}
+	switch mr.State {
+	case "merged":
+		return pullRequestMerged, nil
+	case "closed":
+		return pullRequestClosed, nil
+	default:
+		return pullRequestOpen, nil
+	}
+}
@@ -0,0 +1,237 @@
+/*
+Copyright 2023 Thomas Stadler <thomas@thomasst.xyz>.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	apiv1alpha1 "github.com/thomasstxyz/release-promotion-operator/api/v1alpha1"
+)
+
+// apiCall is a request recorded by the mocked provider API.
+type apiCall struct {
+	method string
+	path   string
+	query  url.Values
+	header http.Header
+	body   map[string]any
+}
+
+// newProviderAPI returns a mocked provider API recording the calls, which responds
+// with the responses by path, with an empty JSON list to other GET requests,
+// and with no content to other POST requests.
+func newProviderAPI(calls *[]apiCall, responses map[string]string) *httptest.Server {
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		defer GinkgoRecover()
+		call := apiCall{method: req.Method, path: req.URL.EscapedPath(), query: req.URL.Query(), header: req.Header}
+		if req.Method == http.MethodPost {
+			Expect(json.NewDecoder(req.Body).Decode(&call.body)).To(Succeed())
+			w.WriteHeader(http.StatusCreated)
+		}
+		*calls = append(*calls, call)
+
+		if response, ok := responses[req.Method+" "+req.URL.Path]; ok {
+			_, _ = w.Write([]byte(response))
+		} else if req.Method == http.MethodGet {
+			_, _ = w.Write([]byte("[]"))
+		}
+	}))
+	DeferCleanup(api.Close)
+	return api
+}
+
+var _ = Describe("Git providers", func() {
+	const sha = "3f786850e387550fdab836ed7e6dc881de23001b"
+
+	var (
+		ctx    context.Context
+		api    *httptest.Server
+		calls  []apiCall
+		secret *corev1.Secret
+	)
+
+	newEnvironment := func(providerType apiv1alpha1.GitProviderType, url string) *apiv1alpha1.Environment {
+		return &apiv1alpha1.Environment{
+			ObjectMeta: metav1.ObjectMeta{Name: "dev"},
+			Spec: apiv1alpha1.EnvironmentSpec{
+				Source:   &apiv1alpha1.SourceSpec{URL: url},
+				Provider: &apiv1alpha1.GitProvider{Type: providerType, APIURL: api.URL, SecretRef: apiv1alpha1.LocalObjectReference{Name: "token"}},
+			},
+		}
+	}
+
+	BeforeEach(func() {
+		ctx = context.Background()
+		calls = nil
+		secret = &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: "token"},
+			Data:       map[string][]byte{gitProviderTokenKey: []byte("s3cr3t")},
+		}
+
+		api = newProviderAPI(&calls, map[string]string{
+			"POST /repos/acme/podinfo/deployments":            `{"id": 42}`,
+			"POST /repos/acme/podinfo/pulls":                  `{"number": 7, "html_url": "https://github.com/acme/podinfo/pull/7"}`,
+			"POST /projects/acme/apps/podinfo/merge_requests": `{"iid": 3, "web_url": "https://gitlab.com/acme/apps/podinfo/-/merge_requests/3"}`,
+		})
+	})
+
+	It("reports commit statuses and deployments to GitHub", func() {
+		provider, err := gitProviderFromSecret(newEnvironment(apiv1alpha1.GitHubProvider, "https://github.com/acme/podinfo.git"), secret)
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(provider.setCommitStatus(ctx, sha, commitStatus{state: commitStateSuccess, context: "promotion/prod", description: "Promoted to prod"})).To(Succeed())
+		Expect(provider.createDeployment(ctx, deployment{sha: sha, ref: "main", environment: "prod", description: "Promoted to prod"})).To(Succeed())
+
+		Expect(calls).To(HaveLen(3))
+		Expect(calls[0].path).To(Equal("/repos/acme/podinfo/statuses/" + sha))
+		Expect(calls[0].header.Get("Authorization")).To(Equal("Bearer s3cr3t"))
+		Expect(calls[0].body).To(Equal(map[string]any{"state": "success", "context": "promotion/prod", "description": "Promoted to prod"}))
+		Expect(calls[1].path).To(Equal("/repos/acme/podinfo/deployments"))
+		Expect(calls[1].body).To(HaveKeyWithValue("ref", sha))
+		Expect(calls[1].body).To(HaveKeyWithValue("environment", "prod"))
+		Expect(calls[2].path).To(Equal("/repos/acme/podinfo/deployments/42/statuses"))
+		Expect(calls[2].body).To(HaveKeyWithValue("state", "success"))
+	})
+
+	It("reports commit statuses and deployments to GitLab", func() {
+		provider, err := gitProviderFromSecret(newEnvironment(apiv1alpha1.GitLabProvider, "ssh://git@gitlab.com/acme/apps/podinfo.git"), secret)
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(provider.setCommitStatus(ctx, sha, commitStatus{state: commitStateFailure, context: "promotion/prod", description: "Promotion to prod failed"})).To(Succeed())
+		Expect(provider.createDeployment(ctx, deployment{sha: sha, ref: "main", environment: "prod"})).To(Succeed())
+
+		Expect(calls).To(HaveLen(2))
+		Expect(calls[0].path).To(Equal("/projects/acme%2Fapps%2Fpodinfo/statuses/" + sha))
+		Expect(calls[0].header.Get("Private-Token")).To(Equal("s3cr3t"))
+		Expect(calls[0].body).To(HaveKeyWithValue("state", "failed"))
+		Expect(calls[0].body).To(HaveKeyWithValue("name", "promotion/prod"))
+		Expect(calls[1].path).To(Equal("/projects/acme%2Fapps%2Fpodinfo/deployments"))
+		Expect(calls[1].body).To(HaveKeyWithValue("status", "success"))
+		Expect(calls[1].body).To(HaveKeyWithValue("ref", "main"))
+	})
+
+	It("reports superseded promotions as canceled", func() {
+		gitHub, err := gitProviderFromSecret(newEnvironment(apiv1alpha1.GitHubProvider, "https://github.com/acme/podinfo.git"), secret)
+		Expect(err).NotTo(HaveOccurred())
+		gitLab, err := gitProviderFromSecret(newEnvironment(apiv1alpha1.GitLabProvider, "ssh://git@gitlab.com/acme/apps/podinfo.git"), secret)
+		Expect(err).NotTo(HaveOccurred())
+
+		status := commitStatus{state: commitStateCanceled, context: "promotion/prod", description: "Superseded"}
+		Expect(gitHub.setCommitStatus(ctx, sha, status)).To(Succeed())
+		Expect(gitLab.setCommitStatus(ctx, sha, status)).To(Succeed())
+
+		Expect(calls).To(HaveLen(2))
+		Expect(calls[0].body).To(HaveKeyWithValue("state", "error"))
+		Expect(calls[1].body).To(HaveKeyWithValue("state", "canceled"))
+	})
+
+	DescribeTable("returns the state of pull requests",
+		func(providerType apiv1alpha1.GitProviderType, response string, expected pullRequestState) {
+			api.Config.Handler = newProviderAPI(&calls, map[string]string{
+				"GET /repos/acme/podinfo/pulls/7":                  response,
+				"GET /projects/acme/apps/podinfo/merge_requests/7": response,
+			}).Config.Handler
+			url := "https://github.com/acme/podinfo.git"
+			if providerType == apiv1alpha1.GitLabProvider {
+				url = "ssh://git@gitlab.com/acme/apps/podinfo.git"
+			}
+			provider, err := gitProviderFromSecret(newEnvironment(providerType, url), secret)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(provider.getPullRequestState(ctx, 7)).To(Equal(expected))
+			Expect(calls).To(HaveLen(1))
+		},
+		Entry("open on GitHub", apiv1alpha1.GitHubProvider, `{"state": "open", "merged": false}`, pullRequestOpen),
+		Entry("merged on GitHub", apiv1alpha1.GitHubProvider, `{"state": "closed", "merged": true}`, pullRequestMerged),
+		Entry("closed on GitHub", apiv1alpha1.GitHubProvider, `{"state": "closed", "merged": false}`, pullRequestClosed),
+		Entry("open on GitLab", apiv1alpha1.GitLabProvider, `{"state": "opened"}`, pullRequestOpen),
+		Entry("merged on GitLab", apiv1alpha1.GitLabProvider, `{"state": "merged"}`, pullRequestMerged),
+		Entry("closed on GitLab", apiv1alpha1.GitLabProvider, `{"state": "closed"}`, pullRequestClosed),
+	)
+
+	It("opens pull requests on GitHub", func() {
+		provider, err := gitProviderFromSecret(newEnvironment(apiv1alpha1.GitHubProvider, "https://github.com/acme/podinfo.git"), secret)
+		Expect(err).NotTo(HaveOccurred())
+
+		pr := &pullRequest{head: "promotion/dev-to-prod", base: "main", title: "Promote dev to prod", description: "Promotes dev"}
+		Expect(provider.openPullRequest(ctx, pr)).To(Succeed())
+		Expect(pr.number).To(Equal(7))
+		Expect(pr.url).To(Equal("https://github.com/acme/podinfo/pull/7"))
+		Expect(pr.opened).To(BeTrue())
+
+		Expect(calls).To(HaveLen(2))
+		Expect(calls[0].method).To(Equal(http.MethodGet))
+		Expect(calls[0].path).To(Equal("/repos/acme/podinfo/pulls"))
+		Expect(calls[0].query).To(Equal(url.Values{"state": {"open"}, "head": {"acme:promotion/dev-to-prod"}, "base": {"main"}}))
+		Expect(calls[1].method).To(Equal(http.MethodPost))
+		Expect(calls[1].path).To(Equal("/repos/acme/podinfo/pulls"))
+		Expect(calls[1].body).To(Equal(map[string]any{"head": "promotion/dev-to-prod", "base": "main", "title": "Promote dev to prod", "body": "Promotes dev"}))
+	})
+
+	It("returns the open pull request of the branch", func() {
+		api.Config.Handler = newProviderAPI(&calls, map[string]string{
+			"GET /repos/acme/podinfo/pulls": `[{"number": 5, "html_url": "https://github.com/acme/podinfo/pull/5"}]`,
+		}).Config.Handler
+		provider, err := gitProviderFromSecret(newEnvironment(apiv1alpha1.GitHubProvider, "https://github.com/acme/podinfo.git"), secret)
+		Expect(err).NotTo(HaveOccurred())
+
+		pr := &pullRequest{head: "promotion/dev-to-prod", base: "main"}
+		Expect(provider.openPullRequest(ctx, pr)).To(Succeed())
+		Expect(pr.number).To(Equal(5))
+		Expect(pr.url).To(Equal("https://github.com/acme/podinfo/pull/5"))
+		Expect(pr.opened).To(BeFalse())
+		Expect(calls).To(HaveLen(1))
+	})
+
+	It("opens merge requests on GitLab", func() {
+		provider, err := gitProviderFromSecret(newEnvironment(apiv1alpha1.GitLabProvider, "ssh://git@gitlab.com/acme/apps/podinfo.git"), secret)
+		Expect(err).NotTo(HaveOccurred())
+
+		pr := &pullRequest{head: "promotion/dev-to-prod", base: "main", title: "Promote dev to prod", description: "Promotes dev"}
+		Expect(provider.openPullRequest(ctx, pr)).To(Succeed())
+		Expect(pr.number).To(Equal(3))
+		Expect(pr.url).To(Equal("https://gitlab.com/acme/apps/podinfo/-/merge_requests/3"))
+		Expect(pr.opened).To(BeTrue())
+
+		Expect(calls).To(HaveLen(2))
+		Expect(calls[0].path).To(Equal("/projects/acme%2Fapps%2Fpodinfo/merge_requests"))
+		Expect(calls[0].query).To(Equal(url.Values{"state": {"opened"}, "source_branch": {"promotion/dev-to-prod"}, "target_branch": {"main"}}))
+		Expect(calls[1].body).To(Equal(map[string]any{"source_branch": "promotion/dev-to-prod", "target_branch": "main", "title": "Promote dev to prod", "description": "Promotes dev"}))
+	})
+
+	It("returns the errors of the API", func() {
+		api.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			http.Error(w, `{"message": "Bad credentials"}`, http.StatusUnauthorized)
+		})
+		provider, err := gitProviderFromSecret(newEnvironment(apiv1alpha1.GitHubProvider, "https://github.com/acme/podinfo"), secret)
+		Expect(err).NotTo(HaveOccurred())
+
+		err = provider.setCommitStatus(ctx, sha, commitStatus{state: commitStatePending, context: "promotion/prod"})
+		Expect(err).To(MatchError(ContainSubstring("401 Unauthorized")))
+		Expect(err).To(MatchError(ContainSubstring("Bad credentials")))
+	})
+})
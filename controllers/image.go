@@ -0,0 +1,61 @@
+/*
+Copyright 2023 Thomas Stadler <thomas@thomasst.xyz>.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	apiv1alpha1 "github.com/thomasstxyz/release-promotion-operator/api/v1alpha1"
+	engine "github.com/thomasstxyz/release-promotion-operator/pkg/promotion"
+)
+
+// environmentImageRepository returns the image repository of the Environment,
+// whose tags are listed with the credentials of its SecretRef, if any.
+func (r *PromotionReconciler) environmentImageRepository(ctx context.Context, c client.Reader, env *apiv1alpha1.Environment) (*engine.ImageRepository, error) {
+	repo, err := engine.NewImageRepository(env.Name, env.Spec.Image, nil)
+	if err != nil {
+		return nil, err
+	}
+	if env.Spec.Image.SecretRef == nil {
+		return repo, nil
+	}
+
+	secret := &corev1.Secret{}
+	if err := c.Get(ctx, client.ObjectKey{Namespace: env.Namespace, Name: env.Spec.Image.SecretRef.Name}, secret); err != nil {
+		return nil, err
+	}
+	auth, err := ociAuth(repo.Repository.RegistryStr(), secret)
+	if err != nil {
+		return nil, err
+	}
+	repo.Tags = &engine.RegistryTagLister{Options: []remote.Option{remote.WithAuth(auth)}}
+	return repo, nil
+}
+
+// checkoutImage returns a checkout without files for the latest tag of the image repository,
+// which is the revision of the source environment.
+func checkoutImage(ctx context.Context, env *apiv1alpha1.Environment, repo *engine.ImageRepository) (*gitCheckout, error) {
+	tag, err := repo.LatestTag(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &gitCheckout{Checkout: &engine.Checkout{Name: env.Name}, env: env, image: repo, imageTag: tag}, nil
+}
@@ -0,0 +1,105 @@
+/*
+Copyright 2023 Thomas Stadler <thomas@thomasst.xyz>.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	apiv1alpha1 "github.com/thomasstxyz/release-promotion-operator/api/v1alpha1"
+	engine "github.com/thomasstxyz/release-promotion-operator/pkg/promotion"
+)
+
+// staticTagLister stands in for a registry with the tags of each repository.
+type staticTagLister map[string][]string
+
+func (l staticTagLister) ListTags(_ context.Context, repo name.Repository) ([]string, error) {
+	return l[repo.String()], nil
+}
+
+var _ = Describe("Image repository environments", func() {
+	var (
+		ctx  context.Context
+		env  *apiv1alpha1.Environment
+		objs *promotionObjects
+	)
+
+	BeforeEach(func() {
+		ctx = context.Background()
+		env = &apiv1alpha1.Environment{
+			ObjectMeta: metav1.ObjectMeta{Name: "dev", Namespace: "default"},
+			Spec: apiv1alpha1.EnvironmentSpec{
+				Image: &apiv1alpha1.ImageRepositorySpec{
+					Repository: "ghcr.io/acme/podinfo",
+					Policy:     apiv1alpha1.ImagePolicy{SemVer: ">=6.0.0 <7.0.0"},
+				},
+			},
+		}
+		repo, err := engine.NewImageRepository(env.Name, env.Spec.Image, staticTagLister{
+			"ghcr.io/acme/podinfo": {"5.2.1", "6.2.0", "6.3.0", "7.0.0-rc.1"},
+		})
+		Expect(err).NotTo(HaveOccurred())
+		objs = &promotionObjects{
+			from:      env,
+			fromImage: repo,
+			template: &apiv1alpha1.PromotionTemplate{Spec: apiv1alpha1.PromotionTemplateSpec{
+				Images: []apiv1alpha1.ImageOperation{{Paths: []string{"app"}}},
+			}},
+		}
+	})
+
+	It("promotes the latest tag selected by the policy", func() {
+		Expect(objs.sourceRevision(ctx)).To(Equal("6.3.0"))
+		from, err := objs.checkoutSource(ctx)
+		Expect(err).NotTo(HaveOccurred())
+		defer from.Close()
+		Expect(from.revision()).To(Equal("6.3.0"))
+
+		dir := GinkgoT().TempDir()
+		Expect(os.MkdirAll(filepath.Join(dir, "envs/prod/app"), 0o755)).To(Succeed())
+		Expect(os.WriteFile(filepath.Join(dir, "envs/prod/app/deployment.yaml"), []byte("image: ghcr.io/acme/podinfo:6.2.0\n"), 0o644)).To(Succeed())
+		to := &gitCheckout{Checkout: &engine.Checkout{Name: "prod", Dir: dir, Path: "envs/prod"}}
+
+		changes, err := objs.applyTemplate(from, to)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(changes.Modified).To(ConsistOf("envs/prod/app/deployment.yaml"))
+		Expect(os.ReadFile(filepath.Join(dir, "envs/prod/app/deployment.yaml"))).To(BeEquivalentTo("image: ghcr.io/acme/podinfo:6.3.0\n"))
+	})
+
+	It("lists the tags with the credentials of the Secret", func() {
+		env.Spec.Image.SecretRef = &apiv1alpha1.LocalObjectReference{Name: "registry"}
+		c := fake.NewClientBuilder().WithObjects(&corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: "registry", Namespace: "default"},
+			Data: map[string][]byte{corev1.DockerConfigJsonKey: []byte(
+				`{"auths": {"ghcr.io": {"username": "flux", "password": "s3cr3t"}}}`)},
+		}).Build()
+
+		repo, err := (&PromotionReconciler{}).environmentImageRepository(ctx, c, env)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(repo.Tags).To(BeAssignableToTypeOf(&engine.RegistryTagLister{}))
+		Expect(repo.Tags.(*engine.RegistryTagLister).Options).To(HaveLen(1))
+	})
+})
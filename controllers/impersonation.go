@@ -0,0 +1,142 @@
+/*
+Copyright 2023 Thomas Stadler <thomas@thomasst.xyz>.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/rest"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	apiv1alpha1 "github.com/thomasstxyz/release-promotion-operator/api/v1alpha1"
+)
+
+// defaultServiceAccountName is the ServiceAccount impersonated if impersonation
+// is enforced and the Promotion does not specify a ServiceAccount.
+const defaultServiceAccountName = "default"
+
+// serviceAccountName returns the name of the ServiceAccount to impersonate
+// for the Promotion, or an empty string to use the operator's own identity.
+func (r *PromotionReconciler) serviceAccountName(promotion *apiv1alpha1.Promotion) string {
+	if promotion.Spec.ServiceAccountName != "" {
+		return promotion.Spec.ServiceAccountName
+	}
+	if r.EnforceImpersonation {
+		return defaultServiceAccountName
+	}
+	return ""
+}
+
+// impersonatedUserName returns the user name of the ServiceAccount to impersonate
+// for the Promotion, or an empty string to use the operator's own identity.
+func (r *PromotionReconciler) impersonatedUserName(promotion *apiv1alpha1.Promotion) string {
+	if name := r.serviceAccountName(promotion); name != "" {
+		return fmt.Sprintf("system:serviceaccount:%s:%s", promotion.Namespace, name)
+	}
+	return ""
+}
+
+// tenantClients caches the clients of the Promotions per impersonated user,
+// so that their transports and connections are reused across reconciliations.
+// The clients of a ServiceAccount are evicted when it changes, e.g. when its
+// token Secrets are rotated, or when it is deleted.
+type tenantClients struct {
+	mu      sync.Mutex
+	clients map[string]*tenantClientSet
+}
+
+// tenantClientSet holds the clients acting with the identity of a Promotion.
+type tenantClientSet struct {
+	// serviceAccount is the UID and resource version of
+	// the ServiceAccount the clients were created for.
+	serviceAccount string
+	reader         client.Reader
+	dynamic        dynamic.Interface
+}
+
+// tenant returns the clients impersonating the ServiceAccount of the Promotion,
+// or the clients of the operator if no ServiceAccount is impersonated.
+// Reads of an impersonating client.Reader are not cached.
+func (r *PromotionReconciler) tenant(ctx context.Context, promotion *apiv1alpha1.Promotion) (*tenantClientSet, error) {
+	userName := r.impersonatedUserName(promotion)
+
+	var serviceAccount string
+	if userName != "" {
+		key := types.NamespacedName{Namespace: promotion.Namespace, Name: r.serviceAccountName(promotion)}
+		sa := &corev1.ServiceAccount{}
+		if err := r.Get(ctx, key, sa); err != nil {
+			if apierrors.IsNotFound(err) {
+				r.tenantClients.evict(userName)
+			}
+			return nil, fmt.Errorf("failed to get ServiceAccount %s: %w", key, err)
+		}
+		serviceAccount = fmt.Sprintf("%s/%s", sa.UID, sa.ResourceVersion)
+	}
+
+	r.tenantClients.mu.Lock()
+	defer r.tenantClients.mu.Unlock()
+	if cached, ok := r.tenantClients.clients[userName]; ok && cached.serviceAccount == serviceAccount {
+		return cached, nil
+	}
+	delete(r.tenantClients.clients, userName)
+
+	config := rest.CopyConfig(r.RESTConfig)
+	config.Impersonate = rest.ImpersonationConfig{UserName: userName}
+	dynamicClient, err := dynamic.NewForConfig(config)
+	if err != nil {
+		return nil, err
+	}
+	tenant := &tenantClientSet{serviceAccount: serviceAccount, reader: r.Client, dynamic: dynamicClient}
+	if userName != "" {
+		tenant.reader, err = client.New(config, client.Options{Scheme: r.Scheme, Mapper: r.RESTMapper()})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if r.tenantClients.clients == nil {
+		r.tenantClients.clients = map[string]*tenantClientSet{}
+	}
+	r.tenantClients.clients[userName] = tenant
+	return tenant, nil
+}
+
+// evict removes the clients of the impersonated user from the cache.
+func (tc *tenantClients) evict(userName string) {
+	tc.mu.Lock()
+	defer tc.mu.Unlock()
+	delete(tc.clients, userName)
+}
+
+// tenantClient returns a client impersonating the ServiceAccount of the Promotion,
+// or the operator's client if no ServiceAccount is impersonated.
+func (r *PromotionReconciler) tenantClient(ctx context.Context, promotion *apiv1alpha1.Promotion) (client.Reader, error) {
+	if r.serviceAccountName(promotion) == "" {
+		return r.Client, nil
+	}
+	tenant, err := r.tenant(ctx, promotion)
+	if err != nil {
+		return nil, err
+	}
+	return tenant.reader, nil
+}
@@ -0,0 +1,216 @@
+/*
+Copyright 2023 Thomas Stadler <thomas@thomasst.xyz>.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/rest"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	apiv1alpha1 "github.com/thomasstxyz/release-promotion-operator/api/v1alpha1"
+)
+
+var _ = Describe("Impersonation of ServiceAccounts", func() {
+	var (
+		ctx       context.Context
+		mu        sync.Mutex
+		granted   string
+		users     []string
+		promotion *apiv1alpha1.Promotion
+		r         *PromotionReconciler
+	)
+
+	// impersonated returns the users impersonated by the requests so far.
+	impersonated := func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]string(nil), users...)
+	}
+
+	BeforeEach(func() {
+		ctx = context.Background()
+		granted = "system:serviceaccount:apps:promoter"
+		users = nil
+
+		// The API server serves the ConfigMap and the Secret
+		// of the apps namespace to the granted user only.
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			user := req.Header.Get("Impersonate-User")
+			mu.Lock()
+			users = append(users, user)
+			mu.Unlock()
+
+			w.Header().Set("Content-Type", "application/json")
+			if user != granted {
+				w.WriteHeader(http.StatusForbidden)
+				fmt.Fprintf(w, `{"kind":"Status","apiVersion":"v1","status":"Failure","reason":"Forbidden","code":403,"message":"%s cannot get %s"}`,
+					user, req.URL.Path)
+				return
+			}
+			switch req.URL.Path {
+			case "/api/v1/namespaces/apps/configmaps/app":
+				fmt.Fprint(w, `{"kind":"ConfigMap","apiVersion":"v1","metadata":{"name":"app","namespace":"apps"}}`)
+			case "/api/v1/namespaces/apps/secrets/git-credentials":
+				fmt.Fprint(w, `{"kind":"Secret","apiVersion":"v1","metadata":{"name":"git-credentials","namespace":"apps"},"data":{"username":"Zmx1eA=="}}`)
+			default:
+				w.WriteHeader(http.StatusNotFound)
+				fmt.Fprint(w, `{"kind":"Status","apiVersion":"v1","status":"Failure","reason":"NotFound","code":404}`)
+			}
+		}))
+		DeferCleanup(server.Close)
+
+		scheme := runtime.NewScheme()
+		Expect(apiv1alpha1.AddToScheme(scheme)).To(Succeed())
+		Expect(corev1.AddToScheme(scheme)).To(Succeed())
+		mapper := meta.NewDefaultRESTMapper(nil)
+		mapper.Add(corev1.SchemeGroupVersion.WithKind("Secret"), meta.RESTScopeNamespace)
+		var serviceAccounts []client.Object
+		for _, name := range []string{"promoter", "intruder", "default"} {
+			serviceAccounts = append(serviceAccounts, &corev1.ServiceAccount{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "apps"}})
+		}
+		r = &PromotionReconciler{
+			Client:     fake.NewClientBuilder().WithScheme(scheme).WithRESTMapper(mapper).WithObjects(serviceAccounts...).Build(),
+			Scheme:     scheme,
+			RESTConfig: &rest.Config{Host: server.URL},
+		}
+
+		promotion = &apiv1alpha1.Promotion{
+			ObjectMeta: metav1.ObjectMeta{Name: "dev-to-prod", Namespace: "apps"},
+			Spec: apiv1alpha1.PromotionSpec{
+				ServiceAccountName: "promoter",
+				ReadinessChecks: apiv1alpha1.ReadinessChecks{
+					LocalObjectsRef: []apiv1alpha1.LocalObjectsRef{{
+						GroupVersionResource: metav1.GroupVersionResource{Version: "v1", Resource: "configmaps"},
+						Name:                 "app",
+					}},
+				},
+			},
+		}
+	})
+
+	// getSecret reads the Secret with the identity of the Promotion.
+	getSecret := func() (*corev1.Secret, error) {
+		tenant, err := r.tenantClient(ctx, promotion)
+		Expect(err).NotTo(HaveOccurred())
+		secret := &corev1.Secret{}
+		return secret, tenant.Get(ctx, client.ObjectKey{Namespace: "apps", Name: "git-credentials"}, secret)
+	}
+
+	It("checks readiness and reads Secrets as the ServiceAccount of the Promotion", func() {
+		unready, err := r.readinessChecks(ctx, promotion)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(unready).To(BeEmpty())
+
+		secret, err := getSecret()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(secret.Data).To(HaveKeyWithValue("username", []byte("flux")))
+		Expect(impersonated()).To(ConsistOf(granted, granted))
+	})
+
+	It("denies what RBAC does not grant to the ServiceAccount", func() {
+		promotion.Spec.ServiceAccountName = "intruder"
+
+		_, err := r.readinessChecks(ctx, promotion)
+		Expect(apierrors.IsForbidden(err)).To(BeTrue(), "unexpected error: %v", err)
+
+		_, err = getSecret()
+		Expect(apierrors.IsForbidden(err)).To(BeTrue(), "unexpected error: %v", err)
+		Expect(impersonated()).To(ConsistOf("system:serviceaccount:apps:intruder", "system:serviceaccount:apps:intruder"))
+	})
+
+	It("impersonates the default ServiceAccount if impersonation is enforced", func() {
+		promotion.Spec.ServiceAccountName = ""
+		r.EnforceImpersonation = true
+
+		_, err := r.readinessChecks(ctx, promotion)
+		Expect(apierrors.IsForbidden(err)).To(BeTrue(), "unexpected error: %v", err)
+		Expect(impersonated()).To(ConsistOf("system:serviceaccount:apps:default"))
+
+		granted = "system:serviceaccount:apps:default"
+		_, err = r.readinessChecks(ctx, promotion)
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("uses the identity of the operator if no ServiceAccount is impersonated", func() {
+		promotion.Spec.ServiceAccountName = ""
+		granted = ""
+
+		_, err := r.readinessChecks(ctx, promotion)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(impersonated()).To(ConsistOf(""))
+
+		tenant, err := r.tenantClient(ctx, promotion)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(tenant).To(BeIdenticalTo(r.Client))
+	})
+
+	It("reuses the clients of each ServiceAccount", func() {
+		tenant, err := r.tenant(ctx, promotion)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(r.tenant(ctx, promotion)).To(BeIdenticalTo(tenant))
+
+		other := promotion.DeepCopy()
+		other.Spec.ServiceAccountName = "intruder"
+		Expect(r.tenant(ctx, other)).NotTo(BeIdenticalTo(tenant))
+	})
+
+	It("evicts the clients of a ServiceAccount whose token changes", func() {
+		tenant, err := r.tenant(ctx, promotion)
+		Expect(err).NotTo(HaveOccurred())
+
+		sa := &corev1.ServiceAccount{}
+		Expect(r.Get(ctx, client.ObjectKey{Namespace: "apps", Name: "promoter"}, sa)).To(Succeed())
+		sa.Secrets = []corev1.ObjectReference{{Name: "promoter-token-rotated"}}
+		Expect(r.Update(ctx, sa)).To(Succeed())
+
+		rotated, err := r.tenant(ctx, promotion)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(rotated).NotTo(BeIdenticalTo(tenant))
+		Expect(r.tenant(ctx, promotion)).To(BeIdenticalTo(rotated))
+	})
+
+	It("evicts the clients of a ServiceAccount which is deleted", func() {
+		_, err := r.tenant(ctx, promotion)
+		Expect(err).NotTo(HaveOccurred())
+
+		sa := &corev1.ServiceAccount{ObjectMeta: metav1.ObjectMeta{Name: "promoter", Namespace: "apps"}}
+		Expect(r.Delete(ctx, sa)).To(Succeed())
+		_, err = r.tenant(ctx, promotion)
+		Expect(apierrors.IsNotFound(err)).To(BeTrue(), "unexpected error: %v", err)
+		Expect(r.tenantClients.clients).NotTo(HaveKey(granted))
+
+		sa = &corev1.ServiceAccount{ObjectMeta: metav1.ObjectMeta{Name: "promoter", Namespace: "apps"}}
+		Expect(r.Create(ctx, sa)).To(Succeed())
+		secret, err := getSecret()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(secret.Data).To(HaveKeyWithValue("username", []byte("flux")))
+	})
+})
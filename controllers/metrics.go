@@ -0,0 +1,127 @@
+/*
+Copyright 2023 Thomas Stadler <thomas@thomasst.xyz>.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+
+	apiv1alpha1 "github.com/thomasstxyz/release-promotion-operator/api/v1alpha1"
+)
+
+var (
+	promotionsStarted = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "release_promotion_started_total",
+			Help: "Number of promotions started, per source and destination environment.",
+		},
+		[]string{"namespace", "from", "to"},
+	)
+
+	promotionsCompleted = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "release_promotion_completed_total",
+			Help: "Number of promotions completed, per source and destination environment and outcome.",
+		},
+		[]string{"namespace", "from", "to", "outcome"},
+	)
+
+	promotionLeadTime = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "release_promotion_lead_time_seconds",
+			Help:    "Time from the commit in the source environment to the promotion commit in the destination environment.",
+			Buckets: prometheus.ExponentialBuckets(60, 2, 15),
+		},
+		[]string{"namespace", "from", "to"},
+	)
+
+	readinessCheckDuration = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name: "release_promotion_readiness_check_duration_seconds",
+			Help: "Duration of the readiness checks of a Promotion.",
+		},
+		[]string{"namespace", "promotion"},
+	)
+
+	gitOperationDuration = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name: "release_promotion_git_operation_duration_seconds",
+			Help: "Duration of Git operations, per operation.",
+		},
+		[]string{"operation"},
+	)
+
+	promotionBlocked = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "release_promotion_blocked",
+			Help: "Whether a Promotion is currently blocked (1) or not (0), e.g. by its readiness checks, a denied reference, a failed verification, its version policy or a pending approval.",
+		},
+		[]string{"namespace", "promotion"},
+	)
+
+	notificationsSent = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "release_promotion_notifications_total",
+			Help: "Number of notifications, per PromotionNotifier and outcome.",
+		},
+		[]string{"namespace", "notifier", "outcome"},
+	)
+)
+
+func init() {
+	metrics.Registry.MustRegister(
+		promotionsStarted,
+		promotionsCompleted,
+		promotionLeadTime,
+		readinessCheckDuration,
+		gitOperationDuration,
+		promotionBlocked,
+		notificationsSent,
+	)
+}
+
+// environmentLabels returns the namespace, from and to label values of the Promotion.
+func environmentLabels(promotion *apiv1alpha1.Promotion) []string {
+	return []string{
+		promotion.Namespace,
+		promotion.Spec.FromSpec.EnvironmentRef.Name,
+		promotion.Spec.ToSpec.EnvironmentRef.Name,
+	}
+}
+
+// observeGitOperation records the duration of the Git operation started at start.
+// It is meant to be deferred.
+func observeGitOperation(operation string, start time.Time) {
+	gitOperationDuration.WithLabelValues(operation).Observe(time.Since(start).Seconds())
+}
+
+// setBlocked records whether the Promotion is blocked by one of its gates.
+func setBlocked(promotion *apiv1alpha1.Promotion, blocked bool) {
+	value := 0.0
+	if blocked {
+		value = 1
+	}
+	promotionBlocked.WithLabelValues(promotion.Namespace, promotion.Name).Set(value)
+}
+
+// deletePromotionMetrics removes the per Promotion series of a deleted Promotion.
+func deletePromotionMetrics(namespace, name string) {
+	promotionBlocked.DeleteLabelValues(namespace, name)
+	readinessCheckDuration.DeleteLabelValues(namespace, name)
+}
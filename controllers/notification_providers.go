@@ -0,0 +1,241 @@
+/*
+Copyright 2023 Thomas Stadler <thomas@thomasst.xyz>.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"k8s.io/apimachinery/pkg/util/uuid"
+
+	apiv1alpha1 "github.com/thomasstxyz/release-promotion-operator/api/v1alpha1"
+)
+
+const (
+	// hmacSignatureHeader carries the HMAC-SHA256 of the payload of the generic provider.
+	hmacSignatureHeader = "X-Signature"
+	// cloudEventTypePrefix is prepended to the lowercase event type of CloudEvents.
+	cloudEventTypePrefix = "io.release-promotion-operator.promotion."
+)
+
+// promotionEvent is a lifecycle event of a Promotion, the payload of the generic provider.
+type promotionEvent struct {
+	Type           apiv1alpha1.PromotionEventType `json:"type"`
+	Namespace      string                         `json:"namespace"`
+	Promotion      string                         `json:"promotion"`
+	From           string                         `json:"from"`
+	To             string                         `json:"to"`
+	SourceRevision string                         `json:"sourceRevision,omitempty"`
+	TargetRevision string                         `json:"targetRevision,omitempty"`
+	PullRequestURL string                         `json:"pullRequestURL,omitempty"`
+	Message        string                         `json:"message"`
+	Timestamp      time.Time                      `json:"timestamp"`
+}
+
+// title summarizes the event in a single line.
+func (e *promotionEvent) title() string {
+	return fmt.Sprintf("Promotion %s/%s from %s to %s: %s", e.Namespace, e.Promotion, e.From, e.To, e.Type)
+}
+
+// facts returns the details of the event as name and value pairs.
+func (e *promotionEvent) facts() [][2]string {
+	var facts [][2]string
+	for _, f := range [][2]string{
+		{"Source revision", e.SourceRevision},
+		{"Target revision", e.TargetRevision},
+		{"Pull request", e.PullRequestURL},
+	} {
+		if f[1] != "" {
+			facts = append(facts, f)
+		}
+	}
+	return facts
+}
+
+// color returns the hex color of the event type for chat messages.
+func (e *promotionEvent) color() string {
+	switch e.Type {
+	case apiv1alpha1.PromotionSucceededEvent:
+		return "2EB67D"
+	case apiv1alpha1.PromotionFailedEvent:
+		return "E01E5A"
+	case apiv1alpha1.PromotionBlockedEvent, apiv1alpha1.PromotionSupersededEvent, apiv1alpha1.PromotionRolledBackEvent:
+		return "ECB22E"
+	default:
+		return "36C5F0"
+	}
+}
+
+// notificationProvider posts events to the address of a PromotionNotifier.
+type notificationProvider struct {
+	providerType apiv1alpha1.NotificationProviderType
+	address      string
+	hmacKey      []byte
+}
+
+// retryableError is returned for failed deliveries which may succeed when retried.
+type retryableError struct {
+	err error
+}
+
+func (e *retryableError) Error() string {
+	return e.err.Error()
+}
+
+func (e *retryableError) Unwrap() error {
+	return e.err
+}
+
+// send posts the event. Network errors, rate limited requests and
+// server errors are returned as retryableError.
+func (p *notificationProvider) send(ctx context.Context, httpClient *http.Client, event *promotionEvent) error {
+	body, contentType, err := p.payload(event)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.address, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", contentType)
+	if p.providerType == apiv1alpha1.GenericProvider && len(p.hmacKey) > 0 {
+		req.Header.Set(hmacSignatureHeader, "sha256="+hmacSHA256(p.hmacKey, body))
+	}
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		// The error of the client contains the unredacted address
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			err = urlErr.Err
+		}
+		return &retryableError{err: fmt.Errorf("failed to post to %s: %w", redactURL(p.address), err)}
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 1<<16))
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return nil
+	}
+	err = fmt.Errorf("%s responded with %s", redactURL(p.address), resp.Status)
+	if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500 {
+		return &retryableError{err: err}
+	}
+	return err
+}
+
+// payload encodes the event in the format of the provider.
+func (p *notificationProvider) payload(event *promotionEvent) ([]byte, string, error) {
+	switch p.providerType {
+	case apiv1alpha1.SlackProvider:
+		body, err := json.Marshal(slackPayload(event))
+		return body, "application/json", err
+	case apiv1alpha1.MSTeamsProvider:
+		body, err := json.Marshal(msTeamsPayload(event))
+		return body, "application/json", err
+	case apiv1alpha1.GenericProvider:
+		body, err := json.Marshal(event)
+		return body, "application/json", err
+	case apiv1alpha1.CloudEventsProvider:
+		body, err := json.Marshal(cloudEventPayload(event))
+		return body, "application/cloudevents+json", err
+	default:
+		return nil, "", fmt.Errorf("unsupported notification provider type %q", p.providerType)
+	}
+}
+
+// slackPayload returns the message of a Slack-compatible incoming webhook.
+func slackPayload(event *promotionEvent) map[string]any {
+	fields := []map[string]any{}
+	for _, f := range event.facts() {
+		fields = append(fields, map[string]any{"title": f[0], "value": f[1], "short": false})
+	}
+	return map[string]any{
+		"text": event.title(),
+		"attachments": []map[string]any{{
+			"color":  "#" + event.color(),
+			"text":   event.Message,
+			"fields": fields,
+			"ts":     event.Timestamp.Unix(),
+		}},
+	}
+}
+
+// msTeamsPayload returns the message card of a Microsoft Teams incoming webhook.
+func msTeamsPayload(event *promotionEvent) map[string]any {
+	facts := []map[string]string{}
+	for _, f := range event.facts() {
+		facts = append(facts, map[string]string{"name": f[0], "value": f[1]})
+	}
+	return map[string]any{
+		"@type":      "MessageCard",
+		"@context":   "https://schema.org/extensions",
+		"themeColor": event.color(),
+		"summary":    event.title(),
+		"sections": []map[string]any{{
+			"activityTitle": event.title(),
+			"activityText":  event.Message,
+			"facts":         facts,
+		}},
+	}
+}
+
+// cloudEventPayload returns the event as a CloudEvent in structured content mode.
+func cloudEventPayload(event *promotionEvent) map[string]any {
+	ce := map[string]any{
+		"specversion":     "1.0",
+		"id":              string(uuid.NewUUID()),
+		"source":          fmt.Sprintf("/apis/%s/namespaces/%s/promotions/%s", apiv1alpha1.GroupVersion, event.Namespace, event.Promotion),
+		"type":            cloudEventTypePrefix + strings.ToLower(string(event.Type)),
+		"time":            event.Timestamp.UTC().Format(time.RFC3339),
+		"datacontenttype": "application/json",
+		"data":            event,
+	}
+	if event.SourceRevision != "" {
+		ce["subject"] = event.SourceRevision
+	}
+	return ce
+}
+
+// hmacSHA256 returns the hex encoded HMAC-SHA256 of the body.
+func hmacSHA256(key, body []byte) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// redactURL strips the credentials, path and query of the address,
+// which webhook URLs commonly embed their secrets in.
+func redactURL(address string) string {
+	u, err := url.Parse(address)
+	if err != nil || u.Host == "" {
+		return "notification address"
+	}
+	return u.Scheme + "://" + u.Host
+}
@@ -0,0 +1,269 @@
+/*
+Copyright 2023 Thomas Stadler <thomas@thomasst.xyz>.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	apiv1alpha1 "github.com/thomasstxyz/release-promotion-operator/api/v1alpha1"
+)
+
+const (
+	// notificationQueueSize is the number of notifications buffered for delivery,
+	// further notifications are dropped until the queue drains.
+	notificationQueueSize = 256
+	// notificationWorkers is the number of notifications delivered concurrently.
+	notificationWorkers = 4
+	// notificationTimeout is the timeout of a single delivery attempt.
+	notificationTimeout = 15 * time.Second
+	// notificationRetryInterval is the backoff before the first retry, doubled for each further retry.
+	notificationRetryInterval = 2 * time.Second
+)
+
+// notification is an event to be delivered to a PromotionNotifier.
+type notification struct {
+	notifier types.NamespacedName
+	provider *notificationProvider
+	retries  int
+	event    promotionEvent
+}
+
+// notificationDispatcher delivers notifications in the background, retrying
+// failed deliveries and applying the rate limits of the PromotionNotifiers.
+// It is run by the manager.
+type notificationDispatcher struct {
+	httpClient    *http.Client
+	retryInterval time.Duration
+	queue         chan notification
+
+	mu       sync.Mutex
+	limiters map[types.NamespacedName]*notifierLimiter
+}
+
+// notifierLimiter is the rate limiter of a PromotionNotifier
+// with the limit it has been created for.
+type notifierLimiter struct {
+	every   time.Duration
+	burst   int
+	limiter *rate.Limiter
+}
+
+func newNotificationDispatcher() *notificationDispatcher {
+	return &notificationDispatcher{
+		httpClient:    &http.Client{Timeout: notificationTimeout},
+		retryInterval: notificationRetryInterval,
+		queue:         make(chan notification, notificationQueueSize),
+		limiters:      map[types.NamespacedName]*notifierLimiter{},
+	}
+}
+
+// Start delivers queued notifications until the context is cancelled.
+func (d *notificationDispatcher) Start(ctx context.Context) error {
+	var wg sync.WaitGroup
+	for i := 0; i < notificationWorkers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case n := <-d.queue:
+					d.deliver(ctx, n)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	return nil
+}
+
+// enqueue queues the notification for delivery, unless it exceeds the
+// rate limit of its PromotionNotifier or the queue is full.
+func (d *notificationDispatcher) enqueue(ctx context.Context, notifier *apiv1alpha1.PromotionNotifier, n notification) {
+	log := log.FromContext(ctx).WithValues("notifier", n.notifier.Name, "event", n.event.Type)
+
+	if !d.allow(notifier) {
+		log.Info("Dropped notification exceeding the rate limit")
+		notificationsSent.WithLabelValues(n.notifier.Namespace, n.notifier.Name, "RateLimited").Inc()
+		return
+	}
+
+	select {
+	case d.queue <- n:
+	default:
+		log.Info("Dropped notification, the notification queue is full")
+		notificationsSent.WithLabelValues(n.notifier.Namespace, n.notifier.Name, "Dropped").Inc()
+	}
+}
+
+// allow returns true if sending a notification does not exceed the rate limit of the PromotionNotifier.
+func (d *notificationDispatcher) allow(notifier *apiv1alpha1.PromotionNotifier) bool {
+	every, burst := notifier.GetRateLimit()
+	key := types.NamespacedName{Namespace: notifier.Namespace, Name: notifier.Name}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if burst == 0 {
+		delete(d.limiters, key)
+		return true
+	}
+
+	l, ok := d.limiters[key]
+	if !ok || l.every != every || l.burst != burst {
+		l = &notifierLimiter{every: every, burst: burst, limiter: rate.NewLimiter(rate.Every(every), burst)}
+		d.limiters[key] = l
+	}
+	return l.limiter.Allow()
+}
+
+// deliver sends the notification, retrying retryable failures with exponential backoff.
+func (d *notificationDispatcher) deliver(ctx context.Context, n notification) {
+	log := log.FromContext(ctx).WithValues("notifier", n.notifier, "event", n.event.Type, "promotion", n.event.Promotion)
+
+	backoff := d.retryInterval
+	for attempt := 0; ; attempt++ {
+		err := n.provider.send(ctx, d.httpClient, &n.event)
+		if err == nil {
+			notificationsSent.WithLabelValues(n.notifier.Namespace, n.notifier.Name, "Succeeded").Inc()
+			return
+		}
+
+		var retryable *retryableError
+		if !errors.As(err, &retryable) || attempt >= n.retries {
+			log.Error(err, "Failed to deliver notification", "attempts", attempt+1)
+			notificationsSent.WithLabelValues(n.notifier.Namespace, n.notifier.Name, "Failed").Inc()
+			return
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
+
+// notify sends the event to the PromotionNotifiers selecting the Promotion.
+// Failures to look up the PromotionNotifiers are logged, but do not fail the reconciliation.
+func (r *PromotionReconciler) notify(ctx context.Context, promotion *apiv1alpha1.Promotion, eventType apiv1alpha1.PromotionEventType, record *apiv1alpha1.PromotionRecord, message string) {
+	if r.notifications == nil {
+		return
+	}
+	log := log.FromContext(ctx)
+
+	notifiers := &apiv1alpha1.PromotionNotifierList{}
+	if err := r.List(ctx, notifiers, client.InNamespace(promotion.Namespace)); err != nil {
+		log.Error(err, "Failed to list PromotionNotifiers")
+		return
+	}
+
+	event := promotionEvent{
+		Type:      eventType,
+		Namespace: promotion.Namespace,
+		Promotion: promotion.Name,
+		From:      promotion.Spec.FromSpec.EnvironmentRef.Name,
+		To:        promotion.Spec.ToSpec.EnvironmentRef.Name,
+		Message:   message,
+		Timestamp: time.Now(),
+	}
+	if record != nil {
+		event.SourceRevision = record.SourceRevision
+		event.TargetRevision = record.TargetRevision
+		event.PullRequestURL = record.PullRequestURL
+	}
+
+	for i := range notifiers.Items {
+		notifier := &notifiers.Items[i]
+		selected, err := notifierSelects(notifier, promotion)
+		if err != nil {
+			log.Error(err, "Invalid promotion selector", "notifier", notifier.Name)
+			continue
+		}
+		if !selected || !notifier.Subscribes(eventType) {
+			continue
+		}
+
+		provider, err := r.notificationProvider(ctx, promotion, notifier)
+		if err != nil {
+			log.Error(err, "Failed to configure notification provider", "notifier", notifier.Name)
+			notificationsSent.WithLabelValues(notifier.Namespace, notifier.Name, "Failed").Inc()
+			continue
+		}
+		r.notifications.enqueue(ctx, notifier, notification{
+			notifier: types.NamespacedName{Namespace: notifier.Namespace, Name: notifier.Name},
+			provider: provider,
+			retries:  notifier.GetRetries(),
+			event:    event,
+		})
+	}
+}
+
+// notifierSelects returns true if the promotion selector of the PromotionNotifier matches the Promotion.
+func notifierSelects(notifier *apiv1alpha1.PromotionNotifier, promotion *apiv1alpha1.Promotion) (bool, error) {
+	if notifier.Spec.PromotionSelector == nil {
+		return true, nil
+	}
+	selector, err := metav1.LabelSelectorAsSelector(notifier.Spec.PromotionSelector)
+	if err != nil {
+		return false, err
+	}
+	return selector.Matches(labels.Set(promotion.Labels)), nil
+}
+
+// notificationProvider returns the provider of the PromotionNotifier,
+// reading its Secret with the identity of the Promotion.
+func (r *PromotionReconciler) notificationProvider(ctx context.Context, promotion *apiv1alpha1.Promotion, notifier *apiv1alpha1.PromotionNotifier) (*notificationProvider, error) {
+	provider := &notificationProvider{
+		providerType: notifier.Spec.Type,
+		address:      notifier.Spec.Address,
+	}
+
+	if notifier.Spec.SecretRef != nil {
+		tenant, err := r.tenantClient(ctx, promotion)
+		if err != nil {
+			return nil, err
+		}
+		secret := &corev1.Secret{}
+		if err := tenant.Get(ctx, client.ObjectKey{Namespace: notifier.Namespace, Name: notifier.Spec.SecretRef.Name}, secret); err != nil {
+			return nil, err
+		}
+		if address, ok := secret.Data[apiv1alpha1.NotifierAddressKey]; ok {
+			provider.address = string(address)
+		}
+		provider.hmacKey = secret.Data[apiv1alpha1.NotifierHMACKey]
+	}
+
+	if provider.address == "" {
+		return nil, fmt.Errorf("no address set in spec.address or the %s of the Secret", apiv1alpha1.NotifierAddressKey)
+	}
+	return provider, nil
+}
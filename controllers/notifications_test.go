@@ -0,0 +1,190 @@
+/*
+Copyright 2023 Thomas Stadler <thomas@thomasst.xyz>.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+
+	apiv1alpha1 "github.com/thomasstxyz/release-promotion-operator/api/v1alpha1"
+)
+
+// receivedRequest is a request recorded by the test receiver.
+type receivedRequest struct {
+	header http.Header
+	body   map[string]any
+	raw    []byte
+}
+
+var _ = Describe("Notification providers", func() {
+	var (
+		ctx        context.Context
+		receiver   *httptest.Server
+		mu         sync.Mutex
+		received   []receivedRequest
+		failures   int
+		dispatcher *notificationDispatcher
+		event      promotionEvent
+	)
+
+	requests := func() []receivedRequest {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]receivedRequest(nil), received...)
+	}
+
+	newNotification := func(providerType apiv1alpha1.NotificationProviderType) notification {
+		return notification{
+			notifier: types.NamespacedName{Namespace: "default", Name: string(providerType)},
+			provider: &notificationProvider{providerType: providerType, address: receiver.URL + "/hooks/secret-token"},
+			retries:  apiv1alpha1.DefaultNotificationRetries,
+			event:    event,
+		}
+	}
+
+	BeforeEach(func() {
+		ctx = context.Background()
+		received, failures = nil, 0
+
+		receiver = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			raw, _ := io.ReadAll(req.Body)
+			mu.Lock()
+			defer mu.Unlock()
+			if failures > 0 {
+				failures--
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+			r := receivedRequest{header: req.Header, raw: raw}
+			_ = json.Unmarshal(raw, &r.body)
+			received = append(received, r)
+		}))
+		DeferCleanup(receiver.Close)
+
+		dispatcher = newNotificationDispatcher()
+		dispatcher.retryInterval = time.Millisecond
+
+		event = promotionEvent{
+			Type:           apiv1alpha1.PromotionSucceededEvent,
+			Namespace:      "default",
+			Promotion:      "dev-to-prod",
+			From:           "dev",
+			To:             "prod",
+			SourceRevision: "1f0c3e2",
+			TargetRevision: "9a8b7c6",
+			Message:        "Promoted source revision 1f0c3e2",
+			Timestamp:      time.Date(2023, 3, 1, 9, 0, 0, 0, time.UTC),
+		}
+	})
+
+	It("posts Slack-compatible messages", func() {
+		dispatcher.deliver(ctx, newNotification(apiv1alpha1.SlackProvider))
+
+		Expect(requests()).To(HaveLen(1))
+		body := requests()[0].body
+		Expect(body["text"]).To(Equal("Promotion default/dev-to-prod from dev to prod: Succeeded"))
+		Expect(body["attachments"]).To(ConsistOf(HaveKeyWithValue("text", "Promoted source revision 1f0c3e2")))
+	})
+
+	It("posts Microsoft Teams message cards", func() {
+		dispatcher.deliver(ctx, newNotification(apiv1alpha1.MSTeamsProvider))
+
+		Expect(requests()).To(HaveLen(1))
+		body := requests()[0].body
+		Expect(body["@type"]).To(Equal("MessageCard"))
+		Expect(body["sections"]).To(ConsistOf(HaveKeyWithValue("facts", ContainElement(
+			map[string]any{"name": "Source revision", "value": "1f0c3e2"},
+		))))
+	})
+
+	It("signs generic JSON payloads with HMAC", func() {
+		n := newNotification(apiv1alpha1.GenericProvider)
+		n.provider.hmacKey = []byte("shared-key")
+		dispatcher.deliver(ctx, n)
+
+		Expect(requests()).To(HaveLen(1))
+		req := requests()[0]
+		Expect(req.body).To(HaveKeyWithValue("type", "Succeeded"))
+		Expect(req.body).To(HaveKeyWithValue("sourceRevision", "1f0c3e2"))
+		Expect(req.header.Get(hmacSignatureHeader)).To(Equal("sha256=" + hmacSHA256([]byte("shared-key"), req.raw)))
+	})
+
+	It("posts structured CloudEvents", func() {
+		dispatcher.deliver(ctx, newNotification(apiv1alpha1.CloudEventsProvider))
+
+		Expect(requests()).To(HaveLen(1))
+		req := requests()[0]
+		Expect(req.header.Get("Content-Type")).To(Equal("application/cloudevents+json"))
+		Expect(req.body).To(HaveKeyWithValue("specversion", "1.0"))
+		Expect(req.body).To(HaveKeyWithValue("type", "io.release-promotion-operator.promotion.succeeded"))
+		Expect(req.body).To(HaveKeyWithValue("source", "/apis/api.release-promotion-operator.io/v1alpha1/namespaces/default/promotions/dev-to-prod"))
+		Expect(req.body).To(HaveKeyWithValue("data", HaveKeyWithValue("to", "prod")))
+	})
+
+	It("retries failed deliveries", func() {
+		failures = 2
+		dispatcher.deliver(ctx, newNotification(apiv1alpha1.GenericProvider))
+		Expect(requests()).To(HaveLen(1))
+
+		failures = 2
+		n := newNotification(apiv1alpha1.GenericProvider)
+		n.retries = 1
+		dispatcher.deliver(ctx, n)
+		Expect(requests()).To(HaveLen(1))
+	})
+
+	It("does not leak the address in errors", func() {
+		n := newNotification(apiv1alpha1.GenericProvider)
+		n.provider.address = "http://127.0.0.1:1/hooks/secret-token"
+		err := n.provider.send(ctx, dispatcher.httpClient, &n.event)
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).NotTo(ContainSubstring("secret-token"))
+	})
+
+	It("drops notifications exceeding the rate limit", func() {
+		notifier := &apiv1alpha1.PromotionNotifier{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "generic"},
+			Spec: apiv1alpha1.PromotionNotifierSpec{
+				Type:      apiv1alpha1.GenericProvider,
+				RateLimit: &apiv1alpha1.NotificationRateLimit{Events: 2, Period: metav1.Duration{Duration: time.Hour}},
+			},
+		}
+		for i := 0; i < 3; i++ {
+			dispatcher.enqueue(ctx, notifier, newNotification(apiv1alpha1.GenericProvider))
+		}
+		Expect(dispatcher.queue).To(HaveLen(2))
+
+		runCtx, cancel := context.WithCancel(ctx)
+		DeferCleanup(cancel)
+		go func() {
+			defer GinkgoRecover()
+			Expect(dispatcher.Start(runCtx)).To(Succeed())
+		}()
+		Eventually(requests).Should(HaveLen(2))
+	})
+})
@@ -0,0 +1,206 @@
+/*
+Copyright 2023 Thomas Stadler <thomas@thomasst.xyz>.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	apiv1alpha1 "github.com/thomasstxyz/release-promotion-operator/api/v1alpha1"
+	engine "github.com/thomasstxyz/release-promotion-operator/pkg/promotion"
+)
+
+// ociAuth returns the credentials for the registry from the '.dockerconfigjson' field of the Secret.
+func ociAuth(registry string, secret *corev1.Secret) (authn.Authenticator, error) {
+	data, ok := secret.Data[corev1.DockerConfigJsonKey]
+	if !ok {
+		return nil, fmt.Errorf("Secret %s contains no %s", secret.Name, corev1.DockerConfigJsonKey)
+	}
+	var config struct {
+		Auths map[string]authn.AuthConfig `json:"auths"`
+	}
+	if err := json.Unmarshal(data, &config); err != nil {
+		return nil, fmt.Errorf("invalid %s in Secret %s: %w", corev1.DockerConfigJsonKey, secret.Name, err)
+	}
+
+	for server, auth := range config.Auths {
+		// Servers may be given as URLs, e.g. 'https://index.docker.io/v1/'
+		host := server
+		if _, rest, found := strings.Cut(host, "://"); found {
+			host = rest
+		}
+		host, _, _ = strings.Cut(host, "/")
+		if reg, err := name.NewRegistry(host); err == nil && reg.RegistryStr() == registry {
+			return authn.FromConfig(auth), nil
+		}
+	}
+	return nil, fmt.Errorf("Secret %s contains no credentials for %s", secret.Name, registry)
+}
+
+// environmentOCIRepository returns the OCI repository of the Environment,
+// with the credentials of its SecretRef, if any.
+func (r *PromotionReconciler) environmentOCIRepository(ctx context.Context, c client.Reader, env *apiv1alpha1.Environment) (*engine.OCIRepository, error) {
+	repo, err := engine.NewOCIRepository(env.Name, env.Spec.OCI.URL, env.Spec.OCI.GetTag(), env.Spec.OCI.Insecure)
+	if err != nil {
+		return nil, err
+	}
+	if env.Spec.OCI.SecretRef == nil {
+		return repo, nil
+	}
+
+	secret := &corev1.Secret{}
+	if err := c.Get(ctx, client.ObjectKey{Namespace: env.Namespace, Name: env.Spec.OCI.SecretRef.Name}, secret); err != nil {
+		return nil, err
+	}
+	auth, err := ociAuth(repo.Tag.RegistryStr(), secret)
+	if err != nil {
+		return nil, err
+	}
+	repo.Options = append(repo.Options, remote.WithAuth(auth))
+	return repo, nil
+}
+
+// environmentCosignVerifier returns the verifier of the cosign public keys
+// of the Environment's verification policy, if any.
+func (r *PromotionReconciler) environmentCosignVerifier(ctx context.Context, c client.Reader, env *apiv1alpha1.Environment) (*engine.CosignVerifier, error) {
+	if env.Spec.Verify == nil {
+		return nil, nil
+	}
+
+	secret := &corev1.Secret{}
+	if err := c.Get(ctx, client.ObjectKey{Namespace: env.Namespace, Name: env.Spec.Verify.SecretRef.Name}, secret); err != nil {
+		return nil, err
+	}
+	keys := map[string][]byte{}
+	for key, value := range secret.Data {
+		if strings.HasSuffix(key, verificationCosignKeySuffix) {
+			keys[key] = value
+		}
+	}
+	verifier, err := engine.NewCosignVerifier(keys)
+	if err != nil {
+		return nil, fmt.Errorf("Secret %s: %w", secret.Name, err)
+	}
+	return verifier, nil
+}
+
+// verifyOCISource verifies the cosign signature of the source artifact,
+// if the source Environment has a verification policy.
+func verifyOCISource(ctx context.Context, objs *promotionObjects, digest v1.Hash) error {
+	if objs.fromCosign == nil {
+		return nil
+	}
+
+	revision := objs.fromOCI.Revision(digest)
+	key, err := objs.fromCosign.Verify(ctx, objs.fromOCI, digest)
+	if err != nil {
+		return &sourceVerificationError{revision: revision, err: err}
+	}
+	log.FromContext(ctx).V(1).Info("Verified signature of source revision", "revision", revision, "key", key)
+	return nil
+}
+
+// dryRunOCI records the revisions the artifact would be copied from and to.
+func (r *PromotionReconciler) dryRunOCI(ctx context.Context, promotion *apiv1alpha1.Promotion, objs *promotionObjects) error {
+	digest, err := objs.fromOCI.Resolve(ctx)
+	if err != nil {
+		return err
+	}
+	if err := verifyOCISource(ctx, objs, digest); err != nil {
+		return err
+	}
+	if _, err := objs.checkVersionPolicy(nil, objs.fromOCI.Revision(digest)); err != nil {
+		return err
+	}
+
+	result := &apiv1alpha1.DryRunResult{
+		ObservedGeneration: promotion.Generation,
+		SourceRevision:     objs.fromOCI.Revision(digest),
+		LastRunTime:        metav1.Now(),
+		RequestedAt:        promotion.DryRunRequest(),
+	}
+	target, err := objs.toOCI.Resolve(ctx)
+	switch {
+	case errors.Is(err, engine.ErrTagNotFound):
+	case err != nil:
+		return err
+	default:
+		result.TargetRevision = objs.toOCI.Revision(target)
+	}
+
+	// Keep the last dry run if nothing changed since, so that the status is not updated on every reconciliation
+	if last := promotion.Status.DryRun; last != nil && last.ObservedGeneration == result.ObservedGeneration &&
+		last.SourceRevision == result.SourceRevision && last.TargetRevision == result.TargetRevision &&
+		last.RequestedAt == result.RequestedAt {
+		return nil
+	}
+	promotion.Status.DryRun = result
+	return nil
+}
+
+// pushOCIPromotion copies the artifact the tag of the source environment points to
+// to the tag of the destination environment. It records the promoted source revision
+// and the resulting target revision.
+func (r *PromotionReconciler) pushOCIPromotion(ctx context.Context, promotion *apiv1alpha1.Promotion, objs *promotionObjects, record *apiv1alpha1.PromotionRecord) error {
+	if promotion.Spec.Strategy.PullRequest {
+		return fmt.Errorf("the pull-request strategy is not supported for environments with an OCI repository")
+	}
+
+	digest, err := objs.fromOCI.Resolve(ctx)
+	if err != nil {
+		return err
+	}
+	sourceRevision := objs.fromOCI.Revision(digest)
+	record.SourceRevision = sourceRevision
+	// The source tag may have moved on since its revision has been approved
+	if err := engine.RequireApproval(promotion, sourceRevision); err != nil {
+		return err
+	}
+	if err := verifyOCISource(ctx, objs, digest); err != nil {
+		return err
+	}
+	if record.Version, err = objs.checkVersionPolicy(nil, sourceRevision); err != nil {
+		return err
+	}
+
+	changed, err := engine.CopyOCI(ctx, objs.fromOCI, objs.toOCI, digest)
+	if err != nil {
+		return err
+	}
+	record.TargetRevision = objs.toOCI.Revision(digest)
+	if !changed {
+		log.FromContext(ctx).Info("Destination environment is already up to date", "targetRevision", record.TargetRevision)
+		return nil
+	}
+
+	log.FromContext(ctx).Info("Copied artifact", "targetRevision", record.TargetRevision, "tag", objs.toOCI.Tag.String())
+	r.Recorder.Eventf(promotion, corev1.EventTypeNormal, "Tagged",
+		"Copied artifact %s for source revision %s to tag %s of environment %s", digest, sourceRevision, objs.toOCI.Tag, objs.to.Name)
+	return nil
+}
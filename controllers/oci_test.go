@@ -0,0 +1,166 @@
+/*
+Copyright 2023 Thomas Stadler <thomas@thomasst.xyz>.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"io"
+	"log"
+	"net/http/httptest"
+	"strings"
+
+	"github.com/google/go-containerregistry/pkg/registry"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+
+	apiv1alpha1 "github.com/thomasstxyz/release-promotion-operator/api/v1alpha1"
+	engine "github.com/thomasstxyz/release-promotion-operator/pkg/promotion"
+)
+
+var _ = Describe("OCI environments", func() {
+	var (
+		ctx       context.Context
+		digest    v1.Hash
+		objs      *promotionObjects
+		promotion *apiv1alpha1.Promotion
+		recorder  *record.FakeRecorder
+		r         *PromotionReconciler
+	)
+
+	BeforeEach(func() {
+		ctx = context.Background()
+		server := httptest.NewServer(registry.New(registry.Logger(log.New(io.Discard, "", 0))))
+		DeferCleanup(server.Close)
+		host := strings.TrimPrefix(server.URL, "http://")
+
+		from, err := engine.NewOCIRepository("dev", "oci://"+host+"/manifests", "dev", true)
+		Expect(err).NotTo(HaveOccurred())
+		to, err := engine.NewOCIRepository("prod", "oci://"+host+"/manifests", "prod", true)
+		Expect(err).NotTo(HaveOccurred())
+		img, err := random.Image(1024, 1)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(remote.Write(from.Tag, img)).To(Succeed())
+		digest, err = img.Digest()
+		Expect(err).NotTo(HaveOccurred())
+
+		objs = &promotionObjects{
+			from:    &apiv1alpha1.Environment{ObjectMeta: metav1.ObjectMeta{Name: "dev"}},
+			fromOCI: from,
+			to:      &apiv1alpha1.Environment{ObjectMeta: metav1.ObjectMeta{Name: "prod"}},
+			toOCI:   to,
+		}
+		promotion = &apiv1alpha1.Promotion{ObjectMeta: metav1.ObjectMeta{Name: "dev-to-prod", Namespace: "default"}}
+		recorder = record.NewFakeRecorder(10)
+		r = &PromotionReconciler{Recorder: recorder}
+	})
+
+	It("records the revisions of a dry run", func() {
+		Expect(r.dryRunOCI(ctx, promotion, objs)).To(Succeed())
+		Expect(promotion.Status.DryRun.SourceRevision).To(Equal("dev@" + digest.String()))
+		Expect(promotion.Status.DryRun.TargetRevision).To(BeEmpty())
+	})
+
+	It("copies the artifact to the destination tag", func() {
+		record := &apiv1alpha1.PromotionRecord{}
+		Expect(r.pushOCIPromotion(ctx, promotion, objs, record)).To(Succeed())
+		Expect(record.SourceRevision).To(Equal("dev@" + digest.String()))
+		Expect(record.TargetRevision).To(Equal("prod@" + digest.String()))
+		Expect(objs.toOCI.Resolve(ctx)).To(Equal(digest))
+		Expect(recorder.Events).To(Receive(ContainSubstring("Tagged")))
+
+		Expect(r.pushOCIPromotion(ctx, promotion, objs, record)).To(Succeed())
+		Expect(recorder.Events).NotTo(Receive())
+	})
+
+	It("blocks unsigned artifacts if the source has a verification policy", func() {
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		Expect(err).NotTo(HaveOccurred())
+		der, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+		Expect(err).NotTo(HaveOccurred())
+		objs.fromCosign, err = engine.NewCosignVerifier(map[string][]byte{
+			"cosign.pub": pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}),
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		err = r.pushOCIPromotion(ctx, promotion, objs, &apiv1alpha1.PromotionRecord{})
+		var verificationErr *sourceVerificationError
+		Expect(errors.As(err, &verificationErr)).To(BeTrue())
+		Expect(err).To(MatchError(ContainSubstring("artifact is not signed")))
+		_, err = objs.toOCI.Resolve(ctx)
+		Expect(err).To(MatchError(engine.ErrTagNotFound))
+	})
+
+	It("blocks versions violating the version policy of the destination", func() {
+		objs.to.Spec.VersionPolicy = &apiv1alpha1.VersionPolicy{SemVer: ">=1.0.0"}
+
+		err := r.pushOCIPromotion(ctx, promotion, objs, &apiv1alpha1.PromotionRecord{})
+		Expect(err).To(MatchError(`version "dev" violates the version policy of environment prod: not a semantic version`))
+		Expect(blockedByVersionPolicy(promotion, err)).To(BeTrue())
+		stalled := meta.FindStatusCondition(promotion.Status.Conditions, apiv1alpha1.StalledCondition)
+		Expect(stalled).NotTo(BeNil())
+		Expect(stalled.Reason).To(Equal(apiv1alpha1.VersionPolicyViolatedReason))
+		_, err = objs.toOCI.Resolve(ctx)
+		Expect(err).To(MatchError(engine.ErrTagNotFound))
+	})
+
+	It("records the version of promoted artifacts", func() {
+		desc, err := remote.Get(objs.fromOCI.Tag)
+		Expect(err).NotTo(HaveOccurred())
+		objs.fromOCI.Tag = objs.fromOCI.Tag.Context().Tag("v1.2.0")
+		Expect(remote.Tag(objs.fromOCI.Tag, desc)).To(Succeed())
+		objs.to.Spec.VersionPolicy = &apiv1alpha1.VersionPolicy{NoDowngrade: true}
+
+		record := &apiv1alpha1.PromotionRecord{}
+		Expect(r.pushOCIPromotion(ctx, promotion, objs, record)).To(Succeed())
+		Expect(record.Version).To(Equal("v1.2.0"))
+
+		objs.to.Status.LastPromotedVersion = "1.3.0"
+		err = r.pushOCIPromotion(ctx, promotion, objs, &apiv1alpha1.PromotionRecord{})
+		Expect(err).To(MatchError(ContainSubstring("downgrade from 1.3.0")))
+	})
+
+	It("reads the credentials for the registry from docker config Secrets", func() {
+		secret := &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: "registry"},
+			Data: map[string][]byte{corev1.DockerConfigJsonKey: []byte(
+				`{"auths": {"https://index.docker.io/v1/": {"username": "flux", "password": "s3cr3t"}}}`)},
+		}
+		auth, err := ociAuth("index.docker.io", secret)
+		Expect(err).NotTo(HaveOccurred())
+		config, err := auth.Authorization()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(config.Username).To(Equal("flux"))
+		Expect(config.Password).To(Equal("s3cr3t"))
+
+		_, err = ociAuth("ghcr.io", secret)
+		Expect(err).To(MatchError("Secret registry contains no credentials for ghcr.io"))
+	})
+})
@@ -18,32 +18,73 @@ package controllers
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"strings"
 	"time"
 
+	"github.com/go-git/go-git/v5/plumbing/transport"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/schema"
-	"k8s.io/client-go/dynamic"
-	"sigs.k8s.io/cli-utils/pkg/kstatus/status"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/client-go/util/retry"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
 	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/source"
 
 	apiv1alpha1 "github.com/thomasstxyz/release-promotion-operator/api/v1alpha1"
+	engine "github.com/thomasstxyz/release-promotion-operator/pkg/promotion"
 )
 
 // PromotionReconciler reconciles a Promotion object
 type PromotionReconciler struct {
 	client.Client
-	Scheme *runtime.Scheme
+	Scheme   *runtime.Scheme
+	Recorder record.EventRecorder
+
+	// RESTConfig is the config the clients for the readiness checks are created from.
+	RESTConfig *rest.Config
+
+	// ClusterResourceNamespace is the namespace in which the
+	// Secrets referenced by ClusterEnvironments are looked up.
+	ClusterResourceNamespace string
+
+	// EnforceImpersonation impersonates the ServiceAccount named "default" of the
+	// namespace for Promotions which do not specify a ServiceAccount, rather
+	// than reading with the identity of the operator, which is not isolated
+	// from other namespaces.
+	EnforceImpersonation bool
+
+	tenantClients tenantClients
+	remoteClients remoteClusterClients
+	notifications *notificationDispatcher
 }
 
 //+kubebuilder:rbac:groups=api.release-promotion-operator.io,resources=promotions,verbs=get;list;watch;create;update;patch;delete
 //+kubebuilder:rbac:groups=api.release-promotion-operator.io,resources=promotions/status,verbs=get;update;patch
 //+kubebuilder:rbac:groups=api.release-promotion-operator.io,resources=promotions/finalizers,verbs=update
+//+kubebuilder:rbac:groups=api.release-promotion-operator.io,resources=environments,verbs=get;list;watch
+//+kubebuilder:rbac:groups=api.release-promotion-operator.io,resources=environments/status,verbs=get;update;patch
+//+kubebuilder:rbac:groups=api.release-promotion-operator.io,resources=promotiontemplates,verbs=get;list;watch
+//+kubebuilder:rbac:groups=api.release-promotion-operator.io,resources=clusterenvironments,verbs=get;list;watch
+//+kubebuilder:rbac:groups=api.release-promotion-operator.io,resources=clusterenvironments/status,verbs=get;update;patch
+//+kubebuilder:rbac:groups=api.release-promotion-operator.io,resources=clusterpromotiontemplates,verbs=get;list;watch
+//+kubebuilder:rbac:groups=api.release-promotion-operator.io,resources=referencegrants,verbs=get;list;watch
+//+kubebuilder:rbac:groups=api.release-promotion-operator.io,resources=promotionnotifiers,verbs=get;list;watch
+//+kubebuilder:rbac:groups="",resources=secrets,verbs=get;list;watch
+//+kubebuilder:rbac:groups="",resources=serviceaccounts,verbs=get;list;watch;impersonate
+//+kubebuilder:rbac:groups="",resources=events,verbs=create;patch
 
 // Reconcile is part of the main kubernetes reconciliation loop which aims to
 // move the current state of the cluster closer to the desired state.
@@ -57,39 +98,247 @@ type PromotionReconciler struct {
 func (r *PromotionReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
 	log := log.FromContext(ctx)
 
-	log.Info("Begin Reconciliation", "ctx", ctx, "req", req)
-
 	// Get Promotion object
 	promotion := &apiv1alpha1.Promotion{}
 	if err := r.Get(ctx, req.NamespacedName, promotion); err != nil {
+		if apierrors.IsNotFound(err) {
+			deletePromotionMetrics(req.Namespace, req.Name)
+		}
 		return ctrl.Result{}, client.IgnoreNotFound(err)
 	}
+	before := promotion.Status.DeepCopy()
 
-	// Do readiness checks
-	var unreadyResources []apiv1alpha1.LocalObjectsRef
-	ReadinessChecksSucceeded, unreadyResources, err := r.readinessChecks(ctx, promotion)
-	if err != nil {
-		fmt.Println(err)
+	log = log.WithValues(
+		"from", promotion.Spec.FromSpec.EnvironmentRef.Name,
+		"to", promotion.Spec.ToSpec.EnvironmentRef.Name,
+	)
+	ctx = ctrl.LoggerInto(ctx, log)
+	log.V(1).Info("Begin reconciliation")
+
+	result, reconcileErr := r.reconcile(ctx, promotion)
+	r.recordReadyTransition(ctx, promotion, before)
+
+	// Poll the open pull request until it has been merged or closed
+	if promotion.Status.PullRequest != nil && reconcileErr == nil &&
+		(result.RequeueAfter == 0 || result.RequeueAfter > pullRequestPollInterval) {
+		result.RequeueAfter = pullRequestPollInterval
 	}
 
 	// Update status of Promotion
-	if err := r.updateStatus(ctx, promotion, unreadyResources, ReadinessChecksSucceeded); err != nil {
+	promotion.Status.ObservedGeneration = promotion.Generation
+	if err := r.updateStatus(ctx, promotion, before); err != nil {
 		return ctrl.Result{}, client.IgnoreNotFound(err)
 	}
 
-	return ctrl.Result{}, nil
+	return result, reconcileErr
+}
+
+// recordReadyTransition logs and emits an event if the Ready condition changed.
+func (r *PromotionReconciler) recordReadyTransition(ctx context.Context, promotion *apiv1alpha1.Promotion, before *apiv1alpha1.PromotionStatus) {
+	ready := meta.FindStatusCondition(promotion.Status.Conditions, apiv1alpha1.ReadyCondition)
+	if ready == nil {
+		return
+	}
+	if old := meta.FindStatusCondition(before.Conditions, apiv1alpha1.ReadyCondition); old != nil &&
+		old.Status == ready.Status && old.Reason == ready.Reason && old.Message == ready.Message {
+		return
+	}
+
+	log.FromContext(ctx).Info("Ready condition changed", "status", ready.Status, "reason", ready.Reason, "message", ready.Message)
+
+	eventType := corev1.EventTypeNormal
+	if meta.IsStatusConditionTrue(promotion.Status.Conditions, apiv1alpha1.StalledCondition) || failureReasons[ready.Reason] {
+		eventType = corev1.EventTypeWarning
+	}
+	r.Recorder.Event(promotion, eventType, ready.Reason, ready.Message)
+
+	if blockingReasons[ready.Reason] {
+		if old := meta.FindStatusCondition(before.Conditions, apiv1alpha1.ReadyCondition); old == nil || old.Reason != ready.Reason {
+			r.notify(ctx, promotion, apiv1alpha1.PromotionBlockedEvent, nil, ready.Message)
+		}
+	}
+}
+
+// blockingReasons are the reasons of the Ready condition of a blocked Promotion.
+var blockingReasons = map[string]bool{
+	apiv1alpha1.DependencyNotReadyReason:       true,
+	apiv1alpha1.ReferenceNotGrantedReason:      true,
+	apiv1alpha1.SourceVerificationFailedReason: true,
+	apiv1alpha1.WaitingForApprovalReason:       true,
+}
+
+// failureReasons are the reasons of the Ready condition of a Promotion
+// which failed with a transient error and is retried.
+var failureReasons = map[string]bool{
+	apiv1alpha1.ReadinessChecksFailedReason: true,
+	apiv1alpha1.ClusterUnreachableReason:    true,
+	apiv1alpha1.DryRunFailedReason:          true,
+	apiv1alpha1.PromotionFailedReason:       true,
+}
+
+// reconcile runs the readiness checks and the promotion, recording the
+// outcome in the conditions of the Promotion.
+func (r *PromotionReconciler) reconcile(ctx context.Context, promotion *apiv1alpha1.Promotion) (ctrl.Result, error) {
+	// Check that references to other namespaces are granted,
+	// the Promotion is requeued when a ReferenceGrant changes
+	denied, err := r.deniedReferences(ctx, promotion)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	if len(denied) > 0 {
+		setBlocked(promotion, true)
+		markStalled(promotion, apiv1alpha1.ReferenceNotGrantedReason, strings.Join(denied, "; "))
+		return ctrl.Result{}, nil
+	}
+
+	// Report the outcome of the pull request of the last promotion, regardless of the Trigger
+	if promotion.Status.PullRequest != nil {
+		r.reconcilePullRequest(ctx, promotion)
+	}
+
+	// Promote only when the Trigger is due, dry runs are rendered on every reconciliation
+	now := time.Now()
+	trigger, err := engine.EvaluateTrigger(promotion, now)
+	if err != nil {
+		markStalled(promotion, apiv1alpha1.PromotionFailedReason, err.Error())
+		return ctrl.Result{}, nil
+	}
+	promotion.Status.NextScheduleTime = trigger.NextSchedule
+	if !trigger.Due && !promotion.IsDryRun() {
+		setBlocked(promotion, false)
+		markWaiting(promotion, trigger.Message)
+		return ctrl.Result{RequeueAfter: trigger.RequeueAfter}, nil
+	}
+
+	// Do readiness checks
+	start := time.Now()
+	unreadyObjects, err := r.readinessChecks(ctx, promotion)
+	readinessCheckDuration.WithLabelValues(promotion.Namespace, promotion.Name).Observe(time.Since(start).Seconds())
+	setBlocked(promotion, err != nil || len(unreadyObjects) > 0)
+	if err != nil {
+		promotion.Status.DependentObjectsReady = false
+		var unreachable *clusterUnreachableError
+		if errors.As(err, &unreachable) {
+			markReconciling(promotion, apiv1alpha1.ClusterUnreachableReason, err.Error())
+			return ctrl.Result{RequeueAfter: dependencyRequeueInterval}, nil
+		}
+		markReconciling(promotion, apiv1alpha1.ReadinessChecksFailedReason, err.Error())
+		return ctrl.Result{}, err
+	}
+	promotion.Status.UnreadyObjects = unreadyObjects
+	promotion.Status.DependentObjectsReady = len(unreadyObjects) == 0
+
+	// Render the changes without promoting them
+	if promotion.IsDryRun() {
+		if err := r.dryRun(ctx, promotion); err != nil {
+			if blockedBySourceVerification(promotion, err) || blockedByVersionPolicy(promotion, err) {
+				return ctrl.Result{RequeueAfter: trigger.RequeueAfter}, nil
+			}
+			markFailed(promotion, apiv1alpha1.DryRunFailedReason, err)
+			return ctrl.Result{}, err
+		}
+	}
+
+	// Wait for all dependent objects to be ready
+	if !promotion.Status.DependentObjectsReady {
+		markReconciling(promotion, apiv1alpha1.DependencyNotReadyReason, unreadyMessage(promotion, unreadyObjects))
+		return ctrl.Result{RequeueAfter: dependencyRequeueInterval}, nil
+	}
+
+	if promotion.IsDryRun() {
+		markReady(promotion, apiv1alpha1.DryRunSucceededReason,
+			fmt.Sprintf("Dry run rendered for source revision %s", promotion.Status.DryRun.SourceRevision))
+		return ctrl.Result{RequeueAfter: trigger.RequeueAfter}, nil
+	}
+
+	// The trigger is handled once the promotion has been attempted,
+	// a failed promotion is retried when the Trigger is due again
+	err = r.promote(ctx, promotion)
+	trigger.Handled(promotion, now)
+	if err != nil {
+		if blockedBySourceVerification(promotion, err) || blockedByVersionPolicy(promotion, err) {
+			return ctrl.Result{RequeueAfter: trigger.RequeueAfter}, nil
+		}
+		var approvalErr *engine.ApprovalRequiredError
+		if errors.As(err, &approvalErr) {
+			setBlocked(promotion, true)
+			markReconciling(promotion, apiv1alpha1.WaitingForApprovalReason, err.Error())
+			return ctrl.Result{RequeueAfter: trigger.RequeueAfter}, nil
+		}
+		markFailed(promotion, apiv1alpha1.PromotionFailedReason, err)
+		return ctrl.Result{}, err
+	}
+	markReady(promotion, apiv1alpha1.PromotionSucceededReason,
+		fmt.Sprintf("Promoted source revision %s", promotion.Status.LastPromotedRevision))
+
+	return ctrl.Result{RequeueAfter: trigger.RequeueAfter}, nil
+}
+
+// blockedBySourceVerification marks the Promotion as blocked if the error is
+// a failed verification of the source revision. The error is not returned,
+// as retrying cannot succeed until a commit signed by a trusted key is pushed,
+// which is picked up when the Trigger is evaluated again.
+func blockedBySourceVerification(promotion *apiv1alpha1.Promotion, err error) bool {
+	var verificationErr *sourceVerificationError
+	if !errors.As(err, &verificationErr) {
+		return false
+	}
+	setBlocked(promotion, true)
+	markStalled(promotion, apiv1alpha1.SourceVerificationFailedReason, err.Error())
+	return true
+}
+
+// blockedByVersionPolicy marks the Promotion as blocked if the error is a violation
+// of the version policy of the destination environment. Like failed verifications,
+// the error is not returned, as only a new source revision can resolve it.
+func blockedByVersionPolicy(promotion *apiv1alpha1.Promotion, err error) bool {
+	var policyErr *engine.VersionPolicyError
+	if !errors.As(err, &policyErr) {
+		return false
+	}
+	setBlocked(promotion, true)
+	markStalled(promotion, apiv1alpha1.VersionPolicyViolatedReason, err.Error())
+	return true
+}
+
+// dependencyRequeueInterval is the interval in which the
+// readiness checks are repeated until all dependent objects are ready.
+const dependencyRequeueInterval = 30 * time.Second
+
+// pullRequestPollInterval is the interval in which the state of the open
+// pull request is polled until it has been merged or closed.
+const pullRequestPollInterval = 5 * time.Minute
+
+// unreadyMessage summarizes the unready objects in a single line.
+func unreadyMessage(promotion *apiv1alpha1.Promotion, unreadyObjects []apiv1alpha1.UnreadyObject) string {
+	names := make([]string, 0, len(unreadyObjects))
+	for _, o := range unreadyObjects {
+		name := o.GroupVersionResource.Resource + "/" + o.Name
+		if o.Namespace != "" && o.Namespace != promotion.Namespace {
+			name = o.GroupVersionResource.Resource + "/" + o.Namespace + "/" + o.Name
+		}
+		names = append(names, name)
+	}
+	return fmt.Sprintf("%d of %d dependent objects are not ready: %s",
+		len(unreadyObjects), len(promotion.GetLocalObjectsRefsForReadinessChecks()), strings.Join(names, ", "))
 }
 
 // readinessChecks checks the status of all dependent objects for readiness
 // using [kstatus](https://github.com/kubernetes-sigs/cli-utils/tree/master/pkg/kstatus)
-func (r *PromotionReconciler) readinessChecks(ctx context.Context, promotion *apiv1alpha1.Promotion) (bool, []apiv1alpha1.LocalObjectsRef, error) {
-	// Create dynamic client to be able to get unstructured resources
-	dynamicClient, err := dynamic.NewForConfig(ctrl.GetConfigOrDie())
+// and returns the objects which are not ready.
+func (r *PromotionReconciler) readinessChecks(ctx context.Context, promotion *apiv1alpha1.Promotion) ([]apiv1alpha1.UnreadyObject, error) {
+	// Get unstructured resources with a dynamic client impersonating the
+	// ServiceAccount of the Promotion, which reads the kubeconfig Secrets
+	// of remote clusters as well
+	tenant, err := r.tenant(ctx, promotion)
+	if err != nil {
+		return nil, err
+	}
 
 	var dependentResources []apiv1alpha1.LocalObjectsRef = promotion.GetLocalObjectsRefsForReadinessChecks()
 
 	// Check ready status of each specified object
-	var unreadyResources []apiv1alpha1.LocalObjectsRef
+	var unreadyObjects []apiv1alpha1.UnreadyObject
 	for _, dr := range dependentResources {
 		gvr := schema.GroupVersionResource{
 			Group:    dr.GroupVersionResource.Group,
@@ -104,117 +353,749 @@ func (r *PromotionReconciler) readinessChecks(ctx context.Context, promotion *ap
 			ns = promotion.Namespace
 		}
 
-		// Fetch dependent object
+		// Fetch dependent object, from a remote cluster if the check has a kubeconfig
+		resourceClient := tenant.dynamic
+		if dr.KubeConfig != nil {
+			resourceClient, err = r.remoteClients.get(ctx, tenant.reader, promotion.Namespace, dr.KubeConfig)
+			if err != nil {
+				return nil, err
+			}
+		}
 		var obj *unstructured.Unstructured
-		obj, err = dynamicClient.Resource(gvr).Namespace(ns).Get(ctx, dr.Name, v1.GetOptions{}, "")
+		obj, err = resourceClient.Resource(gvr).Namespace(ns).Get(ctx, dr.Name, v1.GetOptions{}, "")
 		if err != nil {
-			fmt.Printf("error getting obj: %v\n", err)
-			return false, unreadyResources, err
+			if dr.KubeConfig != nil && isClusterUnreachable(ctx, err) {
+				return nil, &clusterUnreachableError{
+					secret: types.NamespacedName{Namespace: promotion.Namespace, Name: dr.KubeConfig.SecretRef.Name},
+					err:    err,
+				}
+			}
+			return nil, fmt.Errorf("failed to get %s %s/%s: %w", gvr.Resource, ns, dr.Name, err)
 		}
 
-		// Check status of dependent object
-		result, err := status.Compute(obj)
+		// Check status of dependent object, it is unready if its status
+		// is any other than status.CurrentStatus (Ready status)
+		unready, err := engine.CheckReadiness(dr, obj)
 		if err != nil {
-			fmt.Printf("error retrieving status of obj: %v\n", err)
-			return false, unreadyResources, err
+			return nil, err
 		}
-		fmt.Printf("The status of %s is: %q. Message: %s\n", dr.Name, result.Status, result.Message)
-
-		// Mark object unready if status is any other than status.CurrentStatus (Ready status)
-		if result.Status != status.CurrentStatus {
-			unreadyResources = append(unreadyResources, dr)
+		log.FromContext(ctx).V(1).Info("Checked readiness of dependent object",
+			"resource", gvr.String(), "namespace", ns, "name", dr.Name, "ready", unready == nil)
+		if unready != nil {
+			unreadyObjects = append(unreadyObjects, *unready)
 		}
 	}
 
-	return true, unreadyResources, err
+	return unreadyObjects, nil
 }
 
-func (r *PromotionReconciler) updateStatus(ctx context.Context, promotion *apiv1alpha1.Promotion, unreadyResources []apiv1alpha1.LocalObjectsRef, ReadinessChecksSucceeded bool) error {
-	// get beforeConditions
-	var beforeConditions []metav1.Condition = promotion.Status.Conditions
+// promotionObjects holds the objects referenced by a Promotion.
+type promotionObjects struct {
+	from         *apiv1alpha1.Environment
+	fromAuth     transport.AuthMethod
+	fromArtifact *engine.Artifact
+	fromOCI      *engine.OCIRepository
+	fromImage    *engine.ImageRepository
+	fromVerifier *commitVerifier
+	fromSOPSKeys *engine.SOPSKeyring
+	fromProvider gitProvider
+	fromCosign   *engine.CosignVerifier
+	to           *apiv1alpha1.Environment
+	toOCI        *engine.OCIRepository
+	toAuth       transport.AuthMethod
+	toSigner     commitSigner
+	toSOPSKeys   *engine.SOPSKeyring
+	toProvider   gitProvider
+	template     *apiv1alpha1.PromotionTemplate
+}
 
-	var afterConditions []metav1.Condition = beforeConditions
+// getPromotionObjects fetches the Environments and the PromotionTemplate
+// referenced by the Promotion, along with the Git credentials of the Environments.
+func (r *PromotionReconciler) getPromotionObjects(ctx context.Context, promotion *apiv1alpha1.Promotion) (*promotionObjects, error) {
+	resolver := &engine.Resolver{Reader: r.Client, ClusterResourceNamespace: r.ClusterResourceNamespace}
+	resolved, err := resolver.Resolve(ctx, promotion)
+	if err != nil {
+		return nil, err
+	}
+	objs := &promotionObjects{from: resolved.From, to: resolved.To, template: resolved.Template}
+	if objs.to.Spec.SourceRef != nil {
+		return nil, &stalledError{fmt.Errorf("environment %s reads its files from %s %s and cannot be promoted to",
+			objs.to.Name, objs.to.Spec.SourceRef.Kind, objs.to.Spec.SourceRef.Name)}
+	}
+	if objs.to.Spec.Image != nil {
+		return nil, &stalledError{fmt.Errorf("environment %s has an image repository and cannot be promoted to", objs.to.Name)}
+	}
+	if objs.from.Spec.Image == nil && len(objs.template.Spec.Images) > 0 {
+		return nil, &stalledError{fmt.Errorf("PromotionTemplate %s has image operations, but environment %s has no image repository",
+			objs.template.Name, objs.from.Name)}
+	}
+	if objs.from.Spec.Image != nil && len(objs.template.Spec.CopySpec)+len(objs.template.Spec.Charts) > 0 {
+		return nil, &stalledError{fmt.Errorf("PromotionTemplate %s has copy or chart operations, but environment %s has an image repository instead of files",
+			objs.template.Name, objs.from.Name)}
+	}
+	if (objs.from.Spec.OCI != nil) != (objs.to.Spec.OCI != nil) {
+		return nil, &stalledError{fmt.Errorf("environments with an OCI repository can only be promoted to and from each other, not from %s to %s",
+			objs.from.Name, objs.to.Name)}
+	}
 
-	// Get index of existing condition of type "Ready"
-	var readyTypeConditionIndex int
-	var readyTypeConditionExists bool
-	for i, bc := range beforeConditions {
-		switch bc.Type {
-		case "Ready":
-			readyTypeConditionIndex = i
-			readyTypeConditionExists = true
+	// The Secrets of Environments in the namespace of the Promotion are read with
+	// the identity of its ServiceAccount. Other namespaces have granted the reference,
+	// and the Secrets of ClusterEnvironments are managed by the operator's namespace.
+	tenant, err := r.tenantClient(ctx, promotion)
+	if err != nil {
+		return nil, err
+	}
+	secretReader := func(kind string, key types.NamespacedName) client.Reader {
+		if kind == apiv1alpha1.EnvironmentKind && key.Namespace == promotion.Namespace {
+			return tenant
 		}
+		return r.Client
 	}
 
-	if !ReadinessChecksSucceeded {
-		promotion.Status.DependentObjectsReady = false
-
-		condition := metav1.Condition{
-			Type:               "Ready",
-			Status:             metav1.ConditionFalse,
-			LastTransitionTime: metav1.NewTime(time.Now()),
-			Reason:             "ReadinessChecksFailed",
-			// TODO: output the object, which failed
-			Message: "Error fetching dependent objects!",
+	if objs.from.Spec.OCI != nil {
+		if objs.fromOCI, err = r.environmentOCIRepository(ctx, secretReader(promotion.FromEnvironmentKind(), promotion.FromEnvironmentKey()), objs.from); err != nil {
+			return nil, err
 		}
+		if objs.fromCosign, err = r.environmentCosignVerifier(ctx, secretReader(promotion.FromEnvironmentKind(), promotion.FromEnvironmentKey()), objs.from); err != nil {
+			return nil, err
+		}
+		if objs.toOCI, err = r.environmentOCIRepository(ctx, secretReader(promotion.ToEnvironmentKind(), promotion.ToEnvironmentKey()), objs.to); err != nil {
+			return nil, err
+		}
+		return objs, nil
+	}
 
-		if readyTypeConditionExists {
-			afterConditions[readyTypeConditionIndex] = condition
-		} else {
-			afterConditions = append(afterConditions, condition)
+	if objs.fromAuth, err = r.environmentAuth(ctx, secretReader(promotion.FromEnvironmentKind(), promotion.FromEnvironmentKey()), objs.from); err != nil {
+		return nil, err
+	}
+	if objs.from.Spec.Image != nil {
+		if objs.fromImage, err = r.environmentImageRepository(ctx, secretReader(promotion.FromEnvironmentKind(), promotion.FromEnvironmentKey()), objs.from); err != nil {
+			return nil, err
+		}
+	}
+	if objs.from.Spec.SourceRef != nil {
+		// Flux source objects are read with the same identity as the Secrets
+		if objs.fromArtifact, err = r.environmentArtifact(ctx, secretReader(promotion.FromEnvironmentKind(), promotion.FromEnvironmentKey()), objs.from); err != nil {
+			return nil, err
+		}
+	}
+	if objs.fromVerifier, err = r.environmentVerifier(ctx, secretReader(promotion.FromEnvironmentKind(), promotion.FromEnvironmentKey()), objs.from); err != nil {
+		return nil, err
+	}
+	if objs.fromSOPSKeys, err = r.environmentSOPSKeys(ctx, secretReader(promotion.FromEnvironmentKind(), promotion.FromEnvironmentKey()), objs.from); err != nil {
+		return nil, err
+	}
+	if objs.fromProvider, err = r.environmentGitProvider(ctx, secretReader(promotion.FromEnvironmentKind(), promotion.FromEnvironmentKey()), objs.from); err != nil {
+		return nil, err
+	}
+	if objs.toAuth, err = r.environmentAuth(ctx, secretReader(promotion.ToEnvironmentKind(), promotion.ToEnvironmentKey()), objs.to); err != nil {
+		return nil, err
+	}
+	if objs.toSigner, err = r.environmentSigner(ctx, secretReader(promotion.ToEnvironmentKind(), promotion.ToEnvironmentKey()), objs.to); err != nil {
+		return nil, err
+	}
+	if objs.toSOPSKeys, err = r.environmentSOPSKeys(ctx, secretReader(promotion.ToEnvironmentKind(), promotion.ToEnvironmentKey()), objs.to); err != nil {
+		return nil, err
+	}
+	if promotion.Spec.Strategy.PullRequest {
+		if objs.to.Spec.Provider == nil {
+			return nil, &stalledError{fmt.Errorf("the pull-request strategy requires a provider on environment %s to open pull requests with", objs.to.Name)}
+		}
+		if objs.toProvider, err = r.environmentGitProvider(ctx, secretReader(promotion.ToEnvironmentKind(), promotion.ToEnvironmentKey()), objs.to); err != nil {
+			return nil, err
 		}
 	}
 
-	if ReadinessChecksSucceeded {
-		promotion.Status.DependentObjectsReady = true
+	return objs, nil
+}
 
-		condition := metav1.Condition{
-			Type:               "Ready",
-			Status:             metav1.ConditionTrue,
-			LastTransitionTime: metav1.NewTime(time.Now()),
-			Reason:             "ReadinessChecksSucceeded",
-			Message:            "All dependent objects are ready!",
+// sourceRevision resolves the current revision of the source environment,
+// without cloning its repository or downloading its artifact.
+func (objs *promotionObjects) sourceRevision(ctx context.Context) (string, error) {
+	if objs.fromImage != nil {
+		return objs.fromImage.LatestTag(ctx)
+	}
+	if objs.fromOCI != nil {
+		digest, err := objs.fromOCI.Resolve(ctx)
+		if err != nil {
+			return "", err
 		}
+		return objs.fromOCI.Revision(digest), nil
+	}
+	if objs.fromArtifact != nil {
+		return objs.fromArtifact.Revision, nil
+	}
+	return remoteHead(ctx, objs.from, objs.fromAuth)
+}
+
+// checkoutSource clones the source environment, extracts the artifact of its Flux source,
+// or selects the latest tag of its image repository.
+func (objs *promotionObjects) checkoutSource(ctx context.Context) (*gitCheckout, error) {
+	if objs.fromImage != nil {
+		return checkoutImage(ctx, objs.from, objs.fromImage)
+	}
+	if objs.fromArtifact != nil {
+		return fetchEnvironmentArtifact(ctx, objs.from, objs.fromArtifact)
+	}
+	return cloneEnvironment(ctx, objs.from, objs.fromAuth)
+}
+
+// applyTemplate applies the PromotionTemplate to the destination checkout: the tag of
+// the source image repository is set by the image operations, files are copied and
+// chart versions promoted within the chart constraints of the destination otherwise.
+func (objs *promotionObjects) applyTemplate(from, to *gitCheckout) (*engine.ChangeSet, error) {
+	if from.image != nil {
+		return engine.SetImages(to.Checkout, objs.template.Spec.Images, from.image.Repository.Name(), from.imageTag)
+	}
+	to.ChartConstraints = objs.to.Spec.Charts
+	return engine.ApplyTemplate(from.Checkout, to.Checkout, &objs.template.Spec)
+}
+
+// checkVersionPolicy extracts the version of the source revision and checks it against the
+// version policy of the destination environment, if any, and the version last promoted to it.
+// The checkout of the source is nil for environments without files.
+// It returns the version, or an empty string without a policy.
+func (objs *promotionObjects) checkVersionPolicy(from *gitCheckout, revision string) (string, error) {
+	policy := objs.to.Spec.VersionPolicy
+	if policy == nil {
+		return "", nil
+	}
+
+	var checkout *engine.Checkout
+	if from != nil && from.image == nil {
+		checkout = from.Checkout
+	}
+	version, err := engine.ExtractVersion(checkout, revision, policy.Source)
+	if err != nil {
+		return "", err
+	}
+	if err := engine.CheckVersion(policy, objs.to.Name, version, objs.to.Status.LastPromotedVersion); err != nil {
+		return "", err
+	}
+	return version, nil
+}
 
-		if readyTypeConditionExists {
-			afterConditions[readyTypeConditionIndex] = condition
+// recordPromotedVersion records the version promoted to the destination environment in its
+// status, which later promotions to it are checked against, whichever Promotion they belong to.
+func (r *PromotionReconciler) recordPromotedVersion(ctx context.Context, promotion *apiv1alpha1.Promotion, version string) error {
+	if version == "" {
+		return nil
+	}
+	err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		var env client.Object
+		var status *apiv1alpha1.EnvironmentStatus
+		if promotion.ToEnvironmentKind() == apiv1alpha1.ClusterEnvironmentKind {
+			clusterEnv := &apiv1alpha1.ClusterEnvironment{}
+			env, status = clusterEnv, &clusterEnv.Status
 		} else {
-			afterConditions = append(afterConditions, condition)
+			namespacedEnv := &apiv1alpha1.Environment{}
+			env, status = namespacedEnv, &namespacedEnv.Status
+		}
+		if err := r.Get(ctx, promotion.ToEnvironmentKey(), env); err != nil {
+			return err
 		}
+		if status.LastPromotedVersion == version {
+			return nil
+		}
+		patch := client.MergeFromWithOptions(env.DeepCopyObject().(client.Object), client.MergeFromWithOptimisticLock{})
+		status.LastPromotedVersion = version
+		return r.Status().Patch(ctx, env, patch)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to record version %s on %s %s: %w",
+			version, promotion.ToEnvironmentKind(), promotion.Spec.ToSpec.EnvironmentRef.Name, err)
 	}
+	return nil
+}
 
-	if len(unreadyResources) != 0 && ReadinessChecksSucceeded {
-		promotion.Status.DependentObjectsReady = false
+// environmentAuth returns the Git credentials of the Environment's SecretRef, if any.
+func (r *PromotionReconciler) environmentAuth(ctx context.Context, c client.Reader, env *apiv1alpha1.Environment) (transport.AuthMethod, error) {
+	if env.Spec.Source == nil || env.Spec.Source.SecretRef == nil {
+		return nil, nil
+	}
+
+	secret := &corev1.Secret{}
+	if err := c.Get(ctx, client.ObjectKey{Namespace: env.Namespace, Name: env.Spec.Source.SecretRef.Name}, secret); err != nil {
+		return nil, err
+	}
+	return gitAuth(env.Spec.Source.URL, secret)
+}
+
+// environmentSigner returns the signer of the Environment's SigningKey, if any.
+func (r *PromotionReconciler) environmentSigner(ctx context.Context, c client.Reader, env *apiv1alpha1.Environment) (commitSigner, error) {
+	if env.Spec.SigningKey == nil {
+		return nil, nil
+	}
+
+	secret := &corev1.Secret{}
+	if err := c.Get(ctx, client.ObjectKey{Namespace: env.Namespace, Name: env.Spec.SigningKey.SecretRef.Name}, secret); err != nil {
+		return nil, err
+	}
+	return commitSignerFromSecret(secret)
+}
+
+// environmentVerifier returns the verifier of the Environment's verification policy, if any.
+func (r *PromotionReconciler) environmentVerifier(ctx context.Context, c client.Reader, env *apiv1alpha1.Environment) (*commitVerifier, error) {
+	if env.Spec.Verify == nil {
+		return nil, nil
+	}
 
-		condition := metav1.Condition{
-			Type:               "Ready",
-			Status:             metav1.ConditionFalse,
-			LastTransitionTime: metav1.NewTime(time.Now()),
-			Reason:             "ReadinessChecksFailed",
-			Message:            fmt.Sprintf("Dependent objects are not ready:\n%v", unreadyResources),
+	secret := &corev1.Secret{}
+	if err := c.Get(ctx, client.ObjectKey{Namespace: env.Namespace, Name: env.Spec.Verify.SecretRef.Name}, secret); err != nil {
+		return nil, err
+	}
+	return commitVerifierFromSecret(secret)
+}
+
+// environmentGitProvider returns the provider of the Environment's Git hosting service, if any.
+func (r *PromotionReconciler) environmentGitProvider(ctx context.Context, c client.Reader, env *apiv1alpha1.Environment) (gitProvider, error) {
+	if env.Spec.Provider == nil {
+		return nil, nil
+	}
+
+	secret := &corev1.Secret{}
+	if err := c.Get(ctx, client.ObjectKey{Namespace: env.Namespace, Name: env.Spec.Provider.SecretRef.Name}, secret); err != nil {
+		return nil, err
+	}
+	return gitProviderFromSecret(env, secret)
+}
+
+// environmentSOPSKeys returns the keys of the Environment's Decryption, if any.
+func (r *PromotionReconciler) environmentSOPSKeys(ctx context.Context, c client.Reader, env *apiv1alpha1.Environment) (*engine.SOPSKeyring, error) {
+	if env.Spec.Decryption == nil {
+		return nil, nil
+	}
+
+	secret := &corev1.Secret{}
+	if err := c.Get(ctx, client.ObjectKey{Namespace: env.Namespace, Name: env.Spec.Decryption.SecretRef.Name}, secret); err != nil {
+		return nil, err
+	}
+	keyring, err := engine.NewSOPSKeyring(secret.Data)
+	if err != nil {
+		return nil, fmt.Errorf("Secret %s: %w", secret.Name, err)
+	}
+	return keyring, nil
+}
+
+// verifySource verifies the signature of the checked out source revision,
+// if the source Environment has a verification policy.
+func verifySource(ctx context.Context, from *gitCheckout, verifier *commitVerifier) error {
+	if verifier == nil {
+		return nil
+	}
+
+	revision, err := from.revision()
+	if err != nil {
+		return err
+	}
+	fingerprint, err := from.verifyHead(verifier)
+	if err != nil {
+		return &sourceVerificationError{revision: revision, err: err}
+	}
+	log.FromContext(ctx).V(1).Info("Verified signature of source revision", "revision", revision, "fingerprint", fingerprint)
+	return nil
+}
+
+// dryRun clones the source and destination environments, applies the
+// PromotionTemplate and records the resulting diff in the status.
+// Nothing is committed or pushed to the destination environment.
+func (r *PromotionReconciler) dryRun(ctx context.Context, promotion *apiv1alpha1.Promotion) error {
+	objs, err := r.getPromotionObjects(ctx, promotion)
+	if err != nil {
+		return err
+	}
+	if objs.fromOCI != nil {
+		return r.dryRunOCI(ctx, promotion, objs)
+	}
+
+	// Skip cloning if neither the Promotion nor the environments changed
+	// since the last dry run, unless it has been requested again
+	if last := promotion.Status.DryRun; last != nil && last.ObservedGeneration == promotion.Generation &&
+		last.RequestedAt == promotion.DryRunRequest() {
+		sourceRevision, err := objs.sourceRevision(ctx)
+		if err != nil {
+			return err
+		}
+		targetRevision, err := remoteHead(ctx, objs.to, objs.toAuth)
+		if err != nil {
+			return err
 		}
+		if last.SourceRevision == sourceRevision && last.TargetRevision == targetRevision {
+			return nil
+		}
+	}
 
-		if readyTypeConditionExists {
-			afterConditions[readyTypeConditionIndex] = condition
-		} else {
-			afterConditions = append(afterConditions, condition)
+	from, err := objs.checkoutSource(ctx)
+	if err != nil {
+		return err
+	}
+	defer from.Close()
+	if err := verifySource(ctx, from, objs.fromVerifier); err != nil {
+		return err
+	}
+	sourceRevision, err := from.revision()
+	if err != nil {
+		return err
+	}
+	if _, err := objs.checkVersionPolicy(from, sourceRevision); err != nil {
+		return err
+	}
+	from.SOPSKeys = objs.fromSOPSKeys
+	to, err := cloneEnvironment(ctx, objs.to, objs.toAuth)
+	if err != nil {
+		return err
+	}
+	defer to.Close()
+	to.SOPSKeys = objs.toSOPSKeys
+
+	if _, err := objs.applyTemplate(from, to); err != nil {
+		return err
+	}
+
+	result, err := to.Diff(ctx, apiv1alpha1.MaxDryRunPatchSize)
+	if err != nil {
+		return err
+	}
+	result.SourceRevision = sourceRevision
+	result.ObservedGeneration = promotion.Generation
+	result.LastRunTime = metav1.Now()
+	result.RequestedAt = promotion.DryRunRequest()
+
+	promotion.Status.DryRun = result
+	return nil
+}
+
+// promote applies the PromotionTemplate to the destination environment and
+// pushes the result, unless the current revision of the source environment
+// has already been promoted. The outcome is recorded in the status.
+func (r *PromotionReconciler) promote(ctx context.Context, promotion *apiv1alpha1.Promotion) error {
+	objs, err := r.getPromotionObjects(ctx, promotion)
+	if err != nil {
+		return err
+	}
+
+	sourceRevision, err := objs.sourceRevision(ctx)
+	if err != nil {
+		return err
+	}
+	if sourceRevision == promotion.Status.LastPromotedRevision {
+		promotion.Status.PendingApprovalRevision = ""
+		return nil
+	}
+	if err := engine.RequireApproval(promotion, sourceRevision); err != nil {
+		return err
+	}
+
+	log := log.FromContext(ctx).WithValues("revision", sourceRevision)
+	ctx = ctrl.LoggerInto(ctx, log)
+	log.Info("Promoting source revision")
+	promotionsStarted.WithLabelValues(environmentLabels(promotion)...).Inc()
+
+	start := metav1.Now()
+	record := apiv1alpha1.PromotionRecord{
+		SourceRevision: sourceRevision,
+		StartTime:      start,
+	}
+	r.notify(ctx, promotion, apiv1alpha1.PromotionStartedEvent, &record,
+		fmt.Sprintf("Promoting source revision %s", sourceRevision))
+	r.reportCommitStatus(ctx, promotion, objs, sourceRevision, commitStatePending, fmt.Sprintf("Promoting to %s", objs.to.Name))
+
+	previousPullRequest := promotion.Status.PullRequest
+	err = r.pushPromotion(ctx, promotion, objs, &record)
+	record.Duration = metav1.Duration{Duration: time.Since(start.Time)}
+	var approvalErr *engine.ApprovalRequiredError
+	if errors.As(err, &approvalErr) {
+		// The source environment moved on to a revision waiting for approval
+		// since the promotion started, which abandons the started promotion
+		record.SourceRevision = sourceRevision
+		record.Outcome = apiv1alpha1.PromotionSuperseded
+		record.Message = err.Error()
+		promotion.Status.RecordPromotion(record)
+		promotionsCompleted.WithLabelValues(append(environmentLabels(promotion), string(record.Outcome))...).Inc()
+		log.Info("Promotion superseded by a source revision waiting for approval", "pendingRevision", approvalErr.Revision)
+		r.notify(ctx, promotion, apiv1alpha1.PromotionSupersededEvent, &record,
+			fmt.Sprintf("Promotion of source revision %s has been superseded by source revision %s, which is waiting for approval",
+				sourceRevision, approvalErr.Revision))
+		r.reportCommitStatus(ctx, promotion, objs, sourceRevision, commitStateCanceled,
+			fmt.Sprintf("Superseded by source revision %s", approvalErr.Revision))
+		return err
+	}
+
+	promotion.Status.LastAttemptedRevision = record.SourceRevision
+	promotion.Status.LastAttemptTime = &start
+
+	// The version is recorded on the destination once promoted, which is when
+	// the pull request has been merged with the pull-request strategy
+	pullRequest := promotion.Status.PullRequest
+	awaitingMerge := pullRequest != nil && pullRequest.SourceRevision == record.SourceRevision
+	if err == nil && !awaitingMerge {
+		err = r.recordPromotedVersion(ctx, promotion, record.Version)
+	}
+	if err != nil {
+		record.Outcome = apiv1alpha1.PromotionFailed
+		record.Message = err.Error()
+		promotion.Status.RecordPromotion(record)
+		promotionsCompleted.WithLabelValues(append(environmentLabels(promotion), string(record.Outcome))...).Inc()
+		log.Error(err, "Promotion failed")
+		r.notify(ctx, promotion, apiv1alpha1.PromotionFailedEvent, &record, record.Message)
+		r.reportCommitStatus(ctx, promotion, objs, record.SourceRevision, commitStateFailure, fmt.Sprintf("Promotion to %s failed", objs.to.Name))
+		return err
+	}
+
+	rolledBack := engine.PromotedBefore(promotion, record.SourceRevision)
+	record.Outcome = apiv1alpha1.PromotionSucceeded
+	promotion.Status.RecordPromotion(record)
+	promotionsCompleted.WithLabelValues(append(environmentLabels(promotion), string(record.Outcome))...).Inc()
+	log.Info("Promotion succeeded", "targetRevision", record.TargetRevision, "duration", record.Duration.Duration)
+
+	now := metav1.Now()
+	promotion.Status.LastPromotedRevision = record.SourceRevision
+	promotion.Status.LastTargetRevision = record.TargetRevision
+	if record.Version != "" && !awaitingMerge {
+		promotion.Status.LastPromotedVersion = record.Version
+	}
+	promotion.Status.LastPromotionTime = &now
+
+	message := fmt.Sprintf("Promoted source revision %s", record.SourceRevision)
+	r.notify(ctx, promotion, apiv1alpha1.PromotionSucceededEvent, &record, message)
+	if awaitingMerge {
+		// The pull request of the previous source revision has been updated
+		if previousPullRequest != nil && previousPullRequest.SourceRevision != pullRequest.SourceRevision {
+			r.reportCommitStatus(ctx, promotion, objs, previousPullRequest.SourceRevision, commitStateCanceled,
+				fmt.Sprintf("Superseded by source revision %s", pullRequest.SourceRevision))
+		}
+		r.reportCommitStatus(ctx, promotion, objs, record.SourceRevision, commitStatePending,
+			fmt.Sprintf("Waiting for the pull request to %s to be merged", objs.to.Name))
+	} else {
+		r.reportDeployment(ctx, promotion, objs, record.SourceRevision)
+	}
+	if rolledBack {
+		r.notify(ctx, promotion, apiv1alpha1.PromotionRolledBackEvent, &record,
+			fmt.Sprintf("Rolled back to source revision %s, which had been superseded by later promotions", record.SourceRevision))
+	}
+	return nil
+}
+
+// reconcilePullRequest reports the outcome of the open pull request of the
+// pull-request strategy to the provider of the source environment, once it
+// has been merged or closed. Like other reports, failures are recorded as
+// events, and the pull request is checked again on the next reconciliation.
+func (r *PromotionReconciler) reconcilePullRequest(ctx context.Context, promotion *apiv1alpha1.Promotion) {
+	pr := promotion.Status.PullRequest
+	log := log.FromContext(ctx).WithValues("url", pr.URL, "revision", pr.SourceRevision)
+
+	objs, err := r.getPromotionObjects(ctx, promotion)
+	if err != nil {
+		log.Error(err, "Failed to get state of pull request")
+		return
+	}
+	if objs.toProvider == nil {
+		// The Promotion no longer uses the pull-request strategy
+		promotion.Status.PullRequest = nil
+		r.reportCommitStatus(ctx, promotion, objs, pr.SourceRevision, commitStateCanceled,
+			fmt.Sprintf("The pull request to %s is no longer tracked", objs.to.Name))
+		return
+	}
+
+	state, err := objs.toProvider.getPullRequestState(ctx, pr.Number)
+	if err != nil {
+		log.Error(err, "Failed to get state of pull request")
+		r.Recorder.Eventf(promotion, corev1.EventTypeWarning, "ReportFailed", "Failed to get state of pull request %s: %s", pr.URL, err)
+		return
+	}
+	switch state {
+	case pullRequestMerged:
+		// The pull request is tracked until its version has been recorded
+		if err := r.recordPromotedVersion(ctx, promotion, pr.Version); err != nil {
+			log.Error(err, "Failed to record version of merged pull request")
+			r.Recorder.Eventf(promotion, corev1.EventTypeWarning, "RecordFailed", "Failed to record version of merged pull request %s: %s", pr.URL, err)
+			return
+		}
+		if pr.Version != "" {
+			promotion.Status.LastPromotedVersion = pr.Version
 		}
+		log.Info("Pull request has been merged")
+		promotion.Status.PullRequest = nil
+		r.Recorder.Eventf(promotion, corev1.EventTypeNormal, "PullRequestMerged",
+			"Pull request %s of source revision %s has been merged", pr.URL, pr.SourceRevision)
+		r.reportDeployment(ctx, promotion, objs, pr.SourceRevision)
+	case pullRequestClosed:
+		log.Info("Pull request has been closed without merging")
+		promotion.Status.PullRequest = nil
+		r.Recorder.Eventf(promotion, corev1.EventTypeWarning, "PullRequestClosed",
+			"Pull request %s of source revision %s has been closed without merging", pr.URL, pr.SourceRevision)
+		r.reportCommitStatus(ctx, promotion, objs, pr.SourceRevision, commitStateFailure,
+			fmt.Sprintf("The pull request to %s has been closed without merging", objs.to.Name))
+	}
+}
+
+// reportCommitStatus sets the status of the promotion on the source commit,
+// if the source Environment has a Git provider. Failures are recorded as
+// events, as they do not affect the promotion.
+func (r *PromotionReconciler) reportCommitStatus(ctx context.Context, promotion *apiv1alpha1.Promotion, objs *promotionObjects, sha string, state commitState, description string) {
+	if objs.fromProvider == nil {
+		return
+	}
+	status := commitStatus{state: state, context: "promotion/" + objs.to.Name, description: description}
+	if err := objs.fromProvider.setCommitStatus(ctx, sha, status); err != nil {
+		log.FromContext(ctx).Error(err, "Failed to set commit status")
+		r.Recorder.Eventf(promotion, corev1.EventTypeWarning, "ReportFailed", "Failed to set commit status on %s: %s", sha, err)
+	}
+}
+
+// reportDeployment sets a successful commit status and creates a deployment
+// of the source commit to the destination environment, if the source
+// Environment has a Git provider.
+func (r *PromotionReconciler) reportDeployment(ctx context.Context, promotion *apiv1alpha1.Promotion, objs *promotionObjects, sha string) {
+	if objs.fromProvider == nil {
+		return
+	}
+	description := fmt.Sprintf("Promoted to %s", objs.to.Name)
+	r.reportCommitStatus(ctx, promotion, objs, sha, commitStateSuccess, description)
+
+	d := deployment{sha: sha, ref: objs.from.Spec.Source.GetBranch(), environment: objs.to.Name, description: description}
+	if err := objs.fromProvider.createDeployment(ctx, d); err != nil {
+		log.FromContext(ctx).Error(err, "Failed to create deployment")
+		r.Recorder.Eventf(promotion, corev1.EventTypeWarning, "ReportFailed", "Failed to create deployment of %s: %s", sha, err)
+	}
+}
+
+// pushPromotion clones the environments, applies the PromotionTemplate and
+// pushes the resulting commit. With the pull-request strategy the commit is pushed
+// to a dedicated branch instead of the destination environment's branch, and a
+// pull request of the branch is opened with the destination's provider.
+// It records the promoted source revision, the resulting target revision,
+// the key the commit has been signed with and the URL of the pull request,
+// which is tracked in the status until it has been merged or closed.
+func (r *PromotionReconciler) pushPromotion(ctx context.Context, promotion *apiv1alpha1.Promotion, objs *promotionObjects, record *apiv1alpha1.PromotionRecord) error {
+	if objs.fromOCI != nil {
+		return r.pushOCIPromotion(ctx, promotion, objs, record)
+	}
+
+	from, err := objs.checkoutSource(ctx)
+	if err != nil {
+		return err
+	}
+	defer from.Close()
+
+	sourceRevision, err := from.revision()
+	if err != nil {
+		return err
 	}
+	record.SourceRevision = sourceRevision
+	// The source environment may have moved on since its revision has been approved
+	if err := engine.RequireApproval(promotion, sourceRevision); err != nil {
+		return err
+	}
+	if err := verifySource(ctx, from, objs.fromVerifier); err != nil {
+		return err
+	}
+	if record.Version, err = objs.checkVersionPolicy(from, sourceRevision); err != nil {
+		return err
+	}
+	from.SOPSKeys = objs.fromSOPSKeys
+
+	to, err := cloneEnvironment(ctx, objs.to, objs.toAuth)
+	if err != nil {
+		return err
+	}
+	defer to.Close()
+	to.signer = objs.toSigner
+	to.SOPSKeys = objs.toSOPSKeys
 
-	promotion.Status.Conditions = afterConditions
+	changes, err := objs.applyTemplate(from, to)
+	if err != nil {
+		return err
+	}
+	log.FromContext(ctx).V(1).Info("Applied PromotionTemplate",
+		"added", len(changes.Added), "modified", len(changes.Modified), "deleted", len(changes.Deleted))
 
-	err := r.Status().Update(ctx, promotion, &client.SubResourceUpdateOptions{})
+	message := fmt.Sprintf("Promote %s to %s\n\nSource revision: %s\nPromotion: %s/%s",
+		objs.from.Name, objs.to.Name, sourceRevision, promotion.Namespace, promotion.Name)
+	targetRevision, changed, err := to.commit(message)
 	if err != nil {
-		fmt.Printf("error updating status of resource: %v\n", err)
 		return err
 	}
+	if !changed {
+		log.FromContext(ctx).Info("Destination environment is already up to date", "targetRevision", targetRevision)
+		record.TargetRevision = targetRevision
+		return nil
+	}
+
+	branch := objs.to.Spec.Source.GetBranch()
+	if promotion.Spec.Strategy.PullRequest {
+		branch = promotionBranch(promotion)
+	}
+	if err := to.push(ctx, branch); err != nil {
+		return err
+	}
+	record.TargetRevision = targetRevision
+	if objs.toSigner != nil {
+		record.SigningKeyFingerprint = objs.toSigner.fingerprint()
+	}
+
+	log.FromContext(ctx).Info("Pushed promotion commit", "targetRevision", targetRevision, "branch", branch)
+	if promotion.Spec.Strategy.PullRequest {
+		pr := &pullRequest{
+			head:  branch,
+			base:  objs.to.Spec.Source.GetBranch(),
+			title: fmt.Sprintf("Promote %s to %s", objs.from.Name, objs.to.Name),
+			description: fmt.Sprintf("Promotes source revision %s of environment %s.\n\nPromotion: %s/%s",
+				sourceRevision, objs.from.Name, promotion.Namespace, promotion.Name),
+		}
+		if err := objs.toProvider.openPullRequest(ctx, pr); err != nil {
+			return fmt.Errorf("failed to open pull request of branch %s: %w", branch, err)
+		}
+		record.PullRequestURL = pr.url
+		promotion.Status.PullRequest = &apiv1alpha1.PullRequestStatus{
+			URL:            pr.url,
+			Number:         pr.number,
+			SourceRevision: sourceRevision,
+			Version:        record.Version,
+		}
+		if pr.opened {
+			log.FromContext(ctx).Info("Opened pull request", "url", pr.url)
+			r.notify(ctx, promotion, apiv1alpha1.PullRequestOpenedEvent, record,
+				fmt.Sprintf("Opened pull request %s of branch %s into environment %s", pr.url, branch, objs.to.Name))
+		} else {
+			log.FromContext(ctx).Info("Updated open pull request", "url", pr.url)
+		}
+	}
+	if sourceTime, err := from.headTime(); err == nil {
+		promotionLeadTime.WithLabelValues(environmentLabels(promotion)...).Observe(time.Since(sourceTime).Seconds())
+	}
+	r.Recorder.Eventf(promotion, corev1.EventTypeNormal, "Committed",
+		"Pushed commit %s for source revision %s to branch %s of environment %s", targetRevision, sourceRevision, branch, objs.to.Name)
 
-	return err
+	return nil
+}
+
+// promotionBranch returns the branch the pull-request strategy pushes to.
+func promotionBranch(promotion *apiv1alpha1.Promotion) string {
+	return "promotion/" + promotion.Name
+}
+
+// updateStatus persists the status of the Promotion, if it changed.
+func (r *PromotionReconciler) updateStatus(ctx context.Context, promotion *apiv1alpha1.Promotion, before *apiv1alpha1.PromotionStatus) error {
+	if equality.Semantic.DeepEqual(before, &promotion.Status) {
+		return nil
+	}
+
+	return r.Status().Update(ctx, promotion, &client.SubResourceUpdateOptions{})
 }
 
 // SetupWithManager sets up the controller with the Manager.
 func (r *PromotionReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	r.notifications = newNotificationDispatcher()
+	if err := mgr.Add(r.notifications); err != nil {
+		return err
+	}
+
 	return ctrl.NewControllerManagedBy(mgr).
 		For(&apiv1alpha1.Promotion{}).
+		Watches(
+			&source.Kind{Type: &apiv1alpha1.ReferenceGrant{}},
+			handler.EnqueueRequestsFromMapFunc(r.promotionsForReferenceGrant),
+		).
 		Complete(r)
 }
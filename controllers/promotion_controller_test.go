@@ -0,0 +1,971 @@
+/*
+Copyright 2023 Thomas Stadler <thomas@thomasst.xyz>.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	dto "github.com/prometheus/client_model/go"
+	"golang.org/x/crypto/ssh"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	apiv1alpha1 "github.com/thomasstxyz/release-promotion-operator/api/v1alpha1"
+	engine "github.com/thomasstxyz/release-promotion-operator/pkg/promotion"
+)
+
+var _ = Describe("Promotions of Git environments", func() {
+	var (
+		ctx       context.Context
+		dev, prod *testRepository
+		objects   []client.Object
+		promotion *apiv1alpha1.Promotion
+		recorder  *record.FakeRecorder
+		r         *PromotionReconciler
+
+		reconcileAgain func() (*apiv1alpha1.Promotion, error)
+	)
+
+	newReconciler := func() *PromotionReconciler {
+		scheme := runtime.NewScheme()
+		Expect(apiv1alpha1.AddToScheme(scheme)).To(Succeed())
+		Expect(corev1.AddToScheme(scheme)).To(Succeed())
+		return &PromotionReconciler{
+			Client:   fake.NewClientBuilder().WithScheme(scheme).WithObjects(objects...).Build(),
+			Scheme:   scheme,
+			Recorder: recorder,
+
+			ClusterResourceNamespace: "release-promotion-operator-system",
+		}
+	}
+
+	// notifications returns the events queued for delivery since the last call.
+	notifications := func() []promotionEvent {
+		var events []promotionEvent
+		for {
+			select {
+			case n := <-r.notifications.queue:
+				events = append(events, n.event)
+			default:
+				return events
+			}
+		}
+	}
+
+	// reconcilePromotion stores the Promotion, reconciles it with a new
+	// reconciler and returns the reconciled Promotion.
+	reconcilePromotion := func() (*apiv1alpha1.Promotion, error) {
+		objects = append(objects, promotion)
+		r = newReconciler()
+		r.RESTConfig = &rest.Config{}
+		r.notifications = newNotificationDispatcher()
+		return reconcileAgain()
+	}
+
+	// reconcileAgain reconciles the stored Promotion again with the same reconciler.
+	reconcileAgain = func() (*apiv1alpha1.Promotion, error) {
+		_, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: client.ObjectKeyFromObject(promotion)})
+		reconciled := &apiv1alpha1.Promotion{}
+		Expect(r.Get(ctx, client.ObjectKeyFromObject(promotion), reconciled)).To(Succeed())
+		return reconciled, err
+	}
+
+	// events returns the events recorded since the last call.
+	events := func() []string {
+		var recorded []string
+		for {
+			select {
+			case event := <-recorder.Events:
+				recorded = append(recorded, event)
+			default:
+				return recorded
+			}
+		}
+	}
+
+	BeforeEach(func() {
+		ctx = context.Background()
+		dev = newTestRepository(map[string]string{
+			"dev/app/deployment.yaml": "image: podinfo:6.3.0\n",
+			"dev/app/service.yaml":    "port: 9898\n",
+		})
+		prod = newTestRepository(map[string]string{
+			"prod/app/deployment.yaml": "image: podinfo:6.2.0\n",
+			"prod/app/configmap.yaml":  "debug: false\n",
+		})
+
+		promotion = &apiv1alpha1.Promotion{
+			ObjectMeta: metav1.ObjectMeta{Name: "dev-to-prod", Namespace: "apps", Generation: 1},
+			Spec: apiv1alpha1.PromotionSpec{
+				FromSpec:    apiv1alpha1.FromSpec{EnvironmentRef: apiv1alpha1.EnvironmentReference{Name: "dev"}},
+				ToSpec:      apiv1alpha1.ToSpec{EnvironmentRef: apiv1alpha1.EnvironmentReference{Name: "prod"}},
+				TemplateRef: apiv1alpha1.TemplateRef{Name: "app"},
+			},
+		}
+		objects = []client.Object{
+			&apiv1alpha1.Environment{
+				ObjectMeta: metav1.ObjectMeta{Name: "dev", Namespace: "apps"},
+				Spec:       apiv1alpha1.EnvironmentSpec{Source: &apiv1alpha1.SourceSpec{URL: dev.url()}, Path: "dev"},
+			},
+			&apiv1alpha1.Environment{
+				ObjectMeta: metav1.ObjectMeta{Name: "prod", Namespace: "apps"},
+				Spec:       apiv1alpha1.EnvironmentSpec{Source: &apiv1alpha1.SourceSpec{URL: prod.url()}, Path: "prod"},
+			},
+			&apiv1alpha1.PromotionTemplate{
+				ObjectMeta: metav1.ObjectMeta{Name: "app", Namespace: "apps"},
+				Spec:       apiv1alpha1.PromotionTemplateSpec{CopySpec: []apiv1alpha1.CopyOperation{{Source: "app", Destination: "app"}}},
+			},
+		}
+		recorder = record.NewFakeRecorder(10)
+		r = newReconciler()
+	})
+
+	Context("dry runs", func() {
+		It("renders the diff without pushing", func() {
+			targetRevision := prod.head("master")
+
+			Expect(r.dryRun(ctx, promotion)).To(Succeed())
+			result := promotion.Status.DryRun
+			Expect(result).NotTo(BeNil())
+			Expect(result.ObservedGeneration).To(Equal(int64(1)))
+			Expect(result.SourceRevision).To(Equal(dev.head("master")))
+			Expect(result.TargetRevision).To(Equal(targetRevision))
+			Expect(result.Added).To(ConsistOf("prod/app/service.yaml"))
+			Expect(result.Modified).To(ConsistOf("prod/app/deployment.yaml"))
+			Expect(result.Deleted).To(ConsistOf("prod/app/configmap.yaml"))
+			Expect(result.LinesAdded).To(Equal(2))
+			Expect(result.LinesDeleted).To(Equal(2))
+			Expect(result.Patch).To(ContainSubstring("+image: podinfo:6.3.0"))
+			Expect(result.PatchTruncated).To(BeFalse())
+
+			Expect(prod.head("master")).To(Equal(targetRevision))
+			Expect(recorder.Events).NotTo(Receive())
+		})
+
+		It("truncates the patch", func() {
+			dev.commit("Add a large ConfigMap", map[string]string{
+				"dev/app/configmap.yaml": strings.Repeat("debug: true\n", apiv1alpha1.MaxDryRunPatchSize),
+			})
+
+			Expect(r.dryRun(ctx, promotion)).To(Succeed())
+			result := promotion.Status.DryRun
+			Expect(result.Modified).To(ConsistOf("prod/app/deployment.yaml", "prod/app/configmap.yaml"))
+			Expect(result.LinesAdded).To(Equal(apiv1alpha1.MaxDryRunPatchSize + 2))
+			Expect(result.Patch).To(HaveLen(apiv1alpha1.MaxDryRunPatchSize))
+			Expect(result.PatchTruncated).To(BeTrue())
+		})
+
+		It("renders the dry run again for new source revisions", func() {
+			Expect(r.dryRun(ctx, promotion)).To(Succeed())
+
+			revision := dev.commit("Release podinfo 6.4.0", map[string]string{"dev/app/deployment.yaml": "image: podinfo:6.4.0\n"})
+			Expect(r.dryRun(ctx, promotion)).To(Succeed())
+			Expect(promotion.Status.DryRun.SourceRevision).To(Equal(revision))
+			Expect(promotion.Status.DryRun.Patch).To(ContainSubstring("+image: podinfo:6.4.0"))
+		})
+
+		It("renders the dry run again when requested", func() {
+			Expect(r.dryRun(ctx, promotion)).To(Succeed())
+			rendered := promotion.Status.DryRun
+			Expect(rendered.RequestedAt).To(BeEmpty())
+
+			By("keeping the dry run if nothing changed")
+			Expect(r.dryRun(ctx, promotion)).To(Succeed())
+			Expect(promotion.Status.DryRun).To(BeIdenticalTo(rendered))
+
+			promotion.Annotations = map[string]string{apiv1alpha1.DryRunRequestedAtAnnotation: "2023-03-01T09:00:00Z"}
+			Expect(r.dryRun(ctx, promotion)).To(Succeed())
+			Expect(promotion.Status.DryRun).NotTo(BeIdenticalTo(rendered))
+			Expect(promotion.Status.DryRun.RequestedAt).To(Equal("2023-03-01T09:00:00Z"))
+			Expect(promotion.Status.DryRun.SourceRevision).To(Equal(rendered.SourceRevision))
+			Expect(promotion.Status.DryRun.Patch).To(Equal(rendered.Patch))
+		})
+
+		It("reports no changes if the destination is up to date", func() {
+			prod.commit("Promote podinfo 6.3.0", map[string]string{
+				"prod/app/deployment.yaml": "image: podinfo:6.3.0\n",
+				"prod/app/service.yaml":    "port: 9898\n",
+			})
+			Expect(r.dryRun(ctx, promotion)).To(Succeed())
+			Expect(promotion.Status.DryRun.Added).To(BeEmpty())
+			Expect(promotion.Status.DryRun.Modified).To(BeEmpty())
+			Expect(promotion.Status.DryRun.Patch).NotTo(ContainSubstring("podinfo"))
+		})
+
+		It("rejects copy operations escaping the environment's repository", func() {
+			template := objects[2].(*apiv1alpha1.PromotionTemplate)
+			template.Spec.CopySpec = []apiv1alpha1.CopyOperation{{Source: "../../..", Destination: "app"}}
+			r = newReconciler()
+
+			Expect(r.dryRun(ctx, promotion)).To(MatchError(ContainSubstring("escapes the repository of environment dev")))
+			Expect(promotion.Status.DryRun).To(BeNil())
+		})
+	})
+
+	Context("conditions", func() {
+		It("marks the Promotion as ready once promoted", func() {
+			reconciled, err := reconcilePromotion()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(reconciled.Status.ObservedGeneration).To(Equal(int64(1)))
+			ready := meta.FindStatusCondition(reconciled.Status.Conditions, apiv1alpha1.ReadyCondition)
+			Expect(ready).NotTo(BeNil())
+			Expect(ready.Status).To(Equal(metav1.ConditionTrue))
+			Expect(ready.Reason).To(Equal(apiv1alpha1.PromotionSucceededReason))
+			Expect(ready.Message).To(Equal("Promoted source revision " + dev.head("master")))
+			Expect(ready.ObservedGeneration).To(Equal(int64(1)))
+			Expect(meta.FindStatusCondition(reconciled.Status.Conditions, apiv1alpha1.ReconcilingCondition)).To(BeNil())
+			Expect(meta.FindStatusCondition(reconciled.Status.Conditions, apiv1alpha1.StalledCondition)).To(BeNil())
+		})
+
+		It("keeps the conditions if nothing changed", func() {
+			reconciled, err := reconcilePromotion()
+			Expect(err).NotTo(HaveOccurred())
+
+			again, err := reconcileAgain()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(again.ResourceVersion).To(Equal(reconciled.ResourceVersion))
+			Expect(again.Status.Conditions).To(Equal(reconciled.Status.Conditions))
+		})
+
+		It("retries transient errors while reconciling", func() {
+			objects[1].(*apiv1alpha1.Environment).Spec.Source.URL = "file://" + GinkgoT().TempDir() + "/missing"
+
+			reconciled, err := reconcilePromotion()
+			Expect(err).To(MatchError(ContainSubstring("failed to clone")))
+			ready := meta.FindStatusCondition(reconciled.Status.Conditions, apiv1alpha1.ReadyCondition)
+			Expect(ready.Status).To(Equal(metav1.ConditionFalse))
+			Expect(ready.Reason).To(Equal(apiv1alpha1.PromotionFailedReason))
+			Expect(meta.IsStatusConditionTrue(reconciled.Status.Conditions, apiv1alpha1.ReconcilingCondition)).To(BeTrue())
+			Expect(meta.FindStatusCondition(reconciled.Status.Conditions, apiv1alpha1.StalledCondition)).To(BeNil())
+			Expect(recorder.Events).To(Receive(HavePrefix("Warning PromotionFailed")))
+		})
+
+		It("stalls on errors which require a change", func() {
+			promotion.Spec.Strategy.PullRequest = true
+
+			reconciled, err := reconcilePromotion()
+			Expect(err).To(HaveOccurred())
+			stalled := meta.FindStatusCondition(reconciled.Status.Conditions, apiv1alpha1.StalledCondition)
+			Expect(stalled).NotTo(BeNil())
+			Expect(stalled.Status).To(Equal(metav1.ConditionTrue))
+			Expect(stalled.Reason).To(Equal(apiv1alpha1.PromotionFailedReason))
+			Expect(stalled.Message).To(Equal("the pull-request strategy requires a provider on environment prod to open pull requests with"))
+			Expect(meta.FindStatusCondition(reconciled.Status.Conditions, apiv1alpha1.ReconcilingCondition)).To(BeNil())
+			Expect(recorder.Events).To(Receive(HavePrefix("Warning PromotionFailed")))
+		})
+
+		It("stops stalling once a changed spec waits for the trigger", func() {
+			sourceRevision := dev.head("master")
+			reconciled, err := reconcilePromotion()
+			Expect(err).NotTo(HaveOccurred())
+
+			reconciled.Generation = 2
+			reconciled.Spec.Trigger = &apiv1alpha1.Trigger{Type: apiv1alpha1.ScheduleTrigger, Schedule: "every monday"}
+			Expect(r.Update(ctx, reconciled)).To(Succeed())
+			reconciled, err = reconcileAgain()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(meta.IsStatusConditionTrue(reconciled.Status.Conditions, apiv1alpha1.StalledCondition)).To(BeTrue())
+
+			reconciled.Generation = 3
+			reconciled.Spec.Trigger = &apiv1alpha1.Trigger{Type: apiv1alpha1.ManualTrigger}
+			Expect(r.Update(ctx, reconciled)).To(Succeed())
+			reconciled, err = reconcileAgain()
+			Expect(err).NotTo(HaveOccurred())
+			ready := meta.FindStatusCondition(reconciled.Status.Conditions, apiv1alpha1.ReadyCondition)
+			Expect(ready.Status).To(Equal(metav1.ConditionTrue))
+			Expect(ready.Reason).To(Equal(apiv1alpha1.WaitingForTriggerReason))
+			Expect(ready.Message).To(HaveSuffix("the last promotion of source revision " + sourceRevision + " succeeded"))
+			Expect(ready.ObservedGeneration).To(Equal(int64(3)))
+			Expect(meta.FindStatusCondition(reconciled.Status.Conditions, apiv1alpha1.StalledCondition)).To(BeNil())
+			Expect(meta.FindStatusCondition(reconciled.Status.Conditions, apiv1alpha1.ReconcilingCondition)).To(BeNil())
+		})
+
+		It("stops stalling once the reference is granted while waiting for the trigger", func() {
+			promotion.Spec.FromSpec.EnvironmentRef.Namespace = "team-dev"
+			promotion.Spec.Trigger = &apiv1alpha1.Trigger{Type: apiv1alpha1.ManualTrigger}
+			reconciled, err := reconcilePromotion()
+			Expect(err).NotTo(HaveOccurred())
+			stalled := meta.FindStatusCondition(reconciled.Status.Conditions, apiv1alpha1.StalledCondition)
+			Expect(stalled).NotTo(BeNil())
+			Expect(stalled.Reason).To(Equal(apiv1alpha1.ReferenceNotGrantedReason))
+
+			Expect(r.Create(ctx, &apiv1alpha1.ReferenceGrant{
+				ObjectMeta: metav1.ObjectMeta{Name: "apps", Namespace: "team-dev"},
+				Spec: apiv1alpha1.ReferenceGrantSpec{
+					From: []apiv1alpha1.ReferenceGrantFrom{{Namespace: "apps"}},
+					To:   []apiv1alpha1.ReferenceGrantTo{{Kind: apiv1alpha1.EnvironmentKind, Name: "dev"}},
+				},
+			})).To(Succeed())
+			reconciled, err = reconcileAgain()
+			Expect(err).NotTo(HaveOccurred())
+			ready := meta.FindStatusCondition(reconciled.Status.Conditions, apiv1alpha1.ReadyCondition)
+			Expect(ready.Status).To(Equal(metav1.ConditionTrue))
+			Expect(ready.Reason).To(Equal(apiv1alpha1.WaitingForTriggerReason))
+			Expect(meta.FindStatusCondition(reconciled.Status.Conditions, apiv1alpha1.StalledCondition)).To(BeNil())
+		})
+
+		It("summarizes the unready objects in a single line", func() {
+			promotion.Spec.ReadinessChecks.LocalObjectsRef = []apiv1alpha1.LocalObjectsRef{
+				{GroupVersionResource: metav1.GroupVersionResource{Version: "v1", Resource: "deployments"}, Name: "podinfo"},
+				{GroupVersionResource: metav1.GroupVersionResource{Version: "v1", Resource: "services"}, Name: "podinfo", Namespace: "team-dev"},
+			}
+			unready := []apiv1alpha1.UnreadyObject{
+				{LocalObjectsRef: promotion.Spec.ReadinessChecks.LocalObjectsRef[0], Status: "InProgress"},
+				{LocalObjectsRef: promotion.Spec.ReadinessChecks.LocalObjectsRef[1], Status: "Failed"},
+			}
+			Expect(unreadyMessage(promotion, unready)).To(Equal(
+				"2 of 2 dependent objects are not ready: deployments/podinfo, services/team-dev/podinfo"))
+		})
+	})
+
+	Context("events", func() {
+		It("records the commit and the promotion", func() {
+			sourceRevision := dev.head("master")
+
+			reconciled, err := reconcilePromotion()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(events()).To(Equal([]string{
+				fmt.Sprintf("Normal Committed Pushed commit %s for source revision %s to branch master of environment prod",
+					reconciled.Status.LastTargetRevision, sourceRevision),
+				"Normal PromotionSucceeded Promoted source revision " + sourceRevision,
+			}))
+
+			_, err = reconcileAgain()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(events()).To(BeEmpty())
+		})
+
+		It("records failures as warnings once", func() {
+			objects[1].(*apiv1alpha1.Environment).Spec.Source.URL = "file://" + GinkgoT().TempDir() + "/missing"
+
+			_, err := reconcilePromotion()
+			Expect(err).To(HaveOccurred())
+			recorded := events()
+			Expect(recorded).To(HaveLen(1))
+			Expect(recorded[0]).To(HavePrefix("Warning PromotionFailed failed to clone"))
+
+			_, err = reconcileAgain()
+			Expect(err).To(HaveOccurred())
+			Expect(events()).To(BeEmpty())
+		})
+
+		It("records source revisions waiting for approval", func() {
+			sourceRevision := dev.head("master")
+			targetRevision := prod.head("master")
+			promotion.Spec.RequireApproval = true
+			objects = append(objects, &apiv1alpha1.PromotionNotifier{
+				ObjectMeta: metav1.ObjectMeta{Name: "blocked", Namespace: "apps"},
+				Spec: apiv1alpha1.PromotionNotifierSpec{
+					Type:    apiv1alpha1.GenericProvider,
+					Address: "https://hooks.example.com",
+					Events:  []apiv1alpha1.PromotionEventType{apiv1alpha1.PromotionBlockedEvent},
+				},
+			})
+
+			_, err := reconcilePromotion()
+			Expect(err).NotTo(HaveOccurred())
+			message := (&engine.ApprovalRequiredError{Revision: sourceRevision}).Error()
+			Expect(events()).To(Equal([]string{"Normal WaitingForApproval " + message}))
+			Expect(prod.head("master")).To(Equal(targetRevision))
+
+			blocked := notifications()
+			Expect(blocked).To(HaveLen(1))
+			Expect(blocked[0].Type).To(Equal(apiv1alpha1.PromotionBlockedEvent))
+			Expect(blocked[0].Message).To(Equal(message))
+		})
+	})
+
+	Context("ClusterEnvironment destinations", func() {
+		BeforeEach(func() {
+			promotion.Spec.ToSpec.EnvironmentRef = apiv1alpha1.EnvironmentReference{Kind: apiv1alpha1.ClusterEnvironmentKind, Name: "prod"}
+			objects = append(objects, &apiv1alpha1.ClusterEnvironment{
+				ObjectMeta: metav1.ObjectMeta{Name: "prod"},
+				Spec:       apiv1alpha1.EnvironmentSpec{Source: &apiv1alpha1.SourceSpec{URL: prod.url()}, Path: "prod"},
+			})
+		})
+
+		// grant returns a ReferenceGrant in the namespace, which permits
+		// the apps namespace to promote to the prod ClusterEnvironment.
+		grant := func(namespace string) *apiv1alpha1.ReferenceGrant {
+			return &apiv1alpha1.ReferenceGrant{
+				ObjectMeta: metav1.ObjectMeta{Name: "apps", Namespace: namespace},
+				Spec: apiv1alpha1.ReferenceGrantSpec{
+					From: []apiv1alpha1.ReferenceGrantFrom{{Namespace: "apps"}},
+					To:   []apiv1alpha1.ReferenceGrantTo{{Kind: apiv1alpha1.ClusterEnvironmentKind, Name: "prod"}},
+				},
+			}
+		}
+
+		It("denies promoting to a ClusterEnvironment without a ReferenceGrant", func() {
+			targetRevision := prod.head("master")
+			objects = append(objects, grant("apps"))
+
+			reconciled, err := reconcilePromotion()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(prod.head("master")).To(Equal(targetRevision))
+
+			message := "promoting to ClusterEnvironment prod is not granted to namespace apps by any ReferenceGrant in namespace release-promotion-operator-system"
+			ready := meta.FindStatusCondition(reconciled.Status.Conditions, apiv1alpha1.ReadyCondition)
+			Expect(ready).NotTo(BeNil())
+			Expect(ready.Reason).To(Equal(apiv1alpha1.ReferenceNotGrantedReason))
+			Expect(ready.Message).To(Equal(message))
+			Expect(meta.IsStatusConditionTrue(reconciled.Status.Conditions, apiv1alpha1.StalledCondition)).To(BeTrue())
+			Expect(testutil.ToFloat64(promotionBlocked.WithLabelValues("apps", "dev-to-prod"))).To(Equal(1.0))
+			Expect(events()).To(Equal([]string{"Warning ReferenceNotGranted " + message}))
+		})
+
+		It("promotes to a ClusterEnvironment granted in the cluster resource namespace", func() {
+			targetRevision := prod.head("master")
+			objects = append(objects, grant("release-promotion-operator-system"))
+
+			reconciled, err := reconcilePromotion()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(meta.IsStatusConditionTrue(reconciled.Status.Conditions, apiv1alpha1.ReadyCondition)).To(BeTrue())
+			Expect(prod.head("master")).NotTo(Equal(targetRevision))
+		})
+
+		It("reconciles Promotions when their ClusterEnvironment is granted", func() {
+			objects = append(objects, promotion)
+			r = newReconciler()
+
+			Expect(r.promotionsForReferenceGrant(grant("apps"))).To(BeEmpty())
+			Expect(r.promotionsForReferenceGrant(grant("release-promotion-operator-system"))).To(ConsistOf(
+				ctrl.Request{NamespacedName: client.ObjectKeyFromObject(promotion)},
+			))
+		})
+	})
+
+	Context("version policies", func() {
+		// withLastPromotedVersion records the version as last promoted to prod.
+		withLastPromotedVersion := func(version string) {
+			objects[1].(*apiv1alpha1.Environment).Status.LastPromotedVersion = version
+			r = newReconciler()
+		}
+
+		// lastPromotedVersion returns the version recorded on prod.
+		lastPromotedVersion := func() string {
+			env := &apiv1alpha1.Environment{}
+			Expect(r.Get(ctx, client.ObjectKey{Namespace: "apps", Name: "prod"}, env)).To(Succeed())
+			return env.Status.LastPromotedVersion
+		}
+
+		BeforeEach(func() {
+			objects[1].(*apiv1alpha1.Environment).Spec.VersionPolicy = &apiv1alpha1.VersionPolicy{
+				Source:      apiv1alpha1.VersionSource{File: "app/deployment.yaml", Pattern: `podinfo:(\S+)`},
+				NoDowngrade: true,
+			}
+			r = newReconciler()
+		})
+
+		It("records the promoted version on the destination environment", func() {
+			Expect(r.promote(ctx, promotion)).To(Succeed())
+			Expect(promotion.Status.History[0].Version).To(Equal("6.3.0"))
+			Expect(promotion.Status.LastPromotedVersion).To(Equal("6.3.0"))
+			Expect(lastPromotedVersion()).To(Equal("6.3.0"))
+		})
+
+		It("rejects downgrades from the version recorded on the destination environment", func() {
+			targetRevision := prod.head("master")
+			withLastPromotedVersion("6.4.0")
+
+			err := r.promote(ctx, promotion)
+			Expect(err).To(MatchError(`version "6.3.0" violates the version policy of environment prod: downgrade from 6.4.0`))
+			Expect(blockedByVersionPolicy(promotion, err)).To(BeTrue())
+			Expect(prod.head("master")).To(Equal(targetRevision))
+			Expect(lastPromotedVersion()).To(Equal("6.4.0"))
+		})
+
+		It("rejects all versions if the recorded version is not a semantic version", func() {
+			targetRevision := prod.head("master")
+			withLastPromotedVersion("latest")
+
+			err := r.promote(ctx, promotion)
+			Expect(err).To(MatchError(ContainSubstring(`the last promoted version "latest" is not a semantic version`)))
+			Expect(blockedByVersionPolicy(promotion, err)).To(BeTrue())
+			Expect(prod.head("master")).To(Equal(targetRevision))
+		})
+	})
+
+	Context("metrics", func() {
+		var labels []string
+
+		// sampleCount returns the number of observations of the histogram.
+		sampleCount := func(observer prometheus.Observer) uint64 {
+			metric := &dto.Metric{}
+			Expect(observer.(prometheus.Metric).Write(metric)).To(Succeed())
+			return metric.GetHistogram().GetSampleCount()
+		}
+
+		BeforeEach(func() {
+			labels = environmentLabels(promotion)
+		})
+
+		It("counts successful promotions and observes their lead time", func() {
+			started := testutil.ToFloat64(promotionsStarted.WithLabelValues(labels...))
+			succeeded := testutil.ToFloat64(promotionsCompleted.WithLabelValues(append(labels, "Succeeded")...))
+			failed := testutil.ToFloat64(promotionsCompleted.WithLabelValues(append(labels, "Failed")...))
+			leadTimes := sampleCount(promotionLeadTime.WithLabelValues(labels...))
+			readinessChecks := sampleCount(readinessCheckDuration.WithLabelValues("apps", "dev-to-prod"))
+			clones := sampleCount(gitOperationDuration.WithLabelValues("clone"))
+			pushes := sampleCount(gitOperationDuration.WithLabelValues("push"))
+
+			_, err := reconcilePromotion()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(testutil.ToFloat64(promotionsStarted.WithLabelValues(labels...))).To(Equal(started + 1))
+			Expect(testutil.ToFloat64(promotionsCompleted.WithLabelValues(append(labels, "Succeeded")...))).To(Equal(succeeded + 1))
+			Expect(testutil.ToFloat64(promotionsCompleted.WithLabelValues(append(labels, "Failed")...))).To(Equal(failed))
+			Expect(sampleCount(promotionLeadTime.WithLabelValues(labels...))).To(Equal(leadTimes + 1))
+			Expect(sampleCount(readinessCheckDuration.WithLabelValues("apps", "dev-to-prod"))).To(Equal(readinessChecks + 1))
+			Expect(sampleCount(gitOperationDuration.WithLabelValues("clone"))).To(Equal(clones + 2))
+			Expect(sampleCount(gitOperationDuration.WithLabelValues("push"))).To(Equal(pushes + 1))
+			Expect(testutil.ToFloat64(promotionBlocked.WithLabelValues("apps", "dev-to-prod"))).To(BeZero())
+		})
+
+		It("counts failed promotions", func() {
+			objects[1].(*apiv1alpha1.Environment).Spec.Source.URL = "file://" + GinkgoT().TempDir() + "/missing"
+			started := testutil.ToFloat64(promotionsStarted.WithLabelValues(labels...))
+			succeeded := testutil.ToFloat64(promotionsCompleted.WithLabelValues(append(labels, "Succeeded")...))
+			failed := testutil.ToFloat64(promotionsCompleted.WithLabelValues(append(labels, "Failed")...))
+			leadTimes := sampleCount(promotionLeadTime.WithLabelValues(labels...))
+
+			_, err := reconcilePromotion()
+			Expect(err).To(HaveOccurred())
+			Expect(testutil.ToFloat64(promotionsStarted.WithLabelValues(labels...))).To(Equal(started + 1))
+			Expect(testutil.ToFloat64(promotionsCompleted.WithLabelValues(append(labels, "Succeeded")...))).To(Equal(succeeded))
+			Expect(testutil.ToFloat64(promotionsCompleted.WithLabelValues(append(labels, "Failed")...))).To(Equal(failed + 1))
+			Expect(sampleCount(promotionLeadTime.WithLabelValues(labels...))).To(Equal(leadTimes))
+			Expect(testutil.ToFloat64(promotionBlocked.WithLabelValues("apps", "dev-to-prod"))).To(BeZero())
+		})
+
+		It("flags blocked promotions until they are deleted", func() {
+			// The dependent object lives on a cluster which is never reachable
+			promotion.Spec.ReadinessChecks.LocalObjectsRef = []apiv1alpha1.LocalObjectsRef{
+				{GroupVersionResource: metav1.GroupVersionResource{Group: "apps", Version: "v1", Resource: "deployments"}, Name: "podinfo"},
+			}
+			started := testutil.ToFloat64(promotionsStarted.WithLabelValues(labels...))
+
+			_, err := reconcilePromotion()
+			Expect(err).To(HaveOccurred())
+			Expect(testutil.ToFloat64(promotionBlocked.WithLabelValues("apps", "dev-to-prod"))).To(Equal(1.0))
+			Expect(testutil.ToFloat64(promotionsStarted.WithLabelValues(labels...))).To(Equal(started))
+
+			Expect(r.Delete(ctx, promotion)).To(Succeed())
+			_, err = r.Reconcile(ctx, ctrl.Request{NamespacedName: client.ObjectKeyFromObject(promotion)})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(promotionBlocked.DeleteLabelValues("apps", "dev-to-prod")).To(BeFalse())
+			Expect(readinessCheckDuration.DeleteLabelValues("apps", "dev-to-prod")).To(BeFalse())
+		})
+
+		It("resets the blocked flag while waiting for the trigger", func() {
+			promotion.Spec.FromSpec.EnvironmentRef.Namespace = "team-dev"
+			promotion.Spec.Trigger = &apiv1alpha1.Trigger{Type: apiv1alpha1.ManualTrigger}
+
+			_, err := reconcilePromotion()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(testutil.ToFloat64(promotionBlocked.WithLabelValues("apps", "dev-to-prod"))).To(Equal(1.0))
+
+			Expect(r.Create(ctx, &apiv1alpha1.ReferenceGrant{
+				ObjectMeta: metav1.ObjectMeta{Name: "apps", Namespace: "team-dev"},
+				Spec: apiv1alpha1.ReferenceGrantSpec{
+					From: []apiv1alpha1.ReferenceGrantFrom{{Namespace: "apps"}},
+					To:   []apiv1alpha1.ReferenceGrantTo{{Kind: apiv1alpha1.EnvironmentKind, Name: "dev"}},
+				},
+			})).To(Succeed())
+			_, err = reconcileAgain()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(testutil.ToFloat64(promotionBlocked.WithLabelValues("apps", "dev-to-prod"))).To(BeZero())
+		})
+
+		It("flags promotions waiting for approval as blocked until approved", func() {
+			sourceRevision := dev.head("master")
+			promotion.Spec.RequireApproval = true
+
+			reconciled, err := reconcilePromotion()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(meta.FindStatusCondition(reconciled.Status.Conditions, apiv1alpha1.ReadyCondition).Reason).To(Equal(apiv1alpha1.WaitingForApprovalReason))
+			Expect(testutil.ToFloat64(promotionBlocked.WithLabelValues("apps", "dev-to-prod"))).To(Equal(1.0))
+
+			reconciled.Annotations = map[string]string{apiv1alpha1.ApprovedRevisionAnnotation: sourceRevision}
+			Expect(r.Update(ctx, reconciled)).To(Succeed())
+			reconciled, err = reconcileAgain()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(reconciled.Status.LastPromotedRevision).To(Equal(sourceRevision))
+			Expect(testutil.ToFloat64(promotionBlocked.WithLabelValues("apps", "dev-to-prod"))).To(BeZero())
+		})
+	})
+
+	Context("promotions", func() {
+		It("pushes the promotion to the branch of the destination", func() {
+			sourceRevision := dev.head("master")
+
+			Expect(r.promote(ctx, promotion)).To(Succeed())
+			Expect(promotion.Status.LastPromotedRevision).To(Equal(sourceRevision))
+			Expect(promotion.Status.LastTargetRevision).To(Equal(prod.head("master")))
+			Expect(promotion.Status.History).To(HaveLen(1))
+			record := promotion.Status.History[0]
+			Expect(record.Outcome).To(Equal(apiv1alpha1.PromotionSucceeded))
+			Expect(record.SourceRevision).To(Equal(sourceRevision))
+			Expect(record.TargetRevision).To(Equal(prod.head("master")))
+			Expect(record.PullRequestURL).To(BeEmpty())
+
+			commit := prod.commitObject(record.TargetRevision)
+			Expect(commit.Message).To(Equal("Promote dev to prod\n\nSource revision: " + sourceRevision + "\nPromotion: apps/dev-to-prod"))
+			file, err := commit.File("prod/app/deployment.yaml")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(file.Contents()).To(Equal("image: podinfo:6.3.0\n"))
+			Expect(prod.head(promotionBranch(promotion))).To(BeEmpty())
+			Expect(recorder.Events).To(Receive(ContainSubstring("Pushed commit " + record.TargetRevision)))
+		})
+
+		It("does not promote the same source revision again", func() {
+			Expect(r.promote(ctx, promotion)).To(Succeed())
+			targetRevision := prod.head("master")
+
+			Expect(r.promote(ctx, promotion)).To(Succeed())
+			Expect(promotion.Status.History).To(HaveLen(1))
+			Expect(prod.head("master")).To(Equal(targetRevision))
+		})
+
+		It("records failed promotions", func() {
+			sourceRevision := dev.head("master")
+			objects[1].(*apiv1alpha1.Environment).Spec.Source.URL = "file://" + GinkgoT().TempDir() + "/missing"
+			r = newReconciler()
+
+			Expect(r.promote(ctx, promotion)).To(MatchError(ContainSubstring("failed to clone")))
+			Expect(promotion.Status.LastAttemptedRevision).To(Equal(sourceRevision))
+			Expect(promotion.Status.LastAttemptTime).NotTo(BeNil())
+			Expect(promotion.Status.LastPromotedRevision).To(BeEmpty())
+			Expect(promotion.Status.History).To(HaveLen(1))
+			Expect(promotion.Status.History[0].Outcome).To(Equal(apiv1alpha1.PromotionFailed))
+			Expect(promotion.Status.History[0].Message).To(ContainSubstring("failed to clone"))
+		})
+
+		It("reads the credentials of the environments from their Secrets", func() {
+			objects[1].(*apiv1alpha1.Environment).Spec.Source.SecretRef = &apiv1alpha1.LocalObjectReference{Name: "git-credentials"}
+			r = newReconciler()
+
+			Expect(r.promote(ctx, promotion)).To(MatchError(ContainSubstring(`secrets "git-credentials" not found`)))
+
+			objects = append(objects, &corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{Name: "git-credentials", Namespace: "apps"},
+				Data:       map[string][]byte{"username": []byte("flux"), "password": []byte("s3cr3t")},
+			})
+			r = newReconciler()
+			Expect(r.promote(ctx, promotion)).To(Succeed())
+		})
+
+		Context("with a signing key", func() {
+			// useSigningKey signs the commits promoted to prod with the key in the Secret.
+			useSigningKey := func(data map[string][]byte) {
+				objects[1].(*apiv1alpha1.Environment).Spec.SigningKey = &apiv1alpha1.SigningKey{
+					SecretRef: apiv1alpha1.LocalObjectReference{Name: "signing-key"},
+				}
+				objects = append(objects, &corev1.Secret{
+					ObjectMeta: metav1.ObjectMeta{Name: "signing-key", Namespace: "apps"},
+					Data:       data,
+				})
+				r = newReconciler()
+			}
+
+			// signedCommit returns the promoted commit encoded without its signature, and the signature.
+			signedCommit := func() ([]byte, string) {
+				commit := prod.commitObject(prod.head("master"))
+				Expect(commit.PGPSignature).NotTo(BeEmpty())
+				data, err := encodeWithoutSignature(commit)
+				Expect(err).NotTo(HaveOccurred())
+				return data, commit.PGPSignature
+			}
+
+			It("signs the promoted commit with an OpenPGP key", func() {
+				entity := newOpenPGPKey()
+				useSigningKey(map[string][]byte{signingKeyPGPKey: armoredOpenPGPKey(entity, true)})
+
+				Expect(r.promote(ctx, promotion)).To(Succeed())
+				data, signature := signedCommit()
+				signer, err := openpgp.CheckArmoredDetachedSignature(openpgp.EntityList{entity},
+					bytes.NewReader(data), strings.NewReader(signature), nil)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(signer.PrimaryKey.Fingerprint).To(Equal(entity.PrimaryKey.Fingerprint))
+
+				Expect(promotion.Status.History).To(HaveLen(1))
+				Expect(promotion.Status.History[0].TargetRevision).To(Equal(prod.head("master")))
+				Expect(promotion.Status.History[0].SigningKeyFingerprint).To(Equal(openPGPFingerprint(entity)))
+			})
+
+			It("signs the promoted commit with an SSH key", func() {
+				identity, publicKey := newSSHSigningKey()
+				useSigningKey(map[string][]byte{signingKeySSHKey: identity})
+
+				Expect(r.promote(ctx, promotion)).To(Succeed())
+				verifier, err := commitVerifierFromSecret(&corev1.Secret{
+					Data: map[string][]byte{verificationAllowedSigners: allowedSigners(publicKey)},
+				})
+				Expect(err).NotTo(HaveOccurred())
+				Expect(verifier.verify(signedCommit())).To(Equal(ssh.FingerprintSHA256(publicKey)))
+
+				Expect(promotion.Status.History).To(HaveLen(1))
+				Expect(promotion.Status.History[0].SigningKeyFingerprint).To(Equal(ssh.FingerprintSHA256(publicKey)))
+			})
+
+			It("does not promote with an invalid signing key", func() {
+				targetRevision := prod.head("master")
+				useSigningKey(map[string][]byte{signingKeySSHKey: []byte("not a key")})
+
+				Expect(r.promote(ctx, promotion)).To(MatchError(ContainSubstring("invalid identity in Secret signing-key")))
+				Expect(prod.head("master")).To(Equal(targetRevision))
+			})
+		})
+
+		Context("with the pull-request strategy", func() {
+			var (
+				calls     []apiCall
+				responses map[string]string
+			)
+
+			// requests returns the recorded calls of the method to the path.
+			requests := func(method, path string) []apiCall {
+				var matching []apiCall
+				for _, call := range calls {
+					if call.method == method && call.path == path {
+						matching = append(matching, call)
+					}
+				}
+				return matching
+			}
+
+			// commitStatuses returns the states of the statuses reported on the source revision.
+			commitStatuses := func(sha string) []any {
+				var states []any
+				for _, call := range requests(http.MethodPost, "/repos/acme/dev/statuses/"+sha) {
+					states = append(states, call.body["state"])
+				}
+				return states
+			}
+
+			BeforeEach(func() {
+				calls = nil
+				responses = map[string]string{
+					"POST /repos/acme/prod/pulls":      `{"number": 7, "html_url": "https://github.com/acme/prod/pull/7"}`,
+					"GET /repos/acme/prod/pulls/7":     `{"state": "open", "merged": false}`,
+					"POST /repos/acme/dev/deployments": `{"id": 42}`,
+				}
+				api := newProviderAPI(&calls, responses)
+				promotion.Spec.Strategy.PullRequest = true
+				for i, repository := range []string{"acme/dev", "acme/prod"} {
+					objects[i].(*apiv1alpha1.Environment).Spec.Provider = &apiv1alpha1.GitProvider{
+						Type:       apiv1alpha1.GitHubProvider,
+						APIURL:     api.URL,
+						Repository: repository,
+						SecretRef:  apiv1alpha1.LocalObjectReference{Name: "github-token"},
+					}
+				}
+				objects = append(objects,
+					&corev1.Secret{
+						ObjectMeta: metav1.ObjectMeta{Name: "github-token", Namespace: "apps"},
+						Data:       map[string][]byte{"token": []byte("ghp_s3cr3t")},
+					},
+					&apiv1alpha1.PromotionNotifier{
+						ObjectMeta: metav1.ObjectMeta{Name: "pull-requests", Namespace: "apps"},
+						Spec: apiv1alpha1.PromotionNotifierSpec{
+							Type:    apiv1alpha1.GenericProvider,
+							Address: "https://hooks.example.com",
+							Events: []apiv1alpha1.PromotionEventType{
+								apiv1alpha1.PullRequestOpenedEvent, apiv1alpha1.PromotionSupersededEvent,
+							},
+						},
+					},
+				)
+				r = newReconciler()
+				r.notifications = newNotificationDispatcher()
+			})
+
+			It("opens a pull request of the promotion branch", func() {
+				targetRevision := prod.head("master")
+				sourceRevision := dev.head("master")
+
+				Expect(r.promote(ctx, promotion)).To(Succeed())
+				record := promotion.Status.History[0]
+				Expect(record.Outcome).To(Equal(apiv1alpha1.PromotionSucceeded))
+				Expect(record.PullRequestURL).To(Equal("https://github.com/acme/prod/pull/7"))
+				Expect(promotion.Status.PullRequest).To(Equal(&apiv1alpha1.PullRequestStatus{
+					URL: "https://github.com/acme/prod/pull/7", Number: 7, SourceRevision: sourceRevision,
+				}))
+				Expect(prod.head("master")).To(Equal(targetRevision))
+				Expect(prod.head(promotionBranch(promotion))).To(Equal(record.TargetRevision))
+
+				created := requests(http.MethodPost, "/repos/acme/prod/pulls")
+				Expect(created).To(HaveLen(1))
+				Expect(created[0].header.Get("Authorization")).To(Equal("Bearer ghp_s3cr3t"))
+				Expect(created[0].body).To(HaveKeyWithValue("head", "promotion/dev-to-prod"))
+				Expect(created[0].body).To(HaveKeyWithValue("base", "master"))
+				Expect(commitStatuses(sourceRevision)).To(Equal([]any{"pending", "pending"}))
+				Expect(requests(http.MethodPost, "/repos/acme/dev/deployments")).To(BeEmpty())
+
+				events := notifications()
+				Expect(events).To(HaveLen(1))
+				Expect(events[0].Type).To(Equal(apiv1alpha1.PullRequestOpenedEvent))
+				Expect(events[0].PullRequestURL).To(Equal("https://github.com/acme/prod/pull/7"))
+				Expect(events[0].TargetRevision).To(Equal(record.TargetRevision))
+				Expect(events[0].Message).To(Equal("Opened pull request https://github.com/acme/prod/pull/7 of branch promotion/dev-to-prod into environment prod"))
+			})
+
+			It("reports the deployment once the pull request has been merged", func() {
+				sourceRevision := dev.head("master")
+				Expect(r.promote(ctx, promotion)).To(Succeed())
+				Expect(recorder.Events).To(Receive(ContainSubstring("Committed")))
+
+				r.reconcilePullRequest(ctx, promotion)
+				Expect(promotion.Status.PullRequest).NotTo(BeNil())
+				Expect(requests(http.MethodPost, "/repos/acme/dev/deployments")).To(BeEmpty())
+
+				responses["GET /repos/acme/prod/pulls/7"] = `{"state": "closed", "merged": true}`
+				r.reconcilePullRequest(ctx, promotion)
+				Expect(promotion.Status.PullRequest).To(BeNil())
+				Expect(commitStatuses(sourceRevision)).To(Equal([]any{"pending", "pending", "success"}))
+				deployments := requests(http.MethodPost, "/repos/acme/dev/deployments")
+				Expect(deployments).To(HaveLen(1))
+				Expect(deployments[0].body).To(HaveKeyWithValue("ref", sourceRevision))
+				Expect(deployments[0].body).To(HaveKeyWithValue("environment", "prod"))
+				Expect(recorder.Events).To(Receive(Equal("Normal PullRequestMerged Pull request https://github.com/acme/prod/pull/7 of source revision " + sourceRevision + " has been merged")))
+			})
+
+			It("records the promoted version once the pull request has been merged", func() {
+				objects[1].(*apiv1alpha1.Environment).Spec.VersionPolicy = &apiv1alpha1.VersionPolicy{
+					Source: apiv1alpha1.VersionSource{File: "app/deployment.yaml", Pattern: `podinfo:(\S+)`},
+				}
+				r = newReconciler()
+				r.notifications = newNotificationDispatcher()
+				lastPromotedVersion := func() string {
+					env := &apiv1alpha1.Environment{}
+					Expect(r.Get(ctx, client.ObjectKey{Namespace: "apps", Name: "prod"}, env)).To(Succeed())
+					return env.Status.LastPromotedVersion
+				}
+
+				Expect(r.promote(ctx, promotion)).To(Succeed())
+				Expect(promotion.Status.PullRequest.Version).To(Equal("6.3.0"))
+				Expect(promotion.Status.LastPromotedVersion).To(BeEmpty())
+				Expect(lastPromotedVersion()).To(BeEmpty())
+
+				responses["GET /repos/acme/prod/pulls/7"] = `{"state": "closed", "merged": true}`
+				r.reconcilePullRequest(ctx, promotion)
+				Expect(promotion.Status.PullRequest).To(BeNil())
+				Expect(promotion.Status.LastPromotedVersion).To(Equal("6.3.0"))
+				Expect(lastPromotedVersion()).To(Equal("6.3.0"))
+			})
+
+			It("reports a failure if the pull request has been closed without merging", func() {
+				sourceRevision := dev.head("master")
+				Expect(r.promote(ctx, promotion)).To(Succeed())
+
+				responses["GET /repos/acme/prod/pulls/7"] = `{"state": "closed", "merged": false}`
+				r.reconcilePullRequest(ctx, promotion)
+				Expect(promotion.Status.PullRequest).To(BeNil())
+				Expect(commitStatuses(sourceRevision)).To(Equal([]any{"pending", "pending", "failure"}))
+				Expect(requests(http.MethodPost, "/repos/acme/dev/deployments")).To(BeEmpty())
+			})
+
+			It("updates the open pull request for new source revisions", func() {
+				previousRevision := dev.head("master")
+				Expect(r.promote(ctx, promotion)).To(Succeed())
+				Expect(notifications()).To(HaveLen(1))
+
+				sourceRevision := dev.commit("Release podinfo 6.4.0", map[string]string{"dev/app/deployment.yaml": "image: podinfo:6.4.0\n"})
+				responses["GET /repos/acme/prod/pulls"] = `[{"number": 7, "html_url": "https://github.com/acme/prod/pull/7"}]`
+
+				Expect(r.promote(ctx, promotion)).To(Succeed())
+				record := promotion.Status.History[0]
+				Expect(record.PullRequestURL).To(Equal("https://github.com/acme/prod/pull/7"))
+				Expect(promotion.Status.PullRequest.SourceRevision).To(Equal(sourceRevision))
+				Expect(prod.head(promotionBranch(promotion))).To(Equal(record.TargetRevision))
+				Expect(requests(http.MethodPost, "/repos/acme/prod/pulls")).To(HaveLen(1))
+				Expect(notifications()).To(BeEmpty())
+
+				// The pending status of the previous source revision is superseded
+				Expect(commitStatuses(previousRevision)).To(Equal([]any{"pending", "pending", "error"}))
+				Expect(commitStatuses(sourceRevision)).To(Equal([]any{"pending", "pending"}))
+			})
+
+			It("supersedes the promotion if the source moves on to a revision waiting for approval", func() {
+				approvedRevision := dev.head("master")
+				pendingRevision := dev.commit("Release podinfo 6.4.0", map[string]string{"dev/app/deployment.yaml": "image: podinfo:6.4.0\n"})
+				dev.setHead(approvedRevision)
+				dev.moveOnWhenCloned(pendingRevision)
+				promotion.Spec.RequireApproval = true
+				promotion.Annotations = map[string]string{apiv1alpha1.ApprovedRevisionAnnotation: approvedRevision}
+
+				err := r.promote(ctx, promotion)
+				var approvalErr *engine.ApprovalRequiredError
+				Expect(errors.As(err, &approvalErr)).To(BeTrue())
+				Expect(approvalErr.Revision).To(Equal(pendingRevision))
+				Expect(promotion.Status.PendingApprovalRevision).To(Equal(pendingRevision))
+				Expect(promotion.Status.History).To(HaveLen(1))
+				record := promotion.Status.History[0]
+				Expect(record.Outcome).To(Equal(apiv1alpha1.PromotionSuperseded))
+				Expect(record.SourceRevision).To(Equal(approvedRevision))
+				Expect(promotion.Status.LastAttemptedRevision).To(BeEmpty())
+				Expect(prod.head(promotionBranch(promotion))).To(BeEmpty())
+
+				Expect(commitStatuses(approvedRevision)).To(Equal([]any{"pending", "error"}))
+				events := notifications()
+				Expect(events).To(HaveLen(1))
+				Expect(events[0].Type).To(Equal(apiv1alpha1.PromotionSupersededEvent))
+				Expect(events[0].SourceRevision).To(Equal(approvedRevision))
+			})
+
+			It("requires a provider on the destination environment", func() {
+				objects[1].(*apiv1alpha1.Environment).Spec.Provider = nil
+				r = newReconciler()
+				r.notifications = newNotificationDispatcher()
+
+				Expect(r.promote(ctx, promotion)).To(MatchError(
+					"the pull-request strategy requires a provider on environment prod to open pull requests with"))
+				Expect(prod.head(promotionBranch(promotion))).To(BeEmpty())
+				Expect(notifications()).To(BeEmpty())
+			})
+
+			It("does not notify if the pull request cannot be opened", func() {
+				objects[1].(*apiv1alpha1.Environment).Spec.Provider.APIURL = "http://127.0.0.1:1"
+				r = newReconciler()
+				r.notifications = newNotificationDispatcher()
+
+				Expect(r.promote(ctx, promotion)).To(MatchError(ContainSubstring("failed to open pull request of branch promotion/dev-to-prod")))
+				Expect(promotion.Status.History[0].Outcome).To(Equal(apiv1alpha1.PromotionFailed))
+				Expect(promotion.Status.History[0].PullRequestURL).To(BeEmpty())
+				Expect(promotion.Status.PullRequest).To(BeNil())
+				Expect(notifications()).To(BeEmpty())
+			})
+		})
+	})
+})
@@ -0,0 +1,120 @@
+/*
+Copyright 2023 Thomas Stadler <thomas@thomasst.xyz>.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	apiv1alpha1 "github.com/thomasstxyz/release-promotion-operator/api/v1alpha1"
+)
+
+// promotionReference is an object referenced by a Promotion.
+type promotionReference struct {
+	kind string
+	key  types.NamespacedName
+	// destination is true for the Environment promoted to.
+	destination bool
+}
+
+// promotionReferences returns the objects referenced by the Promotion.
+func promotionReferences(promotion *apiv1alpha1.Promotion) []promotionReference {
+	return []promotionReference{
+		{promotion.FromEnvironmentKind(), promotion.FromEnvironmentKey(), false},
+		{promotion.ToEnvironmentKind(), promotion.ToEnvironmentKey(), true},
+		{promotion.TemplateKind(), promotion.TemplateKey(), false},
+	}
+}
+
+// grantNamespace returns the namespace whose ReferenceGrants must permit the
+// reference of the Promotion, or an empty string if it needs no grant.
+// Promoting to a ClusterEnvironment must be granted in the cluster resource
+// namespace, while other cluster-scoped objects can be referenced from all namespaces.
+func (r *PromotionReconciler) grantNamespace(promotion *apiv1alpha1.Promotion, ref promotionReference) string {
+	switch {
+	case ref.kind == apiv1alpha1.ClusterEnvironmentKind && ref.destination:
+		return r.ClusterResourceNamespace
+	case apiv1alpha1.IsClusterScoped(ref.kind) || ref.key.Namespace == promotion.Namespace:
+		return ""
+	default:
+		return ref.key.Namespace
+	}
+}
+
+// deniedReferences returns a message for each reference of the Promotion
+// which needs a ReferenceGrant, but is not permitted by any.
+func (r *PromotionReconciler) deniedReferences(ctx context.Context, promotion *apiv1alpha1.Promotion) ([]string, error) {
+	var denied []string
+	for _, ref := range promotionReferences(promotion) {
+		namespace := r.grantNamespace(promotion, ref)
+		if namespace == "" {
+			continue
+		}
+
+		grants := &apiv1alpha1.ReferenceGrantList{}
+		if err := r.List(ctx, grants, client.InNamespace(namespace)); err != nil {
+			return nil, err
+		}
+		if grants.Permits(promotion.Namespace, ref.kind, ref.key.Name) {
+			continue
+		}
+		if apiv1alpha1.IsClusterScoped(ref.kind) {
+			denied = append(denied, fmt.Sprintf("promoting to %s %s is not granted to namespace %s by any ReferenceGrant in namespace %s",
+				ref.kind, ref.key.Name, promotion.Namespace, namespace))
+		} else {
+			denied = append(denied, fmt.Sprintf("%s %s is not granted to namespace %s by any ReferenceGrant",
+				ref.kind, ref.key, promotion.Namespace))
+		}
+	}
+	return denied, nil
+}
+
+// promotionsForReferenceGrant maps a ReferenceGrant to the Promotions in the
+// namespaces it grants to, whose references need a grant in its namespace.
+func (r *PromotionReconciler) promotionsForReferenceGrant(obj client.Object) []reconcile.Request {
+	grant, ok := obj.(*apiv1alpha1.ReferenceGrant)
+	if !ok {
+		return nil
+	}
+
+	ctx := context.Background()
+	var requests []reconcile.Request
+	for _, from := range grant.Spec.From {
+		promotions := &apiv1alpha1.PromotionList{}
+		if err := r.List(ctx, promotions, client.InNamespace(from.Namespace)); err != nil {
+			log.FromContext(ctx).Error(err, "Failed to list Promotions for ReferenceGrant",
+				"referenceGrant", client.ObjectKeyFromObject(grant), "namespace", from.Namespace)
+			continue
+		}
+		for i := range promotions.Items {
+			for _, ref := range promotionReferences(&promotions.Items[i]) {
+				if r.grantNamespace(&promotions.Items[i], ref) == grant.Namespace {
+					requests = append(requests, reconcile.Request{
+						NamespacedName: client.ObjectKeyFromObject(&promotions.Items[i]),
+					})
+					break
+				}
+			}
+		}
+	}
+	return requests
+}
@@ -0,0 +1,172 @@
+/*
+Copyright 2023 Thomas Stadler <thomas@thomasst.xyz>.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	apiv1alpha1 "github.com/thomasstxyz/release-promotion-operator/api/v1alpha1"
+)
+
+// remoteClusterTimeout bounds the requests to remote clusters,
+// so that an unreachable cluster does not block the reconciliation.
+const remoteClusterTimeout = 10 * time.Second
+
+// kubeConfigSecretKeys are the keys of a kubeconfig Secret
+// the kubeconfig is read from, in order of precedence.
+var kubeConfigSecretKeys = []string{"value", "value.yaml"}
+
+// clusterUnreachableError is returned if a remote cluster
+// of a readiness check cannot be reached.
+type clusterUnreachableError struct {
+	secret types.NamespacedName
+	err    error
+}
+
+func (e *clusterUnreachableError) Error() string {
+	return fmt.Sprintf("cluster of kubeconfig Secret %s is unreachable: %v", e.secret, e.err)
+}
+
+func (e *clusterUnreachableError) Unwrap() error {
+	return e.err
+}
+
+// isClusterUnreachable returns true if err has not been returned by the
+// API server, but by the transport to it. Errors caused by the cancellation
+// of ctx, e.g. when the operator shuts down, are not attributed to the cluster,
+// whereas requests exceeding remoteClusterTimeout are.
+func isClusterUnreachable(ctx context.Context, err error) bool {
+	if ctx.Err() != nil || errors.Is(err, context.Canceled) {
+		return false
+	}
+	var status apierrors.APIStatus
+	return !errors.As(err, &status)
+}
+
+// restConfigFromKubeConfig returns the REST config of the current context of the
+// kubeconfig. Kubeconfigs of tenants must be self-contained: credential plugins
+// and auth providers would run commands in the operator, and file references
+// would read its files, so both are rejected.
+func restConfigFromKubeConfig(kubeConfig []byte) (*rest.Config, error) {
+	cfg, err := clientcmd.Load(kubeConfig)
+	if err != nil {
+		return nil, err
+	}
+	for name, cluster := range cfg.Clusters {
+		if cluster.CertificateAuthority != "" {
+			return nil, fmt.Errorf("cluster %q references the file %q, use certificate-authority-data instead",
+				name, cluster.CertificateAuthority)
+		}
+	}
+	for name, user := range cfg.AuthInfos {
+		switch {
+		case user.Exec != nil:
+			return nil, fmt.Errorf("user %q uses an exec credential plugin, which is not supported", name)
+		case user.AuthProvider != nil:
+			return nil, fmt.Errorf("user %q uses an auth provider, which is not supported", name)
+		case user.TokenFile != "":
+			return nil, fmt.Errorf("user %q references the file %q, use token instead", name, user.TokenFile)
+		case user.ClientCertificate != "":
+			return nil, fmt.Errorf("user %q references the file %q, use client-certificate-data instead",
+				name, user.ClientCertificate)
+		case user.ClientKey != "":
+			return nil, fmt.Errorf("user %q references the file %q, use client-key-data instead", name, user.ClientKey)
+		}
+	}
+	return clientcmd.NewDefaultClientConfig(*cfg, &clientcmd.ConfigOverrides{}).ClientConfig()
+}
+
+// remoteClusterClients caches the clients of remote clusters per kubeconfig Secret.
+// A client is evicted when the kubeconfig in the Secret changes or the Secret is deleted.
+type remoteClusterClients struct {
+	mu      sync.Mutex
+	clients map[types.NamespacedName]remoteClusterClient
+}
+
+type remoteClusterClient struct {
+	checksum [sha256.Size]byte
+	client   dynamic.Interface
+}
+
+// get returns the client of the cluster of the kubeconfig in the referenced Secret,
+// which is read with the client c.
+func (cc *remoteClusterClients) get(ctx context.Context, c client.Reader, namespace string, ref *apiv1alpha1.KubeConfigReference) (dynamic.Interface, error) {
+	key := types.NamespacedName{Namespace: namespace, Name: ref.SecretRef.Name}
+	secret := &corev1.Secret{}
+	if err := c.Get(ctx, key, secret); err != nil {
+		if apierrors.IsNotFound(err) {
+			cc.evict(key)
+		}
+		return nil, fmt.Errorf("failed to get kubeconfig Secret %s: %w", key, err)
+	}
+
+	var kubeConfig []byte
+	for _, k := range kubeConfigSecretKeys {
+		if v, ok := secret.Data[k]; ok {
+			kubeConfig = v
+			break
+		}
+	}
+	if len(kubeConfig) == 0 {
+		cc.evict(key)
+		return nil, fmt.Errorf("kubeconfig Secret %s has none of the keys %v", key, kubeConfigSecretKeys)
+	}
+	checksum := sha256.Sum256(kubeConfig)
+
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+	if cached, ok := cc.clients[key]; ok && cached.checksum == checksum {
+		return cached.client, nil
+	}
+	delete(cc.clients, key)
+
+	config, err := restConfigFromKubeConfig(kubeConfig)
+	if err != nil {
+		return nil, fmt.Errorf("invalid kubeconfig in Secret %s: %w", key, err)
+	}
+	config.Timeout = remoteClusterTimeout
+	dynamicClient, err := dynamic.NewForConfig(config)
+	if err != nil {
+		return nil, err
+	}
+
+	if cc.clients == nil {
+		cc.clients = map[types.NamespacedName]remoteClusterClient{}
+	}
+	cc.clients[key] = remoteClusterClient{checksum: checksum, client: dynamicClient}
+	return dynamicClient, nil
+}
+
+// evict removes the client of the kubeconfig Secret from the cache.
+func (cc *remoteClusterClients) evict(key types.NamespacedName) {
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+	delete(cc.clients, key)
+}
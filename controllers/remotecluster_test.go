@@ -0,0 +1,236 @@
+/*
+Copyright 2023 Thomas Stadler <thomas@thomasst.xyz>.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"strings"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/envtest"
+
+	apiv1alpha1 "github.com/thomasstxyz/release-promotion-operator/api/v1alpha1"
+)
+
+var _ = Describe("Readiness checks against remote clusters", func() {
+	var (
+		ctx        context.Context
+		remoteEnv  *envtest.Environment
+		reconciler *PromotionReconciler
+		promotion  *apiv1alpha1.Promotion
+	)
+
+	BeforeEach(func() {
+		requireEnvtest()
+		ctx = context.Background()
+
+		By("starting a second API server as the remote cluster")
+		remoteEnv = &envtest.Environment{}
+		remoteCfg, err := remoteEnv.Start()
+		Expect(err).NotTo(HaveOccurred())
+		DeferCleanup(func() {
+			Expect(remoteEnv.Stop()).To(Succeed())
+		})
+
+		user, err := remoteEnv.AddUser(envtest.User{Name: "promotion", Groups: []string{"system:masters"}}, remoteCfg)
+		Expect(err).NotTo(HaveOccurred())
+		kubeConfig, err := user.KubeConfig()
+		Expect(err).NotTo(HaveOccurred())
+		remoteClient, err := client.New(remoteCfg, client.Options{Scheme: scheme.Scheme})
+		Expect(err).NotTo(HaveOccurred())
+
+		ns := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{GenerateName: "remote-test-"}}
+		Expect(k8sClient.Create(ctx, ns)).To(Succeed())
+		Expect(remoteClient.Create(ctx, &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: ns.Name}})).To(Succeed())
+
+		Expect(k8sClient.Create(ctx, &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: "remote-kubeconfig", Namespace: ns.Name},
+			Data:       map[string][]byte{"value": kubeConfig},
+		})).To(Succeed())
+		Expect(remoteClient.Create(ctx, &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Name: "app", Namespace: ns.Name},
+		})).To(Succeed())
+
+		reconciler = &PromotionReconciler{Client: k8sClient, Scheme: scheme.Scheme, RESTConfig: cfg}
+		promotion = &apiv1alpha1.Promotion{
+			ObjectMeta: metav1.ObjectMeta{Name: "dev-to-prod", Namespace: ns.Name},
+			Spec: apiv1alpha1.PromotionSpec{
+				ReadinessChecks: apiv1alpha1.ReadinessChecks{
+					LocalObjectsRef: []apiv1alpha1.LocalObjectsRef{{
+						GroupVersionResource: metav1.GroupVersionResource{Version: "v1", Resource: "configmaps"},
+						Name:                 "app",
+						KubeConfig: &apiv1alpha1.KubeConfigReference{
+							SecretRef: apiv1alpha1.LocalObjectReference{Name: "remote-kubeconfig"},
+						},
+					}},
+				},
+			},
+		}
+	})
+
+	It("fetches the objects from the remote cluster", func() {
+		unready, err := reconciler.readinessChecks(ctx, promotion)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(unready).To(BeEmpty())
+
+		By("not finding the object in the local cluster")
+		promotion.Spec.ReadinessChecks.LocalObjectsRef[0].KubeConfig = nil
+		_, err = reconciler.readinessChecks(ctx, promotion)
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("reports an unreachable remote cluster", func() {
+		_, err := reconciler.readinessChecks(ctx, promotion)
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(remoteEnv.ControlPlane.APIServer.Stop()).To(Succeed())
+
+		_, err = reconciler.readinessChecks(ctx, promotion)
+		var unreachable *clusterUnreachableError
+		Expect(errors.As(err, &unreachable)).To(BeTrue(), "unexpected error: %v", err)
+	})
+})
+
+var _ = Describe("Remote cluster kubeconfigs", func() {
+	const kubeConfig = `apiVersion: v1
+kind: Config
+clusters:
+- name: prod
+  cluster:
+    server: https://prod.example.com
+contexts:
+- name: prod
+  context:
+    cluster: prod
+    user: promotion
+current-context: prod
+users:
+- name: promotion
+  user:
+    token: s3cr3t
+`
+
+	var (
+		ctx     context.Context
+		c       client.Client
+		clients *remoteClusterClients
+		ref     *apiv1alpha1.KubeConfigReference
+		secret  *corev1.Secret
+	)
+
+	BeforeEach(func() {
+		ctx = context.Background()
+		secret = &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: "remote-kubeconfig", Namespace: "apps"},
+			Data:       map[string][]byte{"value": []byte(kubeConfig)},
+		}
+		c = fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(secret).Build()
+		clients = &remoteClusterClients{}
+		ref = &apiv1alpha1.KubeConfigReference{SecretRef: apiv1alpha1.LocalObjectReference{Name: "remote-kubeconfig"}}
+	})
+
+	It("builds the REST config of the current context", func() {
+		config, err := restConfigFromKubeConfig([]byte(kubeConfig))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(config.Host).To(Equal("https://prod.example.com"))
+		Expect(config.BearerToken).To(Equal("s3cr3t"))
+	})
+
+	DescribeTable("rejects kubeconfigs which are not self-contained",
+		func(old, new, message string) {
+			_, err := restConfigFromKubeConfig([]byte(strings.Replace(kubeConfig, old, new, 1)))
+			Expect(err).To(MatchError(message))
+		},
+		Entry("exec credential plugins", "token: s3cr3t",
+			"exec:\n      apiVersion: client.authentication.k8s.io/v1\n      command: cat",
+			`user "promotion" uses an exec credential plugin, which is not supported`),
+		Entry("auth providers", "token: s3cr3t",
+			"auth-provider:\n      name: oidc",
+			`user "promotion" uses an auth provider, which is not supported`),
+		Entry("token files", "token: s3cr3t", "tokenFile: /var/run/secrets/kubernetes.io/serviceaccount/token",
+			`user "promotion" references the file "/var/run/secrets/kubernetes.io/serviceaccount/token", use token instead`),
+		Entry("client certificate files", "token: s3cr3t", "client-certificate: /etc/tls/tls.crt",
+			`user "promotion" references the file "/etc/tls/tls.crt", use client-certificate-data instead`),
+		Entry("client key files", "token: s3cr3t", "client-key: /etc/tls/tls.key",
+			`user "promotion" references the file "/etc/tls/tls.key", use client-key-data instead`),
+		Entry("certificate authority files", "server: https://prod.example.com",
+			"server: https://prod.example.com\n    certificate-authority: /var/run/secrets/kubernetes.io/serviceaccount/ca.crt",
+			`cluster "prod" references the file "/var/run/secrets/kubernetes.io/serviceaccount/ca.crt", use certificate-authority-data instead`),
+	)
+
+	It("reports rejected kubeconfigs of Secrets", func() {
+		secret.Data["value"] = []byte(strings.Replace(kubeConfig, "token: s3cr3t", "auth-provider:\n      name: oidc", 1))
+		Expect(c.Update(ctx, secret)).To(Succeed())
+
+		_, err := clients.get(ctx, c, "apps", ref)
+		Expect(err).To(MatchError(ContainSubstring("invalid kubeconfig in Secret apps/remote-kubeconfig")))
+		Expect(clients.clients).To(BeEmpty())
+	})
+
+	It("caches the client until the kubeconfig changes", func() {
+		cached, err := clients.get(ctx, c, "apps", ref)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(clients.get(ctx, c, "apps", ref)).To(BeIdenticalTo(cached))
+
+		secret.Data["value"] = []byte(strings.Replace(kubeConfig, "s3cr3t", "r0t4t3d", 1))
+		Expect(c.Update(ctx, secret)).To(Succeed())
+		Expect(clients.get(ctx, c, "apps", ref)).NotTo(BeIdenticalTo(cached))
+
+		By("evicting the client of a kubeconfig which has become invalid")
+		secret.Data["value"] = []byte(strings.Replace(kubeConfig, "token: s3cr3t", "tokenFile: /etc/token", 1))
+		Expect(c.Update(ctx, secret)).To(Succeed())
+		_, err = clients.get(ctx, c, "apps", ref)
+		Expect(err).To(HaveOccurred())
+		Expect(clients.clients).To(BeEmpty())
+	})
+
+	It("evicts the client when the Secret is deleted", func() {
+		_, err := clients.get(ctx, c, "apps", ref)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(clients.clients).To(HaveLen(1))
+
+		Expect(c.Delete(ctx, secret)).To(Succeed())
+		_, err = clients.get(ctx, c, "apps", ref)
+		Expect(apierrors.IsNotFound(err)).To(BeTrue(), "unexpected error: %v", err)
+		Expect(clients.clients).To(BeEmpty())
+	})
+
+	It("does not attribute canceled requests to the cluster", func() {
+		refused := &url.Error{Op: "Get", URL: "https://prod.example.com", Err: errors.New("connection refused")}
+		Expect(isClusterUnreachable(ctx, refused)).To(BeTrue())
+		Expect(isClusterUnreachable(ctx, apierrors.NewForbidden(schema.GroupResource{Resource: "configmaps"}, "app", nil))).To(BeFalse())
+
+		timedOut := &url.Error{Op: "Get", URL: "https://prod.example.com", Err: context.DeadlineExceeded}
+		Expect(isClusterUnreachable(ctx, timedOut)).To(BeTrue())
+		Expect(isClusterUnreachable(ctx, &url.Error{Op: "Get", URL: "https://prod.example.com", Err: context.Canceled})).To(BeFalse())
+
+		canceled, cancel := context.WithCancel(ctx)
+		cancel()
+		Expect(isClusterUnreachable(canceled, timedOut)).To(BeFalse())
+	})
+})
@@ -0,0 +1,208 @@
+/*
+Copyright 2023 Thomas Stadler <thomas@thomasst.xyz>.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"golang.org/x/crypto/ssh"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// Keys of a signing key Secret.
+const (
+	// signingKeyPGPKey holds an ASCII-armored OpenPGP private key.
+	signingKeyPGPKey = "git.asc"
+	// signingKeySSHKey holds a PEM encoded SSH private key.
+	signingKeySSHKey = "identity"
+	// signingKeyPassphrase holds the optional passphrase of the private key.
+	signingKeyPassphrase = "passphrase"
+)
+
+// commitSigner signs commits created by the operator.
+type commitSigner interface {
+	// sign returns the armored signature of the encoded, unsigned commit.
+	sign(commit []byte) (string, error)
+	// fingerprint returns the fingerprint of the signing key.
+	fingerprint() string
+}
+
+// commitSignerFromSecret returns the signer of the OpenPGP or SSH
+// private key in the Secret, preferring OpenPGP if both are present.
+func commitSignerFromSecret(secret *corev1.Secret) (commitSigner, error) {
+	passphrase := secret.Data[signingKeyPassphrase]
+
+	if armored, ok := secret.Data[signingKeyPGPKey]; ok {
+		entities, err := openpgp.ReadArmoredKeyRing(bytes.NewReader(armored))
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s in Secret %s: %w", signingKeyPGPKey, secret.Name, err)
+		}
+		if len(entities) != 1 {
+			return nil, fmt.Errorf("%s in Secret %s must contain exactly one key, found %d", signingKeyPGPKey, secret.Name, len(entities))
+		}
+		entity := entities[0]
+		if entity.PrivateKey == nil {
+			return nil, fmt.Errorf("%s in Secret %s does not contain a private key", signingKeyPGPKey, secret.Name)
+		}
+		if entity.PrivateKey.Encrypted {
+			if err := entity.PrivateKey.Decrypt(passphrase); err != nil {
+				return nil, fmt.Errorf("failed to decrypt %s in Secret %s: %w", signingKeyPGPKey, secret.Name, err)
+			}
+		}
+		for _, subkey := range entity.Subkeys {
+			if subkey.PrivateKey != nil && subkey.PrivateKey.Encrypted {
+				if err := subkey.PrivateKey.Decrypt(passphrase); err != nil {
+					return nil, fmt.Errorf("failed to decrypt %s in Secret %s: %w", signingKeyPGPKey, secret.Name, err)
+				}
+			}
+		}
+		return &pgpSigner{entity: entity}, nil
+	}
+
+	if pemBytes, ok := secret.Data[signingKeySSHKey]; ok {
+		var signer ssh.Signer
+		var err error
+		if len(passphrase) > 0 {
+			signer, err = ssh.ParsePrivateKeyWithPassphrase(pemBytes, passphrase)
+		} else {
+			signer, err = ssh.ParsePrivateKey(pemBytes)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s in Secret %s: %w", signingKeySSHKey, secret.Name, err)
+		}
+		return &sshSigner{signer: signer}, nil
+	}
+
+	return nil, fmt.Errorf("Secret %s contains neither %s nor %s", secret.Name, signingKeyPGPKey, signingKeySSHKey)
+}
+
+// pgpSigner signs commits with an OpenPGP key, like 'git commit -S'.
+type pgpSigner struct {
+	entity *openpgp.Entity
+}
+
+func (s *pgpSigner) sign(commit []byte) (string, error) {
+	var sig bytes.Buffer
+	if err := openpgp.ArmoredDetachSign(&sig, s.entity, bytes.NewReader(commit), nil); err != nil {
+		return "", err
+	}
+	return sig.String(), nil
+}
+
+func (s *pgpSigner) fingerprint() string {
+	return strings.ToUpper(hex.EncodeToString(s.entity.PrimaryKey.Fingerprint))
+}
+
+// sshSigner signs commits with an SSH key, like 'git commit -S' with gpg.format=ssh.
+type sshSigner struct {
+	signer ssh.Signer
+}
+
+func (s *sshSigner) sign(commit []byte) (string, error) {
+	data, err := sshSignedData(sshSigNamespace, sshSigHashAlgorithm, commit)
+	if err != nil {
+		return "", err
+	}
+
+	var sig *ssh.Signature
+	if algSigner, ok := s.signer.(ssh.AlgorithmSigner); ok && s.signer.PublicKey().Type() == ssh.KeyAlgoRSA {
+		// SHA-1 RSA signatures are rejected by git
+		sig, err = algSigner.SignWithAlgorithm(rand.Reader, data, ssh.SigAlgoRSASHA2512)
+	} else {
+		sig, err = s.signer.Sign(rand.Reader, data)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	blob := sshSigBlob{
+		Version:       sshSigVersion,
+		PublicKey:     string(s.signer.PublicKey().Marshal()),
+		Namespace:     sshSigNamespace,
+		HashAlgorithm: sshSigHashAlgorithm,
+		Signature:     string(ssh.Marshal(sig)),
+	}
+	return armorSSHSig(append([]byte(sshSigMagic), ssh.Marshal(blob)...)), nil
+}
+
+func (s *sshSigner) fingerprint() string {
+	return ssh.FingerprintSHA256(s.signer.PublicKey())
+}
+
+// SSH signatures as specified in
+// https://github.com/openssh/openssh-portable/blob/master/PROTOCOL.sshsig
+const (
+	sshSigMagic         = "SSHSIG"
+	sshSigVersion       = 1
+	sshSigNamespace     = "git"
+	sshSigHashAlgorithm = "sha512"
+	sshSigArmorBegin    = "-----BEGIN SSH SIGNATURE-----"
+	sshSigArmorEnd      = "-----END SSH SIGNATURE-----"
+)
+
+// sshSigBlob is the signature blob following the magic preamble.
+type sshSigBlob struct {
+	Version       uint32
+	PublicKey     string
+	Namespace     string
+	Reserved      string
+	HashAlgorithm string
+	Signature     string
+}
+
+// sshSignedData returns the data which is signed for the message.
+func sshSignedData(namespace, hashAlgorithm string, message []byte) ([]byte, error) {
+	var hash []byte
+	switch hashAlgorithm {
+	case "sha256":
+		sum := sha256.Sum256(message)
+		hash = sum[:]
+	case "sha512":
+		sum := sha512.Sum512(message)
+		hash = sum[:]
+	default:
+		return nil, fmt.Errorf("unsupported hash algorithm %q", hashAlgorithm)
+	}
+	return append([]byte(sshSigMagic), ssh.Marshal(struct {
+		Namespace     string
+		Reserved      string
+		HashAlgorithm string
+		Hash          string
+	}{namespace, "", hashAlgorithm, string(hash)})...), nil
+}
+
+// armorSSHSig wraps the signature in the armor used by ssh-keygen.
+func armorSSHSig(sig []byte) string {
+	encoded := base64.StdEncoding.EncodeToString(sig)
+	var b strings.Builder
+	b.WriteString(sshSigArmorBegin + "\n")
+	for len(encoded) > 70 {
+		b.WriteString(encoded[:70] + "\n")
+		encoded = encoded[70:]
+	}
+	b.WriteString(encoded + "\n")
+	b.WriteString(sshSigArmorEnd + "\n")
+	return b.String()
+}
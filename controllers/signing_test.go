@@ -0,0 +1,74 @@
+/*
+Copyright 2023 Thomas Stadler <thomas@thomasst.xyz>.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"strings"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"golang.org/x/crypto/ssh"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+var _ = Describe("Commit signers", func() {
+	It("signs with an OpenPGP key", func() {
+		entity := newOpenPGPKey()
+		signer, err := commitSignerFromSecret(&corev1.Secret{
+			Data: map[string][]byte{signingKeyPGPKey: armoredOpenPGPKey(entity, true)},
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(signer.fingerprint()).To(Equal(openPGPFingerprint(entity)))
+
+		signature, err := signer.sign([]byte(testCommit))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(signature).To(HavePrefix("-----BEGIN PGP SIGNATURE-----"))
+		_, err = openpgp.CheckArmoredDetachedSignature(openpgp.EntityList{entity},
+			strings.NewReader(testCommit), strings.NewReader(signature), nil)
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("signs with an SSH key", func() {
+		identity, publicKey := newSSHSigningKey()
+		signer, err := commitSignerFromSecret(&corev1.Secret{
+			Data: map[string][]byte{signingKeySSHKey: identity},
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(signer.fingerprint()).To(Equal(ssh.FingerprintSHA256(publicKey)))
+
+		signature, err := signer.sign([]byte(testCommit))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(signature).To(HavePrefix(sshSigArmorBegin))
+		verifier := &commitVerifier{allowedSigners: []ssh.PublicKey{publicKey}}
+		Expect(verifier.verify([]byte(testCommit), signature)).To(Equal(ssh.FingerprintSHA256(publicKey)))
+	})
+
+	It("rejects Secrets without a private key", func() {
+		secret := &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: "signing-key"},
+			Data:       map[string][]byte{signingKeyPGPKey: armoredOpenPGPKey(newOpenPGPKey(), false)},
+		}
+		_, err := commitSignerFromSecret(secret)
+		Expect(err).To(MatchError("git.asc in Secret signing-key does not contain a private key"))
+
+		secret.Data = map[string][]byte{}
+		_, err = commitSignerFromSecret(secret)
+		Expect(err).To(MatchError("Secret signing-key contains neither git.asc nor identity"))
+	})
+})
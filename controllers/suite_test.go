@@ -17,6 +17,7 @@ limitations under the License.
 package controllers
 
 import (
+	"os"
 	"path/filepath"
 	"testing"
 
@@ -48,6 +49,12 @@ func TestAPIs(t *testing.T) {
 }
 
 var _ = BeforeSuite(func() {
+	// Specs which need an API server skip themselves with requireEnvtest,
+	// the others run without the binaries of the test environment
+	if os.Getenv("KUBEBUILDER_ASSETS") == "" {
+		return
+	}
+
 	logf.SetLogger(zap.New(zap.WriteTo(GinkgoWriter), zap.UseDevMode(true)))
 
 	By("bootstrapping test environment")
@@ -73,7 +80,17 @@ var _ = BeforeSuite(func() {
 
 })
 
+// requireEnvtest skips the spec if the test environment has not been started.
+func requireEnvtest() {
+	if testEnv == nil {
+		Skip("KUBEBUILDER_ASSETS is not set, run the controller tests with 'make test'")
+	}
+}
+
 var _ = AfterSuite(func() {
+	if testEnv == nil {
+		return
+	}
 	By("tearing down the test environment")
 	err := testEnv.Stop()
 	Expect(err).NotTo(HaveOccurred())
@@ -0,0 +1,224 @@
+/*
+Copyright 2023 Thomas Stadler <thomas@thomasst.xyz>.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"golang.org/x/crypto/ssh"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// Keys of a verification Secret.
+const (
+	// verificationPGPKeys holds ASCII-armored OpenPGP public keys.
+	verificationPGPKeys = "git.asc"
+	// verificationAllowedSigners holds an SSH allowed signers file, see ssh-keygen(1).
+	verificationAllowedSigners = "allowed_signers"
+	// verificationCosignKeySuffix is the suffix of the fields holding PEM-encoded cosign
+	// public keys, which verify the artifacts of Environments with an OCI repository.
+	verificationCosignKeySuffix = ".pub"
+)
+
+// sourceVerificationError is returned if the signature
+// of the source revision cannot be verified.
+type sourceVerificationError struct {
+	revision string
+	err      error
+}
+
+func (e *sourceVerificationError) Error() string {
+	return fmt.Sprintf("failed to verify signature of source revision %s: %s", e.revision, e.err)
+}
+
+func (e *sourceVerificationError) Unwrap() error {
+	return e.err
+}
+
+// commitVerifier verifies commit signatures with the trusted OpenPGP and SSH keys.
+type commitVerifier struct {
+	keyring        openpgp.EntityList
+	allowedSigners []ssh.PublicKey
+}
+
+// commitVerifierFromSecret returns the verifier of the public keys in the Secret.
+func commitVerifierFromSecret(secret *corev1.Secret) (*commitVerifier, error) {
+	v := &commitVerifier{}
+
+	if armored, ok := secret.Data[verificationPGPKeys]; ok {
+		keyring, err := openpgp.ReadArmoredKeyRing(bytes.NewReader(armored))
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s in Secret %s: %w", verificationPGPKeys, secret.Name, err)
+		}
+		v.keyring = keyring
+	}
+
+	if allowedSigners, ok := secret.Data[verificationAllowedSigners]; ok {
+		keys, err := parseAllowedSigners(allowedSigners)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s in Secret %s: %w", verificationAllowedSigners, secret.Name, err)
+		}
+		v.allowedSigners = keys
+	}
+
+	if len(v.keyring) == 0 && len(v.allowedSigners) == 0 {
+		return nil, fmt.Errorf("Secret %s contains no keys in %s or %s", secret.Name, verificationPGPKeys, verificationAllowedSigners)
+	}
+	return v, nil
+}
+
+// parseAllowedSigners returns the keys of an allowed signers file which
+// are valid for the git namespace. Principals are not checked, and
+// certificate authorities are not supported.
+func parseAllowedSigners(data []byte) ([]ssh.PublicKey, error) {
+	var keys []ssh.PublicKey
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		// Each line starts with the principals, followed by the options and the key
+		_, rest, found := strings.Cut(line, " ")
+		if !found {
+			return nil, fmt.Errorf("line %d: missing public key", n)
+		}
+		key, _, options, _, err := ssh.ParseAuthorizedKey([]byte(strings.TrimSpace(rest)))
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", n, err)
+		}
+		if allowedSignerForGit(options) {
+			keys = append(keys, key)
+		}
+	}
+	return keys, scanner.Err()
+}
+
+// allowedSignerForGit returns false if the options restrict
+// an allowed signer to namespaces other than git.
+func allowedSignerForGit(options []string) bool {
+	for _, option := range options {
+		if strings.EqualFold(option, "cert-authority") {
+			return false
+		}
+		name, value, _ := strings.Cut(option, "=")
+		if !strings.EqualFold(name, "namespaces") {
+			continue
+		}
+		for _, namespace := range strings.Split(strings.Trim(value, `"`), ",") {
+			if namespace == sshSigNamespace {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+// verify verifies the armored signature of the encoded, unsigned commit
+// and returns the fingerprint of the key it has been signed with.
+func (v *commitVerifier) verify(commit []byte, signature string) (string, error) {
+	if strings.HasPrefix(signature, sshSigArmorBegin) {
+		return v.verifySSH(commit, signature)
+	}
+
+	if len(v.keyring) == 0 {
+		return "", fmt.Errorf("commit is signed with OpenPGP, but no OpenPGP keys are trusted")
+	}
+	signer, err := openpgp.CheckArmoredDetachedSignature(v.keyring, bytes.NewReader(commit), strings.NewReader(signature), nil)
+	if err != nil {
+		return "", err
+	}
+	return strings.ToUpper(hex.EncodeToString(signer.PrimaryKey.Fingerprint)), nil
+}
+
+// verifySSH verifies an SSH signature like 'ssh-keygen -Y verify'.
+func (v *commitVerifier) verifySSH(commit []byte, signature string) (string, error) {
+	if len(v.allowedSigners) == 0 {
+		return "", fmt.Errorf("commit is signed with SSH, but no SSH keys are trusted")
+	}
+
+	raw, err := dearmorSSHSig(signature)
+	if err != nil {
+		return "", err
+	}
+	var blob sshSigBlob
+	if err := ssh.Unmarshal(raw[len(sshSigMagic):], &blob); err != nil {
+		return "", fmt.Errorf("invalid SSH signature: %w", err)
+	}
+	if blob.Version != sshSigVersion {
+		return "", fmt.Errorf("unsupported SSH signature version %d", blob.Version)
+	}
+	if blob.Namespace != sshSigNamespace {
+		return "", fmt.Errorf("SSH signature has namespace %q instead of %q", blob.Namespace, sshSigNamespace)
+	}
+
+	key, err := ssh.ParsePublicKey([]byte(blob.PublicKey))
+	if err != nil {
+		return "", fmt.Errorf("invalid public key of SSH signature: %w", err)
+	}
+	if !v.allowsSSHKey(key) {
+		return "", fmt.Errorf("SSH key %s is not trusted", ssh.FingerprintSHA256(key))
+	}
+
+	var sig ssh.Signature
+	if err := ssh.Unmarshal([]byte(blob.Signature), &sig); err != nil {
+		return "", fmt.Errorf("invalid SSH signature: %w", err)
+	}
+	data, err := sshSignedData(blob.Namespace, blob.HashAlgorithm, commit)
+	if err != nil {
+		return "", err
+	}
+	if err := key.Verify(data, &sig); err != nil {
+		return "", err
+	}
+	return ssh.FingerprintSHA256(key), nil
+}
+
+func (v *commitVerifier) allowsSSHKey(key ssh.PublicKey) bool {
+	for _, allowed := range v.allowedSigners {
+		if bytes.Equal(allowed.Marshal(), key.Marshal()) {
+			return true
+		}
+	}
+	return false
+}
+
+// dearmorSSHSig reverses armorSSHSig, returning the signature including its magic preamble.
+func dearmorSSHSig(armored string) ([]byte, error) {
+	armored = strings.TrimSpace(armored)
+	if !strings.HasPrefix(armored, sshSigArmorBegin) || !strings.HasSuffix(armored, sshSigArmorEnd) {
+		return nil, fmt.Errorf("invalid SSH signature armor")
+	}
+	encoded := strings.Join(strings.Fields(strings.TrimSuffix(strings.TrimPrefix(armored, sshSigArmorBegin), sshSigArmorEnd)), "")
+	raw, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("invalid SSH signature: %w", err)
+	}
+	if !bytes.HasPrefix(raw, []byte(sshSigMagic)) {
+		return nil, fmt.Errorf("invalid SSH signature: missing %s preamble", sshSigMagic)
+	}
+	return raw, nil
+}
@@ -0,0 +1,216 @@
+/*
+Copyright 2023 Thomas Stadler <thomas@thomasst.xyz>.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"strings"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/ProtonMail/go-crypto/openpgp/armor"
+	"github.com/go-git/go-git/v5"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"golang.org/x/crypto/ssh"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	engine "github.com/thomasstxyz/release-promotion-operator/pkg/promotion"
+)
+
+// testCommit is an encoded, unsigned commit.
+const testCommit = `tree 4b825dc642cb6eb9a060e54bf8d69288fbee4904
+author Release Promotion Operator <promotion@example.com> 1672531200 +0000
+committer Release Promotion Operator <promotion@example.com> 1672531200 +0000
+
+Promote dev to prod
+`
+
+// newOpenPGPKey returns a new OpenPGP key.
+func newOpenPGPKey() *openpgp.Entity {
+	entity, err := openpgp.NewEntity("Release Promotion Operator", "", "promotion@example.com", nil)
+	Expect(err).NotTo(HaveOccurred())
+	return entity
+}
+
+// armoredOpenPGPKey returns the ASCII-armored private or public key.
+func armoredOpenPGPKey(entity *openpgp.Entity, private bool) []byte {
+	var buf bytes.Buffer
+	blockType := openpgp.PublicKeyType
+	if private {
+		blockType = openpgp.PrivateKeyType
+	}
+	w, err := armor.Encode(&buf, blockType, nil)
+	Expect(err).NotTo(HaveOccurred())
+	if private {
+		Expect(entity.SerializePrivate(w, nil)).To(Succeed())
+	} else {
+		Expect(entity.Serialize(w)).To(Succeed())
+	}
+	Expect(w.Close()).To(Succeed())
+	return buf.Bytes()
+}
+
+// openPGPFingerprint returns the fingerprint of the key as reported by the operator.
+func openPGPFingerprint(entity *openpgp.Entity) string {
+	return strings.ToUpper(hex.EncodeToString(entity.PrimaryKey.Fingerprint))
+}
+
+// newSSHSigningKey returns a new PEM encoded SSH private key and its public key.
+func newSSHSigningKey() ([]byte, ssh.PublicKey) {
+	identity := newIdentity()
+	signer, err := ssh.ParsePrivateKey(identity)
+	Expect(err).NotTo(HaveOccurred())
+	return identity, signer.PublicKey()
+}
+
+// allowedSigners returns an allowed signers file trusting the keys for git.
+func allowedSigners(keys ...ssh.PublicKey) []byte {
+	var b strings.Builder
+	for _, key := range keys {
+		b.WriteString(`promotion@example.com namespaces="git" ` + string(ssh.MarshalAuthorizedKey(key)))
+	}
+	return []byte(b.String())
+}
+
+// openPGPSignature returns the armored detached signature of the message.
+func openPGPSignature(entity *openpgp.Entity, message string) string {
+	var sig bytes.Buffer
+	Expect(openpgp.ArmoredDetachSign(&sig, entity, strings.NewReader(message), nil)).To(Succeed())
+	return sig.String()
+}
+
+// sshSignature returns the armored SSH signature of the message in the namespace.
+func sshSignature(identity []byte, namespace, message string) string {
+	signer, err := ssh.ParsePrivateKey(identity)
+	Expect(err).NotTo(HaveOccurred())
+	data, err := sshSignedData(namespace, sshSigHashAlgorithm, []byte(message))
+	Expect(err).NotTo(HaveOccurred())
+	sig, err := signer.Sign(rand.Reader, data)
+	Expect(err).NotTo(HaveOccurred())
+	return armorSSHSig(append([]byte(sshSigMagic), ssh.Marshal(sshSigBlob{
+		Version:       sshSigVersion,
+		PublicKey:     string(signer.PublicKey().Marshal()),
+		Namespace:     namespace,
+		HashAlgorithm: sshSigHashAlgorithm,
+		Signature:     string(ssh.Marshal(sig)),
+	})...))
+}
+
+var _ = Describe("Commit verification", func() {
+	var (
+		trustedPGP, untrustedPGP *openpgp.Entity
+		trustedSSH, untrustedSSH []byte
+		trustedSSHKey            ssh.PublicKey
+		verifier                 *commitVerifier
+	)
+
+	BeforeEach(func() {
+		trustedPGP, untrustedPGP = newOpenPGPKey(), newOpenPGPKey()
+		trustedSSH, trustedSSHKey = newSSHSigningKey()
+		untrustedSSH, _ = newSSHSigningKey()
+
+		var err error
+		verifier, err = commitVerifierFromSecret(&corev1.Secret{
+			Data: map[string][]byte{
+				verificationPGPKeys:        armoredOpenPGPKey(trustedPGP, false),
+				verificationAllowedSigners: allowedSigners(trustedSSHKey),
+			},
+		})
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	tampered := strings.Replace(testCommit, "Promote dev to prod", "Promote dev to prod, and more", 1)
+
+	DescribeTable("verifies signatures",
+		func(payload string, signature func() string, fingerprint func() string, message string) {
+			signer, err := verifier.verify([]byte(payload), signature())
+			if message != "" {
+				Expect(err).To(MatchError(ContainSubstring(message)))
+				return
+			}
+			Expect(err).NotTo(HaveOccurred())
+			Expect(signer).To(Equal(fingerprint()))
+		},
+		Entry("of a trusted OpenPGP key", testCommit,
+			func() string { return openPGPSignature(trustedPGP, testCommit) },
+			func() string { return openPGPFingerprint(trustedPGP) }, ""),
+		Entry("of a trusted SSH key", testCommit,
+			func() string { return sshSignature(trustedSSH, "git", testCommit) },
+			func() string { return ssh.FingerprintSHA256(trustedSSHKey) }, ""),
+		Entry("of an untrusted OpenPGP key", testCommit,
+			func() string { return openPGPSignature(untrustedPGP, testCommit) }, nil,
+			"signature made by unknown entity"),
+		Entry("of an untrusted SSH key", testCommit,
+			func() string { return sshSignature(untrustedSSH, "git", testCommit) }, nil,
+			"is not trusted"),
+		Entry("in another SSHSIG namespace", testCommit,
+			func() string { return sshSignature(trustedSSH, "file", testCommit) }, nil,
+			`SSH signature has namespace "file" instead of "git"`),
+		Entry("of a tampered OpenPGP payload", tampered,
+			func() string { return openPGPSignature(trustedPGP, testCommit) }, nil,
+			"hash tag doesn't match"),
+		Entry("of a tampered SSH payload", tampered,
+			func() string { return sshSignature(trustedSSH, "git", testCommit) }, nil,
+			"ssh: signature did not verify"),
+		Entry("with malformed OpenPGP armor", testCommit,
+			func() string { return "-----BEGIN PGP SIGNATURE-----\n\nnot a signature\n" }, nil,
+			"illegal base64 data"),
+		Entry("with malformed SSH armor", testCommit,
+			func() string { return sshSigArmorBegin + "\nU1NIU0lH\n" }, nil,
+			"invalid SSH signature armor"),
+		Entry("with malformed SSH base64", testCommit,
+			func() string { return sshSigArmorBegin + "\n!!!\n" + sshSigArmorEnd + "\n" }, nil,
+			"invalid SSH signature: illegal base64 data"),
+		Entry("without the SSHSIG preamble", testCommit,
+			func() string { return armorSSHSig([]byte("NOTSIG")) }, nil,
+			"invalid SSH signature: missing SSHSIG preamble"),
+		Entry("with a malformed SSH signature blob", testCommit,
+			func() string { return armorSSHSig([]byte(sshSigMagic + "garbage")) }, nil,
+			"invalid SSH signature: ssh: "),
+	)
+
+	It("ignores allowed signers restricted to other namespaces", func() {
+		keys, err := parseAllowedSigners([]byte(
+			"# Release signers\n" +
+				`promotion@example.com namespaces="file" ` + string(ssh.MarshalAuthorizedKey(trustedSSHKey)) +
+				`promotion@example.com cert-authority ` + string(ssh.MarshalAuthorizedKey(trustedSSHKey))))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(keys).To(BeEmpty())
+
+		_, err = parseAllowedSigners([]byte("promotion@example.com\n"))
+		Expect(err).To(MatchError("line 1: missing public key"))
+	})
+
+	It("rejects Secrets without trusted keys", func() {
+		_, err := commitVerifierFromSecret(&corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "trusted-keys"}})
+		Expect(err).To(MatchError("Secret trusted-keys contains no keys in git.asc or allowed_signers"))
+	})
+
+	It("rejects unsigned commits", func() {
+		repo := newTestRepository(map[string]string{"prod/app/deployment.yaml": "image: podinfo:6.2.0\n"})
+		dir := GinkgoT().TempDir()
+		cloned, err := git.PlainClone(dir, false, &git.CloneOptions{URL: repo.url()})
+		Expect(err).NotTo(HaveOccurred())
+
+		checkout := &gitCheckout{Checkout: &engine.Checkout{Dir: dir, Repo: cloned}}
+		_, err = checkout.verifyHead(verifier)
+		Expect(err).To(MatchError("commit is not signed"))
+	})
+})
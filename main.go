@@ -32,6 +32,7 @@ import (
 	"sigs.k8s.io/controller-runtime/pkg/log/zap"
 
 	apiv1alpha1 "github.com/thomasstxyz/release-promotion-operator/api/v1alpha1"
+	apiv1beta1 "github.com/thomasstxyz/release-promotion-operator/api/v1beta1"
 	"github.com/thomasstxyz/release-promotion-operator/controllers"
 	//+kubebuilder:scaffold:imports
 )
@@ -45,6 +46,7 @@ func init() {
 	utilruntime.Must(clientgoscheme.AddToScheme(scheme))
 
 	utilruntime.Must(apiv1alpha1.AddToScheme(scheme))
+	utilruntime.Must(apiv1beta1.AddToScheme(scheme))
 	//+kubebuilder:scaffold:scheme
 }
 
@@ -52,11 +54,20 @@ func main() {
 	var metricsAddr string
 	var enableLeaderElection bool
 	var probeAddr string
+	var clusterResourceNamespace string
+	var enforceImpersonation bool
 	flag.StringVar(&metricsAddr, "metrics-bind-address", ":8080", "The address the metric endpoint binds to.")
 	flag.StringVar(&probeAddr, "health-probe-bind-address", ":8081", "The address the probe endpoint binds to.")
 	flag.BoolVar(&enableLeaderElection, "leader-elect", false,
 		"Enable leader election for controller manager. "+
 			"Enabling this will ensure there is only one active controller manager.")
+	flag.StringVar(&clusterResourceNamespace, "cluster-resource-namespace", "release-promotion-operator-system",
+		"The namespace in which the Secrets referenced by ClusterEnvironments are looked up.")
+	flag.BoolVar(&enforceImpersonation, "enforce-impersonation", false,
+		"Impersonate the ServiceAccount named \"default\" of the namespace for Promotions which do not specify "+
+			"a ServiceAccount, denying readiness checks and Secret lookups unless granted to it by RBAC. "+
+			"Otherwise, these Promotions act with the identity of the operator, "+
+			"so their reads are not isolated from the Secrets and objects of other namespaces.")
 	opts := zap.Options{
 		Development: true,
 	}
@@ -90,12 +101,39 @@ func main() {
 	}
 
 	if err = (&controllers.PromotionReconciler{
-		Client: mgr.GetClient(),
-		Scheme: mgr.GetScheme(),
+		Client:   mgr.GetClient(),
+		Scheme:   mgr.GetScheme(),
+		Recorder: mgr.GetEventRecorderFor("promotion-controller"),
+
+		RESTConfig:               mgr.GetConfig(),
+		ClusterResourceNamespace: clusterResourceNamespace,
+		EnforceImpersonation:     enforceImpersonation,
 	}).SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "Promotion")
 		os.Exit(1)
 	}
+	if os.Getenv("ENABLE_WEBHOOKS") != "false" {
+		if err = (&apiv1alpha1.Environment{}).SetupWebhookWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create webhook", "webhook", "Environment")
+			os.Exit(1)
+		}
+		if err = (&apiv1alpha1.PromotionTemplate{}).SetupWebhookWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create webhook", "webhook", "PromotionTemplate")
+			os.Exit(1)
+		}
+		if err = (&apiv1alpha1.Promotion{}).SetupWebhookWithManager(mgr, clusterResourceNamespace); err != nil {
+			setupLog.Error(err, "unable to create webhook", "webhook", "Promotion")
+			os.Exit(1)
+		}
+		if err = (&apiv1alpha1.ClusterEnvironment{}).SetupWebhookWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create webhook", "webhook", "ClusterEnvironment")
+			os.Exit(1)
+		}
+		if err = (&apiv1alpha1.ClusterPromotionTemplate{}).SetupWebhookWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create webhook", "webhook", "ClusterPromotionTemplate")
+			os.Exit(1)
+		}
+	}
 	//+kubebuilder:scaffold:builder
 
 	if err := mgr.AddHealthzCheck("healthz", healthz.Ping); err != nil {
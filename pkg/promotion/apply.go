@@ -0,0 +1,189 @@
+/*
+Copyright 2023 Thomas Stadler <thomas@thomasst.xyz>.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package promotion
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/go-git/go-billy/v5"
+	"github.com/go-git/go-billy/v5/osfs"
+	"github.com/go-git/go-billy/v5/util"
+	"github.com/go-git/go-git/v5"
+
+	apiv1alpha1 "github.com/thomasstxyz/release-promotion-operator/api/v1alpha1"
+)
+
+// Source is the file tree of the source environment of a promotion.
+type Source struct {
+	// Name is the name of the environment, used in errors.
+	Name string
+	// FS holds the files of the environment's repository.
+	FS fs.FS
+	// Path is the directory of the environment in FS.
+	Path string
+
+	// SOPSKeys holds the keys of the SOPS-encrypted files, if set.
+	SOPSKeys *SOPSKeyring
+}
+
+// Destination is the file tree of the destination environment of a promotion,
+// which is modified in place.
+type Destination struct {
+	// Name is the name of the environment, used in errors.
+	Name string
+	// FS holds the files of the environment's repository.
+	FS billy.Filesystem
+	// Path is the directory of the environment in FS.
+	Path string
+
+	// SOPSKeys holds the keys of the SOPS-encrypted files, if set.
+	SOPSKeys *SOPSKeyring
+	// Committed returns the committed content of the file in FS, if set.
+	// Files re-encrypted from the same content as the committed file keep
+	// its keys, so that they are not changed by every promotion.
+	Committed func(name string) ([]byte, error)
+	// ChartConstraints constrain the chart versions promoted to the environment.
+	ChartConstraints []apiv1alpha1.ChartConstraint
+}
+
+// Apply copies the files of the template's copy operations
+// from the source checkout into the destination checkout.
+func Apply(from, to *Checkout, ops []apiv1alpha1.CopyOperation) (*ChangeSet, error) {
+	return ApplyFS(from.source(), to.destination(), ops)
+}
+
+// ApplyFS copies the files of the template's copy operations from the
+// source into the destination and returns the changed files of the destination.
+// Directories are replaced as a whole, so that deletions are promoted as well.
+// SOPS-encrypted files are verified or re-encrypted according to the operation.
+func ApplyFS(from *Source, to *Destination, ops []apiv1alpha1.CopyOperation) (*ChangeSet, error) {
+	return ApplyTemplateFS(from, to, &apiv1alpha1.PromotionTemplateSpec{CopySpec: ops})
+}
+
+// ApplyTemplate applies the copy and chart operations of the template
+// from the source checkout to the destination checkout.
+func ApplyTemplate(from, to *Checkout, spec *apiv1alpha1.PromotionTemplateSpec) (*ChangeSet, error) {
+	return ApplyTemplateFS(from.source(), to.destination(), spec)
+}
+
+// ApplyTemplateFS applies the copy operations of the template like ApplyFS,
+// followed by its chart operations, and returns the changed files of the destination.
+func ApplyTemplateFS(from *Source, to *Destination, spec *apiv1alpha1.PromotionTemplateSpec) (*ChangeSet, error) {
+	changes := newChangeTracker(to.FS)
+	for _, op := range spec.CopySpec {
+		if err := copyFiles(changes, from, to, op); err != nil {
+			return nil, err
+		}
+	}
+	for _, op := range spec.Charts {
+		if err := promoteChart(changes, from, to, op); err != nil {
+			return nil, err
+		}
+	}
+	return changes.changeSet()
+}
+
+// copyFiles applies the copy operation.
+func copyFiles(changes *changeTracker, from *Source, to *Destination, op apiv1alpha1.CopyOperation) error {
+	src, err := environmentPath(from.Name, from.Path, op.Source)
+	if err != nil {
+		return err
+	}
+	dst, err := environmentPath(to.Name, to.Path, op.Destination)
+	if err != nil {
+		return err
+	}
+
+	if err := changes.remove(dst); err != nil {
+		return err
+	}
+	mode := op.SOPS
+	err = copyTree(from.FS, src, to.FS, dst, func(name string, data []byte, perm fs.FileMode) error {
+		if mode == apiv1alpha1.SOPSVerify || mode == apiv1alpha1.SOPSReencrypt {
+			if data, err = copySOPSFile(from, to, mode, data, name); err != nil {
+				return err
+			}
+		}
+		return changes.write(name, data, perm)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to copy %s to %s: %w", op.Source, op.Destination, err)
+	}
+	return nil
+}
+
+// environmentPath returns the path of p relative to the directory of the environment,
+// and errors if the result would escape the repository.
+func environmentPath(envName, envPath, p string) (string, error) {
+	name := path.Join(filepath.ToSlash(envPath), filepath.ToSlash(p))
+	if !fs.ValidPath(name) {
+		return "", fmt.Errorf("path %q escapes the repository of environment %s", p, envName)
+	}
+	return name, nil
+}
+
+// copyTree recursively copies the file or directory src of from to dst in to,
+// writing the regular files with writeFn.
+func copyTree(from fs.FS, src string, to billy.Filesystem, dst string, writeFn func(name string, data []byte, perm fs.FileMode) error) error {
+	return fs.WalkDir(from, src, func(name string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		rel := strings.TrimPrefix(name, src+"/")
+		if src == "." {
+			rel = name
+		} else if name == src {
+			rel = "."
+		}
+		target := path.Join(dst, rel)
+
+		switch {
+		case d.IsDir():
+			if d.Name() == git.GitDirName {
+				return fs.SkipDir
+			}
+			return to.MkdirAll(target, 0o755)
+		case d.Type().IsRegular():
+			info, err := d.Info()
+			if err != nil {
+				return err
+			}
+			data, err := fs.ReadFile(from, name)
+			if err != nil {
+				return err
+			}
+			return writeFn(target, data, info.Mode().Perm())
+		default:
+			return nil
+		}
+	})
+}
+
+// CopyDir copies the regular files of the directory src to dst,
+// leaving out the Git directory.
+func CopyDir(src, dst string) error {
+	to := osfs.New(dst)
+	return copyTree(os.DirFS(src), ".", to, ".", func(name string, data []byte, perm fs.FileMode) error {
+		return util.WriteFile(to, name, data, perm)
+	})
+}
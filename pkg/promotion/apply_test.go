@@ -0,0 +1,148 @@
+/*
+Copyright 2023 Thomas Stadler <thomas@thomasst.xyz>.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package promotion
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing/fstest"
+
+	"github.com/go-git/go-billy/v5/memfs"
+	"github.com/go-git/go-billy/v5/util"
+	"github.com/go-git/go-git/v5"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	apiv1alpha1 "github.com/thomasstxyz/release-promotion-operator/api/v1alpha1"
+)
+
+var _ = Describe("Applying copy operations", func() {
+	copyApp := []apiv1alpha1.CopyOperation{{Source: "app", Destination: "app"}}
+
+	Context("to file systems", func() {
+		var (
+			from *Source
+			to   *Destination
+		)
+
+		BeforeEach(func() {
+			from = &Source{Name: "dev", Path: "envs/dev", FS: fstest.MapFS{
+				"envs/dev/app/deployment.yaml": {Data: []byte("image: podinfo:6.3.0\n"), Mode: 0o644},
+				"envs/dev/app/service.yaml":    {Data: []byte("port: 9898\n"), Mode: 0o644},
+				"envs/dev/app/.git/HEAD":       {Data: []byte("ref: refs/heads/main\n")},
+			}}
+			to = &Destination{Name: "prod", Path: "envs/prod", FS: memfs.New()}
+			Expect(util.WriteFile(to.FS, "envs/prod/app/deployment.yaml", []byte("image: podinfo:6.2.0\n"), 0o644)).To(Succeed())
+			Expect(util.WriteFile(to.FS, "envs/prod/app/configmap.yaml", []byte("debug: false\n"), 0o644)).To(Succeed())
+			Expect(util.WriteFile(to.FS, "envs/prod/kustomization.yaml", []byte("resources: [app]\n"), 0o644)).To(Succeed())
+		})
+
+		It("replaces directories and returns the change set", func() {
+			changes, err := ApplyFS(from, to, copyApp)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(changes).To(Equal(&ChangeSet{
+				Added:    []string{"envs/prod/app/service.yaml"},
+				Modified: []string{"envs/prod/app/deployment.yaml"},
+				Deleted:  []string{"envs/prod/app/configmap.yaml"},
+			}))
+
+			data, err := util.ReadFile(to.FS, "envs/prod/app/deployment.yaml")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(data)).To(Equal("image: podinfo:6.3.0\n"))
+			_, err = to.FS.Stat("envs/prod/app/.git")
+			Expect(os.IsNotExist(err)).To(BeTrue())
+			_, err = to.FS.Stat("envs/prod/kustomization.yaml")
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("copies single files", func() {
+			changes, err := ApplyFS(from, to, []apiv1alpha1.CopyOperation{{Source: "app/deployment.yaml", Destination: "app/deployment.yaml"}})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(changes).To(Equal(&ChangeSet{Modified: []string{"envs/prod/app/deployment.yaml"}}))
+
+			changes, err = ApplyFS(from, to, []apiv1alpha1.CopyOperation{{Source: "app/deployment.yaml", Destination: "app/deployment.yaml"}})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(changes.Empty()).To(BeTrue())
+		})
+
+		It("refuses paths escaping the repository", func() {
+			_, err := ApplyFS(from, to, []apiv1alpha1.CopyOperation{{Source: "app", Destination: "../../../outside"}})
+			Expect(err).To(MatchError(ContainSubstring("escapes the repository of environment prod")))
+		})
+	})
+
+	Context("to checkouts", func() {
+		var from, to *Checkout
+
+		writeFile := func(c *Checkout, name, content string) {
+			path := filepath.Join(c.Dir, c.Path, name)
+			Expect(os.MkdirAll(filepath.Dir(path), 0o755)).To(Succeed())
+			Expect(os.WriteFile(path, []byte(content), 0o644)).To(Succeed())
+		}
+
+		BeforeEach(func() {
+			from = &Checkout{Name: "dev", Dir: GinkgoT().TempDir(), Path: "envs/dev"}
+			writeFile(from, "app/deployment.yaml", "image: podinfo:6.3.0\n")
+			writeFile(from, "app/service.yaml", "port: 9898\n")
+
+			dir := GinkgoT().TempDir()
+			repo, err := git.PlainInit(dir, false)
+			Expect(err).NotTo(HaveOccurred())
+			to = &Checkout{Name: "prod", Dir: dir, Path: "envs/prod", Repo: repo}
+			writeFile(to, "app/deployment.yaml", "image: podinfo:6.2.0\n")
+			writeFile(to, "app/configmap.yaml", "debug: false\n")
+			_, changed, err := to.Commit("Initial commit")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(changed).To(BeTrue())
+		})
+
+		It("diffs the result", func() {
+			_, err := Apply(from, to, copyApp)
+			Expect(err).NotTo(HaveOccurred())
+
+			result, err := to.Diff(context.Background(), 0)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(result.Added).To(ConsistOf("envs/prod/app/service.yaml"))
+			Expect(result.Modified).To(ConsistOf("envs/prod/app/deployment.yaml"))
+			Expect(result.Deleted).To(ConsistOf("envs/prod/app/configmap.yaml"))
+			Expect(result.LinesAdded).To(Equal(2))
+			Expect(result.LinesDeleted).To(Equal(2))
+			Expect(result.Patch).To(ContainSubstring("+image: podinfo:6.3.0"))
+			Expect(result.PatchTruncated).To(BeFalse())
+		})
+
+		It("truncates the patch", func() {
+			_, err := Apply(from, to, copyApp)
+			Expect(err).NotTo(HaveOccurred())
+
+			result, err := to.Diff(context.Background(), 16)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(result.Patch).To(HaveLen(16))
+			Expect(result.PatchTruncated).To(BeTrue())
+		})
+
+		It("leaves the checkout unchanged if a source is missing", func() {
+			_, err := Apply(from, to, []apiv1alpha1.CopyOperation{{Source: "app/missing.yaml", Destination: "app/missing.yaml"}})
+			Expect(err).To(HaveOccurred())
+
+			result, err := to.Diff(context.Background(), 0)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(result.Patch).To(BeEmpty())
+		})
+	})
+})
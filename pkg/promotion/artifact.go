@@ -0,0 +1,153 @@
+/*
+Copyright 2023 Thomas Stadler <thomas@thomasst.xyz>.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package promotion
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// MaxArtifactSize is the maximum size of the files extracted from an artifact.
+const MaxArtifactSize = 1 << 30
+
+// Artifact is a tarball of the files of an environment, as served by Flux's source-controller.
+type Artifact struct {
+	// URL to download the gzipped tarball from.
+	URL string
+	// Revision is the revision of the source the artifact was built from.
+	Revision string
+	// Digest is the digest of the tarball in the '<algorithm>:<hex>' format.
+	// Only 'sha256' is supported. If empty, the tarball is not verified.
+	Digest string
+}
+
+// FetchArtifact downloads the artifact and extracts it into dir.
+// The tarball is verified against the digest of the artifact; if that fails,
+// an error is returned and the extracted files must not be used.
+// Only directories and regular files are extracted.
+func FetchArtifact(ctx context.Context, client *http.Client, artifact *Artifact, dir string) error {
+	var expected []byte
+	if artifact.Digest != "" {
+		algorithm, encoded, _ := strings.Cut(artifact.Digest, ":")
+		if algorithm != "sha256" {
+			return fmt.Errorf("unsupported digest algorithm of artifact %s", artifact.Digest)
+		}
+		var err error
+		if expected, err = hex.DecodeString(encoded); err != nil {
+			return fmt.Errorf("invalid digest of artifact %s: %w", artifact.Digest, err)
+		}
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, artifact.URL, nil)
+	if err != nil {
+		return err
+	}
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to download artifact: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("failed to download artifact from %s: %s", artifact.URL, resp.Status)
+	}
+
+	hash := sha256.New()
+	body := io.TeeReader(resp.Body, hash)
+	if err := extractTarball(body, dir); err != nil {
+		return fmt.Errorf("failed to extract artifact: %w", err)
+	}
+	// Hash the remainder of the tarball, e.g. the padding after the last entry
+	if _, err := io.Copy(io.Discard, body); err != nil {
+		return fmt.Errorf("failed to download artifact: %w", err)
+	}
+	if expected != nil && !bytes.Equal(hash.Sum(nil), expected) {
+		return fmt.Errorf("digest of artifact %s does not match %s", artifact.URL, artifact.Digest)
+	}
+	return nil
+}
+
+// extractTarball extracts the directories and regular files of the gzipped tarball into dir.
+func extractTarball(r io.Reader, dir string) error {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return err
+	}
+	defer gz.Close()
+
+	var size int64
+	tr := tar.NewReader(gz)
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		name := path.Clean(strings.TrimPrefix(hdr.Name, "./"))
+		if !fs.ValidPath(name) {
+			return fmt.Errorf("invalid file name %q", hdr.Name)
+		}
+		target := filepath.Join(dir, filepath.FromSlash(name))
+
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(target, 0o755); err != nil {
+				return err
+			}
+		case tar.TypeReg:
+			if size += hdr.Size; size > MaxArtifactSize {
+				return fmt.Errorf("extracted files exceed %d bytes", MaxArtifactSize)
+			}
+			if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+				return err
+			}
+			if err := writeFile(target, tr, fs.FileMode(hdr.Mode).Perm()|0o600); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func writeFile(name string, r io.Reader, perm fs.FileMode) error {
+	f, err := os.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, perm)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(f, r); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
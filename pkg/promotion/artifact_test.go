@@ -0,0 +1,106 @@
+/*
+Copyright 2023 Thomas Stadler <thomas@thomasst.xyz>.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package promotion
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+// tarball returns a gzipped tarball of the files, in the order given.
+func tarball(files ...string) []byte {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	for i := 0; i < len(files); i += 2 {
+		name, data := files[i], files[i+1]
+		Expect(tw.WriteHeader(&tar.Header{Name: name, Mode: 0o644, Size: int64(len(data)), Typeflag: tar.TypeReg})).To(Succeed())
+		_, err := tw.Write([]byte(data))
+		Expect(err).NotTo(HaveOccurred())
+	}
+	Expect(tw.Close()).To(Succeed())
+	Expect(gz.Close()).To(Succeed())
+	return buf.Bytes()
+}
+
+var _ = Describe("Fetching artifacts", func() {
+	var (
+		data   []byte
+		server *httptest.Server
+		dir    string
+	)
+
+	BeforeEach(func() {
+		data = tarball("envs/dev/app/deployment.yaml", "image: podinfo:6.3.0\n", "./README.md", "# dev\n")
+		server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path != "/gitrepository/default/dev/latest.tar.gz" {
+				http.NotFound(w, r)
+				return
+			}
+			_, _ = w.Write(data)
+		}))
+		DeferCleanup(server.Close)
+		dir = GinkgoT().TempDir()
+	})
+
+	artifact := func(digest string) *Artifact {
+		return &Artifact{URL: server.URL + "/gitrepository/default/dev/latest.tar.gz", Revision: "main@sha1:0123abc", Digest: digest}
+	}
+
+	It("extracts a verified tarball", func() {
+		digest := fmt.Sprintf("sha256:%x", sha256.Sum256(data))
+		Expect(FetchArtifact(context.Background(), server.Client(), artifact(digest), dir)).To(Succeed())
+
+		Expect(os.ReadFile(filepath.Join(dir, "envs/dev/app/deployment.yaml"))).To(BeEquivalentTo("image: podinfo:6.3.0\n"))
+		Expect(os.ReadFile(filepath.Join(dir, "README.md"))).To(BeEquivalentTo("# dev\n"))
+	})
+
+	It("rejects a tarball not matching the digest", func() {
+		digest := fmt.Sprintf("sha256:%x", sha256.Sum256([]byte("other")))
+		err := FetchArtifact(context.Background(), server.Client(), artifact(digest), dir)
+		Expect(err).To(MatchError(ContainSubstring("does not match")))
+	})
+
+	It("rejects unsupported digest algorithms", func() {
+		err := FetchArtifact(context.Background(), server.Client(), artifact("md5:d41d8cd98f00b204e9800998ecf8427e"), dir)
+		Expect(err).To(MatchError(ContainSubstring("unsupported digest algorithm")))
+	})
+
+	It("rejects files escaping the directory", func() {
+		data = tarball("../evil.yaml", "kind: Secret\n")
+		err := FetchArtifact(context.Background(), server.Client(), artifact(""), dir)
+		Expect(err).To(MatchError(ContainSubstring(`invalid file name "../evil.yaml"`)))
+		Expect(filepath.Join(dir, "..", "evil.yaml")).NotTo(BeAnExistingFile())
+	})
+
+	It("fails on missing artifacts", func() {
+		a := artifact("")
+		a.URL = server.URL + "/gitrepository/default/prod/latest.tar.gz"
+		Expect(FetchArtifact(context.Background(), server.Client(), a, dir)).To(MatchError(ContainSubstring("404 Not Found")))
+	})
+})
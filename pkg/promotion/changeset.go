@@ -0,0 +1,140 @@
+/*
+Copyright 2023 Thomas Stadler <thomas@thomasst.xyz>.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package promotion
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"io/fs"
+	"os"
+	"path"
+	"sort"
+
+	"github.com/go-git/go-billy/v5"
+	"github.com/go-git/go-billy/v5/util"
+	"github.com/go-git/go-git/v5"
+)
+
+// ChangeSet lists the files of the destination changed by a promotion,
+// by their path in the destination's file system.
+type ChangeSet struct {
+	Added    []string
+	Modified []string
+	Deleted  []string
+}
+
+// Empty returns true if no files have been changed.
+func (c *ChangeSet) Empty() bool {
+	return len(c.Added)+len(c.Modified)+len(c.Deleted) == 0
+}
+
+// changeTracker removes and writes the files of a file system,
+// recording their original content to compute the ChangeSet.
+type changeTracker struct {
+	fs billy.Filesystem
+	// original holds the digests of the original content of the touched files,
+	// nil if the file did not exist.
+	original map[string][]byte
+}
+
+func newChangeTracker(fs billy.Filesystem) *changeTracker {
+	return &changeTracker{fs: fs, original: map[string][]byte{}}
+}
+
+// remove removes the file or directory, except for Git directories in it.
+func (t *changeTracker) remove(name string) error {
+	if _, err := t.fs.Lstat(name); os.IsNotExist(err) {
+		return nil
+	}
+	err := util.Walk(t.fs, name, func(p string, info fs.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() && info.Name() == git.GitDirName {
+			return fs.SkipDir
+		}
+		if info.Mode().IsRegular() {
+			return t.record(p)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return util.RemoveAll(t.fs, name)
+}
+
+// write writes the file, creating its directory if needed.
+func (t *changeTracker) write(name string, data []byte, perm fs.FileMode) error {
+	if err := t.record(name); err != nil {
+		return err
+	}
+	if err := t.fs.MkdirAll(path.Dir(name), 0o755); err != nil {
+		return err
+	}
+	return util.WriteFile(t.fs, name, data, perm)
+}
+
+// record records the original content of the file if it has not been touched before.
+func (t *changeTracker) record(name string) error {
+	if _, ok := t.original[name]; ok {
+		return nil
+	}
+	digest, err := t.digest(name)
+	t.original[name] = digest
+	return err
+}
+
+// digest returns the SHA-256 digest of the file, or nil if it does not exist.
+func (t *changeTracker) digest(name string) ([]byte, error) {
+	data, err := util.ReadFile(t.fs, name)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(data)
+	return sum[:], nil
+}
+
+// changeSet compares the touched files with their original content.
+func (t *changeTracker) changeSet() (*ChangeSet, error) {
+	names := make([]string, 0, len(t.original))
+	for name := range t.original {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	changes := &ChangeSet{}
+	for _, name := range names {
+		original := t.original[name]
+		current, err := t.digest(name)
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case original == nil && current != nil:
+			changes.Added = append(changes.Added, name)
+		case original != nil && current == nil:
+			changes.Deleted = append(changes.Deleted, name)
+		case !bytes.Equal(original, current):
+			changes.Modified = append(changes.Modified, name)
+		}
+	}
+	return changes, nil
+}
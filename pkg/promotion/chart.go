@@ -0,0 +1,276 @@
+/*
+Copyright 2023 Thomas Stadler <thomas@thomasst.xyz>.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package promotion
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/blang/semver"
+	"github.com/go-git/go-billy/v5/util"
+	"gopkg.in/yaml.v3"
+
+	apiv1alpha1 "github.com/thomasstxyz/release-promotion-operator/api/v1alpha1"
+)
+
+// ChartVersionError is returned if the version of a chart is not
+// accepted by the chart constraints of the destination environment.
+type ChartVersionError struct {
+	Chart       string
+	Version     string
+	Constraint  string
+	Environment string
+}
+
+func (e *ChartVersionError) Error() string {
+	return fmt.Sprintf("version %s of chart %s is not in the range %q of environment %s", e.Version, e.Chart, e.Constraint, e.Environment)
+}
+
+// chartReference holds the nodes of a YAML file referencing a version of a chart.
+type chartReference struct {
+	version *yaml.Node
+	// appVersion is the appVersion of a Chart.yaml, nil for other files.
+	appVersion *yaml.Node
+}
+
+// promoteChart applies the chart operation: it reads the version of the chart from the
+// source file and writes it into the destination file, if the version is accepted by
+// the chart constraints of the destination.
+func promoteChart(changes *changeTracker, from *Source, to *Destination, op apiv1alpha1.ChartOperation) error {
+	src, err := environmentPath(from.Name, from.Path, op.Source)
+	if err != nil {
+		return err
+	}
+	dst, err := environmentPath(to.Name, to.Path, op.Destination)
+	if err != nil {
+		return err
+	}
+
+	data, err := fs.ReadFile(from.FS, src)
+	if err != nil {
+		return fmt.Errorf("failed to read chart %s: %w", op.Name, err)
+	}
+	source, err := findChartReference(data, op.Name)
+	if err != nil {
+		return fmt.Errorf("%s of environment %s: %w", op.Source, from.Name, err)
+	}
+	if err := checkChartVersion(to, op.Name, source.version.Value); err != nil {
+		return err
+	}
+
+	data, err = util.ReadFile(to.FS, dst)
+	if err != nil {
+		return fmt.Errorf("failed to read chart %s: %w", op.Name, err)
+	}
+	target, err := findChartReference(data, op.Name)
+	if err != nil {
+		return fmt.Errorf("%s of environment %s: %w", op.Destination, to.Name, err)
+	}
+
+	// Replace the values from the end of the file, so that the position of the other one stays valid
+	replacements := []struct{ node, value *yaml.Node }{{target.version, source.version}}
+	if op.AppVersion {
+		if source.appVersion == nil || target.appVersion == nil {
+			return fmt.Errorf("chart %s: appVersion can only be promoted between Chart.yaml files with an appVersion", op.Name)
+		}
+		replacements = append(replacements, struct{ node, value *yaml.Node }{target.appVersion, source.appVersion})
+		if target.appVersion.Line < target.version.Line {
+			replacements[0], replacements[1] = replacements[1], replacements[0]
+		}
+	}
+	for _, r := range replacements {
+		if r.node.Value == r.value.Value {
+			continue
+		}
+		if data, err = replaceScalar(data, r.node, r.value.Value); err != nil {
+			return fmt.Errorf("%s of environment %s: %w", op.Destination, to.Name, err)
+		}
+	}
+
+	info, err := to.FS.Stat(dst)
+	if err != nil {
+		return err
+	}
+	return changes.write(dst, data, info.Mode().Perm())
+}
+
+// checkChartVersion returns a ChartVersionError if the version of the chart
+// is not accepted by the chart constraints of the destination.
+func checkChartVersion(to *Destination, chart, version string) error {
+	for _, constraint := range to.ChartConstraints {
+		if constraint.Name != chart {
+			continue
+		}
+		versionRange, err := semver.ParseRange(constraint.Version)
+		if err != nil {
+			return fmt.Errorf("invalid version range of chart %s in environment %s: %w", chart, to.Name, err)
+		}
+		v, err := semver.ParseTolerant(version)
+		if err != nil || !versionRange(v) {
+			return &ChartVersionError{Chart: chart, Version: version, Constraint: constraint.Version, Environment: to.Name}
+		}
+	}
+	return nil
+}
+
+// findChartReference returns the reference to the chart in the first document of the YAML file
+// referencing it: the version of a Flux HelmRelease, the version of a dependency of a Chart.yaml
+// along with its appVersion, or the targetRevision of an Argo CD Application.
+func findChartReference(data []byte, chart string) (*chartReference, error) {
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	for {
+		var doc yaml.Node
+		err := dec.Decode(&doc)
+		if errors.Is(err, io.EOF) {
+			return nil, fmt.Errorf("no reference to chart %s found", chart)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if len(doc.Content) != 1 || doc.Content[0].Kind != yaml.MappingNode {
+			continue
+		}
+
+		ref, err := chartReferenceIn(doc.Content[0], chart)
+		if ref != nil || err != nil {
+			return ref, err
+		}
+	}
+}
+
+// chartReferenceIn returns the reference to the chart in the document, or nil.
+func chartReferenceIn(doc *yaml.Node, chart string) (*chartReference, error) {
+	var ref *chartReference
+	switch kind := scalarValue(mappingValue(doc, "kind")); {
+	case kind == "HelmRelease":
+		spec := nestedMapping(doc, "spec", "chart", "spec")
+		if spec != nil && scalarValue(mappingValue(spec, "chart")) == chart {
+			ref = &chartReference{version: mappingValue(spec, "version")}
+		}
+	case kind == "Application" && strings.HasPrefix(scalarValue(mappingValue(doc, "apiVersion")), "argoproj.io/"):
+		sources := []*yaml.Node{nestedMapping(doc, "spec", "source")}
+		if list := mappingValue(nestedMapping(doc, "spec"), "sources"); list != nil && list.Kind == yaml.SequenceNode {
+			sources = append(sources, list.Content...)
+		}
+		for _, source := range sources {
+			if source != nil && source.Kind == yaml.MappingNode && scalarValue(mappingValue(source, "chart")) == chart {
+				ref = &chartReference{version: mappingValue(source, "targetRevision")}
+				break
+			}
+		}
+	case kind == "":
+		// Chart.yaml
+		dependencies := mappingValue(doc, "dependencies")
+		if dependencies == nil || dependencies.Kind != yaml.SequenceNode {
+			return nil, nil
+		}
+		for _, dependency := range dependencies.Content {
+			if dependency.Kind == yaml.MappingNode && scalarValue(mappingValue(dependency, "name")) == chart {
+				ref = &chartReference{version: mappingValue(dependency, "version"), appVersion: mappingValue(doc, "appVersion")}
+				break
+			}
+		}
+	}
+
+	if ref == nil {
+		return nil, nil
+	}
+	if ref.version == nil || ref.version.Kind != yaml.ScalarNode || ref.version.Value == "" {
+		return nil, fmt.Errorf("the reference to chart %s has no version", chart)
+	}
+	if ref.appVersion != nil && ref.appVersion.Kind != yaml.ScalarNode {
+		ref.appVersion = nil
+	}
+	return ref, nil
+}
+
+// nestedMapping returns the mapping node at the path of keys, or nil.
+func nestedMapping(node *yaml.Node, keys ...string) *yaml.Node {
+	for _, key := range keys {
+		if node == nil || node.Kind != yaml.MappingNode {
+			return nil
+		}
+		node = mappingValue(node, key)
+	}
+	if node == nil || node.Kind != yaml.MappingNode {
+		return nil
+	}
+	return node
+}
+
+// scalarValue returns the value of the scalar node, or an empty string.
+func scalarValue(node *yaml.Node) string {
+	if node == nil || node.Kind != yaml.ScalarNode {
+		return ""
+	}
+	return node.Value
+}
+
+// replaceScalar replaces the scalar node in the YAML data with the value in the same style,
+// leaving the rest of the file as is.
+func replaceScalar(data []byte, node *yaml.Node, value string) ([]byte, error) {
+	start, err := nodeOffset(data, node)
+	if err != nil {
+		return nil, err
+	}
+
+	end := start + len(node.Value)
+	replacement := value
+	switch node.Style {
+	case 0:
+	case yaml.DoubleQuotedStyle, yaml.SingleQuotedStyle:
+		quote := data[start]
+		closing := bytes.IndexByte(data[start+1:], quote)
+		if closing < 0 {
+			return nil, fmt.Errorf("unterminated string at line %d", node.Line)
+		}
+		end = start + 1 + closing + 1
+		replacement = string(quote) + value + string(quote)
+	default:
+		return nil, fmt.Errorf("unsupported style of the version at line %d", node.Line)
+	}
+	if end > len(data) || (node.Style == 0 && string(data[start:end]) != node.Value) {
+		return nil, fmt.Errorf("failed to locate the version at line %d", node.Line)
+	}
+
+	return append(append(append([]byte{}, data[:start]...), replacement...), data[end:]...), nil
+}
+
+// nodeOffset returns the byte offset of the node from its line and column.
+func nodeOffset(data []byte, node *yaml.Node) (int, error) {
+	offset := 0
+	for line := 1; line < node.Line; line++ {
+		i := bytes.IndexByte(data[offset:], '\n')
+		if i < 0 {
+			return 0, fmt.Errorf("line %d not found", node.Line)
+		}
+		offset += i + 1
+	}
+	for column := 1; column < node.Column; column++ {
+		if offset >= len(data) {
+			return 0, fmt.Errorf("column %d of line %d not found", node.Column, node.Line)
+		}
+		_, size := utf8.DecodeRune(data[offset:])
+		offset += size
+	}
+	return offset, nil
+}
@@ -0,0 +1,192 @@
+/*
+Copyright 2023 Thomas Stadler <thomas@thomasst.xyz>.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package promotion
+
+import (
+	"errors"
+	"testing/fstest"
+
+	"github.com/go-git/go-billy/v5/memfs"
+	"github.com/go-git/go-billy/v5/util"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	apiv1alpha1 "github.com/thomasstxyz/release-promotion-operator/api/v1alpha1"
+)
+
+const (
+	devHelmRelease = `apiVersion: v1
+kind: Namespace
+metadata:
+  name: podinfo
+---
+apiVersion: helm.toolkit.fluxcd.io/v2beta1
+kind: HelmRelease
+metadata:
+  name: podinfo
+spec:
+  chart:
+    spec:
+      chart: podinfo
+      version: 6.3.5
+`
+	prodHelmRelease = `# Managed by promotions
+apiVersion: helm.toolkit.fluxcd.io/v2beta1
+kind: HelmRelease
+metadata:
+  name: podinfo
+spec:
+  chart:
+    spec:
+      chart: podinfo
+      version: "6.2.0" # pinned
+  values:
+    replicaCount: 3
+`
+	devChart = `apiVersion: v2
+name: platform
+version: 1.0.0
+appVersion: "2023.4"
+dependencies:
+  - name: redis
+    version: 17.9.2
+    repository: https://charts.bitnami.com/bitnami
+  - name: podinfo
+    version: 6.3.5
+    repository: https://stefanprodan.github.io/podinfo
+`
+	prodChart = `apiVersion: v2
+name: platform
+version: 1.0.0
+appVersion: '2023.1'
+dependencies:
+  - name: podinfo
+    version: 6.2.0
+    repository: https://stefanprodan.github.io/podinfo
+`
+	prodApplication = `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: podinfo-values
+data:
+  version: 6.2.0
+---
+apiVersion: argoproj.io/v1alpha1
+kind: Application
+metadata:
+  name: podinfo
+spec:
+  sources:
+    - repoURL: https://github.com/acme/values
+      targetRevision: main
+    - repoURL: https://stefanprodan.github.io/podinfo
+      chart: podinfo
+      targetRevision: 6.2.0
+`
+)
+
+var _ = Describe("Promoting chart versions", func() {
+	var (
+		from *Source
+		to   *Destination
+	)
+
+	BeforeEach(func() {
+		from = &Source{Name: "dev", Path: "envs/dev", FS: fstest.MapFS{
+			"envs/dev/podinfo.yaml": {Data: []byte(devHelmRelease), Mode: 0o644},
+			"envs/dev/Chart.yaml":   {Data: []byte(devChart), Mode: 0o644},
+		}}
+		to = &Destination{Name: "prod", Path: "envs/prod", FS: memfs.New()}
+		Expect(util.WriteFile(to.FS, "envs/prod/podinfo.yaml", []byte(prodHelmRelease), 0o644)).To(Succeed())
+		Expect(util.WriteFile(to.FS, "envs/prod/Chart.yaml", []byte(prodChart), 0o644)).To(Succeed())
+		Expect(util.WriteFile(to.FS, "envs/prod/application.yaml", []byte(prodApplication), 0o644)).To(Succeed())
+	})
+
+	readFile := func(name string) string {
+		data, err := util.ReadFile(to.FS, name)
+		Expect(err).NotTo(HaveOccurred())
+		return string(data)
+	}
+
+	It("promotes the version of HelmReleases, keeping the rest of the file", func() {
+		changes, err := ApplyTemplateFS(from, to, &apiv1alpha1.PromotionTemplateSpec{Charts: []apiv1alpha1.ChartOperation{
+			{Name: "podinfo", Source: "podinfo.yaml", Destination: "podinfo.yaml"},
+		}})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(changes).To(Equal(&ChangeSet{Modified: []string{"envs/prod/podinfo.yaml"}}))
+		Expect(readFile("envs/prod/podinfo.yaml")).To(Equal(
+			`# Managed by promotions
+apiVersion: helm.toolkit.fluxcd.io/v2beta1
+kind: HelmRelease
+metadata:
+  name: podinfo
+spec:
+  chart:
+    spec:
+      chart: podinfo
+      version: "6.3.5" # pinned
+  values:
+    replicaCount: 3
+`))
+	})
+
+	It("promotes the version of Chart.yaml dependencies and their appVersion", func() {
+		_, err := ApplyTemplateFS(from, to, &apiv1alpha1.PromotionTemplateSpec{Charts: []apiv1alpha1.ChartOperation{
+			{Name: "podinfo", Source: "Chart.yaml", Destination: "Chart.yaml", AppVersion: true},
+		}})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(readFile("envs/prod/Chart.yaml")).To(Equal(
+			`apiVersion: v2
+name: platform
+version: 1.0.0
+appVersion: '2023.4'
+dependencies:
+  - name: podinfo
+    version: 6.3.5
+    repository: https://stefanprodan.github.io/podinfo
+`))
+	})
+
+	It("promotes the targetRevision of Argo CD Applications", func() {
+		changes, err := ApplyTemplateFS(from, to, &apiv1alpha1.PromotionTemplateSpec{Charts: []apiv1alpha1.ChartOperation{
+			{Name: "podinfo", Source: "podinfo.yaml", Destination: "application.yaml"},
+		}})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(changes.Modified).To(ConsistOf("envs/prod/application.yaml"))
+		Expect(readFile("envs/prod/application.yaml")).To(ContainSubstring("chart: podinfo\n      targetRevision: 6.3.5\n"))
+		Expect(readFile("envs/prod/application.yaml")).To(ContainSubstring("targetRevision: main\n"))
+		Expect(readFile("envs/prod/application.yaml")).To(ContainSubstring("version: 6.2.0\n"))
+	})
+
+	It("rejects versions outside of the constraints of the destination", func() {
+		to.ChartConstraints = []apiv1alpha1.ChartConstraint{{Name: "podinfo", Version: ">=6.0.0 <6.3.0"}}
+		_, err := ApplyTemplateFS(from, to, &apiv1alpha1.PromotionTemplateSpec{Charts: []apiv1alpha1.ChartOperation{
+			{Name: "podinfo", Source: "podinfo.yaml", Destination: "podinfo.yaml"},
+		}})
+		var versionErr *ChartVersionError
+		Expect(errors.As(err, &versionErr)).To(BeTrue())
+		Expect(err).To(MatchError(`version 6.3.5 of chart podinfo is not in the range ">=6.0.0 <6.3.0" of environment prod`))
+		Expect(readFile("envs/prod/podinfo.yaml")).To(Equal(prodHelmRelease))
+	})
+
+	It("fails if the chart is not referenced", func() {
+		_, err := ApplyTemplateFS(from, to, &apiv1alpha1.PromotionTemplateSpec{Charts: []apiv1alpha1.ChartOperation{
+			{Name: "redis", Source: "Chart.yaml", Destination: "Chart.yaml"},
+		}})
+		Expect(err).To(MatchError("Chart.yaml of environment prod: no reference to chart redis found"))
+	})
+})
@@ -0,0 +1,102 @@
+/*
+Copyright 2023 Thomas Stadler <thomas@thomasst.xyz>.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package promotion is the promotion engine shared by the operator and the
+// promote CLI, and can be embedded by other controllers and tools.
+//
+// A Resolver fetches the Environments and the PromotionTemplate of a Promotion,
+// and EvaluateTrigger, RequireApproval and CheckReadiness evaluate the gates
+// a promotion has to pass. ApplyFS applies the copy operations of the template
+// from the file system of the source environment to the one of the destination
+// environment and returns the ChangeSet, and ApplyTemplateFS its chart operations
+// as well. Apply and ApplyTemplate do the same for local Git checkouts, whose
+// result can be committed or diffed. SetImagesFS and SetImages
+// set the tag an ImageRepository selected in the destination environment instead.
+// ExtractVersion and CheckVersion evaluate the version policy of the destination
+// environment against the version of the source revision.
+package promotion
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/go-git/go-billy/v5/osfs"
+	"github.com/go-git/go-git/v5"
+
+	apiv1alpha1 "github.com/thomasstxyz/release-promotion-operator/api/v1alpha1"
+)
+
+// Checkout is a local working tree of an environment.
+type Checkout struct {
+	// Name is the name of the environment, used in errors.
+	Name string
+	// Dir is the root directory of the working tree.
+	Dir string
+	// Path is the directory of the environment relative to Dir.
+	Path string
+	// Repo is the Git repository of the working tree, if any.
+	// It is required to commit and diff the working tree.
+	Repo *git.Repository
+
+	// SOPSKeys holds the keys of the SOPS-encrypted files, if set.
+	SOPSKeys *SOPSKeyring
+	// ChartConstraints constrain the chart versions promoted to the environment.
+	ChartConstraints []apiv1alpha1.ChartConstraint
+}
+
+// Head returns the commit SHA of the checked out branch.
+func (c *Checkout) Head() (string, error) {
+	if c.Repo == nil {
+		return "", fmt.Errorf("%s is not a Git repository", c.Dir)
+	}
+	ref, err := c.Repo.Head()
+	if err != nil {
+		return "", err
+	}
+	return ref.Hash().String(), nil
+}
+
+// source returns the working tree as the Source of a promotion.
+func (c *Checkout) source() *Source {
+	return &Source{Name: c.Name, FS: os.DirFS(c.Dir), Path: c.Path, SOPSKeys: c.SOPSKeys}
+}
+
+// destination returns the working tree as the Destination of a promotion.
+func (c *Checkout) destination() *Destination {
+	return &Destination{Name: c.Name, FS: osfs.New(c.Dir), Path: c.Path, SOPSKeys: c.SOPSKeys, Committed: c.headFile,
+		ChartConstraints: c.ChartConstraints}
+}
+
+// headFile returns the content of the file in the HEAD commit of the checkout.
+func (c *Checkout) headFile(name string) ([]byte, error) {
+	if c.Repo == nil {
+		return nil, os.ErrNotExist
+	}
+	ref, err := c.Repo.Head()
+	if err != nil {
+		return nil, err
+	}
+	commit, err := c.Repo.CommitObject(ref.Hash())
+	if err != nil {
+		return nil, err
+	}
+	f, err := commit.File(name)
+	if err != nil {
+		return nil, err
+	}
+	contents, err := f.Contents()
+	return []byte(contents), err
+}
@@ -0,0 +1,162 @@
+/*
+Copyright 2023 Thomas Stadler <thomas@thomasst.xyz>.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package promotion
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+)
+
+const (
+	// cosignSignatureAnnotation is the annotation of the signature layers holding the signature.
+	cosignSignatureAnnotation = "dev.cosignproject.cosign/signature"
+	// maxCosignPayloadSize is the maximum size of a signed payload.
+	maxCosignPayloadSize = 1 << 20
+)
+
+// cosignPayload is the simple signing payload signed by cosign.
+type cosignPayload struct {
+	Critical struct {
+		Image struct {
+			DockerManifestDigest string `json:"docker-manifest-digest"`
+		} `json:"image"`
+	} `json:"critical"`
+}
+
+// CosignVerifier verifies the cosign signatures of OCI artifacts with trusted public keys.
+// Only signatures made with keys are supported, not keyless signatures.
+type CosignVerifier struct {
+	names []string
+	keys  map[string]crypto.PublicKey
+}
+
+// NewCosignVerifier returns a verifier of the PEM-encoded public keys by name,
+// as written by 'cosign generate-key-pair'.
+func NewCosignVerifier(keys map[string][]byte) (*CosignVerifier, error) {
+	v := &CosignVerifier{keys: map[string]crypto.PublicKey{}}
+	for keyName, data := range keys {
+		block, _ := pem.Decode(data)
+		if block == nil {
+			return nil, fmt.Errorf("invalid %s: no PEM-encoded public key found", keyName)
+		}
+		key, err := x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s: %w", keyName, err)
+		}
+		v.names = append(v.names, keyName)
+		v.keys[keyName] = key
+	}
+	if len(v.names) == 0 {
+		return nil, errors.New("no public keys found")
+	}
+	sort.Strings(v.names)
+	return v, nil
+}
+
+// Verify verifies that the artifact with the digest in the repository has been signed
+// with one of the keys, and returns the name of the key.
+func (v *CosignVerifier) Verify(ctx context.Context, repo *OCIRepository, digest v1.Hash) (string, error) {
+	sigTag := cosignSignatureTag(repo.Tag.Context(), digest)
+	img, err := remote.Image(sigTag, repo.options(ctx)...)
+	if isNotFound(err) {
+		return "", errors.New("artifact is not signed")
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to fetch signatures %s: %w", sigTag, err)
+	}
+	manifest, err := img.Manifest()
+	if err != nil {
+		return "", err
+	}
+
+	for _, layer := range manifest.Layers {
+		encoded, ok := layer.Annotations[cosignSignatureAnnotation]
+		if !ok || layer.Size > maxCosignPayloadSize {
+			continue
+		}
+		signature, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			continue
+		}
+		payload, err := layerContent(img, layer.Digest)
+		if err != nil {
+			return "", err
+		}
+
+		var p cosignPayload
+		if err := json.Unmarshal(payload, &p); err != nil || p.Critical.Image.DockerManifestDigest != digest.String() {
+			continue
+		}
+		for _, keyName := range v.names {
+			if verifySignature(v.keys[keyName], payload, signature) {
+				return keyName, nil
+			}
+		}
+	}
+	return "", errors.New("no signature of a trusted key found")
+}
+
+// cosignSignatureTag returns the tag cosign stores the signatures of the artifact with the digest at.
+func cosignSignatureTag(repo name.Repository, digest v1.Hash) name.Tag {
+	return repo.Tag(fmt.Sprintf("%s-%s.sig", digest.Algorithm, digest.Hex))
+}
+
+// layerContent returns the content of the layer, which is verified against the digest.
+func layerContent(img v1.Image, digest v1.Hash) ([]byte, error) {
+	layer, err := img.LayerByDigest(digest)
+	if err != nil {
+		return nil, err
+	}
+	rc, err := layer.Compressed()
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	return io.ReadAll(io.LimitReader(rc, maxCosignPayloadSize))
+}
+
+// verifySignature verifies the signature of the payload, which is signed with its
+// SHA-256 digest for ECDSA and RSA keys, and as is for Ed25519 keys.
+func verifySignature(key crypto.PublicKey, payload, signature []byte) bool {
+	digest := sha256.Sum256(payload)
+	switch k := key.(type) {
+	case *ecdsa.PublicKey:
+		return ecdsa.VerifyASN1(k, digest[:], signature)
+	case *rsa.PublicKey:
+		return rsa.VerifyPKCS1v15(k, crypto.SHA256, digest[:], signature) == nil
+	case ed25519.PublicKey:
+		return ed25519.Verify(k, payload, signature)
+	default:
+		return false
+	}
+}
@@ -0,0 +1,148 @@
+/*
+Copyright 2023 Thomas Stadler <thomas@thomasst.xyz>.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package promotion
+
+import (
+	"fmt"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/cli-utils/pkg/kstatus/status"
+
+	apiv1alpha1 "github.com/thomasstxyz/release-promotion-operator/api/v1alpha1"
+)
+
+// Trigger is the evaluated Trigger of a Promotion.
+type Trigger struct {
+	// Due is true if the current source revision is to be promoted.
+	Due bool
+	// Message explains what the Promotion is waiting for if it is not due.
+	Message string
+	// RequeueAfter is the duration after which the Trigger is evaluated again, if any.
+	RequeueAfter time.Duration
+
+	// RequestedAt is the value of the RequestedAtAnnotation, if it has not been handled yet.
+	RequestedAt string
+	// Scheduled is true if a promotion of the Schedule trigger is due.
+	Scheduled bool
+	// NextSchedule is the time of the next promotion of the Schedule trigger.
+	NextSchedule *metav1.Time
+}
+
+// EvaluateTrigger determines whether the Trigger of the Promotion is due at now.
+// A missed scheduled promotion is caught up with once, and a promotion requested
+// by the RequestedAtAnnotation or the approval of the pending source revision
+// is due regardless of the type of the Trigger.
+func EvaluateTrigger(promotion *apiv1alpha1.Promotion, now time.Time) (Trigger, error) {
+	t := Trigger{}
+
+	switch promotion.TriggerType() {
+	case apiv1alpha1.ScheduleTrigger:
+		schedule, err := promotion.TriggerSchedule()
+		if err != nil {
+			return t, fmt.Errorf("invalid schedule %q: %w", promotion.Spec.Trigger.Schedule, err)
+		}
+		last := promotion.CreationTimestamp.Time
+		if promotion.Status.LastScheduleTime != nil {
+			last = promotion.Status.LastScheduleTime.Time
+		}
+		t.Scheduled = !schedule.Next(last).After(now)
+		t.Due = t.Scheduled
+
+		next := schedule.Next(now)
+		t.NextSchedule = &metav1.Time{Time: next}
+		t.RequeueAfter = next.Sub(now)
+		t.Message = fmt.Sprintf("Waiting for the next scheduled promotion at %s", next.UTC().Format(time.RFC3339))
+	case apiv1alpha1.ManualTrigger:
+		t.Message = fmt.Sprintf("Waiting for a promotion to be requested with the %s annotation", apiv1alpha1.RequestedAtAnnotation)
+	default:
+		t.Due = true
+		t.RequeueAfter = promotion.TriggerInterval()
+	}
+
+	// Approving the pending source revision promotes it
+	if pending := promotion.Status.PendingApprovalRevision; pending != "" && promotion.Approved(pending) {
+		t.Due = true
+	}
+	if requestedAt, ok := promotion.PromotionRequest(); ok {
+		t.RequestedAt = requestedAt
+		t.Due = true
+	}
+	return t, nil
+}
+
+// Handled records in the status of the Promotion that the
+// promotion of the Trigger has been attempted at now.
+func (t Trigger) Handled(promotion *apiv1alpha1.Promotion, now time.Time) {
+	if t.RequestedAt != "" {
+		promotion.Status.LastHandledRequestedAt = t.RequestedAt
+	}
+	if t.Scheduled {
+		promotion.Status.LastScheduleTime = &metav1.Time{Time: now}
+	}
+}
+
+// ApprovalRequiredError is returned if the source revision has not been approved.
+type ApprovalRequiredError struct {
+	Revision string
+}
+
+func (e *ApprovalRequiredError) Error() string {
+	return fmt.Sprintf("source revision %s is waiting for approval, set the %s annotation to approve it",
+		e.Revision, apiv1alpha1.ApprovedRevisionAnnotation)
+}
+
+// RequireApproval records the source revision as pending approval and returns
+// an ApprovalRequiredError, unless the Promotion has approved it.
+func RequireApproval(promotion *apiv1alpha1.Promotion, revision string) error {
+	if promotion.Approved(revision) {
+		promotion.Status.PendingApprovalRevision = ""
+		return nil
+	}
+	promotion.Status.PendingApprovalRevision = revision
+	return &ApprovalRequiredError{Revision: revision}
+}
+
+// PromotedBefore returns true if the source revision is in the history of successful promotions.
+func PromotedBefore(promotion *apiv1alpha1.Promotion, sourceRevision string) bool {
+	for _, record := range promotion.Status.History {
+		if record.Outcome == apiv1alpha1.PromotionSucceeded && record.SourceRevision == sourceRevision {
+			return true
+		}
+	}
+	return false
+}
+
+// CheckReadiness computes the status of the dependent object of the readiness check
+// using [kstatus](https://github.com/kubernetes-sigs/cli-utils/tree/master/pkg/kstatus)
+// and returns it as an UnreadyObject if it is not ready, or nil if it is.
+func CheckReadiness(ref apiv1alpha1.LocalObjectsRef, obj *unstructured.Unstructured) (*apiv1alpha1.UnreadyObject, error) {
+	result, err := status.Compute(obj)
+	if err != nil {
+		return nil, fmt.Errorf("failed to compute status of %s %s/%s: %w",
+			ref.GroupVersionResource.Resource, obj.GetNamespace(), obj.GetName(), err)
+	}
+	if result.Status == status.CurrentStatus {
+		return nil, nil
+	}
+	return &apiv1alpha1.UnreadyObject{
+		LocalObjectsRef: ref,
+		Status:          result.Status.String(),
+		Message:         result.Message,
+	}, nil
+}
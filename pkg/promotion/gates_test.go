@@ -0,0 +1,145 @@
+/*
+Copyright 2023 Thomas Stadler <thomas@thomasst.xyz>.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package promotion
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	apiv1alpha1 "github.com/thomasstxyz/release-promotion-operator/api/v1alpha1"
+)
+
+var _ = Describe("Promotion triggers", func() {
+	var (
+		created   = time.Date(2023, 3, 1, 8, 30, 0, 0, time.UTC)
+		promotion *apiv1alpha1.Promotion
+	)
+
+	BeforeEach(func() {
+		promotion = &apiv1alpha1.Promotion{ObjectMeta: metav1.ObjectMeta{CreationTimestamp: metav1.Time{Time: created}}}
+	})
+
+	It("promotes every new revision by default", func() {
+		trigger, err := EvaluateTrigger(promotion, created)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(trigger.Due).To(BeTrue())
+		Expect(trigger.RequeueAfter).To(Equal(apiv1alpha1.DefaultTriggerInterval))
+	})
+
+	It("promotes once per scheduled time", func() {
+		promotion.Spec.Trigger = &apiv1alpha1.Trigger{Type: apiv1alpha1.ScheduleTrigger, Schedule: "0 9 * * *"}
+
+		trigger, err := EvaluateTrigger(promotion, created.Add(time.Minute))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(trigger.Due).To(BeFalse())
+		Expect(trigger.RequeueAfter).To(Equal(29 * time.Minute))
+
+		// A missed schedule is caught up with once
+		now := created.Add(26 * time.Hour)
+		trigger, err = EvaluateTrigger(promotion, now)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(trigger.Due).To(BeTrue())
+		Expect(trigger.NextSchedule.Time).To(Equal(time.Date(2023, 3, 3, 9, 0, 0, 0, time.UTC)))
+
+		trigger.Handled(promotion, now)
+		trigger, err = EvaluateTrigger(promotion, now.Add(time.Minute))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(trigger.Due).To(BeFalse())
+	})
+
+	It("promotes on request only once per annotation value", func() {
+		promotion.Spec.Trigger = &apiv1alpha1.Trigger{Type: apiv1alpha1.ManualTrigger}
+
+		trigger, err := EvaluateTrigger(promotion, created)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(trigger.Due).To(BeFalse())
+		Expect(trigger.RequeueAfter).To(BeZero())
+
+		promotion.Annotations = map[string]string{apiv1alpha1.RequestedAtAnnotation: "2023-03-01T10:00:00Z"}
+		trigger, err = EvaluateTrigger(promotion, created)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(trigger.Due).To(BeTrue())
+
+		trigger.Handled(promotion, created)
+		Expect(promotion.Status.LastHandledRequestedAt).To(Equal("2023-03-01T10:00:00Z"))
+		trigger, err = EvaluateTrigger(promotion, created)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(trigger.Due).To(BeFalse())
+	})
+
+	It("promotes the pending source revision once approved", func() {
+		promotion.Spec.Trigger = &apiv1alpha1.Trigger{Type: apiv1alpha1.ManualTrigger}
+		promotion.Spec.RequireApproval = true
+		promotion.Status.PendingApprovalRevision = "1f0c3e2"
+
+		trigger, err := EvaluateTrigger(promotion, created)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(trigger.Due).To(BeFalse())
+
+		promotion.Annotations = map[string]string{apiv1alpha1.ApprovedRevisionAnnotation: "1f0c3e2"}
+		trigger, err = EvaluateTrigger(promotion, created)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(trigger.Due).To(BeTrue())
+		Expect(RequireApproval(promotion, "1f0c3e2")).To(Succeed())
+		Expect(promotion.Status.PendingApprovalRevision).To(BeEmpty())
+
+		Expect(RequireApproval(promotion, "7d4a9b1")).To(MatchError(ContainSubstring("7d4a9b1 is waiting for approval")))
+		Expect(promotion.Status.PendingApprovalRevision).To(Equal("7d4a9b1"))
+	})
+})
+
+var _ = Describe("Readiness checks", func() {
+	ref := apiv1alpha1.LocalObjectsRef{Name: "podinfo"}
+
+	newDeployment := func(generation, observedGeneration int64) *unstructured.Unstructured {
+		return &unstructured.Unstructured{Object: map[string]any{
+			"apiVersion": "apps/v1",
+			"kind":       "Deployment",
+			"metadata":   map[string]any{"name": "podinfo", "namespace": "apps", "generation": generation},
+			"spec":       map[string]any{"replicas": int64(1)},
+			"status": map[string]any{
+				"observedGeneration": observedGeneration,
+				"replicas":           int64(1),
+				"updatedReplicas":    int64(1),
+				"readyReplicas":      int64(1),
+				"availableReplicas":  int64(1),
+				"conditions": []any{
+					map[string]any{"type": "Available", "status": "True"},
+				},
+			},
+		}}
+	}
+
+	It("passes current objects", func() {
+		unready, err := CheckReadiness(ref, newDeployment(2, 2))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(unready).To(BeNil())
+	})
+
+	It("reports objects which are not current", func() {
+		unready, err := CheckReadiness(ref, newDeployment(3, 2))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(unready).NotTo(BeNil())
+		Expect(unready.LocalObjectsRef).To(Equal(ref))
+		Expect(unready.Status).To(Equal("InProgress"))
+	})
+})
@@ -0,0 +1,152 @@
+/*
+Copyright 2023 Thomas Stadler <thomas@thomasst.xyz>.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package promotion
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/plumbing/transport"
+
+	apiv1alpha1 "github.com/thomasstxyz/release-promotion-operator/api/v1alpha1"
+)
+
+// CommitAuthor is the author of the commits created by the operator.
+var CommitAuthor = object.Signature{
+	Name:  "release-promotion-operator",
+	Email: "noreply@release-promotion-operator.io",
+}
+
+// Clone clones the branch of the repository at url into dir.
+func Clone(ctx context.Context, dir, url, branch string, auth transport.AuthMethod) (*git.Repository, error) {
+	repo, err := git.PlainCloneContext(ctx, dir, false, &git.CloneOptions{
+		URL:           url,
+		Auth:          auth,
+		ReferenceName: plumbing.NewBranchReferenceName(branch),
+		SingleBranch:  true,
+		Depth:         1,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to clone %s: %w", url, err)
+	}
+	return repo, nil
+}
+
+// Commit commits all changes in the checkout and returns the commit hash.
+// If there are no changes, the hash of the current HEAD is returned
+// and changed is false.
+func (c *Checkout) Commit(message string) (hash plumbing.Hash, changed bool, err error) {
+	if c.Repo == nil {
+		return plumbing.ZeroHash, false, fmt.Errorf("%s is not a Git repository", c.Dir)
+	}
+	wt, err := c.Repo.Worktree()
+	if err != nil {
+		return plumbing.ZeroHash, false, err
+	}
+	if err := wt.AddWithOptions(&git.AddOptions{All: true}); err != nil {
+		return plumbing.ZeroHash, false, err
+	}
+	st, err := wt.Status()
+	if err != nil {
+		return plumbing.ZeroHash, false, err
+	}
+	if st.IsClean() {
+		head, err := c.Repo.Head()
+		if err != nil {
+			return plumbing.ZeroHash, false, err
+		}
+		return head.Hash(), false, nil
+	}
+
+	author := CommitAuthor
+	author.When = time.Now()
+	h, err := wt.Commit(message, &git.CommitOptions{
+		All:    true,
+		Author: &author,
+	})
+	if err != nil {
+		return plumbing.ZeroHash, false, err
+	}
+	return h, true, nil
+}
+
+// Diff summarizes the uncommitted changes in the checkout.
+// The changes are committed to the repository to be able to diff the trees,
+// so the checkout must be a temporary clone the commit never leaves.
+// The patch is truncated to maxPatchSize bytes, unless maxPatchSize is 0.
+func (c *Checkout) Diff(ctx context.Context, maxPatchSize int) (*apiv1alpha1.DryRunResult, error) {
+	if c.Repo == nil {
+		return nil, fmt.Errorf("%s is not a Git repository", c.Dir)
+	}
+	head, err := c.Repo.Head()
+	if err != nil {
+		return nil, err
+	}
+	result := &apiv1alpha1.DryRunResult{
+		TargetRevision: head.Hash().String(),
+	}
+
+	hash, changed, err := c.Commit("dry run")
+	if err != nil {
+		return nil, err
+	}
+	if !changed {
+		return result, nil
+	}
+
+	before, err := c.Repo.CommitObject(head.Hash())
+	if err != nil {
+		return nil, err
+	}
+	after, err := c.Repo.CommitObject(hash)
+	if err != nil {
+		return nil, err
+	}
+	patch, err := before.PatchContext(ctx, after)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, fp := range patch.FilePatches() {
+		f, t := fp.Files()
+		switch {
+		case f == nil:
+			result.Added = append(result.Added, t.Path())
+		case t == nil:
+			result.Deleted = append(result.Deleted, f.Path())
+		default:
+			result.Modified = append(result.Modified, t.Path())
+		}
+	}
+	for _, stat := range patch.Stats() {
+		result.LinesAdded += stat.Addition
+		result.LinesDeleted += stat.Deletion
+	}
+
+	result.Patch = patch.String()
+	if maxPatchSize > 0 && len(result.Patch) > maxPatchSize {
+		result.Patch = strings.ToValidUTF8(result.Patch[:maxPatchSize], "")
+		result.PatchTruncated = true
+	}
+
+	return result, nil
+}
@@ -0,0 +1,131 @@
+/*
+Copyright 2023 Thomas Stadler <thomas@thomasst.xyz>.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package promotion
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/go-git/go-git/v5"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	apiv1alpha1 "github.com/thomasstxyz/release-promotion-operator/api/v1alpha1"
+)
+
+var _ = Describe("Git checkouts", func() {
+	var (
+		ctx    context.Context
+		origin *Checkout
+		url    string
+		head   string
+	)
+
+	writeFile := func(c *Checkout, name, content string) {
+		path := filepath.Join(c.Dir, c.Path, name)
+		Expect(os.MkdirAll(filepath.Dir(path), 0o755)).To(Succeed())
+		Expect(os.WriteFile(path, []byte(content), 0o644)).To(Succeed())
+	}
+
+	clone := func() *Checkout {
+		dir := GinkgoT().TempDir()
+		repo, err := Clone(ctx, dir, url, "master", nil)
+		Expect(err).NotTo(HaveOccurred())
+		return &Checkout{Name: "prod", Dir: dir, Path: "envs/prod", Repo: repo}
+	}
+
+	BeforeEach(func() {
+		ctx = context.Background()
+		dir := GinkgoT().TempDir()
+		repo, err := git.PlainInit(dir, false)
+		Expect(err).NotTo(HaveOccurred())
+		origin = &Checkout{Name: "prod", Dir: dir, Path: "envs/prod", Repo: repo}
+		writeFile(origin, "app/deployment.yaml", "image: podinfo:6.2.0\n")
+		_, _, err = origin.Commit("Initial commit")
+		Expect(err).NotTo(HaveOccurred())
+		head, err = origin.Head()
+		Expect(err).NotTo(HaveOccurred())
+		url = "file://" + dir
+	})
+
+	It("clones the branch and commits changes", func() {
+		c := clone()
+		Expect(c.Head()).To(Equal(head))
+
+		hash, changed, err := c.Commit("Nothing to commit")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(changed).To(BeFalse())
+		Expect(hash.String()).To(Equal(head))
+
+		writeFile(c, "app/deployment.yaml", "image: podinfo:6.3.0\n")
+		hash, changed, err = c.Commit("Promote podinfo 6.3.0")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(changed).To(BeTrue())
+		Expect(c.Head()).To(Equal(hash.String()))
+
+		commit, err := c.Repo.CommitObject(hash)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(commit.Author.Name).To(Equal(CommitAuthor.Name))
+		Expect(commit.ParentHashes).To(HaveLen(1))
+		Expect(commit.ParentHashes[0].String()).To(Equal(head))
+	})
+
+	It("fails to clone missing branches", func() {
+		_, err := Clone(ctx, GinkgoT().TempDir(), url, "main", nil)
+		Expect(err).To(MatchError(ContainSubstring("failed to clone " + url)))
+	})
+
+	It("diffs against the cloned revision without changing the remote", func() {
+		c := clone()
+		writeFile(c, "app/deployment.yaml", "image: podinfo:6.3.0\n")
+		writeFile(c, "app/service.yaml", "port: 9898\n")
+
+		result, err := c.Diff(ctx, apiv1alpha1.MaxDryRunPatchSize)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result.TargetRevision).To(Equal(head))
+		Expect(result.Added).To(ConsistOf("envs/prod/app/service.yaml"))
+		Expect(result.Modified).To(ConsistOf("envs/prod/app/deployment.yaml"))
+		Expect(result.Deleted).To(BeEmpty())
+		Expect(result.LinesAdded).To(Equal(2))
+		Expect(result.LinesDeleted).To(Equal(1))
+		Expect(result.PatchTruncated).To(BeFalse())
+
+		Expect(origin.Head()).To(Equal(head))
+		Expect(clone().Head()).To(Equal(head))
+	})
+
+	It("truncates large patches to valid UTF-8", func() {
+		c := clone()
+		writeFile(c, "app/configmap.yaml", strings.Repeat("motd: grüß gott\n", apiv1alpha1.MaxDryRunPatchSize))
+
+		result, err := c.Diff(ctx, apiv1alpha1.MaxDryRunPatchSize)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result.Added).To(ConsistOf("envs/prod/app/configmap.yaml"))
+		Expect(result.LinesAdded).To(Equal(apiv1alpha1.MaxDryRunPatchSize))
+		Expect(result.PatchTruncated).To(BeTrue())
+		Expect(len(result.Patch)).To(BeNumerically("<=", apiv1alpha1.MaxDryRunPatchSize))
+		Expect(result.Patch).To(HavePrefix("diff --git"))
+	})
+
+	It("reports no changes", func() {
+		result, err := clone().Diff(ctx, apiv1alpha1.MaxDryRunPatchSize)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result).To(Equal(&apiv1alpha1.DryRunResult{TargetRevision: head}))
+	})
+})
@@ -0,0 +1,245 @@
+/*
+Copyright 2023 Thomas Stadler <thomas@thomasst.xyz>.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package promotion
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/blang/semver"
+	"github.com/go-git/go-billy/v5/util"
+	"github.com/go-git/go-git/v5"
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+
+	apiv1alpha1 "github.com/thomasstxyz/release-promotion-operator/api/v1alpha1"
+)
+
+// ErrNoTagSelected is returned if none of the tags of an image repository passes its policy.
+var ErrNoTagSelected = errors.New("no tag matches the image policy")
+
+// TagLister lists the tags of image repositories. RegistryTagLister lists them
+// in the registry, other implementations can stand in for it, e.g. in tests.
+type TagLister interface {
+	ListTags(ctx context.Context, repo name.Repository) ([]string, error)
+}
+
+// RegistryTagLister lists the tags of image repositories in their registry.
+type RegistryTagLister struct {
+	// Options are the options of the requests to the registry, e.g. the credentials.
+	Options []remote.Option
+}
+
+// ListTags lists the tags of the repository.
+func (l *RegistryTagLister) ListTags(ctx context.Context, repo name.Repository) ([]string, error) {
+	tags, err := remote.List(repo, append([]remote.Option{remote.WithContext(ctx)}, l.Options...)...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list tags of %s: %w", repo, err)
+	}
+	return tags, nil
+}
+
+// ImageRepository is the image repository of an environment,
+// whose latest tag is selected by a policy.
+type ImageRepository struct {
+	// Name is the name of the environment, used in errors.
+	Name string
+	// Repository is the image repository.
+	Repository name.Repository
+	// Policy selects the latest tag.
+	Policy apiv1alpha1.ImagePolicy
+	// Tags lists the tags of the repository.
+	Tags TagLister
+}
+
+// NewImageRepository returns the image repository of the spec, whose tags are
+// listed by tags. If tags is nil, they are listed in the registry.
+func NewImageRepository(envName string, spec *apiv1alpha1.ImageRepositorySpec, tags TagLister) (*ImageRepository, error) {
+	nameOpts := []name.Option{name.StrictValidation}
+	if spec.Insecure {
+		nameOpts = append(nameOpts, name.Insecure)
+	}
+	repo, err := name.NewRepository(spec.Repository, nameOpts...)
+	if err != nil {
+		return nil, fmt.Errorf("invalid image repository of environment %s: %w", envName, err)
+	}
+	if tags == nil {
+		tags = &RegistryTagLister{}
+	}
+	return &ImageRepository{Name: envName, Repository: repo, Policy: spec.Policy, Tags: tags}, nil
+}
+
+// LatestTag returns the tag of the repository selected by the policy.
+func (r *ImageRepository) LatestTag(ctx context.Context) (string, error) {
+	tags, err := r.Tags.ListTags(ctx, r.Repository)
+	if err != nil {
+		return "", err
+	}
+	tag, err := SelectTag(r.Policy, tags)
+	if err != nil {
+		return "", fmt.Errorf("image repository %s of environment %s: %w", r.Repository, r.Name, err)
+	}
+	return tag, nil
+}
+
+// SelectTag returns the latest of the tags according to the policy, like the
+// ImagePolicies of Flux: the tags are filtered by the pattern and ordered by the
+// value extracted from them, either as semantic versions within the range or
+// alphabetically.
+func SelectTag(policy apiv1alpha1.ImagePolicy, tags []string) (string, error) {
+	var pattern *regexp.Regexp
+	if policy.Pattern != "" {
+		var err error
+		if pattern, err = regexp.Compile(policy.Pattern); err != nil {
+			return "", fmt.Errorf("invalid pattern: %w", err)
+		}
+	}
+	var semverRange semver.Range
+	// Pre-releases are only selected if the range mentions one, e.g. '>=2.0.0-rc.0'
+	preReleases := strings.Contains(policy.SemVer, "-")
+	if policy.SemVer != "" {
+		var err error
+		if semverRange, err = semver.ParseRange(policy.SemVer); err != nil {
+			return "", fmt.Errorf("invalid semver range: %w", err)
+		}
+	}
+
+	var latestTag, latestValue string
+	var latestVersion semver.Version
+	for _, tag := range tags {
+		value := tag
+		if pattern != nil {
+			match := pattern.FindStringSubmatchIndex(tag)
+			if match == nil {
+				continue
+			}
+			if policy.Extract != "" {
+				value = string(pattern.ExpandString(nil, policy.Extract, tag, match))
+			}
+		}
+
+		if semverRange != nil {
+			version, err := semver.ParseTolerant(value)
+			if err != nil || !semverRange(version) || (len(version.Pre) > 0 && !preReleases) {
+				continue
+			}
+			if latestTag == "" || version.GT(latestVersion) || (version.EQ(latestVersion) && tag > latestTag) {
+				latestTag, latestVersion = tag, version
+			}
+			continue
+		}
+		if latestTag == "" || value > latestValue || (value == latestValue && tag > latestTag) {
+			latestTag, latestValue = tag, value
+		}
+	}
+
+	if latestTag == "" {
+		return "", ErrNoTagSelected
+	}
+	return latestTag, nil
+}
+
+// SetImages sets the tag of the images of the template's image operations
+// in the destination checkout.
+func SetImages(to *Checkout, ops []apiv1alpha1.ImageOperation, repository, tag string) (*ChangeSet, error) {
+	return SetImagesFS(to.destination(), ops, repository, tag)
+}
+
+// SetImagesFS sets the tag of the references to the images of the operations in
+// the YAML files of the destination and returns the changed files. Operations
+// without a name update the references to the repository. Digests pinning the
+// references are removed, as they belong to the previous tag.
+func SetImagesFS(to *Destination, ops []apiv1alpha1.ImageOperation, repository, tag string) (*ChangeSet, error) {
+	changes := newChangeTracker(to.FS)
+	for _, op := range ops {
+		image := op.Name
+		if image == "" {
+			image = repository
+		}
+		reference := imageReferencePattern(image)
+
+		paths := op.Paths
+		if len(paths) == 0 {
+			paths = []string{"."}
+		}
+		for _, p := range paths {
+			root, err := environmentPath(to.Name, to.Path, p)
+			if err != nil {
+				return nil, err
+			}
+			if _, err := to.FS.Lstat(root); os.IsNotExist(err) {
+				return nil, fmt.Errorf("path %q does not exist in environment %s", p, to.Name)
+			}
+
+			err = util.Walk(to.FS, root, func(name string, info fs.FileInfo, err error) error {
+				if err != nil {
+					return err
+				}
+				if info.IsDir() && info.Name() == git.GitDirName {
+					return fs.SkipDir
+				}
+				if !info.Mode().IsRegular() || (path.Ext(name) != ".yaml" && path.Ext(name) != ".yml") {
+					return nil
+				}
+
+				data, err := util.ReadFile(to.FS, name)
+				if err != nil {
+					return err
+				}
+				updated := setImageTag(reference, string(data), image+":"+tag)
+				if updated == string(data) {
+					return nil
+				}
+				return changes.write(name, []byte(updated), info.Mode().Perm())
+			})
+			if err != nil {
+				return nil, fmt.Errorf("failed to set the tag of %s in %s: %w", image, p, err)
+			}
+		}
+	}
+	return changes.changeSet()
+}
+
+// imageReferencePattern matches the references to the image with an optional tag and digest,
+// which start at the beginning of a line, after whitespace, quotes or '='.
+func imageReferencePattern(image string) *regexp.Regexp {
+	return regexp.MustCompile(`(?m)(?:^|[\s"'=])(` + regexp.QuoteMeta(image) + `(?::[\w][\w.-]{0,127})?(?:@sha256:[a-f0-9]{64})?)`)
+}
+
+// setImageTag replaces the references matched by the pattern with the reference,
+// if they end at the end of a line, before whitespace, quotes, commas or closing brackets.
+func setImageTag(pattern *regexp.Regexp, data, reference string) string {
+	var b strings.Builder
+	last := 0
+	for _, match := range pattern.FindAllStringSubmatchIndex(data, -1) {
+		start, end := match[2], match[3]
+		if end < len(data) && !strings.ContainsRune(" \t\r\n\"',]}", rune(data[end])) {
+			continue
+		}
+		b.WriteString(data[last:start])
+		b.WriteString(reference)
+		last = end
+	}
+	b.WriteString(data[last:])
+	return b.String()
+}
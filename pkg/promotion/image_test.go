@@ -0,0 +1,118 @@
+/*
+Copyright 2023 Thomas Stadler <thomas@thomasst.xyz>.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package promotion
+
+import (
+	"context"
+	"io"
+	"log"
+	"net/http/httptest"
+	"strings"
+
+	"github.com/go-git/go-billy/v5/memfs"
+	"github.com/go-git/go-billy/v5/util"
+	"github.com/google/go-containerregistry/pkg/registry"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	apiv1alpha1 "github.com/thomasstxyz/release-promotion-operator/api/v1alpha1"
+)
+
+var _ = Describe("Image repositories", func() {
+	DescribeTable("selects the latest tag",
+		func(policy apiv1alpha1.ImagePolicy, expected string) {
+			tags := []string{"1.9.0", "1.10.0", "2.0.0-rc.1", "v2.1.0", "main-a1b2c3-100", "main-d4e5f6-99", "latest"}
+			Expect(SelectTag(policy, tags)).To(Equal(expected))
+		},
+		Entry("by semver range", apiv1alpha1.ImagePolicy{SemVer: ">=1.0.0 <2.0.0"}, "1.10.0"),
+		Entry("by semver range with prefixed tags", apiv1alpha1.ImagePolicy{SemVer: ">=2.0.0"}, "v2.1.0"),
+		Entry("including pre-releases", apiv1alpha1.ImagePolicy{SemVer: ">=2.0.0-rc.0 <2.1.0"}, "2.0.0-rc.1"),
+		Entry("alphabetically by pattern", apiv1alpha1.ImagePolicy{Pattern: `^main-`}, "main-d4e5f6-99"),
+		Entry("by extracted versions", apiv1alpha1.ImagePolicy{
+			Pattern: `^main-[a-f0-9]+-(?P<build>\d+)$`, Extract: "$build", SemVer: ">=0.0.0"}, "main-a1b2c3-100"),
+	)
+
+	It("errors if no tag matches the policy", func() {
+		_, err := SelectTag(apiv1alpha1.ImagePolicy{SemVer: ">=3.0.0"}, []string{"1.0.0", "2.0.0"})
+		Expect(err).To(MatchError(ErrNoTagSelected))
+	})
+
+	It("lists the tags in the registry", func() {
+		server := httptest.NewServer(registry.New(registry.Logger(log.New(io.Discard, "", 0))))
+		DeferCleanup(server.Close)
+		host := strings.TrimPrefix(server.URL, "http://")
+
+		repo, err := NewImageRepository("dev", &apiv1alpha1.ImageRepositorySpec{
+			Repository: host + "/acme/podinfo", Insecure: true, Policy: apiv1alpha1.ImagePolicy{SemVer: ">=6.0.0 <7.0.0"},
+		}, nil)
+		Expect(err).NotTo(HaveOccurred())
+		img, err := random.Image(1024, 1)
+		Expect(err).NotTo(HaveOccurred())
+		for _, tag := range []string{"5.2.1", "6.3.0", "6.3.5"} {
+			Expect(remote.Write(repo.Repository.Tag(tag), img)).To(Succeed())
+		}
+
+		Expect(repo.LatestTag(context.Background())).To(Equal("6.3.5"))
+	})
+
+	Context("setting images", func() {
+		var to *Destination
+
+		BeforeEach(func() {
+			to = &Destination{Name: "prod", Path: "envs/prod", FS: memfs.New()}
+			Expect(util.WriteFile(to.FS, "envs/prod/app/deployment.yaml", []byte(
+				"containers:\n"+
+					"- image: ghcr.io/acme/podinfo:6.2.0\n"+
+					"- image: \"ghcr.io/acme/podinfo:6.2.0@sha256:"+strings.Repeat("a", 64)+"\"\n"+
+					"- image: ghcr.io/acme/podinfo-ui:6.2.0\n"+
+					"- args: [--image=ghcr.io/acme/podinfo]\n"), 0o644)).To(Succeed())
+			Expect(util.WriteFile(to.FS, "envs/prod/app/README.md", []byte("ghcr.io/acme/podinfo:6.2.0\n"), 0o644)).To(Succeed())
+			Expect(util.WriteFile(to.FS, "envs/prod/worker/deployment.yaml", []byte("image: ghcr.io/acme/worker:1.0.0\n"), 0o644)).To(Succeed())
+		})
+
+		It("sets the tag of the references to the image", func() {
+			changes, err := SetImagesFS(to, []apiv1alpha1.ImageOperation{{Paths: []string{"app"}}}, "ghcr.io/acme/podinfo", "6.3.0")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(changes).To(Equal(&ChangeSet{Modified: []string{"envs/prod/app/deployment.yaml"}}))
+
+			data, err := util.ReadFile(to.FS, "envs/prod/app/deployment.yaml")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(data)).To(Equal("containers:\n" +
+				"- image: ghcr.io/acme/podinfo:6.3.0\n" +
+				"- image: \"ghcr.io/acme/podinfo:6.3.0\"\n" +
+				"- image: ghcr.io/acme/podinfo-ui:6.2.0\n" +
+				"- args: [--image=ghcr.io/acme/podinfo:6.3.0]\n"))
+		})
+
+		It("sets the tag of other images by name", func() {
+			changes, err := SetImagesFS(to, []apiv1alpha1.ImageOperation{{Name: "ghcr.io/acme/worker"}}, "ghcr.io/acme/podinfo", "1.1.0")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(changes).To(Equal(&ChangeSet{Modified: []string{"envs/prod/worker/deployment.yaml"}}))
+
+			changes, err = SetImagesFS(to, []apiv1alpha1.ImageOperation{{Name: "ghcr.io/acme/worker"}}, "ghcr.io/acme/podinfo", "1.1.0")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(changes.Empty()).To(BeTrue())
+		})
+
+		It("rejects paths outside of the repository", func() {
+			_, err := SetImagesFS(to, []apiv1alpha1.ImageOperation{{Paths: []string{"../../.."}}}, "ghcr.io/acme/podinfo", "6.3.0")
+			Expect(err).To(MatchError(ContainSubstring("escapes the repository of environment prod")))
+		})
+	})
+})
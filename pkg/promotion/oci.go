@@ -0,0 +1,137 @@
+/*
+Copyright 2023 Thomas Stadler <thomas@thomasst.xyz>.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package promotion
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/google/go-containerregistry/pkg/v1/remote/transport"
+)
+
+// ErrTagNotFound is returned if the tag of an OCI repository does not exist.
+var ErrTagNotFound = errors.New("tag not found")
+
+// OCIRepository is the tag of an OCI repository holding the artifact of an environment.
+type OCIRepository struct {
+	// Name is the name of the environment, used in errors.
+	Name string
+	// Tag is the tag of the artifact.
+	Tag name.Tag
+	// Options are the options of the requests to the registry, e.g. the credentials.
+	Options []remote.Option
+}
+
+// NewOCIRepository returns the tag of the 'oci://' repository URL.
+func NewOCIRepository(envName, url, tag string, insecure bool, opts ...remote.Option) (*OCIRepository, error) {
+	nameOpts := []name.Option{name.StrictValidation}
+	if insecure {
+		nameOpts = append(nameOpts, name.Insecure)
+	}
+	ref, err := name.NewTag(strings.TrimPrefix(url, "oci://")+":"+tag, nameOpts...)
+	if err != nil {
+		return nil, fmt.Errorf("invalid OCI repository of environment %s: %w", envName, err)
+	}
+	return &OCIRepository{Name: envName, Tag: ref, Options: opts}, nil
+}
+
+// Resolve returns the digest of the artifact the tag points to.
+func (r *OCIRepository) Resolve(ctx context.Context) (v1.Hash, error) {
+	desc, err := remote.Head(r.Tag, r.options(ctx)...)
+	if isNotFound(err) {
+		return v1.Hash{}, fmt.Errorf("%w: %s", ErrTagNotFound, r.Tag)
+	}
+	if err != nil {
+		return v1.Hash{}, fmt.Errorf("failed to resolve %s: %w", r.Tag, err)
+	}
+	return desc.Digest, nil
+}
+
+// Revision returns the revision of the artifact with the digest, in the '<tag>@<digest>'
+// format of the revisions of Flux OCIRepositories.
+func (r *OCIRepository) Revision(digest v1.Hash) string {
+	return r.Tag.TagStr() + "@" + digest.String()
+}
+
+func (r *OCIRepository) options(ctx context.Context) []remote.Option {
+	return append([]remote.Option{remote.WithContext(ctx)}, r.Options...)
+}
+
+// CopyOCI copies the artifact with the digest from the source repository to the tag
+// of the destination repository, along with its cosign signatures. It returns false
+// if the destination tag already points to the digest.
+func CopyOCI(ctx context.Context, from, to *OCIRepository, digest v1.Hash) (bool, error) {
+	current, err := to.Resolve(ctx)
+	if err != nil && !errors.Is(err, ErrTagNotFound) {
+		return false, err
+	}
+	if err == nil && current == digest {
+		return false, nil
+	}
+
+	if err := copyManifest(ctx, from, from.Tag.Context().Digest(digest.String()), to, to.Tag); err != nil {
+		return false, err
+	}
+
+	// Copy the signatures, so that the artifact can be verified in the destination repository as well
+	sigTag := cosignSignatureTag(from.Tag.Context(), digest)
+	err = copyManifest(ctx, from, sigTag, to, to.Tag.Context().Tag(sigTag.TagStr()))
+	if err != nil && !isNotFound(err) {
+		return false, err
+	}
+	return true, nil
+}
+
+// copyManifest copies the image or index with the reference and its blobs to the tag.
+func copyManifest(ctx context.Context, from *OCIRepository, ref name.Reference, to *OCIRepository, tag name.Tag) error {
+	desc, err := remote.Get(ref, from.options(ctx)...)
+	if err != nil {
+		return fmt.Errorf("failed to fetch %s: %w", ref, err)
+	}
+
+	if desc.MediaType.IsIndex() {
+		index, err := desc.ImageIndex()
+		if err != nil {
+			return err
+		}
+		err = remote.WriteIndex(tag, index, to.options(ctx)...)
+		if err != nil {
+			return fmt.Errorf("failed to push %s: %w", tag, err)
+		}
+		return nil
+	}
+	img, err := desc.Image()
+	if err != nil {
+		return err
+	}
+	if err := remote.Write(tag, img, to.options(ctx)...); err != nil {
+		return fmt.Errorf("failed to push %s: %w", tag, err)
+	}
+	return nil
+}
+
+// isNotFound returns true if the error is a 404 response of the registry.
+func isNotFound(err error) bool {
+	var terr *transport.Error
+	return errors.As(err, &terr) && terr.StatusCode == http.StatusNotFound
+}
@@ -0,0 +1,167 @@
+/*
+Copyright 2023 Thomas Stadler <thomas@thomasst.xyz>.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package promotion
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"log"
+	"net/http/httptest"
+	"strings"
+
+	"github.com/google/go-containerregistry/pkg/registry"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/google/go-containerregistry/pkg/v1/static"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+// signArtifact signs the artifact with the digest in the repository like 'cosign sign --key'.
+func signArtifact(repo *OCIRepository, digest v1.Hash, key *ecdsa.PrivateKey) {
+	payload := []byte(fmt.Sprintf(`{"critical":{"identity":{"docker-reference":%q},"image":{"docker-manifest-digest":%q},"type":"cosign container image signature"},"optional":null}`,
+		repo.Tag.Context().Name(), digest))
+	sum := sha256.Sum256(payload)
+	signature, err := ecdsa.SignASN1(rand.Reader, key, sum[:])
+	Expect(err).NotTo(HaveOccurred())
+
+	img, err := mutate.Append(empty.Image, mutate.Addendum{
+		Layer:       static.NewLayer(payload, types.MediaType("application/vnd.dev.cosign.simplesigning.v1+json")),
+		Annotations: map[string]string{cosignSignatureAnnotation: base64.StdEncoding.EncodeToString(signature)},
+	})
+	Expect(err).NotTo(HaveOccurred())
+	Expect(remote.Write(cosignSignatureTag(repo.Tag.Context(), digest), img)).To(Succeed())
+}
+
+// publicKeyPEM returns the PEM-encoded public key like 'cosign generate-key-pair'.
+func publicKeyPEM(key *ecdsa.PrivateKey) []byte {
+	der, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	Expect(err).NotTo(HaveOccurred())
+	return pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})
+}
+
+var _ = Describe("OCI artifacts", func() {
+	var (
+		ctx      context.Context
+		from, to *OCIRepository
+		digest   v1.Hash
+	)
+
+	BeforeEach(func() {
+		ctx = context.Background()
+		server := httptest.NewServer(registry.New(registry.Logger(log.New(io.Discard, "", 0))))
+		DeferCleanup(server.Close)
+		host := strings.TrimPrefix(server.URL, "http://")
+
+		var err error
+		from, err = NewOCIRepository("dev", "oci://"+host+"/manifests", "dev", true)
+		Expect(err).NotTo(HaveOccurred())
+		to, err = NewOCIRepository("prod", "oci://"+host+"/manifests", "prod", true)
+		Expect(err).NotTo(HaveOccurred())
+
+		img, err := random.Image(1024, 1)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(remote.Write(from.Tag, img)).To(Succeed())
+		digest, err = img.Digest()
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("resolves tags to revisions", func() {
+		Expect(from.Resolve(ctx)).To(Equal(digest))
+		Expect(from.Revision(digest)).To(Equal("dev@" + digest.String()))
+
+		_, err := to.Resolve(ctx)
+		Expect(err).To(MatchError(ErrTagNotFound))
+	})
+
+	It("copies the artifact and its signatures to the destination tag", func() {
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		Expect(err).NotTo(HaveOccurred())
+		signArtifact(from, digest, key)
+
+		host := from.Tag.RegistryStr()
+		other, err := NewOCIRepository("prod", "oci://"+host+"/prod/manifests", "latest", true)
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(CopyOCI(ctx, from, other, digest)).To(BeTrue())
+		Expect(other.Resolve(ctx)).To(Equal(digest))
+
+		verifier, err := NewCosignVerifier(map[string][]byte{"cosign.pub": publicKeyPEM(key)})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(verifier.Verify(ctx, other, digest)).To(Equal("cosign.pub"))
+
+		Expect(CopyOCI(ctx, from, other, digest)).To(BeFalse())
+	})
+
+	It("retags artifacts without signatures in the same repository", func() {
+		Expect(CopyOCI(ctx, from, to, digest)).To(BeTrue())
+		Expect(to.Resolve(ctx)).To(Equal(digest))
+	})
+
+	Context("verifying signatures", func() {
+		var key *ecdsa.PrivateKey
+
+		BeforeEach(func() {
+			var err error
+			key, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("verifies signatures of trusted keys", func() {
+			signArtifact(from, digest, key)
+
+			verifier, err := NewCosignVerifier(map[string][]byte{"cosign.pub": publicKeyPEM(key)})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(verifier.Verify(ctx, from, digest)).To(Equal("cosign.pub"))
+		})
+
+		It("rejects signatures of other keys", func() {
+			other, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+			Expect(err).NotTo(HaveOccurred())
+			signArtifact(from, digest, other)
+
+			verifier, err := NewCosignVerifier(map[string][]byte{"cosign.pub": publicKeyPEM(key)})
+			Expect(err).NotTo(HaveOccurred())
+			_, err = verifier.Verify(ctx, from, digest)
+			Expect(err).To(MatchError("no signature of a trusted key found"))
+		})
+
+		It("rejects unsigned artifacts", func() {
+			verifier, err := NewCosignVerifier(map[string][]byte{"cosign.pub": publicKeyPEM(key)})
+			Expect(err).NotTo(HaveOccurred())
+			_, err = verifier.Verify(ctx, from, digest)
+			Expect(err).To(MatchError("artifact is not signed"))
+		})
+
+		It("rejects invalid public keys", func() {
+			_, err := NewCosignVerifier(map[string][]byte{"cosign.pub": []byte("not a key")})
+			Expect(err).To(MatchError("invalid cosign.pub: no PEM-encoded public key found"))
+		})
+	})
+})
@@ -0,0 +1,100 @@
+/*
+Copyright 2023 Thomas Stadler <thomas@thomasst.xyz>.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package promotion
+
+import (
+	"context"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	apiv1alpha1 "github.com/thomasstxyz/release-promotion-operator/api/v1alpha1"
+)
+
+// Resolver fetches the Environments and the PromotionTemplate referenced by Promotions.
+type Resolver struct {
+	Reader client.Reader
+	// ClusterResourceNamespace is the namespace ClusterEnvironments are resolved in,
+	// so that the Secrets of their SecretRefs are looked up there.
+	ClusterResourceNamespace string
+}
+
+// Resolved holds the objects referenced by a Promotion.
+type Resolved struct {
+	From     *apiv1alpha1.Environment
+	To       *apiv1alpha1.Environment
+	Template *apiv1alpha1.PromotionTemplate
+}
+
+// Resolve fetches the source and destination Environments and the PromotionTemplate of the Promotion.
+func (r *Resolver) Resolve(ctx context.Context, promotion *apiv1alpha1.Promotion) (*Resolved, error) {
+	resolved := &Resolved{}
+
+	var err error
+	if resolved.From, err = r.Environment(ctx, promotion.FromEnvironmentKind(), promotion.FromEnvironmentKey()); err != nil {
+		return nil, err
+	}
+	if resolved.To, err = r.Environment(ctx, promotion.ToEnvironmentKind(), promotion.ToEnvironmentKey()); err != nil {
+		return nil, err
+	}
+	if resolved.Template, err = r.Template(ctx, promotion.TemplateKind(), promotion.TemplateKey()); err != nil {
+		return nil, err
+	}
+	return resolved, nil
+}
+
+// Environment fetches the Environment or ClusterEnvironment with the key.
+// A ClusterEnvironment is returned as an Environment in the ClusterResourceNamespace.
+func (r *Resolver) Environment(ctx context.Context, kind string, key types.NamespacedName) (*apiv1alpha1.Environment, error) {
+	if kind != apiv1alpha1.ClusterEnvironmentKind {
+		env := &apiv1alpha1.Environment{}
+		return env, r.Reader.Get(ctx, key, env)
+	}
+
+	clusterEnv := &apiv1alpha1.ClusterEnvironment{}
+	if err := r.Reader.Get(ctx, key, clusterEnv); err != nil {
+		return nil, err
+	}
+	return &apiv1alpha1.Environment{
+		ObjectMeta: metav1.ObjectMeta{Name: clusterEnv.Name, Namespace: r.ClusterResourceNamespace},
+		Spec:       clusterEnv.Spec,
+		Status:     clusterEnv.Status,
+	}, nil
+}
+
+// Template fetches the PromotionTemplate or ClusterPromotionTemplate with the key.
+func (r *Resolver) Template(ctx context.Context, kind string, key types.NamespacedName) (*apiv1alpha1.PromotionTemplate, error) {
+	if kind != apiv1alpha1.ClusterPromotionTemplateKind {
+		template := &apiv1alpha1.PromotionTemplate{}
+		return template, r.Reader.Get(ctx, key, template)
+	}
+
+	clusterTemplate := &apiv1alpha1.ClusterPromotionTemplate{}
+	if err := r.Reader.Get(ctx, key, clusterTemplate); err != nil {
+		return nil, err
+	}
+	return TemplateFromCluster(clusterTemplate), nil
+}
+
+// TemplateFromCluster returns the ClusterPromotionTemplate as a PromotionTemplate.
+func TemplateFromCluster(clusterTemplate *apiv1alpha1.ClusterPromotionTemplate) *apiv1alpha1.PromotionTemplate {
+	return &apiv1alpha1.PromotionTemplate{
+		ObjectMeta: metav1.ObjectMeta{Name: clusterTemplate.Name},
+		Spec:       clusterTemplate.Spec,
+	}
+}
@@ -0,0 +1,90 @@
+/*
+Copyright 2023 Thomas Stadler <thomas@thomasst.xyz>.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package promotion
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	apiv1alpha1 "github.com/thomasstxyz/release-promotion-operator/api/v1alpha1"
+)
+
+var _ = Describe("Resolving Promotions", func() {
+	var (
+		ctx       context.Context
+		resolver  *Resolver
+		promotion *apiv1alpha1.Promotion
+	)
+
+	BeforeEach(func() {
+		ctx = context.Background()
+		scheme := runtime.NewScheme()
+		Expect(apiv1alpha1.AddToScheme(scheme)).To(Succeed())
+
+		source := &apiv1alpha1.SourceSpec{URL: "https://github.com/acme/fleet"}
+		resolver = &Resolver{
+			Reader: fake.NewClientBuilder().WithScheme(scheme).WithObjects(
+				&apiv1alpha1.Environment{
+					ObjectMeta: metav1.ObjectMeta{Namespace: "apps", Name: "dev"},
+					Spec:       apiv1alpha1.EnvironmentSpec{Source: source, Path: "envs/dev"},
+				},
+				&apiv1alpha1.ClusterEnvironment{
+					ObjectMeta: metav1.ObjectMeta{Name: "prod"},
+					Spec:       apiv1alpha1.EnvironmentSpec{Source: source, Path: "envs/prod"},
+					Status:     apiv1alpha1.EnvironmentStatus{LastPromotedVersion: "2.5.0"},
+				},
+				&apiv1alpha1.ClusterPromotionTemplate{
+					ObjectMeta: metav1.ObjectMeta{Name: "apps"},
+					Spec:       apiv1alpha1.PromotionTemplateSpec{CopySpec: []apiv1alpha1.CopyOperation{{Source: "apps", Destination: "apps"}}},
+				},
+			).Build(),
+			ClusterResourceNamespace: "release-promotion-operator-system",
+		}
+
+		promotion = &apiv1alpha1.Promotion{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "apps", Name: "dev-to-prod"},
+			Spec: apiv1alpha1.PromotionSpec{
+				FromSpec:    apiv1alpha1.FromSpec{EnvironmentRef: apiv1alpha1.EnvironmentReference{Name: "dev"}},
+				ToSpec:      apiv1alpha1.ToSpec{EnvironmentRef: apiv1alpha1.EnvironmentReference{Kind: apiv1alpha1.ClusterEnvironmentKind, Name: "prod"}},
+				TemplateRef: apiv1alpha1.TemplateRef{Kind: apiv1alpha1.ClusterPromotionTemplateKind, Name: "apps"},
+			},
+		}
+	})
+
+	It("resolves Environments, ClusterEnvironments and ClusterPromotionTemplates", func() {
+		resolved, err := resolver.Resolve(ctx, promotion)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(resolved.From.Spec.Path).To(Equal("envs/dev"))
+		Expect(resolved.To.Namespace).To(Equal("release-promotion-operator-system"))
+		Expect(resolved.To.Spec.Path).To(Equal("envs/prod"))
+		Expect(resolved.To.Status.LastPromotedVersion).To(Equal("2.5.0"))
+		Expect(resolved.Template.Spec.CopySpec).To(HaveLen(1))
+	})
+
+	It("returns missing objects as not found", func() {
+		promotion.Spec.FromSpec.EnvironmentRef.Name = "staging"
+		_, err := resolver.Resolve(ctx, promotion)
+		Expect(apierrors.IsNotFound(err)).To(BeTrue())
+	})
+})
@@ -0,0 +1,581 @@
+/*
+Copyright 2023 Thomas Stadler <thomas@thomasst.xyz>.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package promotion
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"filippo.io/age"
+	"filippo.io/age/armor"
+	"github.com/ProtonMail/go-crypto/openpgp"
+	pgparmor "github.com/ProtonMail/go-crypto/openpgp/armor"
+	"github.com/go-git/go-billy/v5/util"
+	"gopkg.in/yaml.v3"
+
+	apiv1alpha1 "github.com/thomasstxyz/release-promotion-operator/api/v1alpha1"
+)
+
+// Files and keys of SOPS, following the conventions of SOPS and Flux.
+const (
+	// sopsConfigFile holds the creation rules with the recipients of encrypted files.
+	sopsConfigFile = ".sops.yaml"
+	// sopsAgeKeySuffix is the suffix of the names of age identity files.
+	sopsAgeKeySuffix = ".agekey"
+	// sopsPGPKeySuffix is the suffix of the names of ASCII-armored OpenPGP key files.
+	sopsPGPKeySuffix = ".asc"
+)
+
+// SOPSKeyring holds the keys of the SOPS-encrypted files of an environment.
+type SOPSKeyring struct {
+	ageIdentities []age.Identity
+	pgpKeys       openpgp.EntityList
+}
+
+// NewSOPSKeyring returns the keyring of the age identities and OpenPGP keys by
+// file name, like the data of a decryption Secret. Files ending in '.agekey'
+// hold age identities, files ending in '.asc' ASCII-armored OpenPGP keys,
+// all other files are ignored.
+func NewSOPSKeyring(keys map[string][]byte) (*SOPSKeyring, error) {
+	keyring := &SOPSKeyring{}
+	for name, data := range keys {
+		switch {
+		case strings.HasSuffix(name, sopsAgeKeySuffix):
+			identities, err := age.ParseIdentities(bytes.NewReader(data))
+			if err != nil {
+				return nil, fmt.Errorf("invalid %s: %w", name, err)
+			}
+			keyring.ageIdentities = append(keyring.ageIdentities, identities...)
+		case strings.HasSuffix(name, sopsPGPKeySuffix):
+			entities, err := openpgp.ReadArmoredKeyRing(bytes.NewReader(data))
+			if err != nil {
+				return nil, fmt.Errorf("invalid %s: %w", name, err)
+			}
+			keyring.pgpKeys = append(keyring.pgpKeys, entities...)
+		}
+	}
+	return keyring, nil
+}
+
+func (k *SOPSKeyring) pgpKey(fingerprint string) *openpgp.Entity {
+	if k == nil {
+		return nil
+	}
+	for _, entity := range k.pgpKeys {
+		if strings.EqualFold(hex.EncodeToString(entity.PrimaryKey.Fingerprint), fingerprint) {
+			return entity
+		}
+	}
+	return nil
+}
+
+// sopsRecipients are the recipients a file is encrypted for.
+type sopsRecipients struct {
+	age []string
+	pgp []string
+}
+
+func newSOPSRecipients(ageRecipients, pgpFingerprints []string) sopsRecipients {
+	r := sopsRecipients{}
+	for _, recipient := range ageRecipients {
+		r.age = append(r.age, strings.TrimSpace(recipient))
+	}
+	for _, fingerprint := range pgpFingerprints {
+		r.pgp = append(r.pgp, strings.ToUpper(strings.TrimSpace(fingerprint)))
+	}
+	sort.Strings(r.age)
+	sort.Strings(r.pgp)
+	return r
+}
+
+func (r sopsRecipients) equal(other sopsRecipients) bool {
+	return strings.Join(r.age, ",") == strings.Join(other.age, ",") &&
+		strings.Join(r.pgp, ",") == strings.Join(other.pgp, ",")
+}
+
+func (r sopsRecipients) String() string {
+	recipients := make([]string, 0, len(r.age)+len(r.pgp))
+	recipients = append(recipients, r.age...)
+	recipients = append(recipients, r.pgp...)
+	if len(recipients) == 0 {
+		return "no recipients"
+	}
+	return strings.Join(recipients, ", ")
+}
+
+// sopsAgeKey is an entry of the age keys in the SOPS metadata.
+type sopsAgeKey struct {
+	Recipient    string `yaml:"recipient"`
+	EncryptedKey string `yaml:"enc"`
+}
+
+// sopsPGPKey is an entry of the OpenPGP keys in the SOPS metadata.
+type sopsPGPKey struct {
+	CreatedAt    string `yaml:"created_at"`
+	EncryptedKey string `yaml:"enc"`
+	Fingerprint  string `yaml:"fp"`
+}
+
+// sopsMetadata is the part of the SOPS metadata which is needed to re-encrypt a file.
+// Key types other than age and OpenPGP are not supported.
+type sopsMetadata struct {
+	Age       []sopsAgeKey `yaml:"age"`
+	PGP       []sopsPGPKey `yaml:"pgp"`
+	MAC       string       `yaml:"mac"`
+	KMS       []yaml.Node  `yaml:"kms"`
+	GCPKMS    []yaml.Node  `yaml:"gcp_kms"`
+	AzureKV   []yaml.Node  `yaml:"azure_kv"`
+	HCVault   []yaml.Node  `yaml:"hc_vault"`
+	KeyGroups []yaml.Node  `yaml:"key_groups"`
+}
+
+// sopsFile is a SOPS-encrypted YAML or JSON file.
+type sopsFile struct {
+	json bool
+	// docs holds the parsed documents, each with the SOPS metadata.
+	docs []*yaml.Node
+	// metadata holds the SOPS metadata of the first document.
+	metadata sopsMetadata
+}
+
+// parseSOPSFile parses the file if it is encrypted with SOPS, and returns nil otherwise.
+// YAML and JSON files are supported, including binary files which SOPS stores as JSON.
+func parseSOPSFile(name string, data []byte) (*sopsFile, error) {
+	f := &sopsFile{}
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".yaml", ".yml":
+	case ".json":
+		f.json = true
+	default:
+		if bytes.Contains(data, []byte("sops_mac=")) || bytes.Contains(data, []byte("[sops]")) {
+			return nil, fmt.Errorf("%s seems to be encrypted with SOPS, but only YAML and JSON files are supported", name)
+		}
+		if !json.Valid(data) {
+			return nil, nil
+		}
+		f.json = true
+	}
+
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	for {
+		doc := &yaml.Node{}
+		if err := decoder.Decode(doc); err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			// Not our business to validate files which are not encrypted
+			return nil, nil
+		}
+		if sopsMetadataNode(doc) == nil {
+			return nil, nil
+		}
+		f.docs = append(f.docs, doc)
+	}
+	if len(f.docs) == 0 {
+		return nil, nil
+	}
+
+	if err := sopsMetadataNode(f.docs[0]).Decode(&f.metadata); err != nil {
+		return nil, fmt.Errorf("invalid SOPS metadata in %s: %w", name, err)
+	}
+	m := f.metadata
+	if len(m.KMS)+len(m.GCPKMS)+len(m.AzureKV)+len(m.HCVault)+len(m.KeyGroups) > 0 {
+		return nil, fmt.Errorf("%s is encrypted with key types other than age and OpenPGP, which are not supported", name)
+	}
+	return f, nil
+}
+
+// sopsMetadataNode returns the value of the top-level 'sops' key of the
+// document, or nil if the document is not encrypted with SOPS.
+func sopsMetadataNode(doc *yaml.Node) *yaml.Node {
+	if doc.Kind != yaml.DocumentNode || len(doc.Content) != 1 || doc.Content[0].Kind != yaml.MappingNode {
+		return nil
+	}
+	metadata := mappingValue(doc.Content[0], "sops")
+	if metadata == nil || metadata.Kind != yaml.MappingNode || mappingValue(metadata, "mac") == nil {
+		return nil
+	}
+	return metadata
+}
+
+// mappingValue returns the value of the key in the mapping node, or nil.
+func mappingValue(mapping *yaml.Node, key string) *yaml.Node {
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		if mapping.Content[i].Value == key {
+			return mapping.Content[i+1]
+		}
+	}
+	return nil
+}
+
+// recipients returns the recipients the file is encrypted for.
+func (f *sopsFile) recipients() sopsRecipients {
+	var ageRecipients, pgpFingerprints []string
+	for _, key := range f.metadata.Age {
+		ageRecipients = append(ageRecipients, key.Recipient)
+	}
+	for _, key := range f.metadata.PGP {
+		pgpFingerprints = append(pgpFingerprints, key.Fingerprint)
+	}
+	return newSOPSRecipients(ageRecipients, pgpFingerprints)
+}
+
+// dataKey decrypts the data key of the file with any of the keys of the keyring.
+func (f *sopsFile) dataKey(keyring *SOPSKeyring) ([]byte, error) {
+	if keyring == nil {
+		return nil, fmt.Errorf("no decryption keys configured")
+	}
+
+	if len(keyring.ageIdentities) > 0 {
+		for _, key := range f.metadata.Age {
+			r, err := age.Decrypt(armor.NewReader(strings.NewReader(key.EncryptedKey)), keyring.ageIdentities...)
+			if err != nil {
+				continue
+			}
+			if dataKey, err := io.ReadAll(r); err == nil {
+				return dataKey, nil
+			}
+		}
+	}
+	if len(keyring.pgpKeys) > 0 {
+		for _, key := range f.metadata.PGP {
+			block, err := pgparmor.Decode(strings.NewReader(key.EncryptedKey))
+			if err != nil {
+				continue
+			}
+			md, err := openpgp.ReadMessage(block.Body, keyring.pgpKeys, nil, nil)
+			if err != nil {
+				continue
+			}
+			if dataKey, err := io.ReadAll(md.UnverifiedBody); err == nil {
+				return dataKey, nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("none of the decryption keys can decrypt the data key")
+}
+
+// setKeys replaces the age and OpenPGP keys in the metadata of all documents.
+func (f *sopsFile) setKeys(ageKeys []sopsAgeKey, pgpKeys []sopsPGPKey) error {
+	for _, doc := range f.docs {
+		metadata := sopsMetadataNode(doc)
+		if err := setMappingValue(metadata, "age", ageKeys); err != nil {
+			return err
+		}
+		if err := setMappingValue(metadata, "pgp", pgpKeys); err != nil {
+			return err
+		}
+	}
+	f.metadata.Age = ageKeys
+	f.metadata.PGP = pgpKeys
+	return nil
+}
+
+// setMappingValue sets the key of the mapping node to the encoded value.
+func setMappingValue(mapping *yaml.Node, key string, value interface{}) error {
+	node := &yaml.Node{}
+	if err := node.Encode(value); err != nil {
+		return err
+	}
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		if mapping.Content[i].Value == key {
+			mapping.Content[i+1] = node
+			return nil
+		}
+	}
+	mapping.Content = append(mapping.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: key}, node)
+	return nil
+}
+
+// encode encodes the file in its original format, with the indentation used by SOPS.
+func (f *sopsFile) encode() ([]byte, error) {
+	var b bytes.Buffer
+	if f.json {
+		if err := encodeJSONNode(&b, f.docs[0], ""); err != nil {
+			return nil, err
+		}
+		b.WriteString("\n")
+		return b.Bytes(), nil
+	}
+
+	encoder := yaml.NewEncoder(&b)
+	encoder.SetIndent(4)
+	for _, doc := range f.docs {
+		if err := encoder.Encode(doc); err != nil {
+			return nil, err
+		}
+	}
+	if err := encoder.Close(); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
+// encodeJSONNode encodes the node as JSON, preserving the order of the keys
+// which the MAC of SOPS depends on.
+func encodeJSONNode(b *bytes.Buffer, node *yaml.Node, indent string) error {
+	switch node.Kind {
+	case yaml.DocumentNode:
+		return encodeJSONNode(b, node.Content[0], indent)
+	case yaml.MappingNode, yaml.SequenceNode:
+		open, close, step := "[", "]", 1
+		if node.Kind == yaml.MappingNode {
+			open, close, step = "{", "}", 2
+		}
+		if len(node.Content) == 0 {
+			b.WriteString(open + close)
+			return nil
+		}
+		b.WriteString(open + "\n")
+		for i := 0; i < len(node.Content); i += step {
+			b.WriteString(indent + "\t")
+			if node.Kind == yaml.MappingNode {
+				key, err := json.Marshal(node.Content[i].Value)
+				if err != nil {
+					return err
+				}
+				b.Write(key)
+				b.WriteString(": ")
+			}
+			if err := encodeJSONNode(b, node.Content[i+step-1], indent+"\t"); err != nil {
+				return err
+			}
+			if i+step < len(node.Content) {
+				b.WriteString(",")
+			}
+			b.WriteString("\n")
+		}
+		b.WriteString(indent + close)
+	case yaml.ScalarNode:
+		switch node.ShortTag() {
+		case "!!str":
+			value, err := json.Marshal(node.Value)
+			if err != nil {
+				return err
+			}
+			b.Write(value)
+		case "!!null":
+			b.WriteString("null")
+		default:
+			b.WriteString(node.Value)
+		}
+	default:
+		return fmt.Errorf("unsupported YAML node in JSON file")
+	}
+	return nil
+}
+
+// sopsConfig is the part of a '.sops.yaml' file which is needed to determine the recipients.
+type sopsConfig struct {
+	CreationRules []sopsCreationRule `yaml:"creation_rules"`
+}
+
+// sopsCreationRule is a creation rule of a '.sops.yaml' file.
+type sopsCreationRule struct {
+	PathRegex string      `yaml:"path_regex"`
+	Age       sopsKeyList `yaml:"age"`
+	PGP       sopsKeyList `yaml:"pgp"`
+	KMS       sopsKeyList `yaml:"kms"`
+	GCPKMS    sopsKeyList `yaml:"gcp_kms"`
+	AzureKV   sopsKeyList `yaml:"azure_keyvault"`
+	HCVault   sopsKeyList `yaml:"hc_vault_transit_uri"`
+	KeyGroups []yaml.Node `yaml:"key_groups"`
+}
+
+// sopsKeyList is a list of keys, given as a comma separated string or as a sequence.
+type sopsKeyList []string
+
+func (l *sopsKeyList) UnmarshalYAML(value *yaml.Node) error {
+	var keys []string
+	if value.Kind == yaml.ScalarNode {
+		keys = strings.Split(value.Value, ",")
+	} else if err := value.Decode(&keys); err != nil {
+		return err
+	}
+	for _, key := range keys {
+		if key = strings.TrimSpace(key); key != "" {
+			*l = append(*l, key)
+		}
+	}
+	return nil
+}
+
+// sopsRecipientsFor returns the recipients of the creation rule matching the file
+// in the '.sops.yaml' file closest to it. The path regex of the rules is matched
+// against the path of the file relative to the directory of the '.sops.yaml' file.
+func sopsRecipientsFor(to *Destination, file string) (sopsRecipients, error) {
+	for dir := path.Dir(file); ; dir = path.Dir(dir) {
+		configFile := path.Join(dir, sopsConfigFile)
+		data, err := util.ReadFile(to.FS, configFile)
+		if err == nil {
+			rel := strings.TrimPrefix(file, dir+"/")
+			return matchSOPSCreationRule(configFile, data, rel)
+		}
+		if !os.IsNotExist(err) {
+			return sopsRecipients{}, err
+		}
+		if dir == "." {
+			break
+		}
+	}
+	return sopsRecipients{}, fmt.Errorf("no %s found in the destination environment", sopsConfigFile)
+}
+
+// matchSOPSCreationRule returns the recipients of the first creation rule matching the path.
+func matchSOPSCreationRule(configPath string, data []byte, path string) (sopsRecipients, error) {
+	config := sopsConfig{}
+	if err := yaml.Unmarshal(data, &config); err != nil {
+		return sopsRecipients{}, fmt.Errorf("invalid %s: %w", configPath, err)
+	}
+
+	for _, rule := range config.CreationRules {
+		if rule.PathRegex != "" {
+			re, err := regexp.Compile(rule.PathRegex)
+			if err != nil {
+				return sopsRecipients{}, fmt.Errorf("invalid path_regex in %s: %w", configPath, err)
+			}
+			if !re.MatchString(path) {
+				continue
+			}
+		}
+		if len(rule.KMS)+len(rule.GCPKMS)+len(rule.AzureKV)+len(rule.HCVault)+len(rule.KeyGroups) > 0 {
+			return sopsRecipients{}, fmt.Errorf("creation rule of %s for %s uses key types other than age and OpenPGP, which are not supported",
+				configPath, path)
+		}
+		return newSOPSRecipients(rule.Age, rule.PGP), nil
+	}
+	return sopsRecipients{}, fmt.Errorf("no creation rule of %s matches %s", configPath, path)
+}
+
+// copySOPSFile returns the content of the file name of the destination copied from data.
+// SOPS-encrypted files are verified or re-encrypted for the recipients of the destination
+// according to the mode.
+func copySOPSFile(from *Source, to *Destination, mode apiv1alpha1.SOPSMode, data []byte, name string) ([]byte, error) {
+	file, err := parseSOPSFile(name, data)
+	if err != nil || file == nil {
+		return data, err
+	}
+
+	recipients, err := sopsRecipientsFor(to, name)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+	if file.recipients().equal(recipients) {
+		return data, nil
+	}
+	if mode == apiv1alpha1.SOPSVerify {
+		return nil, fmt.Errorf("%s is encrypted for %s instead of %s", name, file.recipients(), recipients)
+	}
+	if data, err = reencryptSOPSFile(from, to, file, recipients, name); err != nil {
+		return nil, fmt.Errorf("failed to re-encrypt %s: %w", name, err)
+	}
+	return data, nil
+}
+
+// reencryptSOPSFile returns the file encrypted for the recipients. Like 'sops updatekeys',
+// only the data key is re-encrypted, the encrypted values and the MAC are kept.
+func reencryptSOPSFile(from *Source, to *Destination, file *sopsFile, recipients sopsRecipients, name string) ([]byte, error) {
+	// Keep the keys of the committed file if it has been re-encrypted from
+	// the same content before, so that unchanged files are not committed again
+	if to.Committed != nil {
+		if previous, err := to.Committed(name); err == nil {
+			if previousFile, err := parseSOPSFile(name, previous); err == nil && previousFile != nil &&
+				previousFile.metadata.MAC == file.metadata.MAC && previousFile.recipients().equal(recipients) {
+				if err := file.setKeys(previousFile.metadata.Age, previousFile.metadata.PGP); err != nil {
+					return nil, err
+				}
+				return file.encode()
+			}
+		}
+	}
+
+	dataKey, err := file.dataKey(from.SOPSKeys)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt with the keys of environment %s: %w", from.Name, err)
+	}
+
+	var ageKeys []sopsAgeKey
+	for _, recipient := range recipients.age {
+		parsed, err := age.ParseX25519Recipient(recipient)
+		if err != nil {
+			return nil, fmt.Errorf("invalid age recipient %s: %w", recipient, err)
+		}
+		var b bytes.Buffer
+		aw := armor.NewWriter(&b)
+		w, err := age.Encrypt(aw, parsed)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := w.Write(dataKey); err != nil {
+			return nil, err
+		}
+		if err := w.Close(); err != nil {
+			return nil, err
+		}
+		if err := aw.Close(); err != nil {
+			return nil, err
+		}
+		ageKeys = append(ageKeys, sopsAgeKey{Recipient: recipient, EncryptedKey: b.String()})
+	}
+
+	var pgpKeys []sopsPGPKey
+	for _, fingerprint := range recipients.pgp {
+		entity := to.SOPSKeys.pgpKey(fingerprint)
+		if entity == nil {
+			return nil, fmt.Errorf("the OpenPGP key %s is not among the keys of environment %s", fingerprint, to.Name)
+		}
+		var b bytes.Buffer
+		aw, err := pgparmor.Encode(&b, "PGP MESSAGE", nil)
+		if err != nil {
+			return nil, err
+		}
+		w, err := openpgp.Encrypt(aw, openpgp.EntityList{entity}, nil, &openpgp.FileHints{IsBinary: true}, nil)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := w.Write(dataKey); err != nil {
+			return nil, err
+		}
+		if err := w.Close(); err != nil {
+			return nil, err
+		}
+		if err := aw.Close(); err != nil {
+			return nil, err
+		}
+		pgpKeys = append(pgpKeys, sopsPGPKey{
+			CreatedAt:    time.Now().UTC().Format(time.RFC3339),
+			EncryptedKey: b.String() + "\n",
+			Fingerprint:  fingerprint,
+		})
+	}
+
+	if err := file.setKeys(ageKeys, pgpKeys); err != nil {
+		return nil, err
+	}
+	return file.encode()
+}
@@ -0,0 +1,134 @@
+/*
+Copyright 2023 Thomas Stadler <thomas@thomasst.xyz>.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package promotion
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"filippo.io/age"
+	"github.com/go-git/go-git/v5"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	apiv1alpha1 "github.com/thomasstxyz/release-promotion-operator/api/v1alpha1"
+)
+
+var _ = Describe("Copying SOPS-encrypted files", func() {
+	// testdata/sops/secret.yaml is encrypted for the age identity in testdata/sops/dev.agekey
+	const devRecipient = "age1mevq40y6cvvf5es94zclsxjp2lst2ctjc5x2009hsj04u0ap9eks0wxppc"
+
+	var (
+		from, to   *Checkout
+		encrypted  []byte
+		prodKey    *age.X25519Identity
+		copySecret = func(mode apiv1alpha1.SOPSMode) error {
+			_, err := Apply(from, to, []apiv1alpha1.CopyOperation{
+				{Source: "secret.yaml", Destination: "secret.yaml", SOPS: mode},
+			})
+			return err
+		}
+		setRecipient = func(recipient string) {
+			config := fmt.Sprintf("creation_rules:\n  - path_regex: secret\\.yaml$\n    age: %s\n", recipient)
+			Expect(os.WriteFile(filepath.Join(to.Dir, sopsConfigFile), []byte(config), 0o644)).To(Succeed())
+		}
+	)
+
+	newCheckout := func(name string) *Checkout {
+		dir := GinkgoT().TempDir()
+		repo, err := git.PlainInit(dir, false)
+		Expect(err).NotTo(HaveOccurred())
+		return &Checkout{Name: name, Dir: dir, Repo: repo}
+	}
+
+	BeforeEach(func() {
+		var err error
+		encrypted, err = os.ReadFile(filepath.Join("testdata", "sops", "secret.yaml"))
+		Expect(err).NotTo(HaveOccurred())
+		devKey, err := os.ReadFile(filepath.Join("testdata", "sops", "dev.agekey"))
+		Expect(err).NotTo(HaveOccurred())
+		prodKey, err = age.GenerateX25519Identity()
+		Expect(err).NotTo(HaveOccurred())
+
+		from = newCheckout("dev")
+		from.SOPSKeys, err = NewSOPSKeyring(map[string][]byte{"dev.agekey": devKey})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(os.WriteFile(filepath.Join(from.Dir, "secret.yaml"), encrypted, 0o644)).To(Succeed())
+		to = newCheckout("prod")
+	})
+
+	It("copies files encrypted for the destination's recipients unchanged", func() {
+		setRecipient(devRecipient)
+		Expect(copySecret(apiv1alpha1.SOPSVerify)).To(Succeed())
+
+		copied, err := os.ReadFile(filepath.Join(to.Dir, "secret.yaml"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(copied).To(Equal(encrypted))
+	})
+
+	It("refuses to copy files encrypted for other recipients", func() {
+		setRecipient(prodKey.Recipient().String())
+		err := copySecret(apiv1alpha1.SOPSVerify)
+		Expect(err).To(MatchError(ContainSubstring("secret.yaml is encrypted for " + devRecipient)))
+		Expect(filepath.Join(to.Dir, "secret.yaml")).NotTo(BeAnExistingFile())
+	})
+
+	It("re-encrypts files for the destination's recipients", func() {
+		setRecipient(prodKey.Recipient().String())
+		Expect(copySecret(apiv1alpha1.SOPSReencrypt)).To(Succeed())
+
+		copied, err := os.ReadFile(filepath.Join(to.Dir, "secret.yaml"))
+		Expect(err).NotTo(HaveOccurred())
+		file, err := parseSOPSFile("secret.yaml", copied)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(file.recipients()).To(Equal(newSOPSRecipients([]string{prodKey.Recipient().String()}, nil)))
+
+		source, err := parseSOPSFile("secret.yaml", encrypted)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(file.metadata.MAC).To(Equal(source.metadata.MAC))
+		sourceKey, err := source.dataKey(from.SOPSKeys)
+		Expect(err).NotTo(HaveOccurred())
+		dataKey, err := file.dataKey(&SOPSKeyring{ageIdentities: []age.Identity{prodKey}})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(dataKey).To(Equal(sourceKey))
+	})
+
+	It("keeps the keys of files re-encrypted from the same content before", func() {
+		setRecipient(prodKey.Recipient().String())
+		Expect(copySecret(apiv1alpha1.SOPSReencrypt)).To(Succeed())
+		_, changed, err := to.Commit("Promote secret")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(changed).To(BeTrue())
+
+		changes, err := Apply(from, to, []apiv1alpha1.CopyOperation{
+			{Source: "secret.yaml", Destination: "secret.yaml", SOPS: apiv1alpha1.SOPSReencrypt},
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(changes.Empty()).To(BeTrue())
+	})
+
+	It("copies files which are not encrypted unchanged", func() {
+		plain := []byte("apiVersion: v1\nkind: ConfigMap\n")
+		Expect(os.WriteFile(filepath.Join(from.Dir, "secret.yaml"), plain, 0o644)).To(Succeed())
+		Expect(copySecret(apiv1alpha1.SOPSVerify)).To(Succeed())
+
+		copied, err := os.ReadFile(filepath.Join(to.Dir, "secret.yaml"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(copied).To(Equal(plain))
+	})
+})
@@ -0,0 +1,134 @@
+/*
+Copyright 2023 Thomas Stadler <thomas@thomasst.xyz>.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package promotion
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"regexp"
+	"strings"
+
+	"github.com/blang/semver"
+
+	apiv1alpha1 "github.com/thomasstxyz/release-promotion-operator/api/v1alpha1"
+)
+
+// VersionPolicyError is returned if the version of a source revision
+// violates the version policy of the destination environment.
+type VersionPolicyError struct {
+	Version     string
+	Environment string
+	Reason      string
+}
+
+func (e *VersionPolicyError) Error() string {
+	return fmt.Sprintf("version %q violates the version policy of environment %s: %s", e.Version, e.Environment, e.Reason)
+}
+
+// ExtractVersion extracts the version of the source revision from the source checkout,
+// which is nil for environments without files.
+func ExtractVersion(from *Checkout, revision string, src apiv1alpha1.VersionSource) (string, error) {
+	if from == nil {
+		return ExtractVersionFS(nil, revision, src)
+	}
+	return ExtractVersionFS(from.source(), revision, src)
+}
+
+// ExtractVersionFS extracts the version of the source revision as specified by the version source:
+// from a file of the source, which is nil for environments without files, or from the tag of the
+// revision, e.g. 'v1.2.0' of 'v1.2.0@sha256:...'.
+func ExtractVersionFS(from *Source, revision string, src apiv1alpha1.VersionSource) (string, error) {
+	var value string
+	switch {
+	case src.File == "":
+		value, _, _ = strings.Cut(revision, "@")
+	case from == nil:
+		return "", errors.New("the version cannot be read from a file, as the source environment has no files")
+	default:
+		name, err := environmentPath(from.Name, from.Path, src.File)
+		if err != nil {
+			return "", err
+		}
+		data, err := fs.ReadFile(from.FS, name)
+		if err != nil {
+			return "", fmt.Errorf("failed to read the version: %w", err)
+		}
+		value = strings.TrimSpace(string(data))
+		if src.Chart != "" {
+			ref, err := findChartReference(data, src.Chart)
+			if err != nil {
+				return "", fmt.Errorf("%s of environment %s: %w", src.File, from.Name, err)
+			}
+			value = ref.version.Value
+		}
+	}
+
+	if src.Pattern == "" {
+		return value, nil
+	}
+	pattern, err := regexp.Compile(src.Pattern)
+	if err != nil {
+		return "", fmt.Errorf("invalid version pattern: %w", err)
+	}
+	match := pattern.FindStringSubmatch(value)
+	if match == nil {
+		return "", fmt.Errorf("version pattern %q does not match %q", src.Pattern, value)
+	}
+	if len(match) > 1 {
+		return match[1], nil
+	}
+	return match[0], nil
+}
+
+// CheckVersion checks the version against the version policy of the destination environment,
+// and returns a VersionPolicyError if it is violated. The version must not be lower than
+// lastVersion, the version last promoted to the environment, if set and the policy rejects
+// downgrades. If lastVersion is not a semantic version, no version can be proven not to be
+// a downgrade, so that all are rejected.
+func CheckVersion(policy *apiv1alpha1.VersionPolicy, envName, version, lastVersion string) error {
+	violation := func(format string, args ...any) error {
+		return &VersionPolicyError{Version: version, Environment: envName, Reason: fmt.Sprintf(format, args...)}
+	}
+
+	v, err := semver.ParseTolerant(version)
+	if err != nil {
+		return violation("not a semantic version")
+	}
+	if len(v.Pre) > 0 && !policy.PreReleases {
+		return violation("pre-releases are not allowed")
+	}
+	if policy.SemVer != "" {
+		versionRange, err := semver.ParseRange(policy.SemVer)
+		if err != nil {
+			return fmt.Errorf("invalid semver range of environment %s: %w", envName, err)
+		}
+		if !versionRange(v) {
+			return violation("not in the range %q", policy.SemVer)
+		}
+	}
+	if policy.NoDowngrade && lastVersion != "" {
+		last, err := semver.ParseTolerant(lastVersion)
+		if err != nil {
+			return violation("the last promoted version %q is not a semantic version", lastVersion)
+		}
+		if v.LT(last) {
+			return violation("downgrade from %s", lastVersion)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,74 @@
+/*
+Copyright 2023 Thomas Stadler <thomas@thomasst.xyz>.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package promotion
+
+import (
+	"errors"
+	"testing/fstest"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	apiv1alpha1 "github.com/thomasstxyz/release-promotion-operator/api/v1alpha1"
+)
+
+var _ = Describe("Version policies", func() {
+	from := &Source{Name: "staging", Path: "envs/staging", FS: fstest.MapFS{
+		"envs/staging/VERSION":      {Data: []byte("2.4.1\n")},
+		"envs/staging/release.yaml": {Data: []byte(devHelmRelease)},
+		"envs/staging/app.env":      {Data: []byte("APP_VERSION=v2.5.0-rc.1\n")},
+	}}
+
+	DescribeTable("extracts versions",
+		func(src apiv1alpha1.VersionSource, revision, expected string) {
+			Expect(ExtractVersionFS(from, revision, src)).To(Equal(expected))
+		},
+		Entry("from the content of files", apiv1alpha1.VersionSource{File: "VERSION"}, "", "2.4.1"),
+		Entry("from chart references", apiv1alpha1.VersionSource{File: "release.yaml", Chart: "podinfo"}, "", "6.3.5"),
+		Entry("with patterns", apiv1alpha1.VersionSource{File: "app.env", Pattern: `APP_VERSION=(\S+)`}, "", "v2.5.0-rc.1"),
+		Entry("from the tag of revisions", apiv1alpha1.VersionSource{}, "v1.2.0@sha256:0123", "v1.2.0"),
+		Entry("from image tags", apiv1alpha1.VersionSource{Pattern: `^[0-9.]+`}, "6.3.0-amd64", "6.3.0"),
+	)
+
+	It("fails to read files of environments without files", func() {
+		_, err := ExtractVersionFS(nil, "6.3.0", apiv1alpha1.VersionSource{File: "VERSION"})
+		Expect(err).To(MatchError(ContainSubstring("the source environment has no files")))
+	})
+
+	DescribeTable("checks versions against the policy",
+		func(policy apiv1alpha1.VersionPolicy, version, lastVersion, reason string) {
+			err := CheckVersion(&policy, "prod", version, lastVersion)
+			if reason == "" {
+				Expect(err).NotTo(HaveOccurred())
+				return
+			}
+			var policyErr *VersionPolicyError
+			Expect(errors.As(err, &policyErr)).To(BeTrue())
+			Expect(policyErr.Reason).To(Equal(reason))
+		},
+		Entry("accepts versions in the range", apiv1alpha1.VersionPolicy{SemVer: ">=2.0.0 <3.0.0"}, "v2.4.1", "", ""),
+		Entry("rejects versions outside of the range", apiv1alpha1.VersionPolicy{SemVer: ">=2.0.0 <3.0.0"}, "3.0.0", "", `not in the range ">=2.0.0 <3.0.0"`),
+		Entry("rejects pre-releases", apiv1alpha1.VersionPolicy{}, "2.5.0-rc.1", "", "pre-releases are not allowed"),
+		Entry("accepts allowed pre-releases", apiv1alpha1.VersionPolicy{PreReleases: true}, "2.5.0-rc.1", "", ""),
+		Entry("rejects downgrades", apiv1alpha1.VersionPolicy{NoDowngrade: true}, "2.4.1", "2.5.0", "downgrade from 2.5.0"),
+		Entry("accepts the same version", apiv1alpha1.VersionPolicy{NoDowngrade: true}, "2.5.0", "2.5.0", ""),
+		Entry("allows downgrades by default", apiv1alpha1.VersionPolicy{}, "2.4.1", "2.5.0", ""),
+		Entry("rejects all versions if the last version is invalid", apiv1alpha1.VersionPolicy{NoDowngrade: true}, "2.5.0", "latest",
+			`the last promoted version "latest" is not a semantic version`),
+		Entry("rejects invalid versions", apiv1alpha1.VersionPolicy{}, "main", "", "not a semantic version"),
+	)
+})